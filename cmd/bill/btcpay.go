@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/btcpay"
+	"github.com/urfave/cli/v2"
+)
+
+// btcpayAPIKeyEnv holds the Greenfield API key of the BTCPay store, which
+// is never stored with the settings.
+const btcpayAPIKeyEnv = "BILL_BTCPAY_API_KEY"
+
+// btcpayClient returns the client of the configured BTCPay store, nil when
+// none is configured.
+func btcpayClient() (*btcpay.Client, error) {
+	config, err := btcpay.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.URL == "" {
+		return nil, nil
+	}
+	return btcpay.NewClient(*config, os.Getenv(btcpayAPIKeyEnv))
+}
+
+// requireBTCPay returns the client of the configured BTCPay store, failing
+// when none is configured.
+func requireBTCPay() (*btcpay.Client, error) {
+	client, err := btcpayClient()
+	if err == nil && client == nil {
+		err = fmt.Errorf("no BTCPay Server configured, see `bill btcpay config`")
+	}
+	return client, err
+}
+
+func btcpayCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "btcpay",
+		Usage: "Take payments through a BTCPay Server store (the API key is read from " + btcpayAPIKeyEnv + ")",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "config",
+				Usage: "Show or set the BTCPay Server store",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "url", Usage: "Server URL, e.g. https://btcpay.example.com"},
+					&cli.StringFlag{Name: "store", Usage: "Store ID"},
+					&cli.StringFlag{Name: "webhook-secret", Usage: "Secret of the store webhook pointing to /btcpay/webhook of bill serve"},
+					&cli.IntFlag{Name: "expiration", Usage: "Minutes the checkout accepts payments (default: the store setting)"},
+				},
+				Action: func(c *cli.Context) error {
+					config, err := btcpay.LoadConfig()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading BTCPay settings: %v", err), 1)
+					}
+
+					if c.NumFlags() > 0 {
+						if c.IsSet("url") {
+							config.URL = c.String("url")
+						}
+						if c.IsSet("store") {
+							config.StoreID = c.String("store")
+						}
+						if c.IsSet("webhook-secret") {
+							config.WebhookSecret = c.String("webhook-secret")
+						}
+						if c.IsSet("expiration") {
+							config.ExpirationMinutes = c.Int("expiration")
+						}
+						if err := btcpay.SaveConfig(config); err != nil {
+							return cli.Exit(fmt.Sprintf("Error saving BTCPay settings: %v", err), 1)
+						}
+					}
+
+					if config.URL == "" {
+						fmt.Println("No BTCPay Server configured")
+						return nil
+					}
+					fmt.Printf("Server:  %s\n", config.URL)
+					fmt.Printf("Store:   %s\n", config.StoreID)
+					if config.WebhookSecret != "" {
+						fmt.Println("Webhook: settlements are notified to bill serve")
+					} else {
+						fmt.Println("Webhook: none, settlements are polled")
+					}
+					if config.ExpirationMinutes > 0 {
+						fmt.Printf("Expires: after %d minutes\n", config.ExpirationMinutes)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "checkout",
+				Usage:     "Open a BTCPay invoice for the amount due on a stored invoice",
+				ArgsUsage: "<invoice number>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "update-pdf", Usage: "Regenerate the stored PDF with the checkout link"},
+				},
+				Action: func(c *cli.Context) error {
+					client, err := requireBTCPay()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading BTCPay settings: %v", err), 1)
+					}
+					invoice, err := bill.LoadInvoice(c.Args().First())
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading invoice: %v", err), 1)
+					}
+
+					checkout, err := client.Checkout(invoice)
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error opening the checkout: %v", err), 1)
+					}
+					invoice.Bill.Checkout = checkout
+
+					if c.Bool("update-pdf") && invoice.Path != "" {
+						opts, err := pdfOptions(invoice)
+						if err != nil {
+							return cli.Exit(fmt.Sprintf("Error loading signing key: %v", err), 1)
+						}
+						if err := bill.GenerateDocument(invoice.Bill, invoice.Path, opts); err != nil {
+							return cli.Exit(fmt.Sprintf("Error generating PDF: %v", err), 1)
+						}
+					}
+					if err := bill.SaveInvoice(invoice); err != nil {
+						return cli.Exit(fmt.Sprintf("Error storing invoice: %v", err), 1)
+					}
+
+					fmt.Printf("Checkout of %.2f %s opened: %s\n", checkout.Amount, checkout.Currency, checkout.URL)
+					return nil
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "Record the payments of the BTCPay invoices that settled, for a cron job without webhook",
+				Action: func(c *cli.Context) error {
+					client, err := requireBTCPay()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading BTCPay settings: %v", err), 1)
+					}
+					settled, err := client.Sync(time.Now())
+					for _, invoice := range settled {
+						fmt.Printf("Invoice %s paid through BTCPay, now %s\n", invoice.Bill.Number, invoice.Status)
+					}
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error polling BTCPay Server: %v", err), 1)
+					}
+					if len(settled) == 0 {
+						fmt.Println("No new payment")
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/einvoice"
+	"github.com/urfave/cli/v2"
+)
+
+func exportCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "export",
+		Usage:     "Export a stored invoice as a structured e-invoice",
+		ArgsUsage: "<number>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "ubl",
+				Usage:   "E-invoice format: " + strings.Join(einvoice.Formats, ", "),
+			},
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "Output XML file path"},
+			&cli.StringFlag{Name: "buyer-reference", Usage: "Buyer reference, if the invoice has none"},
+			&cli.StringFlag{Name: "peppol-id", Usage: "Your Peppol ID as scheme:identifier, if the invoice has none"},
+			&cli.StringFlag{Name: "to-peppol-id", Usage: "Client Peppol ID as scheme:identifier, if the invoice has none"},
+			&cli.StringFlag{Name: "recipient-code", Usage: "FatturaPA client recipient code (codice destinatario), if the invoice has none"},
+			&cli.StringFlag{Name: "pec", Usage: "FatturaPA client PEC address, if the invoice has none"},
+			&cli.StringFlag{Name: "leitweg-id", Usage: "XRechnung client Leitweg-ID, if the invoice has none"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.Exit("Usage: bill export <number> --format "+strings.Join(einvoice.Formats, "|"), 1)
+			}
+
+			invoice, err := bill.LoadInvoice(c.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading invoice: %v", err), 1)
+			}
+			if invoice.Status == bill.StatusDraft || invoice.Status == bill.StatusVoid {
+				return cli.Exit(fmt.Sprintf("Invoice %s is %s, only issued invoices can be exported", invoice.Bill.Number, invoice.Status), 1)
+			}
+
+			// Routing data may be completed at export time, the amounts and
+			// parties of an issued invoice never change
+			b := invoice.Bill
+			if b.BuyerReference == "" {
+				b.BuyerReference = c.String("buyer-reference")
+			}
+			if b.PeppolID == "" {
+				b.PeppolID = c.String("peppol-id")
+			}
+			if b.ToPeppolID == "" {
+				b.ToPeppolID = c.String("to-peppol-id")
+			}
+			if b.ToRecipientCode == "" {
+				b.ToRecipientCode = c.String("recipient-code")
+			}
+			if b.ToPEC == "" {
+				b.ToPEC = c.String("pec")
+			}
+			if b.ToLeitwegID == "" {
+				b.ToLeitwegID = c.String("leitweg-id")
+			}
+
+			data, violations, err := einvoice.Export(b, c.String("format"))
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error exporting invoice: %v", err), 1)
+			}
+
+			if len(violations) > 0 {
+				fmt.Fprintf(os.Stderr, "Invoice %s fails %d check(s):\n", invoice.Bill.Number, len(violations))
+				for _, violation := range violations {
+					fmt.Fprintf(os.Stderr, "  %v\n", violation)
+				}
+				return cli.Exit("Nothing exported", 1)
+			}
+
+			outputPath := c.String("output")
+			if outputPath == "" {
+				outputPath = strings.ReplaceAll(invoice.Bill.Number, "/", "-") + ".xml"
+			}
+			if err := os.WriteFile(outputPath, data, 0644); err != nil {
+				return cli.Exit(fmt.Sprintf("Error writing %s: %v", outputPath, err), 1)
+			}
+			fmt.Printf("Invoice %s exported to %s\n", invoice.Bill.Number, outputPath)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/urfave/cli/v2"
+)
+
+func listCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "list",
+		Aliases: []string{"ls"},
+		Usage:   "List stored invoices",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "status", Usage: "Only list invoices in this status"},
+		},
+		Action: func(c *cli.Context) error {
+			var filter bill.Status
+			if c.String("status") != "" {
+				var err error
+				filter, err = bill.ParseStatus(c.String("status"))
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+			}
+
+			invoices, err := bill.ListInvoices()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading invoices: %v", err), 1)
+			}
+
+			for _, inv := range invoices {
+				if filter != "" && inv.Status != filter {
+					continue
+				}
+				fmt.Printf("%-20s %s  %-15s %-30s %12.2f %s\n",
+					inv.Bill.Number, inv.Bill.Date.Format(dateLayout), inv.Status,
+					inv.Bill.ToCompanyName, inv.Bill.Total, inv.Bill.Currency)
+			}
+			return nil
+		},
+	}
+}
+
+func markCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "mark",
+		Usage:     "Change the status of a stored invoice",
+		ArgsUsage: "<number> issued|sent|partially-paid|paid|void",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "update-pdf",
+				Usage: "Regenerate the stored PDF with the watermark of the new status",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 2 {
+				return cli.Exit("Usage: bill mark <number> <status>", 1)
+			}
+
+			status, err := bill.ParseStatus(c.Args().Get(1))
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			invoice, err := bill.LoadInvoice(c.Args().Get(0))
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading invoice: %v", err), 1)
+			}
+			if err := invoice.Transition(status, time.Now()); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			if c.Bool("update-pdf") && invoice.Path != "" {
+				opts, err := pdfOptions(invoice)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Error loading signing key: %v", err), 1)
+				}
+				if err := bill.GenerateDocument(invoice.Bill, invoice.Path, opts); err != nil {
+					return cli.Exit(fmt.Sprintf("Error generating PDF: %v", err), 1)
+				}
+			}
+
+			if err := bill.SaveInvoice(invoice); err != nil {
+				return cli.Exit(fmt.Sprintf("Error storing invoice: %v", err), 1)
+			}
+			fmt.Printf("Invoice %s marked %s\n", invoice.Bill.Number, status)
+			return nil
+		},
+	}
+}
+
+func creditNoteCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "credit-note",
+		Usage:     "Issue a credit note cancelling a stored invoice",
+		ArgsUsage: "<invoice number>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "number", Aliases: []string{"n"}, Required: true, Usage: "Credit note number"},
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "Output PDF (or .html) file path"},
+		},
+		Action: func(c *cli.Context) error {
+			original, err := bill.LoadInvoice(c.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading invoice: %v", err), 1)
+			}
+			if original.Status == bill.StatusDraft {
+				return cli.Exit("Drafts can be edited, no credit note is needed", 1)
+			}
+
+			creditNote := bill.NewCreditNote(original.Bill, c.String("number"), time.Now())
+			invoice, err := bill.NewInvoice(creditNote, bill.StatusIssued, time.Now())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error storing credit note: %v", err), 1)
+			}
+
+			outputPath := c.String("output")
+			if outputPath == "" {
+				outputPath = strings.ReplaceAll(creditNote.Number, "/", "-") + ".pdf"
+			}
+			invoice.FacturX = original.FacturX
+			invoice.Layout = original.Layout
+			invoice.PDFA = original.PDFA
+			invoice.Signed = original.Signed
+			invoice.Path = outputPath
+			opts, err := pdfOptions(invoice)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading signing key: %v", err), 1)
+			}
+			if err := bill.GenerateDocument(creditNote, outputPath, opts); err != nil {
+				return cli.Exit(fmt.Sprintf("Error generating PDF: %v", err), 1)
+			}
+
+			invoice.Path, _ = filepath.Abs(outputPath)
+			if err := bill.SaveInvoice(invoice); err != nil {
+				return cli.Exit(fmt.Sprintf("Error storing credit note: %v", err), 1)
+			}
+			fmt.Printf("Credit note %s for invoice %s generated to %s\n", creditNote.Number, original.Bill.Number, outputPath)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/urfave/cli/v2"
+)
+
+func layoutCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "layout",
+		Usage:     "Print the built-in PDF layout, or check a layout file",
+		ArgsUsage: "[layout.json]",
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				_, err := os.Stdout.Write(bill.DefaultLayoutJSON())
+				return err
+			}
+
+			layout, err := bill.LoadLayout(c.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading layout: %v", err), 1)
+			}
+			fmt.Printf("Layout %s is valid (%d blocks)\n", c.Args().First(), len(layout.Blocks))
+			return nil
+		},
+	}
+}
@@ -4,20 +4,63 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/btcpay"
 	"github.com/louisinger/bill/pkg/ui"
+	"github.com/louisinger/bill/pkg/webhook"
 	"github.com/urfave/cli/v2"
 )
 
 const version = "1.0.0"
 
+// importTimesheet turns the hours of a time-tracking export into template
+// items, so they can be reviewed with the other template items.
+func importTimesheet(c *cli.Context, template *bill.BillTemplate, path string) error {
+	groupBy, err := bill.ParseGroupBy(c.String("group-by"))
+	if err != nil {
+		return err
+	}
+
+	rate := template.HourlyRate
+	if c.IsSet("rate") {
+		rate = c.Float64("rate")
+	}
+	if rate <= 0 {
+		return fmt.Errorf("an hourly rate is required (--rate or hourly_rate in the template)")
+	}
+
+	entries, err := bill.LoadTimesheet(path)
+	if err != nil {
+		return err
+	}
+
+	items := bill.TimesheetItems(entries, groupBy, rate, template.QuantityPrecision)
+	for _, item := range items {
+		template.Items = append(template.Items, bill.TemplateItem{
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			Unit:        item.Unit,
+			UnitPrice:   item.UnitPrice,
+			VATRate:     template.VATRate,
+		})
+	}
+	fmt.Printf("Imported %d time entries as %d items\n", len(entries), len(items))
+	return nil
+}
+
 func main() {
+	webhook.Register()
+
 	app := &cli.App{
 		Name:  "bill",
 		Usage: "Generate PDF invoices with Bitcoin payment support",
 		Action: func(c *cli.Context) error {
 			// Default action: launch GUI
+			go webhook.Run(time.Minute)
 			billApp := ui.NewBillApp()
 			billApp.Run()
 			return nil
@@ -39,8 +82,146 @@ func main() {
 						Aliases: []string{"t"},
 						Usage:   "Path to template JSON file",
 					},
+					&cli.StringFlag{
+						Name:  "timesheet",
+						Usage: "Import hours from a Toggl/Clockify CSV, timewarrior JSON or date,project,hours CSV",
+					},
+					&cli.StringFlag{
+						Name:  "group-by",
+						Value: "project",
+						Usage: "Group imported hours by project or day",
+					},
+					&cli.Float64Flag{
+						Name:  "rate",
+						Usage: "Hourly rate for imported hours (defaults to the template hourly_rate)",
+					},
+					&cli.BoolFlag{
+						Name:  "draft",
+						Usage: "Store the invoice as a draft instead of issuing it",
+					},
+					&cli.StringFlag{
+						Name:  "facturx",
+						Usage: "Embed Factur-X/ZUGFeRD XML at this profile (minimum, basic or en16931)",
+					},
+					&cli.StringFlag{
+						Name:  "pdfa",
+						Usage: "Produce an archival PDF/A file at this level (1b or 3b)",
+					},
+					&cli.StringFlag{
+						Name:  "layout",
+						Usage: "JSON layout file of the PDF (see `bill layout`)",
+					},
+					&cli.StringFlag{
+						Name:  "page-size",
+						Usage: "Page size of the PDF: A4, Letter, Legal or A5 (default: the template's, else A4)",
+					},
+					&cli.StringFlag{
+						Name:  "orientation",
+						Usage: "Page orientation of the PDF: portrait or landscape",
+					},
+					&cli.BoolFlag{
+						Name:  "sign",
+						Usage: "Digitally sign the PDF with the certificate set by `bill signing`",
+					},
+					&cli.IntFlag{
+						Name:  "due-days",
+						Usage: "Days until payment is due, printed as the due date (default: the template payment_days)",
+					},
+					&cli.BoolFlag{
+						Name:  "btcpay",
+						Usage: "Take the payment through the BTCPay Server store set by `bill btcpay config`",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "pdf",
+						Usage: "Output format: pdf or html (a self-contained page for emails and portals)",
+					},
 				},
 				Action: func(c *cli.Context) error {
+					format := c.String("format")
+					outputPath := c.String("output")
+					switch format {
+					case "pdf":
+					case "html":
+						if !c.IsSet("output") {
+							outputPath = "invoice.html"
+						}
+						if !bill.IsHTMLPath(outputPath) {
+							return cli.Exit("HTML invoices need an .html output path", 1)
+						}
+						if c.String("facturx") != "" || c.String("pdfa") != "" || c.Bool("sign") {
+							return cli.Exit("Factur-X, PDF/A and signing are only available on PDF invoices", 1)
+						}
+					default:
+						return cli.Exit(fmt.Sprintf("Unknown format %q (expected pdf or html)", format), 1)
+					}
+
+					var profile bill.FacturXProfile
+					if c.String("facturx") != "" {
+						var err error
+						profile, err = bill.ParseFacturXProfile(c.String("facturx"))
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+					}
+
+					var conformance bill.PDFAConformance
+					if c.String("pdfa") != "" {
+						var err error
+						conformance, err = bill.ParsePDFAConformance(c.String("pdfa"))
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+						if profile != "" && conformance == bill.PDFA1b {
+							return cli.Exit("Factur-X invoices are PDF/A-3b, --pdfa 1b cannot be used with --facturx", 1)
+						}
+					}
+
+					if c.Bool("btcpay") && c.Bool("draft") {
+						return cli.Exit("Draft invoices cannot be paid yet, --btcpay cannot be used with --draft", 1)
+					}
+					var provider *btcpay.Client
+					if c.Bool("btcpay") {
+						var err error
+						if provider, err = requireBTCPay(); err != nil {
+							return cli.Exit(fmt.Sprintf("Error loading BTCPay settings: %v", err), 1)
+						}
+					}
+
+					var sig *bill.Signature
+					if c.Bool("sign") {
+						var err error
+						if sig, err = signature(); err != nil {
+							return cli.Exit(fmt.Sprintf("Error loading signing key: %v", err), 1)
+						}
+					}
+
+					layoutPath := c.String("layout")
+					if layoutPath != "" {
+						// Stored invoices are regenerated from other directories
+						var err error
+						if layoutPath, err = filepath.Abs(layoutPath); err != nil {
+							return cli.Exit(fmt.Sprintf("Error loading layout: %v", err), 1)
+						}
+						if _, err := bill.LoadLayout(layoutPath); err != nil {
+							return cli.Exit(fmt.Sprintf("Error loading layout: %v", err), 1)
+						}
+					}
+
+					pageSize, orientation := c.String("page-size"), c.String("orientation")
+					if c.IsSet("page-size") {
+						var err error
+						if pageSize, err = bill.ParsePageSize(pageSize); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+					}
+					if c.IsSet("orientation") {
+						var err error
+						if orientation, err = bill.ParseOrientation(orientation); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+					}
+
 					var template *bill.BillTemplate
 					if templatePath := c.String("template"); templatePath != "" {
 						var err error
@@ -51,20 +232,90 @@ func main() {
 						fmt.Println("Template loaded successfully")
 					}
 
+					if timesheetPath := c.String("timesheet"); timesheetPath != "" {
+						if template == nil {
+							template = &bill.BillTemplate{}
+						}
+						if err := importTimesheet(c, template, timesheetPath); err != nil {
+							return cli.Exit(fmt.Sprintf("Error importing timesheet: %v", err), 1)
+						}
+					}
+
 					billData := bill.CollectBillData(template)
-					outputPath := c.String("output")
+					if pageSize != "" {
+						billData.PageSize = pageSize
+					}
+					if orientation != "" {
+						billData.Orientation = orientation
+					}
+					if c.IsSet("due-days") {
+						if c.Int("due-days") < 0 {
+							return cli.Exit("--due-days cannot be negative", 1)
+						}
+						billData.DueDate = billData.Date.AddDate(0, 0, c.Int("due-days"))
+					}
 
-					fmt.Printf("Generating bill PDF to %s...\n", outputPath)
-					err := bill.GeneratePDF(billData, outputPath)
+					status := bill.StatusIssued
+					if c.Bool("draft") {
+						status = bill.StatusDraft
+					}
+					invoice, err := bill.NewInvoice(billData, status, time.Now())
 					if err != nil {
-						return cli.Exit(fmt.Sprintf("Error generating PDF: %v", err), 1)
+						return cli.Exit(fmt.Sprintf("Error storing invoice: %v", err), 1)
 					}
 
-					fmt.Println("Bill PDF generated successfully!")
+					invoice.FacturX = profile
+					invoice.Layout = layoutPath
+					invoice.PDFA = conformance
+					invoice.Signed = sig != nil
+					if provider != nil {
+						if billData.Checkout, err = provider.Checkout(invoice); err != nil {
+							return cli.Exit(fmt.Sprintf("Error opening the BTCPay checkout: %v", err), 1)
+						}
+						invoice.Bill.Checkout = billData.Checkout
+						fmt.Printf("BTCPay checkout: %s\n", billData.Checkout.URL)
+					}
+					if format == "html" {
+						fmt.Printf("Generating bill HTML to %s...\n", outputPath)
+						err = bill.GenerateHTMLWithOptions(billData, outputPath, invoice.PDFOptions())
+					} else {
+						fmt.Printf("Generating bill PDF to %s...\n", outputPath)
+						opts := invoice.PDFOptions()
+						opts.Signature = sig
+						err = bill.GeneratePDFWithOptions(billData, outputPath, opts)
+					}
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error generating %s: %v", strings.ToUpper(format), err), 1)
+					}
+
+					invoice.Path, _ = filepath.Abs(outputPath)
+					if err := bill.SaveInvoice(invoice); err != nil {
+						return cli.Exit(fmt.Sprintf("Error storing invoice: %v", err), 1)
+					}
+
+					fmt.Printf("Bill %s generated successfully! (%s)\n", strings.ToUpper(format), status)
 					fmt.Printf("Total amount: %.2f %s\n", billData.Total, billData.Currency)
 					return nil
 				},
 			},
+			recurringCommand(),
+			listCommand(),
+			markCommand(),
+			creditNoteCommand(),
+			paymentCommand(),
+			exportCommand(),
+			renderCommand(),
+			layoutCommand(),
+			checkPDFACommand(),
+			signingCommand(),
+			verifyCommand(),
+			emailCommand(),
+			sendCommand(),
+			dunningCommand(),
+			remindCommand(),
+			serveCommand(),
+			webhookCommand(),
+			btcpayCommand(),
 			{
 				Name:    "version",
 				Aliases: []string{"v"},
@@ -77,7 +328,12 @@ func main() {
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	err := app.Run(os.Args)
+	// Deliver the events the command queued, outside of any lock
+	if _, _, flushErr := webhook.FlushQueued(time.Now()); flushErr != nil {
+		log.Printf("webhook: %v", flushErr)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
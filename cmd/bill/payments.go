@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/urfave/cli/v2"
+)
+
+func paymentCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "payment",
+		Usage: "Record and list payments of stored invoices",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "add",
+				Usage:     "Record a payment received for an invoice",
+				ArgsUsage: "<invoice number>",
+				Flags: []cli.Flag{
+					&cli.Float64Flag{Name: "amount", Aliases: []string{"a"}, Required: true, Usage: "Amount received"},
+					&cli.StringFlag{Name: "date", Usage: "Payment date (YYYY-MM-DD), defaults to today"},
+					&cli.StringFlag{Name: "method", Aliases: []string{"m"}, Value: "bank transfer", Usage: "Payment method (bank transfer, bitcoin, lightning, card, cash...)"},
+					&cli.StringFlag{Name: "reference", Aliases: []string{"r"}, Usage: "Bank reference or transaction id"},
+					&cli.StringFlag{Name: "currency", Usage: "Currency of the amount, defaults to the invoice currency"},
+					&cli.Float64Flag{Name: "rate", Usage: "Exchange rate from the payment currency to the invoice currency"},
+					&cli.BoolFlag{Name: "update-pdf", Usage: "Regenerate the stored PDF with the paid and balance due block"},
+				},
+				Action: func(c *cli.Context) error {
+					invoice, err := bill.LoadInvoice(c.Args().First())
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading invoice: %v", err), 1)
+					}
+
+					date := time.Now()
+					if c.String("date") != "" {
+						date, err = time.ParseInLocation(dateLayout, c.String("date"), time.Local)
+						if err != nil {
+							return cli.Exit(fmt.Sprintf("Invalid date: %v", err), 1)
+						}
+					}
+
+					payment := bill.Payment{
+						Date:      date,
+						Amount:    c.Float64("amount"),
+						Method:    c.String("method"),
+						Reference: c.String("reference"),
+						Currency:  c.String("currency"),
+						Rate:      c.Float64("rate"),
+					}
+					if err := invoice.AddPayment(payment, time.Now()); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+
+					if c.Bool("update-pdf") && invoice.Path != "" {
+						opts, err := pdfOptions(invoice)
+						if err != nil {
+							return cli.Exit(fmt.Sprintf("Error loading signing key: %v", err), 1)
+						}
+						if err := bill.GenerateDocument(invoice.Bill, invoice.Path, opts); err != nil {
+							return cli.Exit(fmt.Sprintf("Error generating PDF: %v", err), 1)
+						}
+					}
+
+					if err := bill.SaveInvoice(invoice); err != nil {
+						return cli.Exit(fmt.Sprintf("Error storing invoice: %v", err), 1)
+					}
+
+					fmt.Printf("Payment recorded, invoice %s is %s\n", invoice.Bill.Number, invoice.Status)
+					printBalance(invoice)
+					return nil
+				},
+			},
+			{
+				Name:      "list",
+				Usage:     "List the payments of an invoice",
+				ArgsUsage: "<invoice number>",
+				Action: func(c *cli.Context) error {
+					invoice, err := bill.LoadInvoice(c.Args().First())
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading invoice: %v", err), 1)
+					}
+
+					for _, p := range invoice.Payments {
+						currency := p.Currency
+						if currency == "" {
+							currency = invoice.Bill.Currency
+						}
+						fmt.Printf("%s  %12.2f %-4s %-15s %s\n",
+							p.Date.Format(dateLayout), p.Amount, currency, p.Method, p.Reference)
+					}
+					printBalance(invoice)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func printBalance(invoice *bill.Invoice) {
+	fmt.Printf("Total: %.2f %s, paid: %.2f %s\n",
+		invoice.Bill.Total, invoice.Bill.Currency, invoice.Paid(), invoice.Bill.Currency)
+	if balance := invoice.Balance(); balance < 0 {
+		fmt.Printf("Overpaid by %.2f %s\n", -balance, invoice.Bill.Currency)
+	} else {
+		fmt.Printf("Balance due: %.2f %s\n", balance, invoice.Bill.Currency)
+	}
+}
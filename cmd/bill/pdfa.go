@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/urfave/cli/v2"
+)
+
+func checkPDFACommand() *cli.Command {
+	return &cli.Command{
+		Name:      "check-pdfa",
+		Usage:     "Check that a PDF complies with PDF/A-1b or PDF/A-3b",
+		ArgsUsage: "<file.pdf>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.Exit("Usage: bill check-pdfa <file.pdf>", 1)
+			}
+			path := c.Args().First()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error reading %s: %v", path, err), 1)
+			}
+			if problems := bill.CheckPDFA(data); len(problems) > 0 {
+				fmt.Fprintf(os.Stderr, "%s fails %d PDF/A check(s):\n", path, len(problems))
+				for _, problem := range problems {
+					fmt.Fprintf(os.Stderr, "  %v\n", problem)
+				}
+				return cli.Exit("Not a PDF/A file", 1)
+			}
+			fmt.Printf("%s passes the PDF/A checks\n", path)
+			return nil
+		},
+	}
+}
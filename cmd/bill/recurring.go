@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/urfave/cli/v2"
+)
+
+const dateLayout = "2006-01-02"
+
+func recurringCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "recurring",
+		Usage: "Manage recurring invoice schedules",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List recurring schedules",
+				Action: func(c *cli.Context) error {
+					schedules, err := bill.LoadSchedules()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading schedules: %v", err), 1)
+					}
+					if len(schedules) == 0 {
+						fmt.Println("No recurring schedules")
+						return nil
+					}
+
+					now := time.Now()
+					for _, s := range schedules {
+						end := "no end"
+						if !s.End.IsZero() {
+							end = s.End.Format(dateLayout)
+						}
+						fmt.Printf("%s: %s on day %d, %s to %s, %d generated, %d due\n",
+							s.Name, s.Frequency, s.DayOfMonth, s.Start.Format(dateLayout), end,
+							len(s.Generated), len(s.Due(now)))
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "add",
+				Usage: "Add a recurring schedule",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "name", Required: true, Usage: "Schedule name"},
+					&cli.StringFlag{Name: "template", Aliases: []string{"t"}, Required: true, Usage: "Path to template JSON file"},
+					&cli.StringFlag{Name: "frequency", Value: "monthly", Usage: "monthly, quarterly or yearly"},
+					&cli.StringFlag{Name: "start", Required: true, Usage: "First billing date (YYYY-MM-DD)"},
+					&cli.StringFlag{Name: "end", Usage: "Last billing date (YYYY-MM-DD)"},
+					&cli.IntFlag{Name: "day", Value: 1, Usage: "Day of month the invoice is issued"},
+					&cli.StringFlag{Name: "number-format", Value: "INV-{YYYY}-{NNN}", Usage: "Invoice number pattern"},
+					&cli.IntFlag{Name: "next-sequence", Value: 1, Usage: "Sequence of the first generated invoice"},
+					&cli.StringFlag{Name: "output-dir", Usage: "Directory receiving the generated PDFs"},
+				},
+				Action: func(c *cli.Context) error {
+					frequency, err := bill.ParseFrequency(c.String("frequency"))
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					start, err := time.ParseInLocation(dateLayout, c.String("start"), time.Local)
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Invalid start date: %v", err), 1)
+					}
+					var end time.Time
+					if c.String("end") != "" {
+						end, err = time.ParseInLocation(dateLayout, c.String("end"), time.Local)
+						if err != nil {
+							return cli.Exit(fmt.Sprintf("Invalid end date: %v", err), 1)
+						}
+					}
+					if _, err := bill.LoadTemplate(c.String("template")); err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading template: %v", err), 1)
+					}
+
+					schedule := bill.Schedule{
+						Name:         c.String("name"),
+						Template:     c.String("template"),
+						Frequency:    frequency,
+						Start:        start,
+						End:          end,
+						DayOfMonth:   c.Int("day"),
+						NumberFormat: c.String("number-format"),
+						NextSequence: c.Int("next-sequence"),
+						OutputDir:    c.String("output-dir"),
+					}
+					if err := schedule.Validate(); err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+
+					schedules, err := bill.LoadSchedules()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading schedules: %v", err), 1)
+					}
+					for _, s := range schedules {
+						if s.Name == schedule.Name {
+							return cli.Exit(fmt.Sprintf("Schedule %s already exists", s.Name), 1)
+						}
+					}
+					if err := bill.SaveSchedules(append(schedules, schedule)); err != nil {
+						return cli.Exit(fmt.Sprintf("Error saving schedules: %v", err), 1)
+					}
+
+					fmt.Printf("Schedule %s added\n", schedule.Name)
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "Remove a recurring schedule",
+				ArgsUsage: "<name>",
+				Action: func(c *cli.Context) error {
+					name := c.Args().First()
+					schedules, err := bill.LoadSchedules()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading schedules: %v", err), 1)
+					}
+					for i, s := range schedules {
+						if s.Name == name {
+							if err := bill.SaveSchedules(append(schedules[:i], schedules[i+1:]...)); err != nil {
+								return cli.Exit(fmt.Sprintf("Error saving schedules: %v", err), 1)
+							}
+							fmt.Printf("Schedule %s removed\n", name)
+							return nil
+						}
+					}
+					return cli.Exit(fmt.Sprintf("Schedule %s not found", name), 1)
+				},
+			},
+			{
+				Name:  "run",
+				Usage: "Generate every invoice due up to today (safe to run from cron)",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "dry-run", Aliases: []string{"n"}, Usage: "Only list the invoices that would be generated"},
+					&cli.StringFlag{Name: "output-dir", Usage: "Directory receiving the PDFs of schedules without one"},
+				},
+				Action: func(c *cli.Context) error {
+					schedules, err := bill.LoadSchedules()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading schedules: %v", err), 1)
+					}
+
+					now := time.Now()
+					count := 0
+					for i := range schedules {
+						s := &schedules[i]
+						if err := s.Validate(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						outputDir := s.OutputDir
+						if outputDir == "" {
+							outputDir = c.String("output-dir")
+						}
+						if outputDir == "" {
+							outputDir = "."
+						}
+
+						for _, occurrence := range s.Due(now) {
+							if c.Bool("dry-run") {
+								fmt.Printf("%s: %s would be issued on %s for %s\n",
+									s.Name, s.NextNumber(occurrence.Date), occurrence.Date.Format(dateLayout), occurrence.Period)
+								s.NextSequence++
+								count++
+								continue
+							}
+
+							generated, err := s.Generate(occurrence, outputDir)
+							if err != nil {
+								return cli.Exit(fmt.Sprintf("Error generating %s for %s: %v", s.Name, occurrence.Period, err), 1)
+							}
+							// Save after each invoice so a failure never regenerates a period
+							if err := bill.SaveSchedules(schedules); err != nil {
+								return cli.Exit(fmt.Sprintf("Error saving schedules: %v", err), 1)
+							}
+							fmt.Printf("%s: %s generated to %s\n", s.Name, generated.Number, generated.Path)
+							count++
+						}
+					}
+
+					if count == 0 {
+						fmt.Println("No invoices due")
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
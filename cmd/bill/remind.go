@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/urfave/cli/v2"
+)
+
+func dunningCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "dunning",
+		Usage:     "Print the payment term and dunning levels, or set them from a JSON file",
+		ArgsUsage: "[dunning.json]",
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				config, err := bill.LoadDunningConfig()
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Error loading dunning settings: %v", err), 1)
+				}
+				data, err := json.MarshalIndent(config, "", "  ")
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				_, err = os.Stdout.Write(append(data, '\n'))
+				return err
+			}
+
+			data, err := os.ReadFile(c.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading dunning settings: %v", err), 1)
+			}
+			config, err := bill.ParseDunningConfig(data)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading dunning settings: %v", err), 1)
+			}
+			if err := bill.SaveDunningConfig(config); err != nil {
+				return cli.Exit(fmt.Sprintf("Error saving dunning settings: %v", err), 1)
+			}
+			fmt.Printf("Dunning settings saved (%d levels, payment term %d days)\n", len(config.Levels), config.PaymentDays)
+			return nil
+		},
+	}
+}
+
+func remindCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "remind",
+		Usage:     "List overdue invoices, or generate their payment reminders",
+		ArgsUsage: "[<number>]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "due", Usage: "Generate every reminder that is due"},
+			&cli.BoolFlag{Name: "dry-run", Usage: "With --due, only list the reminders that would be generated"},
+			&cli.StringFlag{Name: "date", Usage: "Reminder date (YYYY-MM-DD), defaults to today"},
+			&cli.StringFlag{Name: "output-dir", Usage: "Directory of the reminder PDFs (default: next to each invoice)"},
+		},
+		Action: func(c *cli.Context) error {
+			config, err := bill.LoadDunningConfig()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading dunning settings: %v", err), 1)
+			}
+
+			date := time.Now()
+			if c.String("date") != "" {
+				date, err = time.ParseInLocation(dateLayout, c.String("date"), time.Local)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Invalid date: %v", err), 1)
+				}
+			}
+
+			// A single invoice gets its next reminder now, due or not
+			if c.NArg() == 1 {
+				invoice, err := bill.LoadInvoice(c.Args().First())
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Error loading invoice: %v", err), 1)
+				}
+				level, _, ok := config.Next(invoice)
+				if !ok {
+					if invoice.Dunnable() {
+						return cli.Exit(fmt.Sprintf("Every reminder was already sent for invoice %s", invoice.Bill.Number), 1)
+					}
+					return cli.Exit(fmt.Sprintf("Invoice %s is %s, no reminder is needed", invoice.Bill.Number, invoice.Status), 1)
+				}
+				return sendReminder(config, invoice, level, date, c.String("output-dir"))
+			}
+			if c.NArg() > 1 {
+				return cli.Exit("Usage: bill remind [<number>]", 1)
+			}
+
+			invoices, err := bill.ListInvoices()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading invoices: %v", err), 1)
+			}
+
+			if !c.Bool("due") {
+				listOverdue(config, invoices, date)
+				return nil
+			}
+
+			count := 0
+			for i := range invoices {
+				invoice := &invoices[i]
+				level, due := config.Due(invoice, date)
+				if !due {
+					continue
+				}
+				count++
+				if c.Bool("dry-run") {
+					fmt.Printf("%-20s %-30s %12.2f %s  %s\n", invoice.Bill.Number, invoice.Bill.ToCompanyName,
+						invoice.Balance(), invoice.Bill.Currency, config.Levels[level-1].Title)
+					continue
+				}
+				if err := sendReminder(config, invoice, level, date, c.String("output-dir")); err != nil {
+					return err
+				}
+			}
+			if count == 0 {
+				fmt.Println("No reminder is due")
+			}
+			return nil
+		},
+	}
+}
+
+// listOverdue prints the invoices past their due date with the reminders
+// sent so far and when the next one is due.
+func listOverdue(config *bill.DunningConfig, invoices []bill.Invoice, now time.Time) {
+	found := false
+	for i := range invoices {
+		invoice := &invoices[i]
+		due := config.DueDate(invoice)
+		if !invoice.Dunnable() || !now.After(due) {
+			continue
+		}
+		found = true
+		fmt.Printf("%-20s due %s  %-30s %12.2f %s\n", invoice.Bill.Number, due.Format(dateLayout),
+			invoice.Bill.ToCompanyName, invoice.Balance(), invoice.Bill.Currency)
+		for _, reminder := range invoice.Reminders {
+			fmt.Printf("  %s  %s", reminder.Date.Format(dateLayout), reminder.Title)
+			if reminder.Fee > 0 || reminder.Interest > 0 {
+				fmt.Printf(" (fee %.2f, interest %.2f)", reminder.Fee, reminder.Interest)
+			}
+			fmt.Println()
+		}
+		if level, from, ok := config.Next(invoice); ok {
+			fmt.Printf("  next: %s from %s\n", config.Levels[level-1].Title, from.Format(dateLayout))
+		}
+	}
+	if !found {
+		fmt.Println("No overdue invoice")
+	}
+}
+
+// sendReminder generates the reminder PDF of an invoice and records it.
+func sendReminder(config *bill.DunningConfig, invoice *bill.Invoice, level int, date time.Time, dir string) error {
+	reminder, err := config.NewReminder(invoice, level, date)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	outputPath := bill.ReminderPath(invoice, reminder, dir)
+	if reminder.Path, err = filepath.Abs(outputPath); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	if err := invoice.AddReminder(reminder); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	opts, err := pdfOptions(invoice)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Error loading signing key: %v", err), 1)
+	}
+	if err := config.GenerateReminderPDF(invoice, reminder, outputPath, opts); err != nil {
+		return cli.Exit(fmt.Sprintf("Error generating reminder: %v", err), 1)
+	}
+	if err := bill.SaveInvoice(invoice); err != nil {
+		return cli.Exit(fmt.Sprintf("Error storing invoice: %v", err), 1)
+	}
+	fmt.Printf("%s for invoice %s generated to %s\n", reminder.Title, invoice.Bill.Number, outputPath)
+	return nil
+}
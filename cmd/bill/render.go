@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/einvoice"
+	"github.com/urfave/cli/v2"
+)
+
+func renderCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "render",
+		Usage: "Render a UBL or CII e-invoice with the PDF layout, without storing it",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "from",
+				Usage:    "UBL 2.1 or Cross-Industry-Invoice XML file",
+				Required: true,
+			},
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "Output PDF file path"},
+		},
+		Action: func(c *cli.Context) error {
+			b, err := einvoice.ParseFile(c.String("from"))
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error reading %s: %v", c.String("from"), err), 1)
+			}
+
+			outputPath := c.String("output")
+			if outputPath == "" {
+				outputPath = strings.ReplaceAll(b.Number, "/", "-") + ".pdf"
+			}
+			if err := bill.GeneratePDF(b, outputPath); err != nil {
+				return cli.Exit(fmt.Sprintf("Error generating PDF: %v", err), 1)
+			}
+			fmt.Printf("Invoice %s from %s rendered to %s\n", b.Number, b.CompanyName, outputPath)
+			return nil
+		},
+	}
+}
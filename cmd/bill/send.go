@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/email"
+	"github.com/urfave/cli/v2"
+)
+
+// smtpPasswordEnv holds the password of the SMTP account, which is never
+// stored with the settings.
+const smtpPasswordEnv = "BILL_SMTP_PASSWORD"
+
+func emailCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "email",
+		Usage: "Show or set the SMTP server, the message templates and the addresses of clients",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "host", Usage: "SMTP server"},
+			&cli.IntFlag{Name: "port", Usage: "SMTP port (default: 587, 465 with tls, 25 with none)"},
+			&cli.StringFlag{Name: "security", Usage: "Connection security: starttls, tls or none"},
+			&cli.StringFlag{Name: "username", Usage: "SMTP user (the password is read from " + smtpPasswordEnv + ")"},
+			&cli.StringFlag{Name: "from", Usage: "Sender, e.g. \"Muster GmbH <billing@muster.de>\""},
+			&cli.StringFlag{Name: "subject", Usage: "Subject template, e.g. \"Invoice {{.Number}}\""},
+			&cli.StringFlag{Name: "body-file", Usage: "File holding the body template"},
+			&cli.StringFlag{Name: "attach", Usage: "Attach the e-invoice XML in this format (ubl, fatturapa or xrechnung, \"\" for none)"},
+			&cli.StringFlag{Name: "client", Usage: "Client company name whose addresses are set in the client list"},
+			&cli.StringFlag{Name: "to", Usage: "Client recipients, comma separated"},
+			&cli.StringFlag{Name: "cc", Usage: "Client copy recipients, comma separated"},
+			&cli.StringFlag{Name: "client-attach", Usage: "E-invoice format attached for the client, overriding --attach"},
+		},
+		Action: func(c *cli.Context) error {
+			config, err := email.LoadConfig()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading email settings: %v", err), 1)
+			}
+
+			if c.NumFlags() > 0 {
+				if err := updateEmailConfig(c, config); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				if err := email.SaveConfig(config); err != nil {
+					return cli.Exit(fmt.Sprintf("Error saving email settings: %v", err), 1)
+				}
+				if err := updateEmailClient(c); err != nil {
+					return cli.Exit(fmt.Sprintf("Error saving the client addresses: %v", err), 1)
+				}
+			}
+
+			if config.SMTP.Host == "" {
+				fmt.Println("No SMTP server configured")
+			} else {
+				security, _ := email.ParseSecurity(string(config.SMTP.Security))
+				fmt.Printf("Server:   %s (%s)\n", config.SMTP.Host, security)
+				if config.SMTP.Port != 0 {
+					fmt.Printf("Port:     %d\n", config.SMTP.Port)
+				}
+				if config.SMTP.Username != "" {
+					fmt.Printf("Username: %s\n", config.SMTP.Username)
+				}
+			}
+			if config.From != "" {
+				fmt.Printf("From:     %s\n", config.From)
+			}
+			if config.Attach != "" {
+				fmt.Printf("Attach:   %s\n", config.Attach)
+			}
+			clients, err := bill.LoadClients()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading clients: %v", err), 1)
+			}
+			for _, client := range clients {
+				if len(client.Email) == 0 {
+					continue
+				}
+				fmt.Printf("%s: %s", client.Name, strings.Join(client.Email, ", "))
+				if len(client.CC) > 0 {
+					fmt.Printf(" (cc %s)", strings.Join(client.CC, ", "))
+				}
+				if client.Attach != "" {
+					fmt.Printf(" [%s]", client.Attach)
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+}
+
+func updateEmailConfig(c *cli.Context, config *email.Config) error {
+	if c.IsSet("host") {
+		config.SMTP.Host = c.String("host")
+	}
+	if c.IsSet("port") {
+		config.SMTP.Port = c.Int("port")
+	}
+	if c.IsSet("security") {
+		security, err := email.ParseSecurity(c.String("security"))
+		if err != nil {
+			return err
+		}
+		config.SMTP.Security = security
+	}
+	if c.IsSet("username") {
+		config.SMTP.Username = c.String("username")
+	}
+	if c.IsSet("from") {
+		config.From = c.String("from")
+	}
+	if c.IsSet("subject") {
+		config.Subject = c.String("subject")
+	}
+	if c.IsSet("body-file") {
+		body, err := os.ReadFile(c.String("body-file"))
+		if err != nil {
+			return err
+		}
+		config.Body = string(body)
+	}
+	if c.IsSet("attach") {
+		config.Attach = c.String("attach")
+	}
+
+	if c.IsSet("to") || c.IsSet("cc") || c.IsSet("client-attach") {
+		if c.String("client") == "" {
+			return fmt.Errorf("--to, --cc and --client-attach need --client")
+		}
+	}
+	if config.SMTP.Host != "" || config.From != "" {
+		return config.Validate()
+	}
+	return nil
+}
+
+// updateEmailClient sets the addresses of the --client in the client list.
+func updateEmailClient(c *cli.Context) error {
+	name := c.String("client")
+	if name == "" {
+		return nil
+	}
+	client, err := email.LookupClient(name)
+	if err != nil {
+		return err
+	}
+	if c.IsSet("to") {
+		if client.Email, err = email.ParseAddresses(c.String("to")); err != nil {
+			return err
+		}
+	}
+	if c.IsSet("cc") {
+		if client.CC, err = email.ParseAddresses(c.String("cc")); err != nil {
+			return err
+		}
+	}
+	if c.IsSet("client-attach") {
+		client.Attach = c.String("client-attach")
+	}
+	return email.SaveClient(client)
+}
+
+func sendCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "send",
+		Usage:     "Email a stored invoice to its client",
+		ArgsUsage: "<number>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "to", Usage: "Recipients, comma separated (default: the addresses of the client)"},
+			&cli.StringFlag{Name: "cc", Usage: "Copy recipients, comma separated"},
+			&cli.StringFlag{Name: "attach", Usage: "Attach the e-invoice XML in this format, \"\" for none"},
+			&cli.BoolFlag{Name: "eml", Usage: "Write the message as an .eml draft next to the invoice instead of sending it"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.Exit("Usage: bill send <number>", 1)
+			}
+			invoice, err := bill.LoadInvoice(c.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading invoice: %v", err), 1)
+			}
+			if invoice.Status == bill.StatusDraft || invoice.Status == bill.StatusVoid {
+				return cli.Exit(fmt.Sprintf("Invoice %s is %s, only issued invoices can be sent", invoice.Bill.Number, invoice.Status), 1)
+			}
+
+			config, err := email.LoadConfig()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading email settings: %v", err), 1)
+			}
+			// Drafts are sent from a mail client, so need no SMTP server
+			if !c.Bool("eml") {
+				if err := config.Validate(); err != nil {
+					return cli.Exit(fmt.Sprintf("Error in email settings: %v (see `bill email`)", err), 1)
+				}
+			}
+			message, err := composeMessage(c, config, invoice)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error composing email: %v", err), 1)
+			}
+
+			if c.Bool("eml") {
+				path := email.DraftPath(invoice.Path)
+				if err := email.WriteDraft(message, path); err != nil {
+					return cli.Exit(fmt.Sprintf("Error writing draft: %v", err), 1)
+				}
+				fmt.Printf("Draft of invoice %s for %s written to %s\n", invoice.Bill.Number, strings.Join(message.Recipients(), ", "), path)
+				return nil
+			}
+
+			fmt.Printf("Sending invoice %s to %s...\n", invoice.Bill.Number, strings.Join(message.Recipients(), ", "))
+			if err := email.Send(config.SMTP, os.Getenv(smtpPasswordEnv), message); err != nil {
+				return cli.Exit(fmt.Sprintf("Error sending email: %v", err), 1)
+			}
+
+			if invoice.Status == bill.StatusIssued {
+				if err := invoice.Transition(bill.StatusSent, time.Now()); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				if err := bill.SaveInvoice(invoice); err != nil {
+					return cli.Exit(fmt.Sprintf("Error storing invoice: %v", err), 1)
+				}
+			}
+			fmt.Printf("Invoice %s sent\n", invoice.Bill.Number)
+			return nil
+		},
+	}
+}
+
+// composeMessage builds the email of an invoice, the --to, --cc and
+// --attach flags replacing the settings of the client for this message.
+func composeMessage(c *cli.Context, config *email.Config, invoice *bill.Invoice) (*email.Message, error) {
+	client, err := email.LookupClient(invoice.Bill.ToCompanyName)
+	if err != nil {
+		return nil, err
+	}
+	if c.IsSet("to") {
+		if client.Email, err = email.ParseAddresses(c.String("to")); err != nil {
+			return nil, err
+		}
+	}
+	if c.IsSet("cc") {
+		if client.CC, err = email.ParseAddresses(c.String("cc")); err != nil {
+			return nil, err
+		}
+	}
+	if c.IsSet("attach") {
+		client.Attach, config.Attach = c.String("attach"), c.String("attach")
+	}
+	return email.ComposeFor(config, invoice, client)
+}
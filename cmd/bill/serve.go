@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/louisinger/bill/pkg/api"
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/webhook"
+	"github.com/urfave/cli/v2"
+)
+
+// apiTokenEnv holds the bearer token of the API server.
+const apiTokenEnv = "BILL_API_TOKEN"
+
+func serveCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Serve the invoices, clients and catalog over a JSON REST API and a browser UI (the token is read from " + apiTokenEnv + ")",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "addr", Value: "127.0.0.1:8080", Usage: "Address to listen on"},
+			&cli.StringFlag{Name: "template", Usage: "Template providing the seller details and defaults of new invoices"},
+			&cli.StringFlag{Name: "output-dir", Usage: "Directory of the documents of new invoices (default: documents in the config directory)"},
+		},
+		Action: func(c *cli.Context) error {
+			dir := c.String("output-dir")
+			if dir == "" {
+				configDir, err := bill.ConfigDir()
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Error finding the config directory: %v", err), 1)
+				}
+				dir = filepath.Join(configDir, "documents")
+			}
+
+			token := os.Getenv(apiTokenEnv)
+			if token == "" {
+				buf := make([]byte, 24)
+				if _, err := rand.Read(buf); err != nil {
+					return cli.Exit(fmt.Sprintf("Error generating a token: %v", err), 1)
+				}
+				token = hex.EncodeToString(buf)
+				fmt.Printf("No %s set, generated the token %s\n", apiTokenEnv, token)
+			}
+
+			server := api.New(token, dir)
+			server.Version = version
+			if path := c.String("template"); path != "" {
+				template, err := bill.LoadTemplate(path)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Error loading template: %v", err), 1)
+				}
+				server.Template = *template
+			}
+			config, err := bill.LoadSigningConfig()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading signing settings: %v", err), 1)
+			}
+			if config.Certificate != "" {
+				server.Signature = signature
+			}
+
+			provider, err := btcpayClient()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading BTCPay settings: %v", err), 1)
+			}
+			if provider != nil {
+				server.Checkout = provider.Checkout
+				if provider.WebhookSecret != "" {
+					server.Hooks = map[string]http.Handler{"/btcpay/webhook": provider.Webhook(provider.WebhookSecret)}
+				}
+			}
+
+			// Make the webhook deliveries outside of the API lock, and poll
+			// BTCPay Server when it has no webhook to notify settlements
+			go webhook.Run(time.Minute)
+			if provider != nil && provider.WebhookSecret == "" {
+				go func() {
+					for now := range time.Tick(time.Minute) {
+						server.Locked(func() {
+							if _, err := provider.Sync(now); err != nil {
+								log.Printf("btcpay: %v", err)
+							}
+						})
+					}
+				}()
+			}
+
+			fmt.Printf("Serving the API on http://%s (OpenAPI document at /openapi.json, browser UI at /ui/)\n", c.String("addr"))
+			if err := http.ListenAndServe(c.String("addr"), server); err != nil {
+				return cli.Exit(fmt.Sprintf("Error serving the API: %v", err), 1)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/urfave/cli/v2"
+)
+
+// signPasswordEnv holds the password of the signing key, which is never
+// stored with the settings.
+const signPasswordEnv = "BILL_SIGN_PASSWORD"
+
+// signature opens the configured signing key.
+func signature() (*bill.Signature, error) {
+	config, err := bill.LoadSigningConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Signature(os.Getenv(signPasswordEnv))
+}
+
+// pdfOptions returns the options a stored invoice is regenerated with,
+// signed again if it was signed.
+func pdfOptions(invoice *bill.Invoice) (bill.PDFOptions, error) {
+	opts := invoice.PDFOptions()
+	if invoice.Signed && !bill.IsHTMLPath(invoice.Path) {
+		var err error
+		if opts.Signature, err = signature(); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+func signingCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "signing",
+		Usage: "Show or set the certificate PDFs are signed with (the key password is read from " + signPasswordEnv + ")",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "cert", Usage: "PKCS#12 (.p12, .pfx) file, or PEM certificate with its chain"},
+			&cli.StringFlag{Name: "key", Usage: "PEM private key of a PEM certificate"},
+			&cli.StringFlag{Name: "reason", Usage: "Reason shown with the signature"},
+			&cli.BoolFlag{Name: "visible", Usage: "Draw a signature block on the last page"},
+		},
+		Action: func(c *cli.Context) error {
+			config, err := bill.LoadSigningConfig()
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error loading signing settings: %v", err), 1)
+			}
+
+			if c.NumFlags() > 0 {
+				if c.IsSet("cert") {
+					if config.Certificate, err = filepath.Abs(c.String("cert")); err != nil {
+						return cli.Exit(fmt.Sprintf("Error saving signing settings: %v", err), 1)
+					}
+					config.Key = ""
+				}
+				if c.IsSet("key") {
+					if config.Key, err = filepath.Abs(c.String("key")); err != nil {
+						return cli.Exit(fmt.Sprintf("Error saving signing settings: %v", err), 1)
+					}
+				}
+				if c.IsSet("reason") {
+					config.Reason = c.String("reason")
+				}
+				if c.IsSet("visible") {
+					config.Visible = c.Bool("visible")
+				}
+				if _, err := config.Signature(os.Getenv(signPasswordEnv)); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				if err := bill.SaveSigningConfig(config); err != nil {
+					return cli.Exit(fmt.Sprintf("Error saving signing settings: %v", err), 1)
+				}
+			}
+
+			if config.Certificate == "" {
+				fmt.Println("No signing certificate configured")
+				return nil
+			}
+			fmt.Printf("Certificate: %s\n", config.Certificate)
+			if config.Key != "" {
+				fmt.Printf("Key:         %s\n", config.Key)
+			}
+			if config.Reason != "" {
+				fmt.Printf("Reason:      %s\n", config.Reason)
+			}
+			fmt.Printf("Visible:     %t\n", config.Visible)
+			return nil
+		},
+	}
+}
+
+func verifyCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "verify",
+		Usage:     "Check the digital signature of a PDF",
+		ArgsUsage: "<file.pdf>",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.Exit("Usage: bill verify <file.pdf>", 1)
+			}
+			path := c.Args().First()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error reading %s: %v", path, err), 1)
+			}
+			signatures, err := bill.VerifyPDF(data)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Error verifying %s: %v", path, err), 1)
+			}
+
+			failed := false
+			for _, sig := range signatures {
+				if sig.Err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid signature: %v\n", sig.Err)
+					failed = true
+					continue
+				}
+				fmt.Printf("Signed by %s", sig.Signer.Subject.CommonName)
+				if !sig.Time.IsZero() {
+					fmt.Printf(" on %s", sig.Time.Format("2006-01-02 15:04:05 -07:00"))
+				}
+				fmt.Println()
+				if sig.Reason != "" {
+					fmt.Printf("  Reason: %s\n", sig.Reason)
+				}
+				fmt.Printf("  Issuer: %s\n", sig.Signer.Issuer)
+				if sig.TrustErr != nil {
+					fmt.Printf("  Certificate not trusted: %v\n", sig.TrustErr)
+				} else {
+					fmt.Println("  Certificate trusted")
+				}
+				if sig.Modified {
+					fmt.Fprintln(os.Stderr, "  The document was changed after signing")
+					failed = true
+				} else {
+					fmt.Println("  The document was not changed since signing")
+				}
+			}
+			if failed {
+				return cli.Exit(fmt.Sprintf("%s fails the signature check", path), 1)
+			}
+			return nil
+		},
+	}
+}
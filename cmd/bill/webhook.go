@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/louisinger/bill/pkg/webhook"
+	"github.com/urfave/cli/v2"
+)
+
+func webhookCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "webhook",
+		Usage: "Notify other tools of invoice events (created, sent, paid, voided) with signed HTTP POSTs",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List the webhook endpoints",
+				Action: func(c *cli.Context) error {
+					config, err := webhook.LoadConfig()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading webhook settings: %v", err), 1)
+					}
+					if len(config.Endpoints) == 0 {
+						fmt.Println("No webhook endpoint")
+					}
+					for _, endpoint := range config.Endpoints {
+						events := "all events"
+						if len(endpoint.Events) > 0 {
+							var names []string
+							for _, event := range endpoint.Events {
+								names = append(names, string(event))
+							}
+							events = strings.Join(names, ", ")
+						}
+						fmt.Printf("%s  (%s)\n", endpoint.URL, events)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "add",
+				Usage:     "Add a webhook endpoint, or update the one with this URL",
+				ArgsUsage: "<url>",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{Name: "event", Aliases: []string{"e"}, Usage: "Event to send (created, sent, paid, voided), repeatable, every event by default"},
+					&cli.StringFlag{Name: "secret", Usage: "Secret signing the deliveries, generated if not set"},
+				},
+				Action: func(c *cli.Context) error {
+					endpoint := webhook.Endpoint{URL: c.Args().First(), Secret: c.String("secret")}
+					for _, name := range c.StringSlice("event") {
+						event, err := webhook.ParseEvent(name)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+						endpoint.Events = append(endpoint.Events, event)
+					}
+					generated := endpoint.Secret == ""
+					if generated {
+						secret, err := webhook.NewSecret()
+						if err != nil {
+							return cli.Exit(fmt.Sprintf("Error generating a secret: %v", err), 1)
+						}
+						endpoint.Secret = secret
+					}
+
+					config, err := webhook.LoadConfig()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading webhook settings: %v", err), 1)
+					}
+					config.SetEndpoint(endpoint)
+					if err := webhook.SaveConfig(config); err != nil {
+						return cli.Exit(fmt.Sprintf("Error saving webhook settings: %v", err), 1)
+					}
+
+					fmt.Printf("Webhook %s saved\n", endpoint.URL)
+					if generated {
+						fmt.Printf("Signing secret: %s\n", endpoint.Secret)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "Remove a webhook endpoint",
+				ArgsUsage: "<url>",
+				Action: func(c *cli.Context) error {
+					config, err := webhook.LoadConfig()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading webhook settings: %v", err), 1)
+					}
+					if !config.RemoveEndpoint(c.Args().First()) {
+						return cli.Exit(fmt.Sprintf("No webhook endpoint %s", c.Args().First()), 1)
+					}
+					if err := webhook.SaveConfig(config); err != nil {
+						return cli.Exit(fmt.Sprintf("Error saving webhook settings: %v", err), 1)
+					}
+					fmt.Printf("Webhook %s removed\n", c.Args().First())
+					return nil
+				},
+			},
+			{
+				Name:      "test",
+				Usage:     "Send a ping event to the endpoints, or to one of them",
+				ArgsUsage: "[url]",
+				Action: func(c *cli.Context) error {
+					config, err := webhook.LoadConfig()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading webhook settings: %v", err), 1)
+					}
+					endpoints := config.Endpoints
+					if c.Args().Present() {
+						endpoint, ok := config.Endpoint(c.Args().First())
+						if !ok {
+							return cli.Exit(fmt.Sprintf("No webhook endpoint %s", c.Args().First()), 1)
+						}
+						endpoints = []webhook.Endpoint{endpoint}
+					}
+
+					failed := 0
+					for _, endpoint := range endpoints {
+						attempt, err := webhook.Test(endpoint, time.Now())
+						if err != nil {
+							return cli.Exit(fmt.Sprintf("Error sending the ping: %v", err), 1)
+						}
+						if attempt.Error != "" {
+							failed++
+							fmt.Printf("%s: failed, %s\n", endpoint.URL, attempt.Error)
+						} else {
+							fmt.Printf("%s: OK, HTTP %d in %d ms\n", endpoint.URL, attempt.Status, attempt.DurationMS)
+						}
+					}
+					if failed > 0 {
+						return cli.Exit(fmt.Sprintf("%d endpoint(s) failed", failed), 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "log",
+				Usage: "Show the latest deliveries",
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "limit", Aliases: []string{"n"}, Value: 20, Usage: "Number of deliveries to show"},
+				},
+				Action: func(c *cli.Context) error {
+					deliveries, err := webhook.LoadLog()
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error loading the delivery log: %v", err), 1)
+					}
+					if limit := c.Int("limit"); limit > 0 && len(deliveries) > limit {
+						deliveries = deliveries[len(deliveries)-limit:]
+					}
+
+					for i := len(deliveries) - 1; i >= 0; i-- {
+						d := deliveries[i]
+						// Queued deliveries have no attempt yet
+						last := webhook.Attempt{At: d.NextAttempt}
+						if len(d.Attempts) > 0 {
+							last = d.Attempts[len(d.Attempts)-1]
+						}
+						state := string(d.State)
+						switch {
+						case d.State == webhook.Pending && len(d.Attempts) == 0:
+							state += ", queued"
+						case d.State == webhook.Pending:
+							state += ", retry at " + d.NextAttempt.Format("2006-01-02 15:04")
+						case last.Error != "":
+							state += ", " + last.Error
+						}
+						fmt.Printf("%s  %-16s %-12s %s  %d attempt(s), %s\n",
+							last.At.Format("2006-01-02 15:04"), d.Event, d.Invoice, d.URL, len(d.Attempts), state)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "retry",
+				Usage: "Retry the failed deliveries that are due, for a cron job (bill serve retries them by itself)",
+				Action: func(c *cli.Context) error {
+					delivered, failed, err := webhook.Flush(time.Now())
+					if err != nil {
+						return cli.Exit(fmt.Sprintf("Error retrying deliveries: %v", err), 1)
+					}
+					fmt.Printf("%d delivered, %d failed for good\n", delivered, failed)
+					return nil
+				},
+			},
+			{
+				Name:  "listen",
+				Usage: "Run a local endpoint printing the events it receives, to try webhooks out",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "addr", Value: "127.0.0.1:9000", Usage: "Address to listen on"},
+					&cli.StringFlag{Name: "secret", Usage: "Secret to verify the signatures with"},
+				},
+				Action: func(c *cli.Context) error {
+					secret := c.String("secret")
+					handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						body, err := io.ReadAll(r.Body)
+						if err != nil {
+							http.Error(w, err.Error(), http.StatusBadRequest)
+							return
+						}
+						verified := "not verified"
+						if secret != "" {
+							if err := webhook.Verify(secret, r.Header.Get(webhook.HeaderTimestamp), r.Header.Get(webhook.HeaderSignature), body, time.Now()); err != nil {
+								fmt.Printf("%s  %s refused: %v\n", time.Now().Format("15:04:05"), r.Header.Get(webhook.HeaderDelivery), err)
+								http.Error(w, err.Error(), http.StatusUnauthorized)
+								return
+							}
+							verified = "signature OK"
+						}
+
+						var payload webhook.Payload
+						if err := json.Unmarshal(body, &payload); err != nil {
+							http.Error(w, err.Error(), http.StatusBadRequest)
+							return
+						}
+						fmt.Printf("%s  %s %s", time.Now().Format("15:04:05"), r.Header.Get(webhook.HeaderDelivery), payload.Event)
+						if payload.Event != webhook.EventPing {
+							inv := payload.Invoice
+							fmt.Printf(" %s (%s, total %.2f %s, balance %.2f %s)",
+								inv.Number, inv.Status, inv.Total, inv.Currency, inv.Balance, inv.Currency)
+						}
+						fmt.Printf(", %s\n", verified)
+						w.WriteHeader(http.StatusNoContent)
+					})
+
+					fmt.Printf("Listening for webhooks on http://%s\n", c.String("addr"))
+					if err := http.ListenAndServe(c.String("addr"), handler); err != nil {
+						return cli.Exit(fmt.Sprintf("Error listening: %v", err), 1)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
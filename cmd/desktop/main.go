@@ -1,8 +1,16 @@
 package main
 
-import "github.com/louisinger/bill/pkg/ui"
+import (
+	"time"
+
+	"github.com/louisinger/bill/pkg/ui"
+	"github.com/louisinger/bill/pkg/webhook"
+)
 
 func main() {
+	webhook.Register()
+	go webhook.Run(time.Minute)
+
 	app := ui.NewBillApp()
 	app.Run()
 }
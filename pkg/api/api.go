@@ -0,0 +1,309 @@
+// Package api serves the invoice store over HTTP as a JSON REST API:
+// invoices and their documents, payments, the client list and the catalog.
+// Every request but the OpenAPI document needs the bearer token of the
+// server, and errors are JSON objects with a code, a message and, for
+// invalid requests, the fields at fault.
+//
+// The same server has a browser UI under /ui/, plain HTML forms signed in
+// with the token.
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// Server handles the API requests.
+type Server struct {
+	// Token authenticates the clients of the API.
+	Token string
+
+	// Template provides the seller details, the currency and any other
+	// default of the invoices created through the API.
+	Template bill.BillTemplate
+
+	// Dir is where the documents of created invoices are written.
+	Dir string
+
+	// Signature returns the signature of invoices created with "sign".
+	Signature func() (*bill.Signature, error)
+
+	// Checkout opens a checkout at a payment provider for invoices created
+	// with "checkout".
+	Checkout func(inv *bill.Invoice) (*bill.Checkout, error)
+
+	// Hooks receive the notifications of payment providers by path, e.g.
+	// "/btcpay/webhook". They authenticate the requests themselves.
+	Hooks map[string]http.Handler
+
+	// Version is reported by the OpenAPI document.
+	Version string
+
+	// The invoice store is a directory of files, and PDFs are drawn with a
+	// QR code written to the working directory: requests are served one
+	// at a time.
+	mu     sync.Mutex
+	routes []route
+	pages  []route // the browser UI under /ui/
+}
+
+// New returns a server authenticating with token and writing documents to
+// dir.
+func New(token, dir string) *Server {
+	s := &Server{Token: token, Dir: dir}
+	s.routes = s.handlers()
+	s.pages = s.uiHandlers()
+	return s
+}
+
+// route is an endpoint of the API, described for the OpenAPI document.
+type route struct {
+	Method  string
+	Path    string // segments in braces are parameters, e.g. /invoices/{number}
+	Summary string
+	Tag     string
+	Query   []parameter
+	Request interface{} // body decoded by the handler, if any
+	// Response is the JSON body of the success status, or a media type
+	// such as "application/pdf" for documents.
+	Response interface{}
+	Status   int
+	Public   bool
+	Handler  func(w http.ResponseWriter, r *http.Request, params map[string]string) error
+}
+
+type parameter struct {
+	Name        string
+	Description string
+}
+
+// Error is the body of every error response.
+type Error struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError is an invalid value of a request, Field being its JSON path,
+// e.g. "items[0].quantity".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Error codes.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodePaymentProvider  = "payment_provider_error"
+	CodeInternal         = "internal_error"
+)
+
+func errorf(status int, code, format string, args ...interface{}) *Error {
+	return &Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// validation collects the invalid fields of a request.
+type validation []FieldError
+
+func (v *validation) add(field, format string, args ...interface{}) {
+	*v = append(*v, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns the validation error, nil when every field is valid.
+func (v validation) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Message: "the request is invalid", Fields: v}
+}
+
+// notFound maps a missing stored invoice to a 404 error.
+func notFound(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return errorf(http.StatusNotFound, CodeNotFound, "%v", err)
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		log.Printf("api: %v", err)
+		apiErr = errorf(http.StatusInternalServerError, CodeInternal, "%v", err)
+	}
+	if apiErr.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="bill"`)
+	}
+	writeJSON(w, apiErr.Status, struct {
+		Error *Error `json:"error"`
+	}{apiErr})
+}
+
+// maxBody bounds the size of request bodies.
+const maxBody = 1 << 20
+
+func readBody(r *http.Request) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, CodeBadRequest, "reading the body: %v", err)
+	}
+	if len(data) > maxBody {
+		return nil, errorf(http.StatusRequestEntityTooLarge, CodeBadRequest, "the body exceeds %d bytes", maxBody)
+	}
+	return data, nil
+}
+
+// unmarshalStrict reads a JSON body, refusing unknown fields so that typos
+// do not go unnoticed.
+func unmarshalStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errorf(http.StatusBadRequest, CodeBadRequest, "invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// unmarshalLoose reads some fields of a JSON body.
+func unmarshalLoose(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return errorf(http.StatusBadRequest, CodeBadRequest, "invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// decode reads the JSON body of a request.
+func decode(r *http.Request, v interface{}) error {
+	data, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	return unmarshalStrict(data, v)
+}
+
+// match reports whether the escaped path of a request matches the path of
+// a route, returning the unescaped parameters. Parameters may hold an
+// escaped "/", as invoice numbers sometimes do.
+func match(pattern, path string) (map[string]string, bool) {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternParts) != len(pathParts) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, part := range patternParts {
+		value, err := url.PathUnescape(pathParts[i])
+		if err != nil {
+			return nil, false
+		}
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if value == "" {
+				return nil, false
+			}
+			params[part[1:len(part)-1]] = value
+		} else if part != value {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// authorized checks the bearer token of a request.
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.validToken(token)
+}
+
+// validToken compares a token with the server token in constant time.
+func (s *Server) validToken(token string) bool {
+	return s.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// Locked runs f while no request is served, for background changes of the
+// invoice store.
+func (s *Server) Locked(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+	case r.URL.Path == "/ui" || strings.HasPrefix(r.URL.Path, "/ui/"):
+		s.serve(w, r, s.pages, s.signedIn, s.writePageError)
+	case s.Hooks[r.URL.Path] != nil:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.Hooks[r.URL.Path].ServeHTTP(w, r)
+	default:
+		s.serve(w, r, s.routes, s.authorized, func(w http.ResponseWriter, _ *http.Request, err error) {
+			writeError(w, err)
+		})
+	}
+}
+
+// serve dispatches a request to the first route matching it, checking the
+// credentials of non-public routes with authorized.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, routes []route, authorized func(*http.Request) bool, fail func(http.ResponseWriter, *http.Request, error)) {
+	var allowed []string
+	for _, rt := range routes {
+		params, ok := match(rt.Path, r.URL.EscapedPath())
+		if !ok {
+			continue
+		}
+		if rt.Method != r.Method {
+			allowed = append(allowed, rt.Method)
+			continue
+		}
+		if !rt.Public && !authorized(r) {
+			fail(w, r, errorf(http.StatusUnauthorized, CodeUnauthorized, "a valid bearer token is required"))
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := rt.Handler(w, r, params); err != nil {
+			fail(w, r, err)
+		}
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		fail(w, r, errorf(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "%s is not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+	fail(w, r, errorf(http.StatusNotFound, CodeNotFound, "no endpoint at %s", r.URL.Path))
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/einvoice"
+)
+
+func (s *Server) listClients(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	clients, err := bill.LoadClients()
+	if err != nil {
+		return err
+	}
+	if clients == nil {
+		clients = []bill.Client{}
+	}
+	writeJSON(w, http.StatusOK, clients)
+	return nil
+}
+
+func (s *Server) getClient(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	clients, err := bill.LoadClients()
+	if err != nil {
+		return err
+	}
+	i := bill.FindClient(clients, params["name"])
+	if i < 0 {
+		return errorf(http.StatusNotFound, CodeNotFound, "no client %q", params["name"])
+	}
+	writeJSON(w, http.StatusOK, clients[i])
+	return nil
+}
+
+// validateClient reports the invalid fields of a client.
+func validateClient(client bill.Client) error {
+	var v validation
+	if strings.TrimSpace(client.Name) == "" {
+		v.add("name", "is required")
+	}
+	if client.PaymentDays < 0 {
+		v.add("payment_days", "cannot be negative")
+	}
+	if _, err := bill.ParsePageSize(client.PageSize); err != nil {
+		v.add("page_size", "%v", err)
+	}
+	if _, err := bill.ParseOrientation(client.Orientation); err != nil {
+		v.add("orientation", "%v", err)
+	}
+	if client.Currency != "" {
+		if _, err := bill.CurrencyCode(client.Currency); err != nil {
+			v.add("currency", "%v", err)
+		}
+	}
+	for _, field := range []struct {
+		name      string
+		addresses []string
+	}{{"email", client.Email}, {"cc", client.CC}} {
+		for i, address := range field.addresses {
+			if _, err := mail.ParseAddress(address); err != nil {
+				v.add(fmt.Sprintf("%s[%d]", field.name, i), "%q is not an email address", address)
+			}
+		}
+	}
+	if client.Attach != "" {
+		known := false
+		for _, f := range einvoice.Formats {
+			known = known || f == client.Attach
+		}
+		if !known {
+			v.add("attach", "unknown format %q (expected %s)", client.Attach, strings.Join(einvoice.Formats, ", "))
+		}
+	}
+	return v.err()
+}
+
+// saveClient creates a client, or replaces the one named in the path.
+func (s *Server) saveClient(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	var client bill.Client
+	if err := decode(r, &client); err != nil {
+		return err
+	}
+	client.Name = strings.TrimSpace(client.Name)
+	if err := validateClient(client); err != nil {
+		return err
+	}
+
+	clients, err := bill.LoadClients()
+	if err != nil {
+		return err
+	}
+	status, i := http.StatusCreated, -1
+	if params["name"] != "" {
+		if i = bill.FindClient(clients, params["name"]); i < 0 {
+			return errorf(http.StatusNotFound, CodeNotFound, "no client %q", params["name"])
+		}
+	}
+	if other := bill.FindClient(clients, client.Name); other >= 0 && other != i {
+		return errorf(http.StatusConflict, CodeConflict, "client %q already exists", client.Name)
+	}
+	if i >= 0 {
+		clients[i] = client
+		status = http.StatusOK
+	} else {
+		clients = append(clients, client)
+	}
+	if err := bill.SaveClients(clients); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/clients/"+url.PathEscape(client.Name))
+	writeJSON(w, status, client)
+	return nil
+}
+
+func (s *Server) deleteClient(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	clients, err := bill.LoadClients()
+	if err != nil {
+		return err
+	}
+	i := bill.FindClient(clients, params["name"])
+	if i < 0 {
+		return errorf(http.StatusNotFound, CodeNotFound, "no client %q", params["name"])
+	}
+	if err := bill.SaveClients(append(clients[:i], clients[i+1:]...)); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) listProducts(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	products, err := bill.LoadCatalog()
+	if err != nil {
+		return err
+	}
+	if products == nil {
+		products = []bill.Product{}
+	}
+	writeJSON(w, http.StatusOK, products)
+	return nil
+}
+
+func (s *Server) getProduct(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	products, err := bill.LoadCatalog()
+	if err != nil {
+		return err
+	}
+	i := bill.FindProduct(products, params["id"])
+	if i < 0 {
+		return errorf(http.StatusNotFound, CodeNotFound, "no product %q", params["id"])
+	}
+	writeJSON(w, http.StatusOK, products[i])
+	return nil
+}
+
+// validateProduct reports the invalid fields of a product, normalizing its
+// unit.
+func validateProduct(product *bill.Product) error {
+	var v validation
+	if strings.TrimSpace(product.ID) == "" {
+		v.add("id", "is required")
+	}
+	if strings.TrimSpace(product.Description) == "" {
+		v.add("description", "is required")
+	}
+	if product.VATRate < 0 || product.VATRate >= 100 {
+		v.add("vat_rate", "must be between 0 and 100")
+	}
+	unit, err := bill.ParseUnit(string(product.Unit))
+	if err != nil {
+		v.add("unit", "%v", err)
+	}
+	product.Unit = unit
+	return v.err()
+}
+
+// saveProduct creates a product, or replaces the one of the path.
+func (s *Server) saveProduct(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	var product bill.Product
+	if err := decode(r, &product); err != nil {
+		return err
+	}
+	product.ID = strings.TrimSpace(product.ID)
+	if params["id"] != "" && product.ID == "" {
+		product.ID = params["id"]
+	}
+	if err := validateProduct(&product); err != nil {
+		return err
+	}
+
+	products, err := bill.LoadCatalog()
+	if err != nil {
+		return err
+	}
+	status, i := http.StatusCreated, -1
+	if params["id"] != "" {
+		if i = bill.FindProduct(products, params["id"]); i < 0 {
+			return errorf(http.StatusNotFound, CodeNotFound, "no product %q", params["id"])
+		}
+	}
+	if other := bill.FindProduct(products, product.ID); other >= 0 && other != i {
+		return errorf(http.StatusConflict, CodeConflict, "product %q already exists", product.ID)
+	}
+	if i >= 0 {
+		products[i] = product
+		status = http.StatusOK
+	} else {
+		products = append(products, product)
+	}
+	if err := bill.SaveCatalog(products); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/catalog/"+url.PathEscape(product.ID))
+	writeJSON(w, status, product)
+	return nil
+}
+
+func (s *Server) deleteProduct(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	products, err := bill.LoadCatalog()
+	if err != nil {
+		return err
+	}
+	i := bill.FindProduct(products, params["id"])
+	if i < 0 {
+		return errorf(http.StatusNotFound, CodeNotFound, "no product %q", params["id"])
+	}
+	if err := bill.SaveCatalog(append(products[:i], products[i+1:]...)); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
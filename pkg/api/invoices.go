@@ -0,0 +1,643 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/einvoice"
+)
+
+// dateLayout is the format of the dates of requests and responses.
+const dateLayout = "2006-01-02"
+
+// Invoice is a stored invoice as returned by the API.
+type Invoice struct {
+	Number        string              `json:"number"`
+	Date          string              `json:"date"`
+	DueDate       string              `json:"due_date,omitempty"`
+	Status        bill.Status         `json:"status"`
+	CreditNoteFor string              `json:"credit_note_for,omitempty"`
+	Seller        string              `json:"seller"`
+	Client        string              `json:"client"`
+	Currency      string              `json:"currency"`
+	Net           float64             `json:"net"`
+	VAT           float64             `json:"vat"`
+	Total         float64             `json:"total"`
+	Paid          float64             `json:"paid"`
+	Balance       float64             `json:"balance"`
+	Items         []Item              `json:"items"`
+	Payments      []bill.Payment      `json:"payments"`
+	History       []bill.StatusChange `json:"history"`
+	Links         Links               `json:"links"`
+}
+
+// Item is an invoice line.
+type Item struct {
+	Description string    `json:"description"`
+	Quantity    float64   `json:"quantity"`
+	Unit        bill.Unit `json:"unit,omitempty"`
+	UnitPrice   float64   `json:"unit_price"`
+	VATRate     float64   `json:"vat_rate"`
+	Total       float64   `json:"total"`
+}
+
+// Links are the URLs of the documents of an invoice.
+type Links struct {
+	Self     string `json:"self"`
+	PDF      string `json:"pdf"`
+	HTML     string `json:"html"`
+	XML      string `json:"xml"`
+	Payments string `json:"payments"`
+
+	// Checkout is the payment page opened at the payment provider, if
+	// any.
+	Checkout string `json:"checkout,omitempty"`
+}
+
+// InvoiceRequest creates an invoice. The template fields (company_name,
+// to_address, vat_rate...) override those of the server template, and
+// client fills the "to" fields from the client list.
+type InvoiceRequest struct {
+	bill.BillTemplate
+
+	Number  string        `json:"number"`
+	Date    string        `json:"date,omitempty"`
+	DueDate string        `json:"due_date,omitempty"`
+	Client  string        `json:"client,omitempty"`
+	Items   []ItemRequest `json:"items"`
+
+	// Draft keeps the invoice editable: posting the same number again
+	// replaces it.
+	Draft bool `json:"draft,omitempty"`
+
+	// Format of the stored document, pdf (the default) or html.
+	Format  string `json:"format,omitempty"`
+	FacturX string `json:"facturx,omitempty"`
+	PDFA    string `json:"pdfa,omitempty"`
+	Sign    bool   `json:"sign,omitempty"`
+
+	// Checkout opens a payment checkout (a BTCPay Server invoice) for the
+	// total, its link printed in the payment section.
+	Checkout bool `json:"checkout,omitempty"`
+}
+
+// ItemRequest is a line of a new invoice: a catalog product, whose fields
+// may be overridden, or a description with a unit price. Lines without a
+// VAT rate are charged the vat_rate of the invoice.
+type ItemRequest struct {
+	Product     string   `json:"product,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Quantity    float64  `json:"quantity"`
+	Unit        string   `json:"unit,omitempty"`
+	UnitPrice   *float64 `json:"unit_price,omitempty"`
+	VATRate     *float64 `json:"vat_rate,omitempty"`
+}
+
+// PaymentRequest records a payment.
+type PaymentRequest struct {
+	Date      string  `json:"date,omitempty"`
+	Amount    float64 `json:"amount"`
+	Method    string  `json:"method,omitempty"`
+	Reference string  `json:"reference,omitempty"`
+	Currency  string  `json:"currency,omitempty"`
+	Rate      float64 `json:"rate,omitempty"`
+}
+
+// invoiceURL returns the path of an invoice, escaping "/" in its number.
+func invoiceURL(number string) string {
+	return "/invoices/" + url.PathEscape(number)
+}
+
+func newInvoice(inv *bill.Invoice) Invoice {
+	b := inv.Bill
+	self := invoiceURL(b.Number)
+	out := Invoice{
+		Number:        b.Number,
+		Date:          b.Date.Format(dateLayout),
+		Status:        inv.Status,
+		CreditNoteFor: b.CreditNoteFor,
+		Seller:        b.CompanyName,
+		Client:        b.ToCompanyName,
+		Currency:      b.Currency,
+		Net:           b.NetTotal(),
+		VAT:           b.TaxTotal(),
+		Total:         b.Total,
+		Paid:          inv.Paid(),
+		Balance:       inv.Balance(),
+		Items:         []Item{},
+		Payments:      inv.Payments,
+		History:       inv.History,
+		Links: Links{
+			Self:     self,
+			PDF:      self + "/pdf",
+			HTML:     self + "/html",
+			XML:      self + "/xml",
+			Payments: self + "/payments",
+		},
+	}
+	if !b.DueDate.IsZero() {
+		out.DueDate = b.DueDate.Format(dateLayout)
+	}
+	if b.Checkout != nil {
+		out.Links.Checkout = b.Checkout.URL
+	}
+	if out.Payments == nil {
+		out.Payments = []bill.Payment{}
+	}
+	for _, item := range b.Items {
+		out.Items = append(out.Items, Item{
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			Unit:        item.Unit,
+			UnitPrice:   item.UnitPrice,
+			VATRate:     item.VATRate,
+			Total:       item.Total,
+		})
+	}
+	return out
+}
+
+func (s *Server) listInvoices(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	var filter bill.Status
+	if status := r.URL.Query().Get("status"); status != "" {
+		var err error
+		if filter, err = bill.ParseStatus(status); err != nil {
+			return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: err.Error(),
+				Fields: []FieldError{{Field: "status", Message: err.Error()}}}
+		}
+	}
+	client := r.URL.Query().Get("client")
+
+	invoices, err := bill.ListInvoices()
+	if err != nil {
+		return err
+	}
+	out := []Invoice{}
+	for i := range invoices {
+		inv := &invoices[i]
+		if filter != "" && inv.Status != filter {
+			continue
+		}
+		if client != "" && !strings.EqualFold(inv.Bill.ToCompanyName, client) {
+			continue
+		}
+		out = append(out, newInvoice(inv))
+	}
+	writeJSON(w, http.StatusOK, out)
+	return nil
+}
+
+func (s *Server) getInvoice(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	inv, err := bill.LoadInvoice(params["number"])
+	if err != nil {
+		return notFound(err)
+	}
+	writeJSON(w, http.StatusOK, newInvoice(inv))
+	return nil
+}
+
+// parseDate reads an optional date of a request, today when empty.
+func parseDate(v *validation, field, value string) time.Time {
+	if value == "" {
+		return time.Now()
+	}
+	date, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		v.add(field, "expected a date as YYYY-MM-DD")
+	}
+	return date
+}
+
+// billFromRequest builds the bill of a creation request on the server
+// template, checking every field.
+func (s *Server) billFromRequest(req *InvoiceRequest, v *validation) bill.Bill {
+	if strings.TrimSpace(req.Number) == "" {
+		v.add("number", "is required")
+	}
+	date := parseDate(v, "date", req.Date)
+
+	if req.Currency != "" {
+		if _, err := bill.CurrencyCode(req.Currency); err != nil {
+			v.add("currency", "%v", err)
+		}
+	}
+	if _, err := bill.ParsePageSize(req.PageSize); err != nil {
+		v.add("page_size", "%v", err)
+	}
+	if _, err := bill.ParseOrientation(req.Orientation); err != nil {
+		v.add("orientation", "%v", err)
+	}
+	if req.CompanyName == "" {
+		v.add("company_name", "is required (set it in the request or the server template)")
+	}
+	if req.ToCompanyName == "" {
+		v.add("to_company_name", "is required (or give a client)")
+	}
+	for i, method := range req.PaymentMethods {
+		if err := method.Validate(); err != nil {
+			v.add(fmt.Sprintf("payment_methods[%d]", i), "%v", err)
+		}
+	}
+
+	var products []bill.Product
+	if len(req.Items) == 0 {
+		v.add("items", "at least one item is required")
+	}
+	req.BillTemplate.Items = nil
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		var line bill.TemplateItem
+		if item.Product != "" {
+			if products == nil {
+				var err error
+				if products, err = bill.LoadCatalog(); err != nil {
+					v.add(field+".product", "%v", err)
+					continue
+				}
+			}
+			index := bill.FindProduct(products, item.Product)
+			if index < 0 {
+				v.add(field+".product", "no product %q in the catalog", item.Product)
+				continue
+			}
+			line = products[index].Item(item.Quantity)
+			if line.VATRate == 0 {
+				line.VATRate = req.VATRate
+			}
+		} else {
+			line.VATRate = req.VATRate
+			if item.UnitPrice == nil {
+				v.add(field+".unit_price", "is required without a product")
+			}
+		}
+
+		line.Quantity = item.Quantity
+		if item.Description != "" {
+			line.Description = item.Description
+		}
+		if item.Unit != "" {
+			unit, err := bill.ParseUnit(item.Unit)
+			if err != nil {
+				v.add(field+".unit", "%v", err)
+			}
+			line.Unit = unit
+		}
+		if item.UnitPrice != nil {
+			line.UnitPrice = *item.UnitPrice
+		}
+		if item.VATRate != nil {
+			line.VATRate = *item.VATRate
+		}
+
+		if strings.TrimSpace(line.Description) == "" {
+			v.add(field+".description", "is required")
+		}
+		if err := bill.ValidateQuantity(line.Quantity, req.QuantityPrecision); err != nil {
+			v.add(field+".quantity", "%v", err)
+		}
+		if line.VATRate < 0 || line.VATRate >= 100 {
+			v.add(field+".vat_rate", "must be between 0 and 100")
+		}
+		req.BillTemplate.Items = append(req.BillTemplate.Items, line)
+	}
+
+	b := bill.NewBillFromTemplate(req.BillTemplate, strings.TrimSpace(req.Number), date)
+	if req.DueDate != "" {
+		b.DueDate = parseDate(v, "due_date", req.DueDate)
+		if !b.DueDate.IsZero() && b.DueDate.Before(b.Date) {
+			v.add("due_date", "cannot be before the invoice date")
+		}
+	}
+	if req.PaymentDays < 0 {
+		v.add("payment_days", "cannot be negative")
+	}
+	return b
+}
+
+func (s *Server) createInvoice(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	// The body is read over the server template, after the client details
+	// when it names a client, so that every field it sets wins
+	var probe struct {
+		Client string `json:"client"`
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := unmarshalLoose(body, &probe); err != nil {
+		return err
+	}
+	var v validation
+	req, err := s.newRequest(probe.Client, &v)
+	if err != nil {
+		return err
+	}
+	if err := unmarshalStrict(body, &req); err != nil {
+		return err
+	}
+
+	inv, err := s.create(&req, v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", invoiceURL(inv.Bill.Number))
+	writeJSON(w, http.StatusCreated, newInvoice(inv))
+	return nil
+}
+
+// newRequest returns a creation request holding the server template and,
+// when client is not empty, the details of that client.
+func (s *Server) newRequest(client string, v *validation) (InvoiceRequest, error) {
+	req := InvoiceRequest{BillTemplate: s.Template}
+	if client == "" {
+		return req, nil
+	}
+	clients, err := bill.LoadClients()
+	if err != nil {
+		return req, err
+	}
+	if i := bill.FindClient(clients, client); i >= 0 {
+		clients[i].Apply(&req.BillTemplate)
+	} else {
+		v.add("client", "no client %q in the client list", client)
+	}
+	return req, nil
+}
+
+// create checks a creation request, adding to the problems already found
+// in v, then stores the invoice and writes its document.
+func (s *Server) create(req *InvoiceRequest, v validation) (*bill.Invoice, error) {
+	b := s.billFromRequest(req, &v)
+
+	format := strings.ToLower(req.Format)
+	switch format {
+	case "", "pdf":
+		format = "pdf"
+	case "html":
+		if req.FacturX != "" || req.PDFA != "" || req.Sign {
+			v.add("format", "Factur-X, PDF/A and signing are only available on PDF invoices")
+		}
+	default:
+		v.add("format", "expected pdf or html")
+	}
+	var err error
+	var profile bill.FacturXProfile
+	if req.FacturX != "" {
+		if profile, err = bill.ParseFacturXProfile(req.FacturX); err != nil {
+			v.add("facturx", "%v", err)
+		}
+	}
+	var conformance bill.PDFAConformance
+	if req.PDFA != "" {
+		if conformance, err = bill.ParsePDFAConformance(req.PDFA); err != nil {
+			v.add("pdfa", "%v", err)
+		} else if profile != "" && conformance == bill.PDFA1b {
+			v.add("pdfa", "Factur-X invoices are PDF/A-3b")
+		}
+	}
+	if req.Sign && s.Signature == nil {
+		v.add("sign", "the server has no signing certificate")
+	}
+	if req.Checkout && s.Checkout == nil {
+		v.add("checkout", "the server has no payment provider")
+	} else if req.Checkout && req.Draft {
+		v.add("checkout", "draft invoices cannot be paid yet")
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	status := bill.StatusIssued
+	if req.Draft {
+		status = bill.StatusDraft
+	}
+	inv, err := bill.NewInvoice(b, status, time.Now())
+	if err != nil {
+		if errors.Is(err, bill.ErrImmutable) {
+			return nil, errorf(http.StatusConflict, CodeConflict, "%v", err)
+		}
+		return nil, err
+	}
+	inv.FacturX = profile
+	inv.PDFA = conformance
+	inv.Signed = req.Sign
+	if req.Checkout {
+		if inv.Bill.Checkout, err = s.Checkout(inv); err != nil {
+			return nil, errorf(http.StatusBadGateway, CodePaymentProvider, "opening the checkout: %v", err)
+		}
+		b = inv.Bill
+	}
+
+	opts := inv.PDFOptions()
+	if req.Sign {
+		if opts.Signature, err = s.Signature(); err != nil {
+			return nil, fmt.Errorf("signing key: %w", err)
+		}
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, err
+	}
+	name := strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(b.Number)
+	path, err := filepath.Abs(filepath.Join(s.Dir, name+"."+format))
+	if err != nil {
+		return nil, err
+	}
+	if err := bill.GenerateDocument(b, path, opts); err != nil {
+		return nil, errorf(http.StatusUnprocessableEntity, CodeValidation, "the invoice cannot be generated: %v", err)
+	}
+	inv.Path = path
+	if err := bill.SaveInvoice(inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// renderOptions returns the options drawing a stored invoice again, signed
+// if it was.
+func (s *Server) renderOptions(inv *bill.Invoice) (bill.PDFOptions, error) {
+	opts := inv.PDFOptions()
+	if inv.Signed && s.Signature != nil {
+		var err error
+		if opts.Signature, err = s.Signature(); err != nil {
+			return opts, fmt.Errorf("signing key: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// serveRendered draws an invoice to a temporary file with the extension
+// of the format and sends it, shown inline or downloaded as an attachment
+// depending on disposition.
+func (s *Server) serveRendered(w http.ResponseWriter, params map[string]string, ext, contentType, disposition string) error {
+	inv, err := bill.LoadInvoice(params["number"])
+	if err != nil {
+		return notFound(err)
+	}
+	opts, err := s.renderOptions(inv)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "bill-api")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "invoice"+ext)
+	if err := bill.GenerateDocument(inv.Bill, path, opts); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	name := strings.NewReplacer("/", "-", "\\", "-", ":", "-", `"`, "").Replace(inv.Bill.Number) + ext
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, name))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+	return nil
+}
+
+func (s *Server) renderPDF(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	return s.serveRendered(w, params, ".pdf", "application/pdf", "inline")
+}
+
+func (s *Server) renderHTML(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	return s.serveRendered(w, params, ".html", "text/html; charset=utf-8", "inline")
+}
+
+// xmlFormats are the formats of the XML endpoint: the e-invoice formats
+// and the Factur-X CII profiles.
+func xmlFormats() []string {
+	return append(append([]string(nil), einvoice.Formats...), "cii")
+}
+
+func (s *Server) renderXML(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	inv, err := bill.LoadInvoice(params["number"])
+	if err != nil {
+		return notFound(err)
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ubl"
+	}
+
+	var data []byte
+	var violations []error
+	if format == "cii" {
+		profile := bill.FacturXEN16931
+		if p := r.URL.Query().Get("profile"); p != "" {
+			if profile, err = bill.ParseFacturXProfile(p); err != nil {
+				return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: err.Error(),
+					Fields: []FieldError{{Field: "profile", Message: err.Error()}}}
+			}
+		}
+		if data, err = bill.FacturXML(inv.Bill, profile); err != nil {
+			return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Message: err.Error(),
+				Fields: []FieldError{{Field: "cii", Message: err.Error()}}}
+		}
+	} else {
+		known := false
+		for _, f := range einvoice.Formats {
+			known = known || f == format
+		}
+		if !known {
+			message := fmt.Sprintf("unknown format %q (expected %s)", format, strings.Join(xmlFormats(), ", "))
+			return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: message,
+				Fields: []FieldError{{Field: "format", Message: message}}}
+		}
+		if data, violations, err = einvoice.Export(inv.Bill, format); err != nil {
+			return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Message: err.Error()}
+		}
+	}
+
+	// Every broken business rule is reported, the document is not sent
+	if len(violations) > 0 {
+		apiErr := &Error{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    CodeValidation,
+			Message: fmt.Sprintf("the %s e-invoice fails %d check(s)", format, len(violations)),
+		}
+		for _, violation := range violations {
+			apiErr.Fields = append(apiErr.Fields, FieldError{Field: format, Message: violation.Error()})
+		}
+		return apiErr
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+	return nil
+}
+
+func (s *Server) listPayments(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	inv, err := bill.LoadInvoice(params["number"])
+	if err != nil {
+		return notFound(err)
+	}
+	payments := inv.Payments
+	if payments == nil {
+		payments = []bill.Payment{}
+	}
+	writeJSON(w, http.StatusOK, payments)
+	return nil
+}
+
+func (s *Server) addPayment(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	inv, err := bill.LoadInvoice(params["number"])
+	if err != nil {
+		return notFound(err)
+	}
+	var req PaymentRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	if err := recordPayment(inv, req); err != nil {
+		return err
+	}
+	w.Header().Set("Location", invoiceURL(inv.Bill.Number)+"/payments")
+	writeJSON(w, http.StatusCreated, newInvoice(inv))
+	return nil
+}
+
+// recordPayment checks a payment request and records the payment on the
+// invoice.
+func recordPayment(inv *bill.Invoice, req PaymentRequest) error {
+	var v validation
+	payment := bill.Payment{
+		Date:      parseDate(&v, "date", req.Date),
+		Amount:    req.Amount,
+		Method:    req.Method,
+		Reference: req.Reference,
+		Currency:  req.Currency,
+		Rate:      req.Rate,
+	}
+	if payment.Method == "" {
+		payment.Method = "bank transfer"
+	}
+	if req.Amount <= 0 {
+		v.add("amount", "must be positive")
+	}
+	if req.Rate < 0 {
+		v.add("rate", "cannot be negative")
+	}
+	if req.Currency != "" && req.Currency != inv.Bill.Currency && req.Rate == 0 {
+		v.add("rate", "an exchange rate to %s is required for a payment in %s", inv.Bill.Currency, req.Currency)
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	if err := inv.AddPayment(payment, time.Now()); err != nil {
+		return errorf(http.StatusConflict, CodeConflict, "%v", err)
+	}
+	return bill.SaveInvoice(inv)
+}
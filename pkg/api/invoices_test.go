@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// useConfigDir keeps the invoice store of a test in a directory of its own.
+func useConfigDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	useConfigDir(t)
+	s := New("token", t.TempDir())
+	s.Template = bill.BillTemplate{CompanyName: "Muster GmbH", Currency: "EUR", VATRate: 19}
+	return s
+}
+
+// postInvoice creates an invoice of one line of quantity through the API.
+func postInvoice(t *testing.T, s *Server, quantity string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	body := `{"number": "INV-1", "to_company_name": "ACME", "format": "html",
+		"items": [{"description": "Consulting", "quantity": ` + quantity + `, "unit_price": 100}]}`
+	req := httptest.NewRequest(http.MethodPost, "/invoices", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	var out map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("%d response is not JSON: %s", rec.Code, rec.Body)
+	}
+	return rec, out
+}
+
+func storedInvoices(t *testing.T) int {
+	t.Helper()
+	invoices, err := bill.ListInvoices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(invoices)
+}
+
+func TestCreateInvoice(t *testing.T) {
+	s := newTestServer(t)
+	rec, out := postInvoice(t, s, "2.5")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if out["total"] != 297.5 || out["status"] != string(bill.StatusIssued) {
+		t.Errorf("created %v %v, want an issued invoice of 297.5", out["status"], out["total"])
+	}
+	if location := rec.Header().Get("Location"); location != "/invoices/INV-1" {
+		t.Errorf("Location = %q", location)
+	}
+}
+
+func TestCreateInvoiceQuantity(t *testing.T) {
+	for _, quantity := range []string{"0", "-1", "0.0001", "1e12"} {
+		t.Run(quantity, func(t *testing.T) {
+			s := newTestServer(t)
+			rec, out := postInvoice(t, s, quantity)
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), `"items[0].quantity"`) {
+				t.Errorf("error %v does not name items[0].quantity", out["error"])
+			}
+			if n := storedInvoices(t); n != 0 {
+				t.Errorf("%d invoices stored", n)
+			}
+		})
+	}
+}
+
+func TestSubmitFormQuantity(t *testing.T) {
+	for _, quantity := range []string{"NaN", "Inf", "-Inf", "1e12", "0,0001"} {
+		t.Run(quantity, func(t *testing.T) {
+			s := newTestServer(t)
+			form := url.Values{
+				"number":           {"INV-1"},
+				"company_name":     {"Muster GmbH"},
+				"to_company_name":  {"ACME"},
+				"currency":         {"EUR"},
+				"item_description": {"Consulting"},
+				"item_quantity":    {quantity},
+				"item_unit_price":  {"100"},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/ui/new", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: uiCookie, Value: "token"})
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+			}
+			if n := storedInvoices(t); n != 0 {
+				t.Errorf("%d invoices stored", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pathParameters describes the parameters of the route paths.
+var pathParameters = map[string]string{
+	"number": "invoice number, with any \"/\" escaped as %2F",
+	"name":   "client name, matched ignoring case",
+	"id":     "product ID",
+}
+
+// OpenAPI returns the OpenAPI 3.0 document of the API, generated from its
+// routes and the JSON tags of their request and response types.
+func (s *Server) OpenAPI() map[string]interface{} {
+	g := schemaGenerator{components: map[string]interface{}{}}
+	g.components["Error"] = g.schema(reflect.TypeOf(Error{}))
+
+	paths := map[string]interface{}{}
+	for _, rt := range s.routes {
+		op := map[string]interface{}{
+			"summary":     rt.Summary,
+			"operationId": operationID(rt),
+			"tags":        []string{rt.Tag},
+			"responses": map[string]interface{}{
+				strconv.Itoa(rt.Status): g.response(rt),
+				"default":               map[string]interface{}{"$ref": "#/components/responses/Error"},
+			},
+		}
+		if rt.Public {
+			op["security"] = []interface{}{}
+		}
+
+		var params []interface{}
+		for _, segment := range strings.Split(rt.Path, "/") {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				name := segment[1 : len(segment)-1]
+				params = append(params, map[string]interface{}{
+					"name": name, "in": "path", "required": true,
+					"description": pathParameters[name],
+					"schema":      map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		for _, q := range rt.Query {
+			params = append(params, map[string]interface{}{
+				"name": q.Name, "in": "query", "description": q.Description,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if rt.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(rt.Request))},
+				},
+			}
+		}
+
+		item, ok := paths[rt.Path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	version := s.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "bill",
+			"description": "Create invoices, render their documents, record payments and manage the clients and the catalog.",
+			"version":     version,
+		},
+		"paths":    paths,
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []string{}}},
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "Error, with the invalid fields of a request on 422",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type":       "object",
+								"required":   []string{"error"},
+								"properties": map[string]interface{}{"error": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *Server) openAPI(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	writeJSON(w, http.StatusOK, s.OpenAPI())
+	return nil
+}
+
+// operationID names an operation after its method and path, e.g.
+// getInvoicesNumberPdf.
+func operationID(rt route) string {
+	id := strings.ToLower(rt.Method)
+	for _, segment := range strings.Split(rt.Path, "/") {
+		segment = strings.Trim(segment, "{}")
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '.' || r == '_' || r == '-' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+// response describes the success response of a route: a JSON body, a
+// document of a media type, or none.
+func (g *schemaGenerator) response(rt route) map[string]interface{} {
+	out := map[string]interface{}{"description": http.StatusText(rt.Status)}
+	switch response := rt.Response.(type) {
+	case nil:
+	case string:
+		schema := map[string]interface{}{"type": "string"}
+		if response == "application/pdf" {
+			schema["format"] = "binary"
+		} else if response == "application/json" {
+			schema = map[string]interface{}{"type": "object"}
+		}
+		out["content"] = map[string]interface{}{response: map[string]interface{}{"schema": schema}}
+	default:
+		out["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(response))},
+		}
+	}
+	return out
+}
+
+// schemaGenerator derives JSON schemas from Go types the way encoding/json
+// marshals them. Named structs become components referenced by name.
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			// Reserve the name first, for types referring to themselves
+			g.components[t.Name()] = nil
+			g.components[t.Name()] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// object describes the JSON object of a struct. Fields without omitempty
+// are required, except those promoted from an embedded struct: in a
+// request they default to the values of the server template.
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	var walk func(t reflect.Type, embedded bool)
+	walk = func(t reflect.Type, embedded bool) {
+		var inner []reflect.StructField
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				inner = append(inner, field)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			// Outer fields shadow those of embedded structs
+			if _, ok := properties[name]; ok {
+				continue
+			}
+			properties[name] = g.schema(field.Type)
+			if !embedded && !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		for _, field := range inner {
+			walk(field.Type, true)
+		}
+	}
+	walk(t, false)
+
+	out := map[string]interface{}{"type": "object", "properties": properties}
+	if required != nil {
+		out["required"] = required
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// handlers lists the endpoints of the API. The OpenAPI document is
+// generated from this table, so a route added here is documented too.
+func (s *Server) handlers() []route {
+	statusQuery := parameter{Name: "status", Description: "only invoices with this status (draft, issued, sent, partially_paid, paid, void)"}
+	clientQuery := parameter{Name: "client", Description: "only invoices addressed to this client"}
+	formatQuery := parameter{Name: "format", Description: "ubl (the default), fatturapa, xrechnung or cii"}
+	profileQuery := parameter{Name: "profile", Description: "Factur-X profile of the cii format, en16931 by default"}
+
+	return []route{
+		{Method: http.MethodGet, Path: "/openapi.json", Summary: "The OpenAPI document of the API", Tag: "meta",
+			Response: "application/json", Status: http.StatusOK, Public: true, Handler: s.openAPI},
+
+		{Method: http.MethodGet, Path: "/invoices", Summary: "List the stored invoices", Tag: "invoices",
+			Query: []parameter{statusQuery, clientQuery}, Response: []Invoice{}, Status: http.StatusOK, Handler: s.listInvoices},
+		{Method: http.MethodPost, Path: "/invoices", Summary: "Create an invoice and write its document", Tag: "invoices",
+			Request: InvoiceRequest{}, Response: Invoice{}, Status: http.StatusCreated, Handler: s.createInvoice},
+		{Method: http.MethodGet, Path: "/invoices/{number}", Summary: "Get an invoice", Tag: "invoices",
+			Response: Invoice{}, Status: http.StatusOK, Handler: s.getInvoice},
+		{Method: http.MethodGet, Path: "/invoices/{number}/pdf", Summary: "Render an invoice as PDF", Tag: "invoices",
+			Response: "application/pdf", Status: http.StatusOK, Handler: s.renderPDF},
+		{Method: http.MethodGet, Path: "/invoices/{number}/html", Summary: "Render an invoice as HTML", Tag: "invoices",
+			Response: "text/html", Status: http.StatusOK, Handler: s.renderHTML},
+		{Method: http.MethodGet, Path: "/invoices/{number}/xml", Summary: "Export an invoice as an e-invoice", Tag: "invoices",
+			Query: []parameter{formatQuery, profileQuery}, Response: "application/xml", Status: http.StatusOK, Handler: s.renderXML},
+		{Method: http.MethodGet, Path: "/invoices/{number}/payments", Summary: "List the payments of an invoice", Tag: "payments",
+			Response: []bill.Payment{}, Status: http.StatusOK, Handler: s.listPayments},
+		{Method: http.MethodPost, Path: "/invoices/{number}/payments", Summary: "Record a payment", Tag: "payments",
+			Request: PaymentRequest{}, Response: Invoice{}, Status: http.StatusCreated, Handler: s.addPayment},
+
+		{Method: http.MethodGet, Path: "/clients", Summary: "List the clients", Tag: "clients",
+			Response: []bill.Client{}, Status: http.StatusOK, Handler: s.listClients},
+		{Method: http.MethodPost, Path: "/clients", Summary: "Add a client", Tag: "clients",
+			Request: bill.Client{}, Response: bill.Client{}, Status: http.StatusCreated, Handler: s.saveClient},
+		{Method: http.MethodGet, Path: "/clients/{name}", Summary: "Get a client", Tag: "clients",
+			Response: bill.Client{}, Status: http.StatusOK, Handler: s.getClient},
+		{Method: http.MethodPut, Path: "/clients/{name}", Summary: "Replace a client", Tag: "clients",
+			Request: bill.Client{}, Response: bill.Client{}, Status: http.StatusOK, Handler: s.saveClient},
+		{Method: http.MethodDelete, Path: "/clients/{name}", Summary: "Delete a client", Tag: "clients",
+			Status: http.StatusNoContent, Handler: s.deleteClient},
+
+		{Method: http.MethodGet, Path: "/catalog", Summary: "List the products of the catalog", Tag: "catalog",
+			Response: []bill.Product{}, Status: http.StatusOK, Handler: s.listProducts},
+		{Method: http.MethodPost, Path: "/catalog", Summary: "Add a product", Tag: "catalog",
+			Request: bill.Product{}, Response: bill.Product{}, Status: http.StatusCreated, Handler: s.saveProduct},
+		{Method: http.MethodGet, Path: "/catalog/{id}", Summary: "Get a product", Tag: "catalog",
+			Response: bill.Product{}, Status: http.StatusOK, Handler: s.getProduct},
+		{Method: http.MethodPut, Path: "/catalog/{id}", Summary: "Replace a product", Tag: "catalog",
+			Request: bill.Product{}, Response: bill.Product{}, Status: http.StatusOK, Handler: s.saveProduct},
+		{Method: http.MethodDelete, Path: "/catalog/{id}", Summary: "Delete a product", Tag: "catalog",
+			Status: http.StatusNoContent, Handler: s.deleteProduct},
+	}
+}
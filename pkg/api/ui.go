@@ -0,0 +1,647 @@
+package api
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+//go:embed ui/*.html
+var uiFiles embed.FS
+
+// uiCookie holds the token of a browser signed in to the UI.
+const uiCookie = "bill_token"
+
+// formRows is the number of blank item rows of a new invoice form.
+const formRows = 3
+
+var uiFuncs = template.FuncMap{
+	"money": func(amount float64, currency string) string {
+		return fmt.Sprintf("%.2f %s", amount, currency)
+	},
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(dateLayout)
+	},
+	"invoiceURL": func(number string) string {
+		return "/ui" + invoiceURL(number)
+	},
+	"status": func(status bill.Status) string {
+		return strings.ReplaceAll(string(status), "_", " ")
+	},
+	"quantity": func(item bill.BillItem, precision *int) string {
+		return bill.FormatQuantity(item.Quantity, item.Unit, precision)
+	},
+	"itemField": func(i int, field string) string {
+		return fmt.Sprintf("items[%d].%s", i, field)
+	},
+	"fieldError": func(errors map[string]string, field string) string {
+		return errors[field]
+	},
+}
+
+// uiPages holds a template per page, each drawn in the common layout.
+var uiPages = func() map[string]*template.Template {
+	pages := map[string]*template.Template{}
+	for _, name := range []string{"login", "history", "form", "invoice", "error"} {
+		pages[name] = template.Must(template.New("layout.html").Funcs(uiFuncs).
+			ParseFS(uiFiles, "ui/layout.html", "ui/"+name+".html"))
+	}
+	return pages
+}()
+
+// page is the data of a UI template.
+type page struct {
+	Title    string
+	SignedIn bool
+	Message  string // error banner
+	Errors   map[string]string
+	Data     interface{}
+}
+
+// uiHandlers lists the pages of the browser UI.
+func (s *Server) uiHandlers() []route {
+	return []route{
+		{Method: http.MethodGet, Path: "/ui", Handler: s.historyPage},
+		{Method: http.MethodGet, Path: "/ui/login", Public: true, Handler: s.loginPage},
+		{Method: http.MethodPost, Path: "/ui/login", Public: true, Handler: s.login},
+		{Method: http.MethodPost, Path: "/ui/logout", Public: true, Handler: s.logout},
+		{Method: http.MethodGet, Path: "/ui/new", Handler: s.formPage},
+		{Method: http.MethodPost, Path: "/ui/new", Handler: s.submitForm},
+		{Method: http.MethodGet, Path: "/ui/invoices/{number}", Handler: s.invoicePage},
+		{Method: http.MethodGet, Path: "/ui/invoices/{number}/pdf", Handler: s.downloadPDF},
+		{Method: http.MethodGet, Path: "/ui/invoices/{number}/html", Handler: s.renderHTML},
+		{Method: http.MethodPost, Path: "/ui/invoices/{number}/payments", Handler: s.submitPayment},
+	}
+}
+
+// signedIn checks the token cookie of a browser. Forms posted from another
+// site are refused: the cookie is SameSite=Strict, and the Origin header,
+// when sent, must be the server itself.
+func (s *Server) signedIn(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				return false
+			}
+		}
+	}
+	cookie, err := r.Cookie(uiCookie)
+	return err == nil && s.validToken(cookie.Value)
+}
+
+func renderPage(w http.ResponseWriter, status int, name string, p page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'unsafe-inline'; img-src 'self' data:")
+	w.WriteHeader(status)
+	if err := uiPages[name].Execute(w, p); err != nil {
+		log.Printf("ui: %s: %v", name, err)
+	}
+}
+
+// writePageError sends browsers that are not signed in to the login page
+// and shows other errors on a page of their own.
+func (s *Server) writePageError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		log.Printf("ui: %v", err)
+		apiErr = errorf(http.StatusInternalServerError, CodeInternal, "%v", err)
+	}
+	if apiErr.Status == http.StatusUnauthorized {
+		http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+		return
+	}
+	renderPage(w, apiErr.Status, "error", page{
+		Title:    http.StatusText(apiErr.Status),
+		SignedIn: s.signedIn(r),
+		Message:  apiErr.Message,
+	})
+}
+
+// fieldErrors indexes the invalid fields of a validation error, nil for
+// other errors.
+func fieldErrors(err error) map[string]string {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || len(apiErr.Fields) == 0 {
+		return nil
+	}
+	fields := map[string]string{}
+	for _, field := range apiErr.Fields {
+		if fields[field.Field] != "" {
+			fields[field.Field] += "; "
+		}
+		fields[field.Field] += field.Message
+	}
+	return fields
+}
+
+func (s *Server) loginPage(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	renderPage(w, http.StatusOK, "login", page{Title: "Sign in"})
+	return nil
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	if !s.validToken(r.PostFormValue("token")) {
+		renderPage(w, http.StatusUnauthorized, "login", page{Title: "Sign in", Message: "Wrong token"})
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     uiCookie,
+		Value:    s.Token,
+		Path:     "/ui",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/ui/", http.StatusSeeOther)
+	return nil
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	http.SetCookie(w, &http.Cookie{Name: uiCookie, Path: "/ui", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+	return nil
+}
+
+// historyData is the invoice history, filtered by status and client.
+type historyData struct {
+	Status   string
+	Client   string
+	Statuses []bill.Status
+	Invoices []bill.Invoice
+}
+
+func (s *Server) historyPage(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	data := historyData{
+		Status: r.URL.Query().Get("status"),
+		Client: strings.TrimSpace(r.URL.Query().Get("client")),
+		Statuses: []bill.Status{bill.StatusDraft, bill.StatusIssued, bill.StatusSent,
+			bill.StatusPartiallyPaid, bill.StatusPaid, bill.StatusVoid},
+	}
+	invoices, err := bill.ListInvoices()
+	if err != nil {
+		return err
+	}
+	for _, inv := range invoices {
+		if data.Status != "" && string(inv.Status) != data.Status {
+			continue
+		}
+		if data.Client != "" && !strings.Contains(strings.ToLower(inv.Bill.ToCompanyName), strings.ToLower(data.Client)) {
+			continue
+		}
+		data.Invoices = append(data.Invoices, inv)
+	}
+	renderPage(w, http.StatusOK, "history", page{Title: "Invoices", SignedIn: true, Data: data})
+	return nil
+}
+
+// invoiceForm holds the fields of the new invoice form as typed, with the
+// sections of the desktop form. The inputs are named after the JSON fields
+// of InvoiceRequest, so that validation errors land next to them.
+type invoiceForm struct {
+	Number      string
+	Date        string
+	PaymentDays string
+	Currency    string
+	PageSize    string
+	Orientation string
+
+	CompanyName string
+	Address     string
+	VATNumber   string
+	Country     string
+	PeppolID    string
+
+	Client         string
+	ToCompanyName  string
+	ToAddress      string
+	ToVATNumber    string
+	ToCountry      string
+	ToPeppolID     string
+	BuyerReference string
+
+	BitcoinAddress string
+	VATRate        string
+	VATCategory    string
+	VATMention     string
+	FacturX        string
+	PDFA           string
+	Sign           bool
+	Checkout       bool
+	Draft          bool
+
+	Items []itemForm
+}
+
+type itemForm struct {
+	Product     string
+	Description string
+	Quantity    string
+	Unit        string
+	UnitPrice   string
+	VATRate     string
+}
+
+func (i itemForm) blank() bool {
+	return i == itemForm{}
+}
+
+// formData is the data of the form page: the form and its choices.
+type formData struct {
+	Form         invoiceForm
+	Clients      []bill.Client
+	Products     []bill.Product
+	Units        []bill.Unit
+	PageSizes    []string
+	Orientations []string
+	Categories   []option
+	Profiles     []option
+	Levels       []option
+	CanSign      bool
+	CanCheckout  bool
+}
+
+type option struct {
+	Value string
+	Label string
+}
+
+// vatCategories pairs the VAT categories of lines without VAT with their
+// label, as in the desktop form.
+var vatCategories = []option{
+	{bill.VATExempt, "Exempt"},
+	{bill.VATReverseCharge, "Reverse charge"},
+	{bill.VATNotSubject, "Not subject to VAT"},
+	{bill.VATZeroRated, "Zero rated"},
+	{bill.VATIntraCommunity, "Intra-community supply"},
+	{bill.VATExportOutsideEU, "Export outside the EU"},
+}
+
+var facturXProfiles = []option{
+	{"", "None"},
+	{string(bill.FacturXMinimum), "Minimum"},
+	{string(bill.FacturXBasic), "Basic"},
+	{string(bill.FacturXEN16931), "EN 16931"},
+}
+
+var pdfaLevels = []option{
+	{"", "None"},
+	{string(bill.PDFA1b), "PDF/A-1b"},
+	{string(bill.PDFA3b), "PDF/A-3b"},
+}
+
+// formatNumber prints a number of the template for an input, empty when
+// zero.
+func formatNumber(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// newForm returns a form holding the server template.
+func (s *Server) newForm() invoiceForm {
+	t := s.Template
+	f := invoiceForm{
+		Date:           time.Now().Format(dateLayout),
+		Currency:       t.Currency,
+		PageSize:       t.PageSize,
+		Orientation:    t.Orientation,
+		CompanyName:    t.CompanyName,
+		Address:        t.Address,
+		VATNumber:      t.VATNumber,
+		Country:        t.Country,
+		PeppolID:       t.PeppolID,
+		ToCompanyName:  t.ToCompanyName,
+		ToAddress:      t.ToAddress,
+		ToVATNumber:    t.ToVATNumber,
+		ToCountry:      t.ToCountry,
+		ToPeppolID:     t.ToPeppolID,
+		BuyerReference: t.BuyerReference,
+		BitcoinAddress: t.BitcoinAddress,
+		VATRate:        formatNumber(t.VATRate),
+		VATCategory:    t.VATCategory,
+		VATMention:     t.VATExemptionReason,
+	}
+	if t.PaymentDays > 0 {
+		f.PaymentDays = strconv.Itoa(t.PaymentDays)
+	}
+	for _, item := range t.Items {
+		f.Items = append(f.Items, itemForm{
+			Description: item.Description,
+			Quantity:    formatNumber(item.Quantity),
+			Unit:        string(item.Unit),
+			UnitPrice:   formatNumber(item.UnitPrice),
+			VATRate:     formatNumber(item.VATRate),
+		})
+	}
+	return f
+}
+
+// parseForm reads a posted form, dropping the blank item rows.
+func parseForm(r *http.Request) invoiceForm {
+	value := func(name string) string {
+		return strings.TrimSpace(r.PostFormValue(name))
+	}
+	f := invoiceForm{
+		Number:         value("number"),
+		Date:           value("date"),
+		PaymentDays:    value("payment_days"),
+		Currency:       value("currency"),
+		PageSize:       value("page_size"),
+		Orientation:    value("orientation"),
+		CompanyName:    value("company_name"),
+		Address:        value("address"),
+		VATNumber:      value("vat_number"),
+		Country:        value("country"),
+		PeppolID:       value("peppol_id"),
+		Client:         value("client"),
+		ToCompanyName:  value("to_company_name"),
+		ToAddress:      value("to_address"),
+		ToVATNumber:    value("to_vat_number"),
+		ToCountry:      value("to_country"),
+		ToPeppolID:     value("to_peppol_id"),
+		BuyerReference: value("buyer_reference"),
+		BitcoinAddress: value("bitcoin_address"),
+		VATRate:        value("vat_rate"),
+		VATCategory:    value("vat_category"),
+		VATMention:     value("vat_exemption_reason"),
+		FacturX:        value("facturx"),
+		PDFA:           value("pdfa"),
+		Sign:           r.PostFormValue("sign") != "",
+		Checkout:       r.PostFormValue("checkout") != "",
+		Draft:          r.PostFormValue("draft") != "",
+	}
+
+	column := func(name string, i int) string {
+		values := r.PostForm["item_"+name]
+		if i < len(values) {
+			return strings.TrimSpace(values[i])
+		}
+		return ""
+	}
+	for i := range r.PostForm["item_description"] {
+		item := itemForm{
+			Product:     column("product", i),
+			Description: column("description", i),
+			Quantity:    column("quantity", i),
+			Unit:        column("unit", i),
+			UnitPrice:   column("unit_price", i),
+			VATRate:     column("vat_rate", i),
+		}
+		if !item.blank() {
+			f.Items = append(f.Items, item)
+		}
+	}
+	return f
+}
+
+// fillClient sets the details of a client from the client list, as the
+// template of that client would.
+func (f *invoiceForm) fillClient(client bill.Client) {
+	f.ToCompanyName = client.Name
+	f.ToAddress = client.Address
+	f.ToVATNumber = client.VATNumber
+	f.ToCountry = client.Country
+	f.ToPeppolID = client.PeppolID
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{client.BuyerReference, &f.BuyerReference},
+		{client.Currency, &f.Currency},
+		{client.PageSize, &f.PageSize},
+		{client.Orientation, &f.Orientation},
+		{client.VATCategory, &f.VATCategory},
+		{client.ExemptionReason, &f.VATMention},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	if client.PaymentDays > 0 {
+		f.PaymentDays = strconv.Itoa(client.PaymentDays)
+	}
+}
+
+// parseNumber reads a number typed in the form, with a decimal point or
+// comma.
+func parseNumber(v *validation, field, s string) float64 {
+	if s == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		v.add(field, "expected a number")
+		return 0
+	}
+	return f
+}
+
+// request converts the form to a creation request over req, which holds
+// the server template and the selected client.
+func (f invoiceForm) request(req *InvoiceRequest, v *validation) {
+	t := &req.BillTemplate
+	t.Currency = f.Currency
+	t.PageSize = f.PageSize
+	t.Orientation = f.Orientation
+	t.CompanyName = f.CompanyName
+	t.Address = f.Address
+	t.VATNumber = f.VATNumber
+	t.Country = f.Country
+	t.PeppolID = f.PeppolID
+	t.ToCompanyName = f.ToCompanyName
+	t.ToAddress = f.ToAddress
+	t.ToVATNumber = f.ToVATNumber
+	t.ToCountry = f.ToCountry
+	t.ToPeppolID = f.ToPeppolID
+	t.BuyerReference = f.BuyerReference
+	t.BitcoinAddress = f.BitcoinAddress
+	t.VATRate = parseNumber(v, "vat_rate", f.VATRate)
+	t.VATCategory = f.VATCategory
+	t.VATExemptionReason = f.VATMention
+	t.PaymentDays = int(parseNumber(v, "payment_days", f.PaymentDays))
+
+	req.Number = f.Number
+	req.Date = f.Date
+	req.FacturX = f.FacturX
+	req.PDFA = f.PDFA
+	req.Sign = f.Sign
+	req.Checkout = f.Checkout
+	req.Draft = f.Draft
+	req.Items = nil
+	for i, item := range f.Items {
+		line := ItemRequest{
+			Product:     item.Product,
+			Description: item.Description,
+			Quantity:    parseNumber(v, fmt.Sprintf("items[%d].quantity", i), item.Quantity),
+			Unit:        item.Unit,
+		}
+		if item.UnitPrice != "" {
+			price := parseNumber(v, fmt.Sprintf("items[%d].unit_price", i), item.UnitPrice)
+			line.UnitPrice = &price
+		}
+		if item.VATRate != "" {
+			rate := parseNumber(v, fmt.Sprintf("items[%d].vat_rate", i), item.VATRate)
+			line.VATRate = &rate
+		}
+		req.Items = append(req.Items, line)
+	}
+}
+
+// renderForm shows the form with blank rows to add items.
+func (s *Server) renderForm(w http.ResponseWriter, status int, f invoiceForm, message string, fields map[string]string) error {
+	data := formData{
+		Form:         f,
+		Units:        bill.Units,
+		PageSizes:    bill.PageSizes(),
+		Orientations: bill.Orientations(),
+		Categories:   vatCategories,
+		Profiles:     facturXProfiles,
+		Levels:       pdfaLevels,
+		CanSign:      s.Signature != nil,
+		CanCheckout:  s.Checkout != nil,
+	}
+	for i := 0; i < formRows; i++ {
+		data.Form.Items = append(data.Form.Items, itemForm{})
+	}
+	var err error
+	if data.Clients, err = bill.LoadClients(); err != nil {
+		return err
+	}
+	if data.Products, err = bill.LoadCatalog(); err != nil {
+		return err
+	}
+	renderPage(w, status, "form", page{Title: "New invoice", SignedIn: true, Message: message, Errors: fields, Data: data})
+	return nil
+}
+
+func (s *Server) formPage(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	return s.renderForm(w, http.StatusOK, s.newForm(), "", nil)
+}
+
+// submitForm creates the invoice of the form, or fills the form with the
+// selected client or more item rows depending on the button pressed.
+func (s *Server) submitForm(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	if err := r.ParseForm(); err != nil {
+		return errorf(http.StatusBadRequest, CodeBadRequest, "%v", err)
+	}
+	f := parseForm(r)
+
+	var client *bill.Client
+	if f.Client != "" {
+		clients, err := bill.LoadClients()
+		if err != nil {
+			return err
+		}
+		if i := bill.FindClient(clients, f.Client); i >= 0 {
+			client = &clients[i]
+		}
+	}
+	switch r.PostFormValue("action") {
+	case "client":
+		if client == nil {
+			return s.renderForm(w, http.StatusUnprocessableEntity, f, "", map[string]string{"client": "pick a client of the client list"})
+		}
+		f.fillClient(*client)
+		return s.renderForm(w, http.StatusOK, f, "", nil)
+	case "rows":
+		return s.renderForm(w, http.StatusOK, f, "", nil)
+	}
+
+	// A client picked without filling the form still provides the details
+	if client != nil && f.ToCompanyName == "" {
+		f.fillClient(*client)
+	}
+	var v validation
+	req, err := s.newRequest(f.Client, &v)
+	if err != nil {
+		return err
+	}
+	f.request(&req, &v)
+	inv, err := s.create(&req, v)
+	if err != nil {
+		if fields := fieldErrors(err); fields != nil {
+			return s.renderForm(w, http.StatusUnprocessableEntity, f, "Please correct the fields below", fields)
+		}
+		var apiErr *Error
+		if errors.As(err, &apiErr) {
+			return s.renderForm(w, apiErr.Status, f, apiErr.Message, nil)
+		}
+		return err
+	}
+	http.Redirect(w, r, "/ui"+invoiceURL(inv.Bill.Number), http.StatusSeeOther)
+	return nil
+}
+
+// invoiceData is the data of the invoice page.
+type invoiceData struct {
+	Invoice *bill.Invoice
+	Payment PaymentRequest
+}
+
+func (s *Server) renderInvoice(w http.ResponseWriter, status int, inv *bill.Invoice, payment PaymentRequest, message string, fields map[string]string) {
+	if payment.Date == "" {
+		payment.Date = time.Now().Format(dateLayout)
+	}
+	renderPage(w, status, "invoice", page{
+		Title:    inv.Bill.Number,
+		SignedIn: true,
+		Message:  message,
+		Errors:   fields,
+		Data:     invoiceData{Invoice: inv, Payment: payment},
+	})
+}
+
+func (s *Server) invoicePage(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	inv, err := bill.LoadInvoice(params["number"])
+	if err != nil {
+		return notFound(err)
+	}
+	s.renderInvoice(w, http.StatusOK, inv, PaymentRequest{}, "", nil)
+	return nil
+}
+
+func (s *Server) downloadPDF(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	return s.serveRendered(w, params, ".pdf", "application/pdf", "attachment")
+}
+
+func (s *Server) submitPayment(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	inv, err := bill.LoadInvoice(params["number"])
+	if err != nil {
+		return notFound(err)
+	}
+	var v validation
+	req := PaymentRequest{
+		Date:      strings.TrimSpace(r.PostFormValue("date")),
+		Amount:    parseNumber(&v, "amount", strings.TrimSpace(r.PostFormValue("amount"))),
+		Method:    strings.TrimSpace(r.PostFormValue("method")),
+		Reference: strings.TrimSpace(r.PostFormValue("reference")),
+	}
+	err = v.err()
+	if err == nil {
+		err = recordPayment(inv, req)
+	}
+	if err != nil {
+		var apiErr *Error
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+		s.renderInvoice(w, apiErr.Status, inv, req, apiErr.Message, fieldErrors(err))
+		return nil
+	}
+	http.Redirect(w, r, "/ui"+invoiceURL(inv.Bill.Number), http.StatusSeeOther)
+	return nil
+}
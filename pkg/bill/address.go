@@ -0,0 +1,36 @@
+package bill
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PostalAddress is a free-form address split into the parts structured
+// invoices ask for.
+type PostalAddress struct {
+	Lines    []string
+	Postcode string
+	City     string
+}
+
+// postcodeCity matches the last address line, e.g. "75001 Paris".
+var postcodeCity = regexp.MustCompile(`^(\S*\d\S*)\s+(.+)$`)
+
+// ParseAddress splits an address on new lines and commas, reading the
+// postcode and city from the last line.
+func ParseAddress(address string) PostalAddress {
+	var parsed PostalAddress
+	for _, line := range strings.FieldsFunc(address, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if line = strings.TrimSpace(line); line != "" {
+			parsed.Lines = append(parsed.Lines, line)
+		}
+	}
+
+	if len(parsed.Lines) > 0 {
+		if m := postcodeCity.FindStringSubmatch(parsed.Lines[len(parsed.Lines)-1]); m != nil {
+			parsed.Postcode, parsed.City = m[1], m[2]
+			parsed.Lines = parsed.Lines[:len(parsed.Lines)-1]
+		}
+	}
+	return parsed
+}
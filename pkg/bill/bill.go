@@ -2,8 +2,11 @@ package bill
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -16,22 +19,97 @@ import (
 type Bill struct {
 	Number         string
 	Date           time.Time
+	DueDate        time.Time
 	CompanyName    string
 	Address        string
 	VATNumber      string
+	Country        string
 	ToCompanyName  string
 	ToAddress      string
 	ToVATNumber    string
+	ToCountry      string
 	Items          []BillItem
 	Total          float64
 	Currency       string
 	BitcoinAddress string
+
+	// BuyerReference is the reference the client asked to quote, such as a
+	// purchase order number. PeppolID and ToPeppolID are the electronic
+	// addresses of both parties as "scheme:identifier", e.g.
+	// "0208:0123456789".
+	BuyerReference string
+	PeppolID       string
+	ToPeppolID     string
+
+	// Italian e-invoicing (FatturaPA): codici fiscali, the seller tax regime
+	// (RF01 when empty) and where the exchange system delivers the invoice,
+	// a recipient code (codice destinatario) or a PEC address.
+	FiscalCode      string
+	TaxRegime       string
+	ToFiscalCode    string
+	ToRecipientCode string
+	ToPEC           string
+
+	// XRechnung (German public sector): the Leitweg-ID routing the invoice
+	// to the client authority, written as the buyer reference, and the
+	// seller contact point the format requires.
+	ToLeitwegID  string
+	ContactName  string
+	ContactPhone string
+	ContactEmail string
+
+	// VATCategory is the category of lines without VAT (see VATExempt and
+	// the other constants) and VATExemptionReason the mention printed for
+	// them, e.g. "Reverse charge".
+	VATCategory        string
+	VATExemptionReason string
+
+	// QuantityPrecision is the number of decimals shown on quantities,
+	// nil meaning DefaultQuantityPrecision and 0 whole units.
+	QuantityPrecision *int `json:"QuantityDecimals,omitempty"`
+
+	// PageSize (A4, Letter, Legal or A5) and Orientation (portrait or
+	// landscape) of the PDF, empty meaning A4 portrait.
+	PageSize    string
+	Orientation string
+
+	// CreditNoteFor is the number of the invoice cancelled by this bill,
+	// empty for regular invoices.
+	CreditNoteFor string
+
+	// Checkout is the invoice opened at a payment provider for the bill,
+	// if any, shown in the payment section.
+	Checkout *Checkout `json:",omitempty"`
+
+	// PaymentMethods are the other ways to pay the bill, each drawn as a
+	// section of the payment part after the Bitcoin address.
+	PaymentMethods PaymentMethodList `json:",omitempty"`
+}
+
+// UnmarshalJSON reads a bill, including those saved before whole units could
+// be chosen, whose QuantityPrecision of 0 meant the default.
+func (b *Bill) UnmarshalJSON(data []byte) error {
+	type plain Bill
+	var v struct {
+		plain
+		LegacyPrecision int `json:"QuantityPrecision"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = Bill(v.plain)
+	if b.QuantityPrecision == nil && v.LegacyPrecision > 0 {
+		b.QuantityPrecision = &v.LegacyPrecision
+	}
+	return nil
 }
 
 type BillItem struct {
 	Description string
-	Quantity    int
+	Quantity    float64
+	Unit        Unit
 	UnitPrice   float64
+	VATRate     float64
 	Total       float64
 }
 
@@ -39,210 +117,236 @@ type BillTemplate struct {
 	CompanyName    string         `json:"company_name"`
 	Address        string         `json:"address"`
 	VATNumber      string         `json:"vat_number"`
+	Country        string         `json:"country,omitempty"`
 	ToCompanyName  string         `json:"to_company_name"`
 	ToAddress      string         `json:"to_address"`
 	ToVATNumber    string         `json:"to_vat_number"`
+	ToCountry      string         `json:"to_country,omitempty"`
 	BitcoinAddress string         `json:"bitcoin_address"`
 	Currency       string         `json:"currency"`
 	Items          []TemplateItem `json:"items"`
+
+	BuyerReference     string  `json:"buyer_reference,omitempty"`
+	PeppolID           string  `json:"peppol_id,omitempty"`
+	ToPeppolID         string  `json:"to_peppol_id,omitempty"`
+	FiscalCode         string  `json:"fiscal_code,omitempty"`
+	TaxRegime          string  `json:"tax_regime,omitempty"`
+	ToFiscalCode       string  `json:"to_fiscal_code,omitempty"`
+	ToRecipientCode    string  `json:"to_recipient_code,omitempty"`
+	ToPEC              string  `json:"to_pec,omitempty"`
+	ToLeitwegID        string  `json:"to_leitweg_id,omitempty"`
+	ContactName        string  `json:"contact_name,omitempty"`
+	ContactPhone       string  `json:"contact_phone,omitempty"`
+	ContactEmail       string  `json:"contact_email,omitempty"`
+	QuantityPrecision  *int    `json:"quantity_precision,omitempty"`
+	PageSize           string  `json:"page_size,omitempty"`
+	Orientation        string  `json:"orientation,omitempty"`
+	HourlyRate         float64 `json:"hourly_rate,omitempty"`
+	VATRate            float64 `json:"vat_rate,omitempty"`
+	VATCategory        string  `json:"vat_category,omitempty"`
+	VATExemptionReason string  `json:"vat_exemption_reason,omitempty"`
+
+	// PaymentDays sets the due date this many days after the invoice date.
+	PaymentDays int `json:"payment_days,omitempty"`
+
+	// PaymentMethods are offered next to the Bitcoin address, e.g.
+	// [{"type": "sepa", "account_holder": "ACME", "iban": "DE89..."}].
+	PaymentMethods PaymentMethodList `json:"payment_methods,omitempty"`
 }
 
 type TemplateItem struct {
 	Description string  `json:"description"`
-	Quantity    int     `json:"quantity"`
+	Quantity    float64 `json:"quantity"`
+	Unit        Unit    `json:"unit,omitempty"`
 	UnitPrice   float64 `json:"unit_price"`
+	VATRate     float64 `json:"vat_rate,omitempty"`
 }
 
-func generateQRCode(address string) string {
-	qrFile := "bitcoin_qr.png"
-	err := qrcode.WriteFile(fmt.Sprintf("bitcoin:%s", address), qrcode.Medium, 256, qrFile)
+// writeQRCode writes the QR code of content to a temporary file for the
+// PDF, returning the file name or "" on error. Each code gets its own file
+// since the PDF caches images by name.
+func writeQRCode(content string) string {
+	f, err := os.CreateTemp("", "bill_qr_*.png")
+	if err == nil {
+		f.Close()
+		err = qrcode.WriteFile(content, qrcode.Medium, 256, f.Name())
+	}
 	if err != nil {
 		fmt.Printf("Error generating QR code: %v\n", err)
 		return ""
 	}
-	return qrFile
+	return f.Name()
+}
+
+// PDFOptions tunes the output of GeneratePDFWithOptions.
+type PDFOptions struct {
+	// Watermark is stamped diagonally across every page, e.g. "DRAFT".
+	Watermark string
+
+	// Payments already received, shown as a paid and balance due block
+	// under the total.
+	Payments []Payment
+
+	// FacturX embeds the Cross-Industry-Invoice XML of the bill at this
+	// profile, producing a PDF/A-3 Factur-X / ZUGFeRD invoice.
+	FacturX FacturXProfile
+
+	// Layout is the path of a JSON layout file, the built-in layout being
+	// used when empty.
+	Layout string
+
+	// PDFA produces an archival PDF/A file at this level, with embedded
+	// fonts and checked with CheckPDFA. Factur-X invoices are always
+	// PDF/A-3b.
+	PDFA PDFAConformance
+
+	// Signature digitally signs the PDF once complete.
+	Signature *Signature
+}
+
+func drawWatermark(pdf *gofpdf.Fpdf, text string) {
+	width, height := pdf.GetPageSize()
+	x, y := pdf.GetXY()
+
+	// Sized for A4 and shrunk on narrower pages
+	pdf.SetFont("Helvetica", "B", 96*math.Min(1, math.Min(width, height)/210))
+	pdf.SetTextColor(230, 236, 242)
+	textWidth := pdf.GetStringWidth(text)
+
+	pdf.TransformBegin()
+	pdf.TransformRotate(45, width/2, height/2)
+	pdf.Text((width-textWidth)/2, height/2+12, text)
+	pdf.TransformEnd()
+
+	pdf.SetXY(x, y)
 }
 
 func GeneratePDF(bill Bill, outputPath string) error {
-	pdf := gofpdf.New("P", "mm", "A4", "")
+	return GeneratePDFWithOptions(bill, outputPath, PDFOptions{})
+}
+
+func GeneratePDFWithOptions(bill Bill, outputPath string, opts PDFOptions) error {
+	title := "INVOICE"
+	if bill.CreditNoteFor != "" {
+		title = "CREDIT NOTE"
+	}
+	return generatePDF(layoutData{Bill: bill, Title: title}, outputPath, opts)
+}
+
+// generatePDF draws the layout with the given data, the bill and the texts
+// around it.
+func generatePDF(content layoutData, outputPath string, opts PDFOptions) error {
+	bill := content.Bill
+	conformance := opts.PDFA
+	var invoiceXML []byte
+	if opts.FacturX != "" {
+		if conformance == PDFA1b {
+			return fmt.Errorf("factur-x invoices are PDF/A-3, not PDF/A-1")
+		}
+		conformance = PDFA3b
+
+		var err error
+		if invoiceXML, err = FacturXML(bill, opts.FacturX); err != nil {
+			return fmt.Errorf("factur-x: %w", err)
+		}
+	}
+
+	layout, err := LoadLayout(opts.Layout)
+	if err != nil {
+		return err
+	}
+
+	orientation, size, err := pageFormat(bill)
+	if err != nil {
+		return err
+	}
+	pdf := gofpdf.New(orientation, "mm", size, "")
+	pdf.SetMargins(layout.margin(), layout.margin(), layout.margin())
 
 	// Enable UTF-8 encoding
+	var tr func(string) string
+	if conformance != "" {
+		if err := embedPDFAFonts(pdf); err != nil {
+			return err
+		}
+		tr = func(s string) string { return s }
+	} else {
+		tr = pdf.UnicodeTranslatorFromDescriptor("") // Create UTF-8 translator
+	}
 	pdf.SetFont("Helvetica", "", 10)
-	tr := pdf.UnicodeTranslatorFromDescriptor("") // Create UTF-8 translator
+
+	// Watermark is drawn first so the content stays on top of it
+	if opts.Watermark != "" {
+		pdf.SetHeaderFunc(func() {
+			drawWatermark(pdf, opts.Watermark)
+		})
+	}
 
 	pdf.AddPage()
 
-	// Add colors
-	pdf.SetDrawColor(28, 72, 107)   // Dark blue for lines
-	pdf.SetFillColor(240, 248, 255) // Light blue for header backgrounds
-	pdf.SetTextColor(28, 72, 107)   // Dark blue for text
-
-	// Header section
-	pdf.SetFont("Helvetica", "B", 24)
-	pdf.CellFormat(190, 10, "INVOICE", "", 0, "", false, 0, "")
-	pdf.Ln(12)
-
-	// Invoice number and Date section - Moved above separator
-	pdf.SetTextColor(28, 72, 107)
-	pdf.SetFont("Helvetica", "B", 10)
-	pdf.CellFormat(15, 8, "No.", "", 0, "", false, 0, "")
-	pdf.SetFont("Helvetica", "I", 10)
-	pdf.CellFormat(40, 8, bill.Number, "", 0, "", false, 0, "")
-	pdf.SetX(110)
-	pdf.SetFont("Helvetica", "B", 10)
-	pdf.CellFormat(15, 8, "Date", "", 0, "", false, 0, "")
-	pdf.SetFont("Helvetica", "I", 10)
-	pdf.CellFormat(90, 8, "  "+bill.Date.Format("January 2, 2006"), "", 0, "", false, 0, "")
-	pdf.Ln(12)
-
-	// Add line under everything
-	pdf.SetLineWidth(0.5)
-	pdf.Line(10, pdf.GetY(), 200, pdf.GetY())
-	pdf.Ln(15)
-
-	// Company details in two columns
-	pdf.SetFont("Helvetica", "B", 12)
-	leftCol := 10.0
-	rightCol := 110.0
-	startY := pdf.GetY() // Store the starting Y position
-
-	// Left column - From (Your company)
-	pdf.SetFillColor(28, 72, 107)
-	pdf.Rect(leftCol, startY, 90, 8, "F")
-	pdf.SetTextColor(255, 255, 255)
-	pdf.SetXY(leftCol+5, startY+2)
-	pdf.SetFont("Helvetica", "B", 11)
-	pdf.CellFormat(80, 4, "FROM", "", 0, "", false, 0, "")
-
-	// Company details section - Increased gap after header
-	pdf.SetFillColor(240, 248, 255)
-	pdf.Rect(leftCol, startY+10, 90, 40, "F")
-	pdf.SetTextColor(28, 72, 107)
-
-	// Company Name - Adjusted Y positions
-	pdf.SetXY(leftCol+5, startY+12)
-	pdf.SetFont("Helvetica", "B", 12)
-	pdf.CellFormat(80, 6, tr(bill.CompanyName), "", 0, "", false, 0, "")
-
-	// Address - Adjusted Y positions
-	pdf.SetFont("Helvetica", "", 10)
-	pdf.SetXY(leftCol+5, startY+19)
-	pdf.MultiCell(80, 5, tr(bill.Address), "", "", false)
+	renderer := &layoutRenderer{
+		layout: layout,
+		pdf:    pdf,
+		tr:     tr,
+		data:   content,
+		opts:   opts,
+	}
+	if err := renderer.draw(); err != nil {
+		return err
+	}
 
-	// VAT Number - Adjusted Y positions
-	pdf.SetXY(leftCol+5, startY+39)
-	pdf.SetFont("Helvetica", "", 10)
-	pdf.CellFormat(80, 6, tr(bill.VATNumber), "", 0, "", false, 0, "")
-
-	// Right column - TO section
-	pdf.SetFillColor(28, 72, 107)
-	pdf.Rect(rightCol, startY, 90, 8, "F")
-	pdf.SetTextColor(255, 255, 255)
-	pdf.SetXY(rightCol+5, startY+2)
-	pdf.SetFont("Helvetica", "B", 11)
-	pdf.CellFormat(80, 4, "TO", "", 0, "", false, 0, "")
-
-	// TO Details section
-	pdf.SetFillColor(240, 248, 255)
-	pdf.Rect(rightCol, startY+10, 90, 40, "F")
-	pdf.SetTextColor(28, 72, 107)
-
-	// Recipient Company Name
-	pdf.SetXY(rightCol+5, startY+12)
-	pdf.SetFont("Helvetica", "B", 12)
-	pdf.CellFormat(80, 6, tr(bill.ToCompanyName), "", 0, "", false, 0, "")
-
-	// Recipient Address
-	pdf.SetFont("Helvetica", "", 10)
-	pdf.SetXY(rightCol+5, startY+19)
-	pdf.MultiCell(80, 5, tr(bill.ToAddress), "", "", false)
+	signedAt := time.Now()
+	var box *signatureBox
+	if opts.Signature != nil && opts.Signature.Visible {
+		box = drawSignatureBox(pdf, tr, opts.Signature, renderer.bottom, signedAt)
+	}
 
-	// Recipient VAT Number
-	pdf.SetXY(rightCol+5, startY+39)
-	pdf.SetFont("Helvetica", "", 10)
-	pdf.CellFormat(80, 6, tr(bill.ToVATNumber), "", 0, "", false, 0, "")
-
-	// Move to next section
-	pdf.SetXY(10, startY+59)
-
-	// Items table header
-	pdf.SetFillColor(28, 72, 107)
-	pdf.SetTextColor(255, 255, 255)
-	pdf.SetFont("Helvetica", "B", 11)
-
-	pdf.Rect(10, pdf.GetY(), 190, 10, "F")
-	pdf.CellFormat(90, 10, "  Description", "", 0, "", false, 0, "")
-	pdf.CellFormat(30, 10, "Quantity", "", 0, "", false, 0, "")
-	pdf.CellFormat(35, 10, "Unit Price", "", 0, "", false, 0, "")
-	pdf.CellFormat(35, 10, "Total", "", 0, "", false, 0, "")
-	pdf.Ln(10)
-
-	// Table contents
-	pdf.SetTextColor(28, 72, 107)
-	pdf.SetFont("Helvetica", "", 11)
-
-	alternate := false
-	for _, item := range bill.Items {
-		if alternate {
-			pdf.SetFillColor(240, 248, 255)
-			pdf.Rect(10, pdf.GetY(), 190, 10, "F")
+	// The Swiss QR-bill goes under everything else, on the last page
+	slip, err := qrBillFor(content, opts)
+	if err != nil {
+		return err
+	}
+	if slip != nil {
+		bottom := renderer.bottom
+		if box != nil {
+			_, height := pdf.GetPageSize()
+			bottom = height - box.bottom*25.4/72
+		}
+		if err := drawQRBill(pdf, tr, slip, bottom); err != nil {
+			return err
+		}
+	}
+
+	if conformance == "" && opts.Signature == nil {
+		return pdf.OutputFileAndClose(outputPath)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if conformance != "" {
+		if invoiceXML != nil {
+			data, err = embedFacturX(data, bill, opts.FacturX, invoiceXML)
+		} else {
+			data, err = archivePDF(data, bill, conformance)
+		}
+		if err != nil {
+			return err
+		}
+		if problems := CheckPDFA(data); len(problems) > 0 {
+			return fmt.Errorf("PDF/A-%s check failed: %w", conformance, errors.Join(problems...))
+		}
+	}
+
+	// Signing comes last: any later change would break the signature
+	if opts.Signature != nil {
+		if data, err = signPDF(data, opts.Signature, box, signedAt); err != nil {
+			return fmt.Errorf("signing: %w", err)
 		}
-		pdf.SetX(10)
-		pdf.CellFormat(90, 10, "  "+tr(item.Description), "", 0, "", false, 0, "")
-		pdf.CellFormat(30, 10, fmt.Sprintf("%d", item.Quantity), "", 0, "", false, 0, "")
-		pdf.CellFormat(35, 10, tr(fmt.Sprintf("%.2f %s", item.UnitPrice, bill.Currency)), "", 0, "", false, 0, "")
-		pdf.CellFormat(35, 10, tr(fmt.Sprintf("%.2f %s", item.Total, bill.Currency)), "", 0, "", false, 0, "")
-		pdf.Ln(10)
-		alternate = !alternate
-	}
-
-	// Total section
-	pdf.Ln(15)
-	pdf.SetLineWidth(0.2)
-	pdf.Line(120, pdf.GetY(), 200, pdf.GetY())
-	pdf.Ln(8)
-
-	pdf.SetTextColor(28, 72, 107)
-	pdf.SetFont("Helvetica", "B", 14)
-	pdf.SetX(120)
-	pdf.CellFormat(50, 10, "TOTAL", "", 0, "", false, 0, "")
-	pdf.SetX(170)
-	pdf.CellFormat(30, 10, tr(fmt.Sprintf("%.2f %s", bill.Total, bill.Currency)), "", 0, "", false, 0, "")
-
-	// Bitcoin Payment Section
-	pdf.Ln(25)
-	pdf.SetFillColor(240, 248, 255)
-	pdf.SetTextColor(28, 72, 107)
-	pdf.Rect(10, pdf.GetY(), 190, 50, "F")
-
-	pdf.SetFont("Helvetica", "B", 12)
-	pdf.SetX(15)
-	pdf.CellFormat(180, 10, "Bitcoin Payment Details", "", 0, "", false, 0, "")
-	pdf.Ln(10)
-
-	qrFile := generateQRCode(bill.BitcoinAddress)
-	if qrFile != "" {
-		pdf.Image(qrFile, 15, pdf.GetY(), 30, 30, false, "", 0, "")
-		defer os.Remove(qrFile)
-	}
-
-	pdf.SetFillColor(255, 255, 255)
-	pdf.Rect(50, pdf.GetY(), 140, 8, "F")
-	pdf.SetX(50)
-	pdf.SetFont("Courier", "", 8)
-	pdf.SetTextColor(0, 0, 0)
-	pdf.CellFormat(140, 8, "  "+bill.BitcoinAddress, "", 0, "", false, 0, "")
-
-	pdf.Ln(10)
-	pdf.SetX(50)
-	pdf.SetFont("Helvetica", "I", 8)
-	pdf.SetTextColor(28, 72, 107)
-	pdf.CellFormat(140, 6, "Please scan the QR code or copy the address above to make your payment", "", 0, "", false, 0, "")
-
-	pdf.SetY(275)
-	pdf.SetTextColor(128, 128, 128)
-
-	return pdf.OutputFileAndClose(outputPath)
+	}
+	return os.WriteFile(outputPath, data, 0644)
 }
 
 func readString(reader *bufio.Reader, prompt string) string {
@@ -262,10 +366,21 @@ func readFloat(reader *bufio.Reader, prompt string) float64 {
 	}
 }
 
-func readInt(reader *bufio.Reader, prompt string) int {
+func readStringWithDefault(reader *bufio.Reader, prompt, defaultValue string) string {
+	input := readString(reader, fmt.Sprintf("%s [%s]: ", prompt, defaultValue))
+	if input == "" {
+		return defaultValue
+	}
+	return input
+}
+
+func readFloatWithDefault(reader *bufio.Reader, prompt string, defaultValue float64) float64 {
 	for {
-		input := readString(reader, prompt)
-		value, err := strconv.Atoi(input)
+		input := readString(reader, fmt.Sprintf("%s [%g]: ", prompt, defaultValue))
+		if input == "" {
+			return defaultValue
+		}
+		value, err := strconv.ParseFloat(input, 64)
 		if err == nil {
 			return value
 		}
@@ -273,6 +388,28 @@ func readInt(reader *bufio.Reader, prompt string) int {
 	}
 }
 
+func readQuantity(reader *bufio.Reader, prompt string, precision *int) float64 {
+	for {
+		input := readString(reader, prompt)
+		value, err := ParseQuantity(input, precision)
+		if err == nil {
+			return value
+		}
+		fmt.Println("Please enter a valid positive number (e.g. 7.5)")
+	}
+}
+
+func readUnit(reader *bufio.Reader, prompt string) Unit {
+	for {
+		input := readString(reader, prompt)
+		unit, err := ParseUnit(input)
+		if err == nil {
+			return unit
+		}
+		fmt.Println(err)
+	}
+}
+
 func LoadTemplate(path string) (*BillTemplate, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -283,10 +420,102 @@ func LoadTemplate(path string) (*BillTemplate, error) {
 	if err := json.Unmarshal(data, &template); err != nil {
 		return nil, err
 	}
+	if _, err := ParsePageSize(template.PageSize); err != nil {
+		return nil, err
+	}
+	if _, err := ParseOrientation(template.Orientation); err != nil {
+		return nil, err
+	}
+	if err := template.PaymentMethods.Validate(); err != nil {
+		return nil, err
+	}
 
 	return &template, nil
 }
 
+// NewBillFromTemplate builds a bill from a template without prompting,
+// keeping every template item.
+func NewBillFromTemplate(template BillTemplate, number string, date time.Time) Bill {
+	bill := Bill{
+		Number:            number,
+		Date:              date,
+		CompanyName:       template.CompanyName,
+		Address:           template.Address,
+		VATNumber:         template.VATNumber,
+		Country:           template.Country,
+		ToCompanyName:     template.ToCompanyName,
+		ToAddress:         template.ToAddress,
+		ToVATNumber:       template.ToVATNumber,
+		ToCountry:         template.ToCountry,
+		Currency:          template.Currency,
+		BitcoinAddress:    template.BitcoinAddress,
+		QuantityPrecision: template.QuantityPrecision,
+		PageSize:          template.PageSize,
+		Orientation:       template.Orientation,
+		BuyerReference:    template.BuyerReference,
+		PeppolID:          template.PeppolID,
+		ToPeppolID:        template.ToPeppolID,
+		FiscalCode:        template.FiscalCode,
+		TaxRegime:         template.TaxRegime,
+		ToFiscalCode:      template.ToFiscalCode,
+		ToRecipientCode:   template.ToRecipientCode,
+		ToPEC:             template.ToPEC,
+		ToLeitwegID:       template.ToLeitwegID,
+		ContactName:       template.ContactName,
+		ContactPhone:      template.ContactPhone,
+		ContactEmail:      template.ContactEmail,
+
+		VATCategory:        template.VATCategory,
+		VATExemptionReason: template.VATExemptionReason,
+		PaymentMethods:     template.PaymentMethods,
+	}
+	if template.PaymentDays > 0 {
+		bill.DueDate = date.AddDate(0, 0, template.PaymentDays)
+	}
+	if bill.Currency == "" {
+		bill.Currency = "€"
+	}
+
+	for _, templateItem := range template.Items {
+		quantity := RoundQuantity(templateItem.Quantity, bill.QuantityPrecision)
+		itemTotal := LineTotal(quantity, templateItem.UnitPrice)
+		bill.Items = append(bill.Items, BillItem{
+			Description: templateItem.Description,
+			Quantity:    quantity,
+			Unit:        templateItem.Unit,
+			UnitPrice:   templateItem.UnitPrice,
+			VATRate:     templateItem.VATRate,
+			Total:       itemTotal,
+		})
+	}
+	bill.UpdateTotal()
+	return bill
+}
+
+// FormatNumber expands an invoice number pattern such as "INV-{YYYY}-{NNN}":
+// {YYYY}, {YY} and {MM} are replaced by the date and a run of N between braces
+// by the zero-padded sequence.
+func FormatNumber(pattern string, date time.Time, sequence int) string {
+	number := strings.NewReplacer(
+		"{YYYY}", date.Format("2006"),
+		"{YY}", date.Format("06"),
+		"{MM}", date.Format("01"),
+	).Replace(pattern)
+
+	for {
+		start := strings.Index(number, "{N")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(number[start:], "}")
+		if end < 0 || strings.Trim(number[start+1:start+end], "N") != "" {
+			break
+		}
+		number = number[:start] + fmt.Sprintf("%0*d", end-1, sequence) + number[start+end+1:]
+	}
+	return number
+}
+
 func CollectBillData(template *BillTemplate) Bill {
 	reader := bufio.NewReader(os.Stdin)
 
@@ -300,6 +529,30 @@ func CollectBillData(template *BillTemplate) Bill {
 	if template != nil && template.Currency != "" {
 		bill.Currency = template.Currency
 	}
+	defaultVATRate := 0.0
+	if template != nil {
+		bill.QuantityPrecision = template.QuantityPrecision
+		bill.PageSize = template.PageSize
+		bill.Orientation = template.Orientation
+		bill.VATCategory = template.VATCategory
+		bill.VATExemptionReason = template.VATExemptionReason
+		bill.PeppolID = template.PeppolID
+		bill.ToPeppolID = template.ToPeppolID
+		bill.FiscalCode = template.FiscalCode
+		bill.TaxRegime = template.TaxRegime
+		bill.ToFiscalCode = template.ToFiscalCode
+		bill.ToRecipientCode = template.ToRecipientCode
+		bill.ToPEC = template.ToPEC
+		bill.ToLeitwegID = template.ToLeitwegID
+		bill.ContactName = template.ContactName
+		bill.ContactPhone = template.ContactPhone
+		bill.ContactEmail = template.ContactEmail
+		bill.PaymentMethods = template.PaymentMethods
+		if template.PaymentDays > 0 {
+			bill.DueDate = bill.Date.AddDate(0, 0, template.PaymentDays)
+		}
+		defaultVATRate = template.VATRate
+	}
 
 	bill.Number = readString(reader, "Bill Number (e.g., INV-2024-001): ")
 
@@ -362,6 +615,12 @@ func CollectBillData(template *BillTemplate) Bill {
 		bill.VATNumber = readString(reader, "VAT Number: ")
 	}
 
+	if template != nil && template.Country != "" {
+		bill.Country = readStringWithDefault(reader, "Country Code", template.Country)
+	} else {
+		bill.Country = readString(reader, "Country Code (e.g., FR): ")
+	}
+
 	fmt.Println("\n--- Client Details ---")
 	if template != nil && template.ToCompanyName != "" {
 		fmt.Printf("Client Company Name [%s]: ", template.ToCompanyName)
@@ -417,25 +676,38 @@ func CollectBillData(template *BillTemplate) Bill {
 		bill.ToVATNumber = readString(reader, "Client VAT Number: ")
 	}
 
+	if template != nil && template.ToCountry != "" {
+		bill.ToCountry = readStringWithDefault(reader, "Client Country Code", template.ToCountry)
+	} else {
+		bill.ToCountry = readString(reader, "Client Country Code (e.g., DE): ")
+	}
+
+	if template != nil && template.BuyerReference != "" {
+		bill.BuyerReference = readStringWithDefault(reader, "Buyer Reference", template.BuyerReference)
+	} else {
+		bill.BuyerReference = readString(reader, "Buyer Reference (PO number, optional): ")
+	}
+
 	fmt.Println("\n--- Bill Items ---")
 	var items []BillItem
-	total := 0.0
 
 	if template != nil && len(template.Items) > 0 {
 		for _, templateItem := range template.Items {
-			fmt.Printf("\nTemplate item:\nDescription: %s\nQuantity: %d\nUnit Price: %.2f €\n",
-				templateItem.Description, templateItem.Quantity, templateItem.UnitPrice)
+			quantity := RoundQuantity(templateItem.Quantity, bill.QuantityPrecision)
+			fmt.Printf("\nTemplate item:\nDescription: %s\nQuantity: %s\nUnit Price: %.2f €\nVAT: %g%%\n",
+				templateItem.Description, FormatQuantity(quantity, templateItem.Unit, bill.QuantityPrecision), templateItem.UnitPrice, templateItem.VATRate)
 			fmt.Print("Use this item? [Y/n]: ")
 			input := readString(reader, "")
 			if input == "" || strings.ToLower(input) == "y" {
-				itemTotal := float64(templateItem.Quantity) * templateItem.UnitPrice
+				itemTotal := LineTotal(quantity, templateItem.UnitPrice)
 				items = append(items, BillItem{
 					Description: templateItem.Description,
-					Quantity:    templateItem.Quantity,
+					Quantity:    quantity,
+					Unit:        templateItem.Unit,
 					UnitPrice:   templateItem.UnitPrice,
+					VATRate:     templateItem.VATRate,
 					Total:       itemTotal,
 				})
-				total += itemTotal
 			}
 		}
 	}
@@ -447,21 +719,23 @@ func CollectBillData(template *BillTemplate) Bill {
 			break
 		}
 
-		quantity := readInt(reader, "Quantity: ")
+		quantity := readQuantity(reader, "Quantity: ", bill.QuantityPrecision)
+		unit := readUnit(reader, "Unit (hours, days, pieces, kg, months) []: ")
 		unitPrice := readFloat(reader, "Unit Price (€): ")
-		itemTotal := float64(quantity) * unitPrice
+		vatRate := readFloatWithDefault(reader, "VAT Rate (%)", defaultVATRate)
+		itemTotal := LineTotal(quantity, unitPrice)
 
 		items = append(items, BillItem{
 			Description: description,
 			Quantity:    quantity,
+			Unit:        unit,
 			UnitPrice:   unitPrice,
+			VATRate:     vatRate,
 			Total:       itemTotal,
 		})
-
-		total += itemTotal
 	}
 	bill.Items = items
-	bill.Total = total
+	bill.UpdateTotal()
 
 	if template != nil && template.BitcoinAddress != "" {
 		fmt.Printf("Bitcoin Address [%s]: ", template.BitcoinAddress)
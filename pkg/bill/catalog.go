@@ -0,0 +1,62 @@
+package bill
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Product is an entry of the catalog, the goods and services invoiced
+// again and again, referenced by ID.
+type Product struct {
+	ID          string  `json:"id"`
+	Description string  `json:"description"`
+	Unit        Unit    `json:"unit,omitempty"`
+	UnitPrice   float64 `json:"unit_price"`
+	VATRate     float64 `json:"vat_rate,omitempty"`
+}
+
+// Item returns a template item for a quantity of the product.
+func (p Product) Item(quantity float64) TemplateItem {
+	return TemplateItem{
+		Description: p.Description,
+		Quantity:    quantity,
+		Unit:        p.Unit,
+		UnitPrice:   p.UnitPrice,
+		VATRate:     p.VATRate,
+	}
+}
+
+func catalogPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "catalog.json"), nil
+}
+
+// LoadCatalog reads the products of the catalog from the config directory.
+func LoadCatalog() ([]Product, error) {
+	var products []Product
+	if err := loadList(catalogPath, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// SaveCatalog writes the catalog to the config directory, sorted by ID.
+func SaveCatalog(products []Product) error {
+	sort.SliceStable(products, func(i, j int) bool {
+		return products[i].ID < products[j].ID
+	})
+	return saveList(catalogPath, products)
+}
+
+// FindProduct returns the index of the product with this ID, or -1.
+func FindProduct(products []Product, id string) int {
+	for i, product := range products {
+		if product.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,46 @@
+package bill
+
+import "strings"
+
+// Checkout is an invoice opened at a payment provider for the bill, such
+// as a BTCPay Server invoice: its checkout page, where the client picks
+// how to pay, and the destinations it offers.
+type Checkout struct {
+	// Provider names the payment provider, e.g. "btcpay".
+	Provider string
+
+	// ID is the invoice id at the provider, quoted as the reference of the
+	// payment recorded when it settles.
+	ID  string
+	URL string
+
+	Amount       float64
+	Currency     string
+	Destinations []PaymentDestination
+}
+
+// PaymentDestination is where a checkout can be paid with one payment
+// method.
+type PaymentDestination struct {
+	// Method is the payment method as named by the provider, e.g. "BTC"
+	// or "BTC-LightningNetwork".
+	Method string
+
+	// Destination is the address, or the invoice of payment networks
+	// such as Lightning.
+	Destination string
+
+	// Link is the payment URI wallets open, e.g. "bitcoin:bc1q...?amount=0.001".
+	Link string
+
+	// Amount due in the currency of the method, as the provider wrote it.
+	Amount string
+}
+
+// Printable reports whether the destination can be printed on the bill.
+// Lightning invoices (BOLT11, starting with "ln") expire within hours and
+// are left to the checkout page.
+func (d PaymentDestination) Printable() bool {
+	return !strings.HasPrefix(strings.ToLower(d.Link), "lightning:") &&
+		!strings.HasPrefix(strings.ToLower(d.Destination), "ln")
+}
@@ -0,0 +1,145 @@
+package bill
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Client is a customer kept in the client list, whose details fill the
+// "to" fields of the invoices addressed to it.
+type Client struct {
+	Name            string `json:"name"`
+	Address         string `json:"address,omitempty"`
+	VATNumber       string `json:"vat_number,omitempty"`
+	Country         string `json:"country,omitempty"`
+	PeppolID        string `json:"peppol_id,omitempty"`
+	FiscalCode      string `json:"fiscal_code,omitempty"`
+	RecipientCode   string `json:"recipient_code,omitempty"`
+	PEC             string `json:"pec,omitempty"`
+	LeitwegID       string `json:"leitweg_id,omitempty"`
+	BuyerReference  string `json:"buyer_reference,omitempty"`
+	Currency        string `json:"currency,omitempty"`
+	PaymentDays     int    `json:"payment_days,omitempty"`
+	PageSize        string `json:"page_size,omitempty"`
+	Orientation     string `json:"orientation,omitempty"`
+	VATCategory     string `json:"vat_category,omitempty"`
+	ExemptionReason string `json:"vat_exemption_reason,omitempty"`
+
+	// Email and CC are the addresses invoices are emailed to, and Attach
+	// the e-invoice format attached for this client instead of the one of
+	// the email settings.
+	Email  []string `json:"email,omitempty"`
+	CC     []string `json:"cc,omitempty"`
+	Attach string   `json:"attach,omitempty"`
+}
+
+// Apply sets the client details on a template, leaving the template values
+// the client has none for.
+func (c Client) Apply(t *BillTemplate) {
+	t.ToCompanyName = c.Name
+	t.ToAddress = c.Address
+	t.ToVATNumber = c.VATNumber
+	t.ToCountry = c.Country
+	t.ToPeppolID = c.PeppolID
+	t.ToFiscalCode = c.FiscalCode
+	t.ToRecipientCode = c.RecipientCode
+	t.ToPEC = c.PEC
+	t.ToLeitwegID = c.LeitwegID
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{c.BuyerReference, &t.BuyerReference},
+		{c.Currency, &t.Currency},
+		{c.PageSize, &t.PageSize},
+		{c.Orientation, &t.Orientation},
+		{c.VATCategory, &t.VATCategory},
+		{c.ExemptionReason, &t.VATExemptionReason},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	if c.PaymentDays > 0 {
+		t.PaymentDays = c.PaymentDays
+	}
+}
+
+func clientsPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clients.json"), nil
+}
+
+// LoadClients reads the client list from the config directory, sorted by
+// name.
+func LoadClients() ([]Client, error) {
+	var clients []Client
+	if err := loadList(clientsPath, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// SaveClients writes the client list to the config directory.
+func SaveClients(clients []Client) error {
+	sort.SliceStable(clients, func(i, j int) bool {
+		return strings.ToLower(clients[i].Name) < strings.ToLower(clients[j].Name)
+	})
+	return saveList(clientsPath, clients)
+}
+
+// FindClient returns the index of the client with this name, ignoring
+// case, or -1.
+func FindClient(clients []Client, name string) int {
+	for i, client := range clients {
+		if strings.EqualFold(client.Name, strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadList reads a JSON list from the config directory, leaving v empty
+// when the file does not exist yet.
+func loadList(path func() (string, error), v interface{}) error {
+	p, err := path()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(p), err)
+	}
+	return nil
+}
+
+// saveList writes a JSON list to the config directory through a temporary
+// file.
+func saveList(path func() (string, error), v interface{}) error {
+	p, err := path()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,21 @@
+package bill
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ConfigDir returns the directory holding the application settings and
+// data, creating it if needed.
+func ConfigDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	appDir := filepath.Join(configDir, "invoice-generator")
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		return "", err
+	}
+	return appDir, nil
+}
@@ -0,0 +1,345 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultPaymentDays is the payment term of invoices without a due date
+// when none is configured.
+const DefaultPaymentDays = 30
+
+// DunningLevel is a step of the dunning process: a reminder sent Days
+// after the due date for the first level, or after the previous reminder
+// for the next ones.
+type DunningLevel struct {
+	Title string `json:"title"`
+	Days  int    `json:"days"`
+
+	// Fee is charged with the reminder, in the invoice currency, and
+	// Interest is the yearly late payment interest rate in percent,
+	// counted from the due date.
+	Fee      float64 `json:"fee,omitempty"`
+	Interest float64 `json:"interest,omitempty"`
+
+	// Text is printed above the addresses, a template over the bill fields
+	// plus .Balance, .Fees, .InterestAmount and .AmountDue.
+	Text string `json:"text,omitempty"`
+}
+
+// DunningConfig holds the payment term and the dunning levels, in order.
+type DunningConfig struct {
+	// PaymentDays is the payment term of invoices without a due date.
+	PaymentDays int            `json:"payment_days,omitempty"`
+	Levels      []DunningLevel `json:"levels"`
+}
+
+// Reminder records a payment reminder sent for an invoice.
+type Reminder struct {
+	// Level is the dunning level, starting at 1.
+	Level    int       `json:"level"`
+	Title    string    `json:"title"`
+	Date     time.Time `json:"date"`
+	Fee      float64   `json:"fee,omitempty"`
+	Interest float64   `json:"interest,omitempty"`
+	Path     string    `json:"path,omitempty"`
+}
+
+// Number returns the number of the reminder, derived from the invoice one.
+func (r Reminder) Number(invoice string) string {
+	return fmt.Sprintf("%s-R%d", invoice, r.Level)
+}
+
+// DefaultDunningConfig returns a friendly reminder, a second notice and a
+// final notice claiming fees and late payment interest.
+func DefaultDunningConfig() *DunningConfig {
+	return &DunningConfig{
+		PaymentDays: DefaultPaymentDays,
+		Levels: []DunningLevel{
+			{
+				Title: "Payment reminder",
+				Days:  7,
+				Text: "Our records show that invoice {{.Number}} of {{.Date.Format \"January 2, 2006\"}}, due on " +
+					"{{.DueDate.Format \"January 2, 2006\"}}, is still unpaid. This may be an oversight: please transfer " +
+					"the amount below at your earliest convenience. If you have already paid, please disregard this reminder.",
+			},
+			{
+				Title: "Second notice",
+				Days:  14,
+				Fee:   5,
+				Text: "Despite our reminder, invoice {{.Number}} of {{.Date.Format \"January 2, 2006\"}} remains unpaid. " +
+					"Please pay the amount below, including the reminder fee, within 7 days.",
+			},
+			{
+				Title:    "Final notice",
+				Days:     14,
+				Fee:      40,
+				Interest: 8,
+				Text: "Invoice {{.Number}} of {{.Date.Format \"January 2, 2006\"}} is still unpaid despite our reminders. " +
+					"We charge the fees and late payment interest below. Without payment within 7 days, we will pass " +
+					"the claim on for collection without further notice.",
+			},
+		},
+	}
+}
+
+// Validate checks the levels and their texts.
+func (c *DunningConfig) Validate() error {
+	if c.PaymentDays < 0 {
+		return fmt.Errorf("payment days cannot be negative")
+	}
+	if len(c.Levels) == 0 {
+		return fmt.Errorf("no dunning level configured")
+	}
+	for i, level := range c.Levels {
+		if level.Title == "" {
+			return fmt.Errorf("dunning level %d has no title", i+1)
+		}
+		if level.Days < 0 || level.Fee < 0 || level.Interest < 0 {
+			return fmt.Errorf("dunning level %d: days, fee and interest cannot be negative", i+1)
+		}
+		if _, err := template.New("").Parse(level.Text); err != nil {
+			return fmt.Errorf("dunning level %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func dunningPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dunning.json"), nil
+}
+
+// LoadDunningConfig reads the dunning settings, the default ones if none
+// were saved.
+func LoadDunningConfig() (*DunningConfig, error) {
+	path, err := dunningPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultDunningConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseDunningConfig(data)
+}
+
+// ParseDunningConfig reads and checks JSON dunning settings.
+func ParseDunningConfig(data []byte) (*DunningConfig, error) {
+	var config DunningConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("dunning settings: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// SaveDunningConfig writes the dunning settings.
+func SaveDunningConfig(config *DunningConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	path, err := dunningPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// DueDate returns when the invoice is to be paid: its own due date, or the
+// payment term of the settings after its date.
+func (c *DunningConfig) DueDate(inv *Invoice) time.Time {
+	if !inv.Bill.DueDate.IsZero() {
+		return inv.Bill.DueDate
+	}
+	days := c.PaymentDays
+	if days == 0 {
+		days = DefaultPaymentDays
+	}
+	return inv.Bill.Date.AddDate(0, 0, days)
+}
+
+// Dunnable reports whether reminders may be sent for the invoice: an
+// issued invoice, not a credit note, with an outstanding balance.
+func (inv *Invoice) Dunnable() bool {
+	switch inv.Status {
+	case StatusIssued, StatusSent, StatusPartiallyPaid:
+	default:
+		return false
+	}
+	return inv.Bill.CreditNoteFor == "" && inv.Balance() > 0
+}
+
+// Next returns the next dunning level of the invoice, starting at 1, and
+// the day from which its reminder is due. ok is false when the invoice
+// needs no reminder or every level was sent.
+func (c *DunningConfig) Next(inv *Invoice) (level int, from time.Time, ok bool) {
+	if !inv.Dunnable() || len(inv.Reminders) >= len(c.Levels) {
+		return 0, time.Time{}, false
+	}
+	level = len(inv.Reminders) + 1
+	from = c.DueDate(inv)
+	if len(inv.Reminders) > 0 {
+		from = inv.Reminders[len(inv.Reminders)-1].Date
+	}
+	return level, day(from).AddDate(0, 0, c.Levels[level-1].Days), true
+}
+
+// Due reports whether the next reminder of the invoice is due at now, and
+// which level it is.
+func (c *DunningConfig) Due(inv *Invoice, now time.Time) (int, bool) {
+	level, from, ok := c.Next(inv)
+	if !ok || day(now).Before(from) {
+		return 0, false
+	}
+	return level, true
+}
+
+// day truncates a time to its day.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// NewReminder prepares the reminder of a level, computing its fee and the
+// interest on the balance since the due date. The invoice is not changed.
+func (c *DunningConfig) NewReminder(inv *Invoice, level int, date time.Time) (Reminder, error) {
+	if level < 1 || level > len(c.Levels) {
+		return Reminder{}, fmt.Errorf("no dunning level %d", level)
+	}
+	l := c.Levels[level-1]
+	reminder := Reminder{Level: level, Title: l.Title, Date: date, Fee: l.Fee}
+	if days := day(date).Sub(day(c.DueDate(inv))).Hours() / 24; l.Interest > 0 && days > 0 {
+		reminder.Interest = roundAmount(inv.Balance() * l.Interest / 100 * math.Round(days) / 365)
+	}
+	return reminder, nil
+}
+
+// AddReminder records a reminder sent for the invoice, which must be the
+// next level.
+func (inv *Invoice) AddReminder(r Reminder) error {
+	if !inv.Dunnable() {
+		return fmt.Errorf("invoice %s is %s, no reminder can be sent", inv.Bill.Number, inv.Status)
+	}
+	if r.Level != len(inv.Reminders)+1 {
+		return fmt.Errorf("invoice %s is at dunning level %d, not %d", inv.Bill.Number, len(inv.Reminders), r.Level-1)
+	}
+	inv.Reminders = append(inv.Reminders, r)
+	return nil
+}
+
+// reminderNotice is the data of the dunning level texts.
+type reminderNotice struct {
+	Bill
+	Balance        float64
+	Fees           float64
+	InterestAmount float64
+	AmountDue      float64
+}
+
+// reminderBill returns the bill printed on a reminder: the outstanding
+// invoice, the payments received, the fees of every reminder so far and
+// the interest.
+func (c *DunningConfig) reminderBill(inv *Invoice, r Reminder) (Bill, reminderNotice) {
+	b := inv.Bill
+	due := c.DueDate(inv)
+	b.Number = r.Number(inv.Bill.Number)
+	b.Date = r.Date
+	b.DueDate = time.Time{}
+	b.VATCategory, b.VATExemptionReason = "", ""
+	// The checkout of the invoice leaves out the fees and interest
+	b.Checkout = nil
+
+	line := func(description string, amount float64) BillItem {
+		return BillItem{Description: description, Quantity: 1, UnitPrice: amount, Total: amount}
+	}
+	b.Items = []BillItem{line(fmt.Sprintf("Invoice %s of %s, due %s", inv.Bill.Number,
+		inv.Bill.Date.Format("January 2, 2006"), due.Format("January 2, 2006")), inv.Bill.Total)}
+	if paid := inv.Paid(); paid > 0 {
+		b.Items = append(b.Items, line("Payments received", -paid))
+	}
+
+	fees := r.Fee
+	for _, previous := range inv.Reminders {
+		if previous.Level < r.Level {
+			fees += previous.Fee
+		}
+	}
+	if fees > 0 {
+		b.Items = append(b.Items, line("Reminder fees", roundAmount(fees)))
+	}
+	if r.Interest > 0 {
+		l := c.Levels[r.Level-1]
+		days := int(math.Round(day(r.Date).Sub(day(due)).Hours() / 24))
+		b.Items = append(b.Items, line(fmt.Sprintf("Late payment interest, %g%% a year over %d days", l.Interest, days), r.Interest))
+	}
+	b.UpdateTotal()
+
+	notice := reminderNotice{
+		Bill:           inv.Bill,
+		Balance:        inv.Balance(),
+		Fees:           roundAmount(fees),
+		InterestAmount: r.Interest,
+		AmountDue:      b.Total,
+	}
+	notice.Bill.DueDate = due
+	return b, notice
+}
+
+// GenerateReminderPDF draws a reminder in the style of the invoice, with
+// the text of its dunning level. Factur-X, payments and watermarks of the
+// options are ignored: a reminder is not an invoice.
+func (c *DunningConfig) GenerateReminderPDF(inv *Invoice, r Reminder, outputPath string, opts PDFOptions) error {
+	if r.Level < 1 || r.Level > len(c.Levels) {
+		return fmt.Errorf("no dunning level %d", r.Level)
+	}
+	b, notice := c.reminderBill(inv, r)
+
+	var text bytes.Buffer
+	t, err := template.New("").Parse(c.Levels[r.Level-1].Text)
+	if err != nil {
+		return fmt.Errorf("dunning level %d: %w", r.Level, err)
+	}
+	if err := t.Execute(&text, notice); err != nil {
+		return fmt.Errorf("dunning level %d: %w", r.Level, err)
+	}
+
+	if opts.FacturX != "" && opts.PDFA == "" {
+		opts.PDFA = PDFA3b
+	}
+	opts.FacturX, opts.Payments, opts.Watermark = "", nil, ""
+	return generatePDF(layoutData{
+		Bill:        b,
+		Title:       strings.ToUpper(r.Title),
+		ReminderFor: inv.Bill.Number,
+		Notice:      strings.TrimSpace(text.String()),
+	}, outputPath, opts)
+}
+
+// ReminderPath returns where the reminder of a generated invoice is
+// written: next to it, or in dir when set.
+func ReminderPath(inv *Invoice, r Reminder, dir string) string {
+	name := strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(r.Number(inv.Bill.Number)) + ".pdf"
+	if dir == "" && inv.Path != "" {
+		dir = filepath.Dir(inv.Path)
+	}
+	return filepath.Join(dir, name)
+}
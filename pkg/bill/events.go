@@ -0,0 +1,46 @@
+package bill
+
+// Event is a change of a stored invoice other tools may react to, such as
+// webhooks.
+type Event string
+
+const (
+	EventCreated Event = "invoice.created"
+	EventSent    Event = "invoice.sent"
+	EventPaid    Event = "invoice.paid"
+	EventVoided  Event = "invoice.voided"
+)
+
+// Events lists the invoice events.
+var Events = []Event{EventCreated, EventSent, EventPaid, EventVoided}
+
+// statusEvents maps the statuses an invoice moves to with their event.
+var statusEvents = map[Status]Event{
+	StatusSent: EventSent,
+	StatusPaid: EventPaid,
+	StatusVoid: EventVoided,
+}
+
+// InvoiceEvents returns the events of saving inv over previous, the stored
+// version of the invoice or nil when it is new, oldest first.
+func InvoiceEvents(previous, inv *Invoice) []Event {
+	if previous == nil {
+		return []Event{EventCreated}
+	}
+	var events []Event
+	for i := len(previous.History); i < len(inv.History); i++ {
+		if event, ok := statusEvents[inv.History[i].Status]; ok {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// saveHooks are called after an invoice is saved.
+var saveHooks []func(inv *Invoice, events []Event)
+
+// OnInvoiceEvents registers a function called with the events of every
+// invoice saved from now on that has some.
+func OnInvoiceEvents(hook func(inv *Invoice, events []Event)) {
+	saveHooks = append(saveHooks, hook)
+}
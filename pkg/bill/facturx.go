@@ -0,0 +1,281 @@
+package bill
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/cii"
+)
+
+// FacturXProfile is the Factur-X / ZUGFeRD conformance level of the embedded
+// XML. Values are the ones written in the XMP metadata.
+type FacturXProfile string
+
+const (
+	FacturXMinimum  FacturXProfile = "MINIMUM"
+	FacturXBasic    FacturXProfile = "BASIC"
+	FacturXEN16931  FacturXProfile = "EN 16931"
+	FacturXFilename                = "factur-x.xml"
+)
+
+var facturXGuidelines = map[FacturXProfile]string{
+	FacturXMinimum: "urn:factur-x.eu:1p0:minimum",
+	FacturXBasic:   "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic",
+	FacturXEN16931: "urn:cen.eu:en16931:2017",
+}
+
+func ParseFacturXProfile(s string) (FacturXProfile, error) {
+	switch strings.ToLower(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(s)) {
+	case "minimum":
+		return FacturXMinimum, nil
+	case "basic":
+		return FacturXBasic, nil
+	case "en16931", "comfort":
+		return FacturXEN16931, nil
+	}
+	return "", fmt.Errorf("unknown Factur-X profile %q (expected minimum, basic or en16931)", s)
+}
+
+// unitCodes maps units to UN/ECE Recommendation 20 codes.
+var unitCodes = map[Unit]string{
+	UnitHours:  "HUR",
+	UnitDays:   "DAY",
+	UnitPieces: "H87",
+	UnitKg:     "KGM",
+	UnitMonths: "MON",
+}
+
+// UnitCode returns the UN/ECE Recommendation 20 code of the unit, C62
+// ("one") for items without unit.
+func (u Unit) UnitCode() string {
+	if code, ok := unitCodes[u]; ok {
+		return code
+	}
+	return "C62"
+}
+
+// UnitFromCode returns the unit of a UN/ECE Recommendation 20 code, no
+// unit for codes without a matching unit.
+func UnitFromCode(code string) Unit {
+	for unit, unitCode := range unitCodes {
+		if unitCode == code {
+			return unit
+		}
+	}
+	return UnitNone
+}
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// checkFacturX reports the first field missing for the profile.
+func checkFacturX(b Bill, profile FacturXProfile) error {
+	switch {
+	case b.Number == "":
+		return fmt.Errorf("bill number is required")
+	case b.Date.IsZero():
+		return fmt.Errorf("bill date is required")
+	case b.CompanyName == "":
+		return fmt.Errorf("company name is required")
+	case b.ToCompanyName == "":
+		return fmt.Errorf("client company name is required")
+	case !countryCode.MatchString(b.Country):
+		return fmt.Errorf("country code %q is not an ISO 3166-1 alpha-2 code", b.Country)
+	}
+	if profile != FacturXMinimum && !countryCode.MatchString(b.ToCountry) {
+		return fmt.Errorf("client country code %q is not an ISO 3166-1 alpha-2 code", b.ToCountry)
+	}
+	if b.TaxTotal() != 0 && b.VATNumber == "" {
+		return fmt.Errorf("VAT number is required on invoices with VAT")
+	}
+	for _, subtotal := range b.TaxBreakdown() {
+		if subtotal.Category == VATReverseCharge && b.ToVATNumber == "" {
+			return fmt.Errorf("client VAT number is required for reverse charge")
+		}
+	}
+	return nil
+}
+
+// splitAddress turns a free-form address into CII address lines.
+func splitAddress(address, country string) *cii.Address {
+	parsed := ParseAddress(address)
+	addr := &cii.Address{
+		Postcode:  parsed.Postcode,
+		City:      parsed.City,
+		CountryID: country,
+	}
+	if len(parsed.Lines) > 0 {
+		addr.LineOne = parsed.Lines[0]
+	}
+	if len(parsed.Lines) > 1 {
+		addr.LineTwo = parsed.Lines[1]
+	}
+	if len(parsed.Lines) > 2 {
+		addr.LineThree = strings.Join(parsed.Lines[2:], ", ")
+	}
+	return addr
+}
+
+func formatRate(rate float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", rate), "0"), ".")
+}
+
+func tradeTax(category string, rate float64) cii.TradeTax {
+	tax := cii.TradeTax{TypeCode: "VAT", CategoryCode: category}
+	// Lines not subject to VAT carry no rate (BR-O-05)
+	if category != VATNotSubject {
+		tax.RatePercent = formatRate(rate)
+	}
+	return tax
+}
+
+// FacturXML returns the Cross-Industry-Invoice XML of the bill at the
+// given profile. Credit notes are written with positive amounts, the
+// document type carrying the sign.
+func FacturXML(b Bill, profile FacturXProfile) ([]byte, error) {
+	if _, ok := facturXGuidelines[profile]; !ok {
+		return nil, fmt.Errorf("unknown Factur-X profile %q", profile)
+	}
+	if err := checkFacturX(b, profile); err != nil {
+		return nil, err
+	}
+	inv, err := CrossIndustryInvoice(b, profile)
+	if err != nil {
+		return nil, err
+	}
+	return inv.Marshal()
+}
+
+// CrossIndustryInvoice builds the Cross-Industry-Invoice of the bill at
+// the given Factur-X profile without checking that the profile's mandatory
+// fields are filled, for syntaxes adding their own rules on top of it.
+func CrossIndustryInvoice(b Bill, profile FacturXProfile) (*cii.CrossIndustryInvoice, error) {
+	guideline, ok := facturXGuidelines[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown Factur-X profile %q", profile)
+	}
+	currency, err := CurrencyCode(b.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	sign := 1.0
+	typeCode := cii.TypeInvoice
+	if b.CreditNoteFor != "" {
+		sign = -1
+		typeCode = cii.TypeCreditNote
+	}
+	amount := func(v float64) string {
+		return cii.FormatAmount(roundAmount(sign * v))
+	}
+
+	inv := cii.New()
+	inv.Context.Guideline.ID = guideline
+	inv.Document = cii.Document{
+		ID:            b.Number,
+		TypeCode:      typeCode,
+		IssueDateTime: cii.NewDateTime(b.Date),
+	}
+
+	seller := cii.TradeParty{Name: b.CompanyName}
+	buyer := cii.TradeParty{Name: b.ToCompanyName}
+	if profile == FacturXMinimum {
+		seller.Address = &cii.Address{CountryID: b.Country}
+	} else {
+		seller.Address = splitAddress(b.Address, b.Country)
+		buyer.Address = splitAddress(b.ToAddress, b.ToCountry)
+	}
+	if b.VATNumber != "" {
+		seller.TaxRegistrations = []cii.TaxRegistration{{ID: cii.SchemeID{SchemeID: "VA", Value: b.VATNumber}}}
+	}
+	if b.ToVATNumber != "" {
+		buyer.TaxRegistrations = []cii.TaxRegistration{{ID: cii.SchemeID{SchemeID: "VA", Value: b.ToVATNumber}}}
+	}
+
+	tx := &inv.Transaction
+	tx.Agreement.BuyerReference = b.BuyerReference
+	tx.Agreement.Seller = seller
+	tx.Agreement.Buyer = buyer
+
+	settlement := &tx.Settlement
+	settlement.Currency = currency
+	settlement.Summation = cii.HeaderMonetarySum{
+		TaxBasisTotalAmount: amount(b.NetTotal()),
+		TaxTotalAmount:      cii.Amount{CurrencyID: currency, Value: amount(b.TaxTotal())},
+		GrandTotalAmount:    amount(b.Total),
+		DuePayableAmount:    amount(b.Total),
+	}
+	if b.CreditNoteFor != "" {
+		settlement.InvoiceReference = &cii.ReferencedDocument{IssuerAssignedID: b.CreditNoteFor}
+	}
+
+	if profile == FacturXMinimum {
+		return inv, nil
+	}
+
+	for i, item := range b.Items {
+		tx.Lines = append(tx.Lines, cii.LineItem{
+			Document: cii.LineDocument{LineID: fmt.Sprintf("%d", i+1)},
+			Product:  cii.Product{Name: item.Description},
+			Agreement: cii.LineAgreement{
+				NetPrice: cii.Price{ChargeAmount: cii.FormatPrice(math.Abs(item.UnitPrice))},
+			},
+			Delivery: cii.LineDelivery{
+				BilledQuantity: cii.Quantity{
+					UnitCode: item.Unit.UnitCode(),
+					Value:    fmt.Sprintf("%.4f", item.Quantity),
+				},
+			},
+			Settlement: cii.LineSettlement{
+				Tax:       tradeTax(b.VATCategoryFor(item.VATRate), item.VATRate),
+				Summation: cii.LineMonetarySum{LineTotalAmount: amount(item.Total)},
+			},
+		})
+	}
+
+	settlement.PaymentReference = b.Number
+	if b.BitcoinAddress != "" {
+		settlement.PaymentMeans = []cii.PaymentMeans{{
+			TypeCode:    "ZZZ",
+			Information: "Bitcoin " + b.BitcoinAddress,
+		}}
+	}
+	for _, method := range b.PaymentMethods {
+		transfer, ok := method.(BankTransfer)
+		if !ok {
+			continue
+		}
+		// UNTDID 4461: 58 is a SEPA credit transfer
+		means := cii.PaymentMeans{
+			TypeCode: "58",
+			Account: &cii.CreditorAccount{
+				IBAN:        NormalizeIBAN(transfer.IBAN),
+				AccountName: transfer.AccountHolder,
+			},
+		}
+		if transfer.BIC != "" {
+			means.Institution = &cii.CreditorInstitute{BIC: strings.ToUpper(transfer.BIC)}
+		}
+		settlement.PaymentMeans = append(settlement.PaymentMeans, means)
+	}
+	for _, subtotal := range b.TaxBreakdown() {
+		tax := tradeTax(subtotal.Category, subtotal.Rate)
+		tax.CalculatedAmount = amount(subtotal.Amount)
+		tax.BasisAmount = amount(subtotal.Base)
+		tax.ExemptionReason = subtotal.ExemptionReason
+		settlement.Taxes = append(settlement.Taxes, tax)
+	}
+	// BR-CO-25: an amount due needs a due date or payment terms
+	if sign*b.Total > 0 {
+		if b.DueDate.IsZero() {
+			settlement.PaymentTerms = &cii.PaymentTerms{Description: "Payable upon receipt"}
+		} else {
+			due := cii.NewDateTime(b.DueDate)
+			settlement.PaymentTerms = &cii.PaymentTerms{DueDate: &due}
+		}
+	}
+	settlement.Summation.LineTotalAmount = amount(b.NetTotal())
+
+	return inv, nil
+}
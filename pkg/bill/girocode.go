@@ -0,0 +1,96 @@
+package bill
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// EPC069-12 limits of the fields of a GiroCode.
+const (
+	epcMaxName        = 70
+	epcMaxRemittance  = 140
+	epcMaxAmount      = 999999999.99
+	epcMaxPayloadSize = 331
+)
+
+// GiroCode returns the payload of the EPC069-12 QR code ("GiroCode") of a
+// SEPA credit transfer of amount euros to the account, which banking apps
+// scan to fill the transfer. The invoice number is the remittance
+// information: structured when it is an ISO 11649 creditor reference
+// ("RF18539007547034"), else unstructured.
+func (p BankTransfer) GiroCode(b Bill, amount float64) (string, error) {
+	if code, err := CurrencyCode(b.Currency); err != nil || code != "EUR" {
+		return "", fmt.Errorf("GiroCode: SEPA credit transfers are in EUR, not %q", b.Currency)
+	}
+	if amount < 0.01 || amount > epcMaxAmount {
+		return "", fmt.Errorf("GiroCode: amount %.2f out of range (0.01 to 999999999.99 EUR)", amount)
+	}
+	if err := p.Validate(); err != nil {
+		return "", fmt.Errorf("GiroCode: %w", err)
+	}
+	name := strings.TrimSpace(p.AccountHolder)
+	if utf8.RuneCountInString(name) > epcMaxName {
+		return "", fmt.Errorf("GiroCode: the account holder has more than %d characters", epcMaxName)
+	}
+
+	var reference, remittance string
+	if number := strings.TrimSpace(b.Number); ValidateCreditorReference(number) == nil {
+		reference = NormalizeIBAN(number)
+	} else if utf8.RuneCountInString(number) <= epcMaxRemittance {
+		remittance = number
+	} else {
+		return "", fmt.Errorf("GiroCode: the invoice number has more than %d characters", epcMaxRemittance)
+	}
+
+	fields := []string{
+		"BCD", // service tag
+		"002", // version, the BIC being optional within the EEA
+		"1",   // UTF-8
+		"SCT", // SEPA credit transfer
+		strings.ToUpper(strings.TrimSpace(p.BIC)),
+		name,
+		NormalizeIBAN(p.IBAN),
+		fmt.Sprintf("EUR%.2f", amount),
+		"", // purpose
+		reference,
+		remittance,
+	}
+	payload := strings.TrimRight(strings.Join(fields, "\n"), "\n")
+	if len(payload) > epcMaxPayloadSize {
+		return "", fmt.Errorf("GiroCode: the payload has more than %d bytes", epcMaxPayloadSize)
+	}
+	return payload, nil
+}
+
+// ValidateCreditorReference checks an ISO 11649 creditor reference: "RF",
+// two check digits and up to 21 letters and digits, spaces allowed.
+func ValidateCreditorReference(reference string) error {
+	normalized := NormalizeIBAN(reference)
+	if len(normalized) < 5 || len(normalized) > 25 || !strings.HasPrefix(normalized, "RF") {
+		return fmt.Errorf("creditor reference %q: expected RF, two check digits and up to 21 characters", reference)
+	}
+	for _, c := range normalized[2:] {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fmt.Errorf("creditor reference %q holds invalid characters", reference)
+		}
+	}
+	// Same check digits as an IBAN: ISO 7064 mod 97-10
+	if ibanRemainder(normalized) != 1 {
+		return fmt.Errorf("creditor reference %q: wrong check digits", reference)
+	}
+	return nil
+}
+
+// paymentSection returns the section of a payment method on a bill whose
+// payments were received, bank transfers scanning for the amount due.
+func paymentSection(method PaymentMethod, b Bill, payments []Payment) PaymentSection {
+	section := method.Section(b)
+	if transfer, ok := method.(BankTransfer); ok && len(payments) > 0 {
+		section.QRCode, _ = transfer.GiroCode(b, roundAmount(b.Total-TotalPaid(payments)))
+		if section.QRCode == "" {
+			section.Notice = transferNotice
+		}
+	}
+	return section
+}
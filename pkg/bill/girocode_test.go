@@ -0,0 +1,83 @@
+package bill
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCreditorReference(t *testing.T) {
+	for reference, valid := range map[string]bool{
+		"RF18539007547034":        true,
+		"RF18 5390 0754 7034":     true,
+		"rf18539007547034":        true,
+		"RF712348231":             true,
+		"RF19539007547034":        false,
+		"RF18":                    false,
+		"XX18539007547034":        false,
+		"RF18-5390-0754-7034":     false,
+		"RF181234567890123456789": false,
+	} {
+		if err := ValidateCreditorReference(reference); (err == nil) != valid {
+			t.Errorf("ValidateCreditorReference(%q) = %v, want valid %v", reference, err, valid)
+		}
+	}
+}
+
+func TestGiroCode(t *testing.T) {
+	transfer := BankTransfer{AccountHolder: "Muster GmbH", IBAN: "DE89 3704 0044 0532 0130 00", BIC: "cobadeffxxx"}
+	for _, tc := range []struct {
+		name     string
+		transfer BankTransfer
+		number   string
+		amount   float64
+		want     string
+	}{
+		{"unstructured", transfer, "INV-1", 119, "BCD\n002\n1\nSCT\nCOBADEFFXXX\nMuster GmbH\nDE89370400440532013000\nEUR119.00\n\n\nINV-1"},
+		{"creditor reference", transfer, "RF18 5390 0754 7034", 1234.5, "BCD\n002\n1\nSCT\nCOBADEFFXXX\nMuster GmbH\nDE89370400440532013000\nEUR1234.50\n\nRF18539007547034"},
+		{"without BIC", BankTransfer{AccountHolder: "Muster GmbH", IBAN: transfer.IBAN}, "INV-1", 0.01, "BCD\n002\n1\nSCT\n\nMuster GmbH\nDE89370400440532013000\nEUR0.01\n\n\nINV-1"},
+	} {
+		got, err := tc.transfer.GiroCode(Bill{Number: tc.number, Currency: "EUR"}, tc.amount)
+		if err != nil {
+			t.Errorf("%s: GiroCode: %v", tc.name, err)
+		} else if got != tc.want {
+			t.Errorf("%s: GiroCode = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		transfer BankTransfer
+		bill     Bill
+		amount   float64
+		wantErr  string
+	}{
+		{"dollars", transfer, Bill{Number: "INV-1", Currency: "USD"}, 119, "EUR"},
+		{"nothing due", transfer, Bill{Number: "INV-1", Currency: "EUR"}, 0, "out of range"},
+		{"too much", transfer, Bill{Number: "INV-1", Currency: "EUR"}, 1e9, "out of range"},
+		{"invalid IBAN", BankTransfer{AccountHolder: "Muster GmbH", IBAN: "DE00370400440532013000"}, Bill{Number: "INV-1", Currency: "EUR"}, 119, "check digits"},
+		{"long name", BankTransfer{AccountHolder: strings.Repeat("M", 71), IBAN: transfer.IBAN}, Bill{Number: "INV-1", Currency: "EUR"}, 119, "account holder"},
+		{"long number", transfer, Bill{Number: strings.Repeat("1", 141), Currency: "EUR"}, 119, "invoice number"},
+	} {
+		if _, err := tc.transfer.GiroCode(tc.bill, tc.amount); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: GiroCode error = %v, want one mentioning %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestPaymentSection(t *testing.T) {
+	transfer := BankTransfer{AccountHolder: "Muster GmbH", IBAN: "DE89370400440532013000"}
+	b := Bill{Number: "INV-1", Currency: "EUR", Total: 119}
+
+	if section := paymentSection(transfer, b, nil); section.QRCode == "" || section.Notice != transferQRNotice {
+		t.Errorf("unpaid: QR code %q, notice %q", section.QRCode, section.Notice)
+	}
+	partial := paymentSection(transfer, b, []Payment{{Amount: 100}})
+	if !strings.Contains(partial.QRCode, "EUR19.00") || partial.Notice != transferQRNotice {
+		t.Errorf("partially paid: QR code %q, notice %q, want the 19.00 due", partial.QRCode, partial.Notice)
+	}
+	// Nothing left to scan for: no code, and no mention of one
+	paid := paymentSection(transfer, b, []Payment{{Amount: 119}})
+	if paid.QRCode != "" || paid.Notice != transferNotice {
+		t.Errorf("paid: QR code %q, notice %q, want none and %q", paid.QRCode, paid.Notice, transferNotice)
+	}
+}
@@ -0,0 +1,170 @@
+package bill
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+//go:embed invoice.html
+var invoiceHTML string
+
+var htmlTemplate = template.Must(template.New("invoice").Parse(invoiceHTML))
+
+// htmlInvoice is the data of the HTML template, amounts being formatted
+// as on the PDF.
+type htmlInvoice struct {
+	Bill         Bill
+	Title        string
+	PageSize     string
+	Watermark    string
+	Items        []htmlItem
+	Subtotal     string
+	Taxes        []htmlTax
+	Total        string
+	Paid         string
+	Balance      string
+	BalanceLabel string
+	Payments     []htmlPayment
+}
+
+type htmlItem struct {
+	Description string
+	Quantity    string
+	UnitPrice   string
+	Total       string
+}
+
+type htmlTax struct {
+	Label  string
+	Amount string
+}
+
+type htmlPayment struct {
+	Title   string
+	Details []htmlPaymentDetail
+	QRCode  template.URL
+	Notice  string
+}
+
+// htmlPaymentDetail is a line of a payment section, a link when it is the
+// page the QR code opens.
+type htmlPaymentDetail struct {
+	Text string
+	Link bool
+}
+
+// qrCodeDataURI returns the QR code of a payment URI as a PNG data URI.
+func qrCodeDataURI(content string) (template.URL, error) {
+	png, err := qrcode.Encode(content, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+// RenderHTML writes the bill as a self-contained HTML page matching the
+// PDF layout: styles are inline and the QR code is a data URI, so the page
+// can be mailed or served as is. The Factur-X option does not apply.
+func RenderHTML(w io.Writer, bill Bill, opts PDFOptions) error {
+	money := func(amount float64) string {
+		return fmt.Sprintf("%.2f %s", amount, bill.Currency)
+	}
+
+	data := htmlInvoice{
+		Bill:      bill,
+		Title:     "INVOICE",
+		PageSize:  cssPageSize(bill),
+		Watermark: opts.Watermark,
+		Total:     money(bill.Total),
+	}
+	if bill.CreditNoteFor != "" {
+		data.Title = "CREDIT NOTE"
+	}
+	for _, item := range bill.Items {
+		data.Items = append(data.Items, htmlItem{
+			Description: item.Description,
+			Quantity:    FormatQuantity(item.Quantity, item.Unit, bill.QuantityPrecision),
+			UnitPrice:   money(item.UnitPrice),
+			Total:       money(item.Total),
+		})
+	}
+
+	// VAT breakdown, only when some lines are taxed
+	if bill.TaxTotal() != 0 {
+		data.Subtotal = money(bill.NetTotal())
+		for _, subtotal := range bill.TaxBreakdown() {
+			data.Taxes = append(data.Taxes, htmlTax{
+				Label:  fmt.Sprintf("VAT %g%%", subtotal.Rate),
+				Amount: money(subtotal.Amount),
+			})
+		}
+	}
+
+	if len(opts.Payments) > 0 {
+		paid := TotalPaid(opts.Payments)
+		balance := roundAmount(bill.Total - paid)
+		data.BalanceLabel = "BALANCE DUE"
+		if balance < 0 {
+			data.BalanceLabel = "OVERPAID"
+			balance = -balance
+		}
+		data.Paid = money(paid)
+		data.Balance = money(balance)
+	}
+
+	for _, method := range bill.AllPaymentMethods() {
+		section := paymentSection(method, bill, opts.Payments)
+		payment := htmlPayment{Title: section.Title, Notice: section.Notice}
+		for _, line := range section.Details {
+			link := line == section.QRCode && (strings.HasPrefix(line, "https://") || strings.HasPrefix(line, "http://"))
+			payment.Details = append(payment.Details, htmlPaymentDetail{Text: line, Link: link})
+		}
+		if section.QRCode != "" {
+			var err error
+			if payment.QRCode, err = qrCodeDataURI(section.QRCode); err != nil {
+				return fmt.Errorf("generating QR code: %w", err)
+			}
+		}
+		data.Payments = append(data.Payments, payment)
+	}
+
+	return htmlTemplate.Execute(w, data)
+}
+
+// GenerateHTMLWithOptions writes the HTML page of the bill to outputPath.
+func GenerateHTMLWithOptions(bill Bill, outputPath string, opts PDFOptions) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := RenderHTML(file, bill, opts); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// IsHTMLPath reports whether a document path is an HTML page rather than
+// a PDF.
+func IsHTMLPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".html" || ext == ".htm"
+}
+
+// GenerateDocument writes the bill as an HTML page or a PDF depending on
+// the extension of outputPath, so stored invoices are regenerated in the
+// format they were first produced in.
+func GenerateDocument(bill Bill, outputPath string, opts PDFOptions) error {
+	if IsHTMLPath(outputPath) {
+		return GenerateHTMLWithOptions(bill, outputPath, opts)
+	}
+	return GeneratePDFWithOptions(bill, outputPath, opts)
+}
@@ -0,0 +1,88 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// srgbProfile returns a minimal ICC v2 display profile approximating
+// sRGB (D50-adapted primaries, gamma 2.2). PDF/A needs an output intent
+// for documents painting in DeviceRGB.
+func srgbProfile() []byte {
+	fixed := func(v float64) uint32 {
+		return uint32(int32(v * 65536))
+	}
+	xyz := func(x, y, z float64) []byte {
+		data := make([]byte, 20)
+		copy(data, "XYZ ")
+		binary.BigEndian.PutUint32(data[8:], fixed(x))
+		binary.BigEndian.PutUint32(data[12:], fixed(y))
+		binary.BigEndian.PutUint32(data[16:], fixed(z))
+		return data
+	}
+	text := func(s string) []byte {
+		data := append([]byte("text\x00\x00\x00\x00"), s...)
+		return append(data, 0)
+	}
+	desc := func(s string) []byte {
+		data := make([]byte, 12, 12+len(s)+1+79)
+		copy(data, "desc")
+		binary.BigEndian.PutUint32(data[8:], uint32(len(s)+1))
+		data = append(data, s...)
+		data = append(data, 0)
+		// Empty Unicode and ScriptCode descriptions
+		return append(data, make([]byte, 4+4+2+1+67)...)
+	}
+	curve := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x02\x33")
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", desc("sRGB IEC61966-2.1")},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	offset := 128 + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	for _, tag := range tags {
+		for offset%4 != 0 {
+			data.WriteByte(0)
+			offset++
+		}
+		table.WriteString(tag.signature)
+		binary.Write(&table, binary.BigEndian, uint32(offset))
+		binary.Write(&table, binary.BigEndian, uint32(len(tag.data)))
+		data.Write(tag.data)
+		offset += len(tag.data)
+	}
+	for offset%4 != 0 {
+		data.WriteByte(0)
+		offset++
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(offset))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	for i, v := range []uint16{2024, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	binary.BigEndian.PutUint32(header[68:], fixed(0.9642))
+	binary.BigEndian.PutUint32(header[72:], fixed(1.0))
+	binary.BigEndian.PutUint32(header[76:], fixed(0.8249))
+
+	profile := append(header, table.Bytes()...)
+	return append(profile, data.Bytes()...)
+}
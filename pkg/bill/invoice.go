@@ -0,0 +1,294 @@
+package bill
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusDraft         Status = "draft"
+	StatusIssued        Status = "issued"
+	StatusSent          Status = "sent"
+	StatusPartiallyPaid Status = "partially_paid"
+	StatusPaid          Status = "paid"
+	StatusVoid          Status = "void"
+)
+
+// transitions lists the statuses reachable from each status.
+var transitions = map[Status][]Status{
+	StatusDraft:         {StatusIssued, StatusVoid},
+	StatusIssued:        {StatusSent, StatusPartiallyPaid, StatusPaid, StatusVoid},
+	StatusSent:          {StatusPartiallyPaid, StatusPaid, StatusVoid},
+	StatusPartiallyPaid: {StatusPaid},
+}
+
+// ErrImmutable is returned when changing an invoice that was issued.
+var ErrImmutable = errors.New("issued invoices cannot be edited, issue a credit note instead")
+
+func ParseStatus(s string) (Status, error) {
+	status := Status(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "-", "_"))
+	if status == StatusDraft || status == StatusVoid || status == StatusPaid {
+		return status, nil
+	}
+	if _, ok := transitions[status]; ok {
+		return status, nil
+	}
+	return "", fmt.Errorf("unknown status %q", s)
+}
+
+func (s Status) String() string {
+	return strings.ReplaceAll(string(s), "_", " ")
+}
+
+// CanTransition reports whether an invoice may move from s to next.
+func (s Status) CanTransition(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Watermark returns the text stamped across the PDF of an invoice in this
+// status, if any.
+func (s Status) Watermark() string {
+	switch s {
+	case StatusDraft, StatusPaid, StatusVoid:
+		return strings.ToUpper(string(s))
+	}
+	return ""
+}
+
+type StatusChange struct {
+	Status Status    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+// Invoice is a generated bill kept in the invoice store with its status.
+type Invoice struct {
+	Bill     Bill           `json:"bill"`
+	Status   Status         `json:"status"`
+	History  []StatusChange `json:"history"`
+	Payments []Payment      `json:"payments,omitempty"`
+	Path     string         `json:"path,omitempty"`
+
+	// FacturX is the profile of the XML embedded in the PDF, if any, kept
+	// so that regenerated PDFs stay Factur-X invoices.
+	FacturX FacturXProfile `json:"facturx,omitempty"`
+
+	// Layout is the layout file the PDF was drawn with, empty for the
+	// built-in layout.
+	Layout string `json:"layout,omitempty"`
+
+	// PDFA is the PDF/A level of archival PDFs.
+	PDFA PDFAConformance `json:"pdfa,omitempty"`
+
+	// Signed records that the PDF was digitally signed, so that
+	// regenerated PDFs are signed again.
+	Signed bool `json:"signed,omitempty"`
+
+	// Reminders sent for the invoice while overdue, oldest first.
+	Reminders []Reminder `json:"reminders,omitempty"`
+}
+
+// Transition moves the invoice to the next status, recording when.
+func (inv *Invoice) Transition(next Status, at time.Time) error {
+	if !inv.Status.CanTransition(next) {
+		return fmt.Errorf("invoice %s cannot go from %s to %s", inv.Bill.Number, inv.Status, next)
+	}
+	inv.Status = next
+	inv.History = append(inv.History, StatusChange{Status: next, At: at})
+	return nil
+}
+
+// Editable reports whether the bill of the invoice may still change.
+func (inv *Invoice) Editable() bool {
+	return inv.Status == StatusDraft
+}
+
+// Update replaces the bill of a draft invoice.
+func (inv *Invoice) Update(b Bill) error {
+	if !inv.Editable() {
+		return ErrImmutable
+	}
+	if b.Number != inv.Bill.Number {
+		return fmt.Errorf("invoice number cannot change")
+	}
+	inv.Bill = b
+	return nil
+}
+
+// NewInvoice prepares a bill for the store in the given initial status
+// (draft or issued). It fails if an invoice with the same number was already
+// issued. The invoice is not saved.
+func NewInvoice(b Bill, status Status, at time.Time) (*Invoice, error) {
+	if b.Number == "" {
+		return nil, fmt.Errorf("bill number is required")
+	}
+	if status != StatusDraft && status != StatusIssued {
+		return nil, fmt.Errorf("invoices start as draft or issued, not %s", status)
+	}
+
+	existing, err := LoadInvoice(b.Number)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if existing != nil {
+		if err := existing.Update(b); err != nil {
+			return nil, fmt.Errorf("invoice %s: %w", b.Number, err)
+		}
+		if status != existing.Status {
+			if err := existing.Transition(status, at); err != nil {
+				return nil, err
+			}
+		}
+		return existing, nil
+	}
+
+	return &Invoice{
+		Bill:    b,
+		Status:  status,
+		History: []StatusChange{{Status: status, At: at}},
+	}, nil
+}
+
+// NewCreditNote returns a bill cancelling the given invoice, with every item
+// negated. This is how issued invoices are corrected. The checkout of the
+// invoice is not carried over: a credit note is not paid.
+func NewCreditNote(original Bill, number string, date time.Time) Bill {
+	credit := original
+	credit.Number = number
+	credit.Date = date
+	credit.CreditNoteFor = original.Number
+	credit.DueDate = time.Time{}
+	credit.Checkout = nil
+	credit.Items = make([]BillItem, len(original.Items))
+	for i, item := range original.Items {
+		item.UnitPrice = -item.UnitPrice
+		item.Total = -item.Total
+		credit.Items[i] = item
+	}
+	credit.UpdateTotal()
+	return credit
+}
+
+func invoicesDir() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	invoicesDir := filepath.Join(dir, "invoices")
+	if err := os.MkdirAll(invoicesDir, 0755); err != nil {
+		return "", err
+	}
+	return invoicesDir, nil
+}
+
+func invoicePath(number string) (string, error) {
+	dir, err := invoicesDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(number)
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// LoadInvoice reads an invoice from the store. The error wraps
+// os.ErrNotExist if there is no invoice with this number.
+func LoadInvoice(number string) (*Invoice, error) {
+	path, err := invoicePath(number)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("invoice %s: %w", number, os.ErrNotExist)
+		}
+		return nil, err
+	}
+
+	var inv Invoice
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("invoice %s: %w", number, err)
+	}
+	return &inv, nil
+}
+
+// SaveInvoice writes an invoice to the store, then passes the events of
+// the change to the functions registered with OnInvoiceEvents.
+func SaveInvoice(inv *Invoice) error {
+	path, err := invoicePath(inv.Bill.Number)
+	if err != nil {
+		return err
+	}
+
+	var previous *Invoice
+	if len(saveHooks) > 0 {
+		previous, err = LoadInvoice(inv.Bill.Number)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	if events := InvoiceEvents(previous, inv); len(events) > 0 {
+		for _, hook := range saveHooks {
+			hook(inv, events)
+		}
+	}
+	return nil
+}
+
+// ListInvoices returns every stored invoice, most recent first.
+func ListInvoices() ([]Invoice, error) {
+	dir, err := invoicesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	invoices := make([]Invoice, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var inv Invoice
+		if err := json.Unmarshal(data, &inv); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		invoices = append(invoices, inv)
+	}
+
+	sort.SliceStable(invoices, func(i, j int) bool {
+		return invoices[i].Bill.Date.After(invoices[j].Bill.Date)
+	})
+	return invoices, nil
+}
@@ -0,0 +1,569 @@
+package bill
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+//go:embed layout.json
+var defaultLayoutJSON []byte
+
+// Layout describes the PDF of a bill as a list of blocks drawn in order.
+// Positions and sizes are in millimetres on a page of Width × Height with
+// Margin on every side, A4 with 10 mm margins unless set. On another page
+// the horizontal positions and widths follow the width between the
+// margins, while the vertical ones and the fonts shrink on shorter or
+// narrower pages, so the same layout fits A4, Letter, Legal and A5 in
+// either orientation.
+//
+// A block with "y" is drawn at this position; otherwise it follows the
+// previous block, "dy" moving down first like a line break. Texts are Go
+// templates over the bill fields plus .Title ("INVOICE", "CREDIT NOTE" or
+// the title of a reminder), e.g. "{{.Number}}" or
+// "{{.Date.Format \"02/01/2006\"}}", and a block whose "if" template renders
+// empty is skipped. On payment reminders, .ReminderFor is the number of the
+// overdue invoice and .Notice the text of the dunning level.
+//
+// Colours are "#rrggbb" or names of the layout colours; "text" is the
+// default text colour and "line" the default line colour.
+type Layout struct {
+	Width  float64           `json:"width,omitempty"`
+	Height float64           `json:"height,omitempty"`
+	Margin float64           `json:"margin,omitempty"`
+	Font   string            `json:"font,omitempty"`
+	Colors map[string]string `json:"colors,omitempty"`
+	Blocks []Block           `json:"blocks"`
+}
+
+// Block types.
+const (
+	BlockText    = "text"    // a text, on one line or wrapped when multiline
+	BlockRect    = "rect"    // a filled rectangle
+	BlockLine    = "line"    // a horizontal line
+	BlockItems   = "items"   // the item table, one column per field
+	BlockTotals  = "totals"  // VAT breakdown, total, VAT mention and payments
+	BlockPayment = "payment" // one box per payment method of the bill
+)
+
+type Block struct {
+	Type string   `json:"type"`
+	If   string   `json:"if,omitempty"`
+	X    float64  `json:"x"`
+	Y    *float64 `json:"y,omitempty"`
+	DY   float64  `json:"dy,omitempty"`
+	W    float64  `json:"w,omitempty"`
+	H    float64  `json:"h,omitempty"`
+
+	Text      string  `json:"text,omitempty"`
+	Multiline bool    `json:"multiline,omitempty"`
+	Align     string  `json:"align,omitempty"`
+	Font      Font    `json:"font,omitempty"`
+	Color     string  `json:"color,omitempty"`
+	Fill      string  `json:"fill,omitempty"`
+	LineWidth float64 `json:"line_width,omitempty"`
+
+	// Items: the header uses Font, Color and Fill, the rows RowFont and
+	// RowColor, every other row being filled with AlternateFill. Totals:
+	// the first column holds the labels and the second the amounts.
+	Columns       []Column `json:"columns,omitempty"`
+	RowFont       Font     `json:"row_font,omitempty"`
+	RowColor      string   `json:"row_color,omitempty"`
+	AlternateFill string   `json:"alternate_fill,omitempty"`
+}
+
+type Font struct {
+	Family string  `json:"family,omitempty"`
+	Style  string  `json:"style,omitempty"`
+	Size   float64 `json:"size,omitempty"`
+}
+
+// Column is a column of the item table, Value being a template over
+// .Description, .Quantity, .UnitPrice, .Total and .VATRate, all formatted.
+type Column struct {
+	Title string  `json:"title,omitempty"`
+	Value string  `json:"value,omitempty"`
+	W     float64 `json:"w"`
+	Align string  `json:"align,omitempty"`
+}
+
+// layoutData is the data of the block templates.
+type layoutData struct {
+	Bill
+	Title string
+
+	ReminderFor string
+	Notice      string
+}
+
+type layoutItem struct {
+	Description string
+	Quantity    string
+	UnitPrice   string
+	Total       string
+	VATRate     string
+}
+
+// DefaultLayout returns the built-in layout.
+func DefaultLayout() *Layout {
+	layout, err := ParseLayout(defaultLayoutJSON)
+	if err != nil {
+		panic("bill: invalid built-in layout: " + err.Error())
+	}
+	return layout
+}
+
+// DefaultLayoutJSON returns the built-in layout, a starting point for
+// custom layouts.
+func DefaultLayoutJSON() []byte {
+	return append([]byte(nil), defaultLayoutJSON...)
+}
+
+// ParseLayout reads a JSON layout, checking its blocks and templates.
+func ParseLayout(data []byte) (*Layout, error) {
+	var layout Layout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, err
+	}
+	if len(layout.Blocks) == 0 {
+		return nil, fmt.Errorf("layout has no blocks")
+	}
+	if layout.Width < 0 || layout.Height < 0 || layout.Margin < 0 {
+		return nil, fmt.Errorf("layout page size and margin cannot be negative")
+	}
+	if 2*layout.margin() >= layout.width() || 2*layout.margin() >= layout.height() {
+		return nil, fmt.Errorf("layout margins leave no room on the page")
+	}
+	for i, block := range layout.Blocks {
+		switch block.Type {
+		case BlockText, BlockRect, BlockLine, BlockTotals, BlockPayment:
+		case BlockItems:
+			if len(block.Columns) == 0 {
+				return nil, fmt.Errorf("block %d: the item table has no columns", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("block %d: unknown type %q", i+1, block.Type)
+		}
+		if block.Type == BlockTotals && len(block.Columns) != 2 {
+			return nil, fmt.Errorf("block %d: totals need a label and an amount column", i+1)
+		}
+		texts := []string{block.If, block.Text}
+		for _, column := range block.Columns {
+			texts = append(texts, column.Value)
+		}
+		for _, text := range texts {
+			if _, err := template.New("").Parse(text); err != nil {
+				return nil, fmt.Errorf("block %d: %w", i+1, err)
+			}
+		}
+		for _, color := range []string{block.Color, block.Fill, block.RowColor, block.AlternateFill} {
+			if _, err := layout.color(color, ""); err != nil {
+				return nil, fmt.Errorf("block %d: %w", i+1, err)
+			}
+		}
+	}
+	return &layout, nil
+}
+
+// LoadLayout reads a layout file, the built-in layout when path is empty.
+func LoadLayout(path string) (*Layout, error) {
+	if path == "" {
+		return DefaultLayout(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := ParseLayout(data)
+	if err != nil {
+		return nil, fmt.Errorf("layout %s: %w", path, err)
+	}
+	return layout, nil
+}
+
+func (l *Layout) width() float64 {
+	if l.Width == 0 {
+		return 210
+	}
+	return l.Width
+}
+
+func (l *Layout) height() float64 {
+	if l.Height == 0 {
+		return 297
+	}
+	return l.Height
+}
+
+func (l *Layout) margin() float64 {
+	if l.Margin == 0 {
+		return 10
+	}
+	return l.Margin
+}
+
+type rgb struct{ r, g, b int }
+
+// color resolves a colour name or "#rrggbb", fallback naming the layout
+// colour used when name is empty.
+func (l *Layout) color(name, fallback string) (rgb, error) {
+	if name == "" {
+		name = fallback
+	}
+	if value, ok := l.Colors[name]; ok {
+		name = value
+	}
+	if name == "" {
+		return rgb{}, nil
+	}
+	if len(name) != 7 || name[0] != '#' {
+		return rgb{}, fmt.Errorf("color %q is neither #rrggbb nor a layout color", name)
+	}
+	value, err := strconv.ParseUint(name[1:], 16, 32)
+	if err != nil {
+		return rgb{}, fmt.Errorf("color %q is neither #rrggbb nor a layout color", name)
+	}
+	return rgb{int(value >> 16), int(value >> 8 & 0xff), int(value & 0xff)}, nil
+}
+
+// layoutRenderer draws the blocks of a layout on a page.
+type layoutRenderer struct {
+	layout *Layout
+	pdf    *gofpdf.Fpdf
+	tr     func(string) string
+	data   layoutData
+	opts   PDFOptions
+
+	// Scales from the layout page to the PDF page, set by draw
+	kx, ky, kf float64
+
+	// Lowest point reached by the content on its last page
+	page   int
+	bottom float64
+}
+
+// x maps a horizontal layout position to the page.
+func (r *layoutRenderer) x(x float64) float64 {
+	m := r.layout.margin()
+	return m + (x-m)*r.kx
+}
+
+// y maps a vertical layout position to the page.
+func (r *layoutRenderer) y(y float64) float64 {
+	m := r.layout.margin()
+	return m + (y-m)*r.ky
+}
+
+// w and h scale a layout width and height.
+func (r *layoutRenderer) w(w float64) float64 { return w * r.kx }
+func (r *layoutRenderer) h(h float64) float64 { return h * r.ky }
+
+func (r *layoutRenderer) text(text string, data interface{}) (string, error) {
+	t, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (r *layoutRenderer) setFont(font Font) {
+	family := font.Family
+	if family == "" {
+		family = r.layout.Font
+	}
+	if family == "" {
+		family = "Helvetica"
+	}
+	size := font.Size
+	if size == 0 {
+		size = 10
+	}
+	r.pdf.SetFont(family, font.Style, size*r.kf)
+}
+
+func (r *layoutRenderer) setTextColor(name string) {
+	c, _ := r.layout.color(name, "text")
+	r.pdf.SetTextColor(c.r, c.g, c.b)
+}
+
+func (r *layoutRenderer) setFillColor(name string) {
+	c, _ := r.layout.color(name, "")
+	r.pdf.SetFillColor(c.r, c.g, c.b)
+}
+
+func (r *layoutRenderer) setDrawColor(name string) {
+	c, _ := r.layout.color(name, "line")
+	r.pdf.SetDrawColor(c.r, c.g, c.b)
+}
+
+func (r *layoutRenderer) draw() error {
+	width, height := r.pdf.GetPageSize()
+	m := r.layout.margin()
+	r.kx = (width - 2*m) / (r.layout.width() - 2*m)
+	r.ky = math.Min(1, (height-2*m)/(r.layout.height()-2*m))
+	r.kf = math.Min(1, math.Min(r.kx, r.ky))
+
+	for i, block := range r.layout.Blocks {
+		if err := r.drawBlock(block); err != nil {
+			return fmt.Errorf("layout block %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// extend records that the content drawn from page goes down to bottom, or
+// to the current position if lower or on a later page.
+func (r *layoutRenderer) extend(page int, bottom float64) {
+	if current := r.pdf.PageNo(); current != page {
+		page, bottom = current, 0
+	}
+	if page != r.page {
+		r.page, r.bottom = page, 0
+	}
+	r.bottom = math.Max(r.bottom, math.Max(bottom, r.pdf.GetY()))
+}
+
+func (r *layoutRenderer) drawBlock(block Block) error {
+	if block.If != "" {
+		value, err := r.text(block.If, r.data)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(value) == "" {
+			return nil
+		}
+	}
+
+	pdf := r.pdf
+	// Work in page coordinates from here on
+	block.X, block.W, block.H = r.x(block.X), r.w(block.W), r.h(block.H)
+	block.Columns = append([]Column(nil), block.Columns...)
+	for i := range block.Columns {
+		block.Columns[i].W = r.w(block.Columns[i].W)
+	}
+
+	switch {
+	case block.Y != nil:
+		pdf.SetXY(block.X, r.y(*block.Y))
+	case block.DY != 0:
+		pdf.Ln(r.h(block.DY))
+		pdf.SetX(block.X)
+	default:
+		pdf.SetX(block.X)
+	}
+	page, top := pdf.PageNo(), pdf.GetY()
+	defer r.extend(page, top+block.H)
+
+	switch block.Type {
+	case BlockText:
+		text, err := r.text(block.Text, r.data)
+		if err != nil {
+			return err
+		}
+		r.setFont(block.Font)
+		r.setTextColor(block.Color)
+		if block.Multiline {
+			pdf.MultiCell(block.W, block.H, r.tr(text), "", block.Align, false)
+		} else {
+			pdf.CellFormat(block.W, block.H, r.tr(text), "", 0, block.Align, false, 0, "")
+		}
+	case BlockRect:
+		r.setFillColor(block.Fill)
+		pdf.Rect(block.X, pdf.GetY(), block.W, block.H, "F")
+	case BlockLine:
+		if block.LineWidth > 0 {
+			pdf.SetLineWidth(block.LineWidth)
+		}
+		r.setDrawColor(block.Color)
+		pdf.Line(block.X, pdf.GetY(), block.X+block.W, pdf.GetY())
+	case BlockItems:
+		return r.drawItems(block)
+	case BlockTotals:
+		r.drawTotals(block)
+	case BlockPayment:
+		r.drawPayment(block)
+	}
+	return nil
+}
+
+func (r *layoutRenderer) drawItems(block Block) error {
+	pdf := r.pdf
+	b := r.data.Bill
+
+	r.setFillColor(block.Fill)
+	r.setTextColor(block.Color)
+	r.setFont(block.Font)
+	if block.Fill != "" {
+		pdf.Rect(block.X, pdf.GetY(), block.W, block.H, "F")
+	}
+	for _, column := range block.Columns {
+		pdf.CellFormat(column.W, block.H, r.tr(column.Title), "", 0, column.Align, false, 0, "")
+	}
+	pdf.Ln(block.H)
+
+	r.setTextColor(block.RowColor)
+	r.setFont(block.RowFont)
+	alternate := false
+	for _, item := range b.Items {
+		if alternate && block.AlternateFill != "" {
+			r.setFillColor(block.AlternateFill)
+			pdf.Rect(block.X, pdf.GetY(), block.W, block.H, "F")
+		}
+		data := layoutItem{
+			Description: item.Description,
+			Quantity:    FormatQuantity(item.Quantity, item.Unit, b.QuantityPrecision),
+			UnitPrice:   fmt.Sprintf("%.2f %s", item.UnitPrice, b.Currency),
+			Total:       fmt.Sprintf("%.2f %s", item.Total, b.Currency),
+			VATRate:     fmt.Sprintf("%g%%", item.VATRate),
+		}
+		pdf.SetX(block.X)
+		for _, column := range block.Columns {
+			value, err := r.text(column.Value, data)
+			if err != nil {
+				return err
+			}
+			pdf.CellFormat(column.W, block.H, r.tr(value), "", 0, column.Align, false, 0, "")
+		}
+		pdf.Ln(block.H)
+		alternate = !alternate
+	}
+	return nil
+}
+
+func (r *layoutRenderer) drawTotals(block Block) {
+	pdf := r.pdf
+	b := r.data.Bill
+	label, amount := block.Columns[0], block.Columns[1]
+	family := block.Font.Family
+
+	row := func(text string, value float64, font Font, height float64) {
+		r.setFont(font)
+		pdf.SetX(block.X)
+		pdf.CellFormat(label.W, height, r.tr(text), "", 0, label.Align, false, 0, "")
+		pdf.SetX(block.X + label.W)
+		pdf.CellFormat(amount.W, height, r.tr(fmt.Sprintf("%.2f %s", value, b.Currency)), "", 0, amount.Align, false, 0, "")
+	}
+
+	r.setTextColor(block.Color)
+
+	// VAT breakdown, only when some lines are taxed
+	if b.TaxTotal() != 0 {
+		row("Subtotal", b.NetTotal(), Font{Family: family, Size: 11}, r.h(8))
+		pdf.Ln(r.h(8))
+		for _, subtotal := range b.TaxBreakdown() {
+			row(fmt.Sprintf("VAT %g%%", subtotal.Rate), subtotal.Amount, Font{Family: family, Size: 11}, r.h(8))
+			pdf.Ln(r.h(8))
+		}
+	}
+
+	row("TOTAL", b.Total, Font{Family: family, Style: "B", Size: 14}, r.h(10))
+
+	// Mention required on lines without VAT
+	if b.VATExemptionReason != "" {
+		pdf.Ln(r.h(10))
+		r.setFont(Font{Family: family, Style: "I", Size: 9})
+		pdf.SetX(block.X)
+		pdf.CellFormat(label.W+amount.W, r.h(6), r.tr(b.VATExemptionReason), "", 0, "", false, 0, "")
+	}
+
+	// Paid / Balance due section
+	if len(r.opts.Payments) > 0 {
+		paid := TotalPaid(r.opts.Payments)
+		balance := roundAmount(b.Total - paid)
+		balanceLabel := "BALANCE DUE"
+		if balance < 0 {
+			balanceLabel = "OVERPAID"
+			balance = -balance
+		}
+
+		pdf.Ln(r.h(10))
+		row("Paid", paid, Font{Family: family, Size: 11}, r.h(8))
+		pdf.Ln(r.h(8))
+		row(balanceLabel, balance, Font{Family: family, Style: "B", Size: 12}, r.h(8))
+	}
+}
+
+func (r *layoutRenderer) drawPayment(block Block) {
+	pdf := r.pdf
+	b := r.data.Bill
+
+	// One box per payment method, of the block size or more, on the next
+	// page when it does not fit
+	_, pageH := pdf.GetPageSize()
+	_, top, _, breakMargin := pdf.GetMargins()
+	for i, method := range b.AllPaymentMethods() {
+		if i > 0 {
+			pdf.Ln(r.h(5))
+		}
+		section := paymentSection(method, b, r.opts.Payments)
+		// Grow the box to the title, details and notice of the section
+		box := block
+		box.H = math.Max(block.H, r.h(21+9*float64(len(section.Details))))
+		if pdf.GetY()+box.H > pageH-breakMargin {
+			pdf.AddPage()
+			pdf.SetY(top)
+		}
+		y := pdf.GetY()
+		r.drawPaymentSection(box, section)
+		pdf.SetY(y + box.H)
+	}
+}
+
+func (r *layoutRenderer) drawPaymentSection(block Block, section PaymentSection) {
+	pdf := r.pdf
+	family := block.Font.Family
+
+	r.setFillColor(block.Fill)
+	r.setTextColor(block.Color)
+	pdf.Rect(block.X, pdf.GetY(), block.W, block.H, "F")
+
+	// The QR code stays square, the details and notice fill the rest
+	padding, qrSize := r.w(5), 30*r.kf
+	textX := block.X + padding
+	if section.QRCode != "" {
+		textX += padding + qrSize
+	}
+	textW := block.W - textX + block.X - 2*padding
+
+	r.setFont(Font{Family: family, Style: "B", Size: 12})
+	pdf.SetX(block.X + padding)
+	pdf.CellFormat(block.W-2*padding, r.h(10), r.tr(section.Title), "", 0, "", false, 0, "")
+	pdf.Ln(r.h(10))
+
+	if section.QRCode != "" {
+		if qrFile := writeQRCode(section.QRCode); qrFile != "" {
+			pdf.Image(qrFile, block.X+padding, pdf.GetY(), qrSize, qrSize, false, "", 0, "")
+			defer os.Remove(qrFile)
+		}
+	}
+
+	for i, line := range section.Details {
+		if i > 0 {
+			pdf.Ln(r.h(9))
+		}
+		pdf.SetFillColor(255, 255, 255)
+		pdf.Rect(textX, pdf.GetY(), textW, r.h(8), "F")
+		pdf.SetX(textX)
+		r.setFont(Font{Family: "Courier", Size: 8})
+		pdf.SetTextColor(0, 0, 0)
+		pdf.CellFormat(textW, r.h(8), "  "+r.tr(line), "", 0, "", false, 0, "")
+	}
+
+	pdf.Ln(r.h(10))
+	pdf.SetX(textX)
+	r.setFont(Font{Family: family, Style: "I", Size: 8})
+	r.setTextColor(block.Color)
+	pdf.CellFormat(textW, r.h(6), r.tr(section.Notice), "", 0, "", false, 0, "")
+}
@@ -0,0 +1,84 @@
+package bill
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Page sizes of the PDF.
+const (
+	PageA4     = "A4"
+	PageLetter = "Letter"
+	PageLegal  = "Legal"
+	PageA5     = "A5"
+)
+
+// Page orientations of the PDF.
+const (
+	Portrait  = "portrait"
+	Landscape = "landscape"
+)
+
+// PageSizes lists the supported page sizes, the default first.
+func PageSizes() []string {
+	return []string{PageA4, PageLetter, PageLegal, PageA5}
+}
+
+// Orientations lists the supported orientations, the default first.
+func Orientations() []string {
+	return []string{Portrait, Landscape}
+}
+
+// ParsePageSize reads a page size case-insensitively, an empty value
+// meaning A4.
+func ParsePageSize(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return PageA4, nil
+	}
+	for _, size := range PageSizes() {
+		if strings.EqualFold(s, size) {
+			return size, nil
+		}
+	}
+	return "", fmt.Errorf("unknown page size %q (expected %s)", s, strings.Join(PageSizes(), ", "))
+}
+
+// ParseOrientation reads a page orientation, "p" and "l" being accepted
+// and an empty value meaning portrait.
+func ParseOrientation(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "p", Portrait:
+		return Portrait, nil
+	case "l", Landscape:
+		return Landscape, nil
+	}
+	return "", fmt.Errorf("unknown orientation %q (expected portrait or landscape)", s)
+}
+
+// pageFormat returns the gofpdf orientation and size of a bill's page.
+func pageFormat(b Bill) (orientation, size string, err error) {
+	if size, err = ParsePageSize(b.PageSize); err != nil {
+		return "", "", err
+	}
+	o, err := ParseOrientation(b.Orientation)
+	if err != nil {
+		return "", "", err
+	}
+	if o == Landscape {
+		return "L", size, nil
+	}
+	return "P", size, nil
+}
+
+// cssPageSize returns the CSS @page size of a bill, e.g. "letter landscape".
+func cssPageSize(b Bill) string {
+	size, err := ParsePageSize(b.PageSize)
+	if err != nil {
+		size = PageA4
+	}
+	if o, _ := ParseOrientation(b.Orientation); o == Landscape {
+		return size + " " + Landscape
+	}
+	return size
+}
@@ -0,0 +1,109 @@
+package bill
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Payment methods suggested when recording a payment. Any other value is
+// accepted.
+var PaymentMethods = []string{"bank transfer", "bitcoin", "lightning", "card", "cash"}
+
+// Payment is an amount received for an invoice. Amount is expressed in
+// Currency and converted to the invoice currency with Rate.
+type Payment struct {
+	Date      time.Time `json:"date"`
+	Amount    float64   `json:"amount"`
+	Method    string    `json:"method"`
+	Reference string    `json:"reference,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+	Rate      float64   `json:"rate,omitempty"`
+}
+
+// Converted returns the payment amount in the invoice currency.
+func (p Payment) Converted() float64 {
+	if p.Rate == 0 {
+		return p.Amount
+	}
+	return p.Amount * p.Rate
+}
+
+func (p Payment) Validate(invoiceCurrency string) error {
+	if p.Amount <= 0 {
+		return fmt.Errorf("payment amount must be positive")
+	}
+	if p.Date.IsZero() {
+		return fmt.Errorf("payment date is required")
+	}
+	if p.Rate < 0 {
+		return fmt.Errorf("exchange rate cannot be negative")
+	}
+	if p.Currency != "" && p.Currency != invoiceCurrency && p.Rate == 0 {
+		return fmt.Errorf("an exchange rate to %s is required for a payment in %s", invoiceCurrency, p.Currency)
+	}
+	return nil
+}
+
+// TotalPaid sums payments in the invoice currency.
+func TotalPaid(payments []Payment) float64 {
+	paid := 0.0
+	for _, p := range payments {
+		paid += p.Converted()
+	}
+	return roundAmount(paid)
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Paid returns the amount received so far in the invoice currency.
+func (inv *Invoice) Paid() float64 {
+	return TotalPaid(inv.Payments)
+}
+
+// Balance returns the outstanding amount, negative when the client paid
+// more than the invoice total.
+func (inv *Invoice) Balance() float64 {
+	return roundAmount(inv.Bill.Total - inv.Paid())
+}
+
+// AddPayment records a payment and moves the invoice to partially paid or
+// paid. Overpayments are kept and show up as a negative balance.
+func (inv *Invoice) AddPayment(p Payment, at time.Time) error {
+	switch inv.Status {
+	case StatusIssued, StatusSent, StatusPartiallyPaid:
+	default:
+		return fmt.Errorf("cannot record a payment on a %s invoice", inv.Status)
+	}
+	if inv.Bill.CreditNoteFor != "" {
+		return fmt.Errorf("cannot record a payment on credit note %s", inv.Bill.Number)
+	}
+	if err := p.Validate(inv.Bill.Currency); err != nil {
+		return err
+	}
+
+	inv.Payments = append(inv.Payments, p)
+
+	next := StatusPartiallyPaid
+	if inv.Balance() <= 0 {
+		next = StatusPaid
+	}
+	if next == inv.Status {
+		return nil
+	}
+	return inv.Transition(next, at)
+}
+
+// PDFOptions returns the options rendering the invoice as stored: with the
+// watermark of its status and its payments.
+func (inv *Invoice) PDFOptions() PDFOptions {
+	return PDFOptions{
+		Watermark: inv.Status.Watermark(),
+		Payments:  inv.Payments,
+		FacturX:   inv.FacturX,
+		Layout:    inv.Layout,
+		PDFA:      inv.PDFA,
+	}
+}
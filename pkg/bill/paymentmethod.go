@@ -0,0 +1,356 @@
+package bill
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PaymentMethod is a way for the client to pay a bill, drawn as a section
+// of the payment part of the PDF and the HTML page.
+type PaymentMethod interface {
+	// Type names the method in JSON, e.g. "sepa".
+	Type() string
+
+	// Validate checks the details of the method.
+	Validate() error
+
+	// Section returns what the payment part shows for a bill.
+	Section(b Bill) PaymentSection
+}
+
+// PaymentSection is the part of the payment section of a method: its
+// details, printed one per line, and the content of a QR code, if any.
+type PaymentSection struct {
+	Title   string
+	Details []string
+	QRCode  string
+	Notice  string
+}
+
+// Payment method types.
+const (
+	PaymentBitcoin  = "bitcoin"
+	PaymentSEPA     = "sepa"
+	PaymentLinkType = "link"
+	PaymentCheckout = "checkout"
+)
+
+// BitcoinPayment is an on-chain Bitcoin address.
+type BitcoinPayment struct {
+	Address string `json:"address"`
+}
+
+func (p BitcoinPayment) Type() string { return PaymentBitcoin }
+
+func (p BitcoinPayment) Validate() error {
+	if strings.TrimSpace(p.Address) == "" {
+		return fmt.Errorf("bitcoin payment: an address is required")
+	}
+	return nil
+}
+
+func (p BitcoinPayment) Section(b Bill) PaymentSection {
+	return PaymentSection{
+		Title:   "Bitcoin Payment Details",
+		Details: []string{p.Address},
+		QRCode:  "bitcoin:" + p.Address,
+		Notice:  "Please scan the QR code or copy the address above to make your payment",
+	}
+}
+
+// BankTransfer is a SEPA credit transfer to a bank account. The invoice
+// number is given as the reference, and euro invoices carry a GiroCode of
+// the transfer.
+type BankTransfer struct {
+	AccountHolder string `json:"account_holder"`
+	IBAN          string `json:"iban"`
+	BIC           string `json:"bic,omitempty"`
+	BankName      string `json:"bank_name,omitempty"`
+}
+
+func (p BankTransfer) Type() string { return PaymentSEPA }
+
+func (p BankTransfer) Validate() error {
+	if strings.TrimSpace(p.AccountHolder) == "" {
+		return fmt.Errorf("bank transfer: the account holder is required")
+	}
+	if err := ValidateIBAN(p.IBAN); err != nil {
+		return fmt.Errorf("bank transfer: %w", err)
+	}
+	if p.BIC != "" {
+		if err := ValidateBIC(p.BIC); err != nil {
+			return fmt.Errorf("bank transfer: %w", err)
+		}
+	}
+	return nil
+}
+
+// Notices of the bank transfer section, without and with a GiroCode.
+const (
+	transferNotice   = "Please quote the reference above with your transfer"
+	transferQRNotice = "Please scan the QR code with your banking app or quote the reference above"
+)
+
+func (p BankTransfer) Section(b Bill) PaymentSection {
+	details := []string{
+		"Account holder " + p.AccountHolder,
+		"IBAN           " + FormatIBAN(p.IBAN),
+	}
+	if p.BIC != "" {
+		details = append(details, "BIC            "+strings.ToUpper(p.BIC))
+	}
+	if p.BankName != "" {
+		details = append(details, "Bank           "+p.BankName)
+	}
+	details = append(details, "Reference      "+b.Number)
+	section := PaymentSection{
+		Title:   "Bank Transfer",
+		Details: details,
+		Notice:  transferNotice,
+	}
+	if giroCode, err := p.GiroCode(b, b.Total); err == nil {
+		section.QRCode = giroCode
+		section.Notice = transferQRNotice
+	}
+	return section
+}
+
+// PaymentLink is a page where the client pays, such as a PayPal.me or a
+// card payment link.
+type PaymentLink struct {
+	// Name of the service, e.g. "PayPal", shown as the title.
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+}
+
+func (p PaymentLink) Type() string { return PaymentLinkType }
+
+func (p PaymentLink) Validate() error {
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("payment link %q: expected an http or https URL", p.URL)
+	}
+	return nil
+}
+
+func (p PaymentLink) Section(b Bill) PaymentSection {
+	title := "Online Payment"
+	if p.Name != "" {
+		title = "Pay with " + p.Name
+	}
+	return PaymentSection{
+		Title:   title,
+		Details: []string{p.URL},
+		QRCode:  p.URL,
+		Notice:  "Please scan the QR code or open the link above to make your payment",
+	}
+}
+
+func (c *Checkout) Type() string { return PaymentCheckout }
+
+func (c *Checkout) Validate() error {
+	return PaymentLink{URL: c.URL}.Validate()
+}
+
+// Section shows the checkout page and the destinations that can be
+// printed.
+func (c *Checkout) Section(b Bill) PaymentSection {
+	section := PaymentLink{URL: c.URL}.Section(b)
+	for _, destination := range c.Destinations {
+		if destination.Printable() {
+			section.Details = append(section.Details, destination.Method+": "+destination.Destination)
+		}
+	}
+	return section
+}
+
+// PaymentMethodList lists payment methods, written in JSON as objects with a
+// "type" next to the fields of the method, e.g.
+// {"type": "sepa", "account_holder": "ACME", "iban": "DE89..."}.
+type PaymentMethodList []PaymentMethod
+
+// Validate checks every method.
+func (m PaymentMethodList) Validate() error {
+	for _, method := range m {
+		if err := method.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m PaymentMethodList) MarshalJSON() ([]byte, error) {
+	out := make([]map[string]interface{}, 0, len(m))
+	for _, method := range m {
+		data, err := json.Marshal(method)
+		if err != nil {
+			return nil, err
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		fields["type"] = method.Type()
+		out = append(out, fields)
+	}
+	return json.Marshal(out)
+}
+
+func (m *PaymentMethodList) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	methods := make(PaymentMethodList, 0, len(raw))
+	for i, item := range raw {
+		var kind struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(item, &kind); err != nil {
+			return fmt.Errorf("payment method %d: %w", i+1, err)
+		}
+		var method PaymentMethod
+		var err error
+		switch kind.Type {
+		case PaymentBitcoin:
+			var p BitcoinPayment
+			err = json.Unmarshal(item, &p)
+			method = p
+		case PaymentSEPA:
+			var p BankTransfer
+			err = json.Unmarshal(item, &p)
+			method = p
+		case PaymentLinkType:
+			var p PaymentLink
+			err = json.Unmarshal(item, &p)
+			method = p
+		case PaymentQRBill:
+			var p SwissQRBill
+			err = json.Unmarshal(item, &p)
+			method = p
+		default:
+			return fmt.Errorf("payment method %d: unknown type %q (expected %s, %s, %s or %s)", i+1, kind.Type, PaymentBitcoin, PaymentSEPA, PaymentLinkType, PaymentQRBill)
+		}
+		if err != nil {
+			return fmt.Errorf("payment method %d: %w", i+1, err)
+		}
+		methods = append(methods, method)
+	}
+	*m = methods
+	return nil
+}
+
+// AllPaymentMethods returns the ways to pay the bill in the order of the
+// payment sections: its checkout, which replaces the Bitcoin address, or
+// else the Bitcoin address, then its payment methods.
+func (b Bill) AllPaymentMethods() []PaymentMethod {
+	var methods []PaymentMethod
+	switch {
+	case b.Checkout != nil:
+		methods = append(methods, b.Checkout)
+	case b.BitcoinAddress != "":
+		methods = append(methods, BitcoinPayment{Address: b.BitcoinAddress})
+	}
+	for _, method := range b.PaymentMethods {
+		if p, ok := method.(BitcoinPayment); ok && p.Address == b.BitcoinAddress {
+			continue
+		}
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+// BankTransfer returns the first bank transfer method of the bill, if any.
+func (b Bill) BankTransfer() (BankTransfer, bool) {
+	for _, method := range b.PaymentMethods {
+		if p, ok := method.(BankTransfer); ok {
+			return p, true
+		}
+	}
+	return BankTransfer{}, false
+}
+
+// ibanLengths is the length of the IBANs of each country of the IBAN
+// registry.
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16,
+	"BG": 22, "BH": 22, "BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28,
+	"CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29, "ES": 24,
+	"FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18,
+	"GR": 27, "GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23,
+	"IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32,
+	"LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22,
+	"MK": 19, "MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24,
+	"PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "SA": 24,
+	"SC": 31, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+// NormalizeIBAN removes the spaces of an IBAN and upper-cases it.
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// FormatIBAN writes an IBAN in groups of four characters, as printed.
+func FormatIBAN(iban string) string {
+	iban = NormalizeIBAN(iban)
+	var groups []string
+	for len(iban) > 4 {
+		groups = append(groups, iban[:4])
+		iban = iban[4:]
+	}
+	return strings.Join(append(groups, iban), " ")
+}
+
+// ValidateIBAN checks the country, the length and the ISO 7064 mod 97-10
+// check digits of an IBAN, spaces allowed.
+func ValidateIBAN(iban string) error {
+	normalized := NormalizeIBAN(iban)
+	if len(normalized) < 15 {
+		return fmt.Errorf("IBAN %q is too short", iban)
+	}
+	for _, c := range normalized {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fmt.Errorf("IBAN %q holds invalid characters", iban)
+		}
+	}
+	length, ok := ibanLengths[normalized[:2]]
+	if !ok {
+		return fmt.Errorf("IBAN %q: unknown country %s", iban, normalized[:2])
+	}
+	if len(normalized) != length {
+		return fmt.Errorf("IBAN %q: %s IBANs have %d characters, not %d", iban, normalized[:2], length, len(normalized))
+	}
+	if ibanRemainder(normalized) != 1 {
+		return fmt.Errorf("IBAN %q: wrong check digits", iban)
+	}
+	return nil
+}
+
+// ibanRemainder returns the IBAN, its first four characters moved to the
+// end and its letters written as numbers (A = 10 ... Z = 35), modulo 97.
+func ibanRemainder(iban string) int {
+	remainder := 0
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' {
+			remainder = (remainder*100 + int(c-'A'+10)) % 97
+		} else {
+			remainder = (remainder*10 + int(c-'0')) % 97
+		}
+	}
+	return remainder
+}
+
+var bicPattern = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+
+// ValidateBIC checks the format of a BIC (SWIFT code): a bank code, a
+// country code and a location code, then an optional branch code.
+func ValidateBIC(bic string) error {
+	if !bicPattern.MatchString(strings.ToUpper(strings.TrimSpace(bic))) {
+		return fmt.Errorf("BIC %q: expected 8 or 11 letters and digits, e.g. COBADEFFXXX", bic)
+	}
+	return nil
+}
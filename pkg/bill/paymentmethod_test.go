@@ -0,0 +1,69 @@
+package bill
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateIBAN(t *testing.T) {
+	for _, tc := range []struct {
+		iban    string
+		wantErr string
+	}{
+		{"DE89370400440532013000", ""},
+		{"de89 3704 0044 0532 0130 00", ""},
+		{"GB82 WEST 1234 5698 7654 32", ""},
+		{"CH93 0076 2011 6238 5295 7", ""},
+		{"NO9386011117947", ""},
+		{"DE89370400440532013001", "check digits"},
+		{"DE98370400440532013000", "check digits"},
+		{"DE8937040044053201300", "22 characters"},
+		{"XX89370400440532013000", "unknown country"},
+		{"DE89-3704-0044-0532-0130-00", "invalid characters"},
+		{"DE89", "too short"},
+	} {
+		err := ValidateIBAN(tc.iban)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("ValidateIBAN(%q): %v", tc.iban, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("ValidateIBAN(%q) = %v, want an error mentioning %q", tc.iban, err, tc.wantErr)
+		}
+	}
+}
+
+func TestIBANRemainder(t *testing.T) {
+	// Check digits 00 give 98 minus the check digits of the account
+	if got := ibanRemainder("DE00370400440532013000"); 98-got != 89 {
+		t.Errorf("ibanRemainder = %d, want the check digits 89", got)
+	}
+	if got := ibanRemainder("DE89370400440532013000"); got != 1 {
+		t.Errorf("ibanRemainder of a valid IBAN = %d, want 1", got)
+	}
+}
+
+func TestFormatIBAN(t *testing.T) {
+	for iban, want := range map[string]string{
+		"DE89370400440532013000":        "DE89 3704 0044 0532 0130 00",
+		"ch9300762011623852957":         "CH93 0076 2011 6238 5295 7",
+		" GB82 WEST 1234 5698 7654 32 ": "GB82 WEST 1234 5698 7654 32",
+	} {
+		if got := FormatIBAN(iban); got != want {
+			t.Errorf("FormatIBAN(%q) = %q, want %q", iban, got, want)
+		}
+	}
+}
+
+func TestValidateBIC(t *testing.T) {
+	for bic, valid := range map[string]bool{
+		"COBADEFFXXX": true,
+		"cobadeff":    true,
+		"COBADEFF1":   false,
+		"COBA1EFFXXX": false,
+		"":            false,
+	} {
+		if err := ValidateBIC(bic); (err == nil) != valid {
+			t.Errorf("ValidateBIC(%q) = %v, want valid %v", bic, err, valid)
+		}
+	}
+}
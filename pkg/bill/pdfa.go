@@ -0,0 +1,499 @@
+package bill
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	pdfCreator  = "bill"
+	pdfProducer = "bill (gofpdf)"
+)
+
+// PDFAConformance is the PDF/A level of an archival PDF.
+type PDFAConformance string
+
+const (
+	PDFA1b PDFAConformance = "1b"
+	PDFA3b PDFAConformance = "3b"
+)
+
+// ParsePDFAConformance reads a PDF/A level such as "1b" or "PDF/A-3b".
+func ParsePDFAConformance(s string) (PDFAConformance, error) {
+	level := strings.ToLower(strings.TrimSpace(s))
+	level = strings.TrimPrefix(strings.TrimPrefix(level, "pdf/"), "a-")
+	switch PDFAConformance(level) {
+	case PDFA1b, PDFA3b:
+		return PDFAConformance(level), nil
+	}
+	return "", fmt.Errorf("unknown PDF/A level %q (expected 1b or 3b)", s)
+}
+
+// part returns the PDF/A part number, 1 or 3.
+func (c PDFAConformance) part() int {
+	if c == PDFA1b {
+		return 1
+	}
+	return 3
+}
+
+// pdfaFonts holds the fonts embedded in PDF/A files, with their licenses:
+// the SIL Open Font License for Noto Sans and the Bitstream Vera license
+// for DejaVu Sans Mono.
+//
+//go:embed fonts/*.ttf
+var pdfaFonts embed.FS
+
+// embedPDFAFonts registers embeddable fonts under the names of the core
+// fonts used by layouts, which PDF/A forbids as they are not embedded:
+// Noto Sans for Helvetica and DejaVu Sans Mono for Courier. PDF/A files
+// are therefore set in Noto Sans rather than Helvetica, with slightly
+// wider text. Text drawn with them is UTF-8, without the cp1252
+// translation of the core fonts.
+func embedPDFAFonts(pdf *gofpdf.Fpdf) error {
+	for _, font := range []struct{ family, style, file string }{
+		{"helvetica", "", "NotoSans-Regular.ttf"},
+		{"helvetica", "B", "NotoSans-Bold.ttf"},
+		{"helvetica", "I", "NotoSans-Italic.ttf"},
+		{"helvetica", "BI", "NotoSans-BoldItalic.ttf"},
+		{"courier", "", "DejaVuSansMono-Powerline.ttf"},
+	} {
+		data, err := pdfaFonts.ReadFile("fonts/" + font.file)
+		if err != nil {
+			return err
+		}
+		pdf.AddUTF8FontFromBytes(font.family, font.style, data)
+		if err := pdf.Error(); err != nil {
+			return fmt.Errorf("PDF/A font %s: %w", font.file, err)
+		}
+	}
+	return nil
+}
+
+// pdfaInfo is the document information of a PDF/A file, written both in
+// the Info dictionary and in the XMP metadata, which must agree.
+type pdfaInfo struct {
+	Title  string
+	Author string
+	Date   time.Time
+
+	// Conformance is the PDF/A level declared in the metadata.
+	Conformance PDFAConformance
+
+	// FacturX declares the embedded invoice in the metadata when set.
+	FacturX FacturXProfile
+}
+
+// pdfAttachment is a file embedded as an associated file of the document.
+type pdfAttachment struct {
+	Name         string
+	Description  string
+	MimeType     string
+	Relationship string
+	Data         []byte
+}
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	pagesPattern     = regexp.MustCompile(`/Pages\s+(\d+)\s+0\s+R`)
+	prevPattern      = regexp.MustCompile(`/Prev\s+(\d+)`)
+)
+
+// pdfObjects is the body of a PDF as written by gofpdf: uncompressed
+// objects indexed by cross-reference tables, the first one possibly
+// followed by incremental updates.
+type pdfObjects struct {
+	objects map[int][]byte
+	size    int
+	root    int
+	info    int
+}
+
+func trailerRef(trailer []byte, key string) (int, error) {
+	m := regexp.MustCompile(`/` + key + `\s+(\d+)\s+0\s+R`).FindSubmatch(trailer)
+	if m == nil {
+		return 0, fmt.Errorf("PDF trailer has no /%s", key)
+	}
+	return strconv.Atoi(string(m[1]))
+}
+
+func parsePDFObjects(data []byte) (*pdfObjects, error) {
+	m := startxrefPattern.FindSubmatch(data)
+	if m == nil {
+		return nil, fmt.Errorf("PDF has no startxref")
+	}
+	xrefOffset, _ := strconv.Atoi(string(m[1]))
+
+	// Incremental updates, such as signatures, chain their tables to the
+	// previous ones; the latest entry of an object wins
+	pdf := &pdfObjects{objects: make(map[int][]byte)}
+	offsets := make(map[int]int)
+	boundaries := []int{len(data)}
+	var trailer []byte
+	for seen := map[int]bool{}; !seen[xrefOffset]; {
+		seen[xrefOffset] = true
+		if xrefOffset >= len(data) || !bytes.HasPrefix(data[xrefOffset:], []byte("xref")) {
+			return nil, fmt.Errorf("PDF cross-reference table not found")
+		}
+		boundaries = append(boundaries, xrefOffset)
+
+		trailerStart := bytes.Index(data[xrefOffset:], []byte("trailer"))
+		if trailerStart < 0 {
+			return nil, fmt.Errorf("PDF has no trailer")
+		}
+		table := strings.Fields(string(data[xrefOffset+len("xref") : xrefOffset+trailerStart]))
+		section := data[xrefOffset+trailerStart:]
+		if end := bytes.Index(section, []byte("startxref")); end >= 0 {
+			section = section[:end]
+		}
+		if trailer == nil {
+			trailer = section
+		}
+
+		for i := 0; i+1 < len(table); {
+			first, err1 := strconv.Atoi(table[i])
+			count, err2 := strconv.Atoi(table[i+1])
+			if err1 != nil || err2 != nil || i+2+3*count > len(table) {
+				return nil, fmt.Errorf("malformed PDF cross-reference table")
+			}
+			for n := 0; n < count; n++ {
+				entry := table[i+2+3*n : i+5+3*n]
+				if _, ok := offsets[first+n]; ok || entry[2] != "n" {
+					continue
+				}
+				offset, err := strconv.Atoi(entry[0])
+				if err != nil || offset >= xrefOffset {
+					return nil, fmt.Errorf("malformed PDF cross-reference entry")
+				}
+				offsets[first+n] = offset
+			}
+			if first+count > pdf.size {
+				pdf.size = first + count
+			}
+			i += 2 + 3*count
+		}
+
+		prev := prevPattern.FindSubmatch(section)
+		if prev == nil {
+			break
+		}
+		xrefOffset, _ = strconv.Atoi(string(prev[1]))
+	}
+
+	// Each object runs until the next object or cross-reference table
+	for _, offset := range offsets {
+		boundaries = append(boundaries, offset)
+	}
+	sort.Ints(boundaries)
+	for number, offset := range offsets {
+		end := boundaries[sort.SearchInts(boundaries, offset+1)]
+		object := bytes.TrimRight(data[offset:end], "\r\n ")
+		if !bytes.HasPrefix(object, []byte(fmt.Sprintf("%d 0 obj", number))) || !bytes.HasSuffix(object, []byte("endobj")) {
+			return nil, fmt.Errorf("malformed PDF object %d", number)
+		}
+		pdf.objects[number] = object
+	}
+
+	var err error
+	if pdf.root, err = trailerRef(trailer, "Root"); err != nil {
+		return nil, err
+	}
+	if pdf.info, err = trailerRef(trailer, "Info"); err != nil {
+		return nil, err
+	}
+	if _, ok := pdf.objects[pdf.root]; !ok {
+		return nil, fmt.Errorf("PDF catalog not found")
+	}
+	return pdf, nil
+}
+
+// pdfText encodes a PDF text string, in UTF-16 when not plain ASCII.
+func pdfText(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r > 126 || r < 32 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+	}
+
+	var hex strings.Builder
+	hex.WriteString("<FEFF")
+	for _, r := range s {
+		if r > 0xFFFF {
+			r -= 0x10000
+			fmt.Fprintf(&hex, "%04X%04X", 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+			continue
+		}
+		fmt.Fprintf(&hex, "%04X", r)
+	}
+	hex.WriteString(">")
+	return hex.String()
+}
+
+func pdfDate(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("(D:%s%c%02d'%02d')", t.Format("20060102150405"), sign, offset/3600, offset%3600/60)
+}
+
+func pdfName(s string) string {
+	var name strings.Builder
+	for _, c := range []byte(s) {
+		if c < '!' || c > '~' || strings.IndexByte("/#()<>[]{}%", c) >= 0 {
+			fmt.Fprintf(&name, "#%02X", c)
+			continue
+		}
+		name.WriteByte(c)
+	}
+	return "/" + name.String()
+}
+
+func pdfStream(dict string, data []byte, compress bool) []byte {
+	if compress {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(data)
+		w.Close()
+		data = buf.Bytes()
+		dict += " /Filter /FlateDecode"
+	}
+	var stream bytes.Buffer
+	fmt.Fprintf(&stream, "<<%s /Length %d>>\nstream\n", dict, len(data))
+	stream.Write(data)
+	stream.WriteString("\nendstream")
+	return stream.Bytes()
+}
+
+func xmlText(s string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+const facturXSchema = `  <rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+   <fx:DocumentType>INVOICE</fx:DocumentType>
+   <fx:DocumentFileName>%s</fx:DocumentFileName>
+   <fx:Version>1.0</fx:Version>
+   <fx:ConformanceLevel>%s</fx:ConformanceLevel>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+   <pdfaExtension:schemas>
+    <rdf:Bag>
+     <rdf:li rdf:parseType="Resource">
+      <pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+      <pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+      <pdfaSchema:prefix>fx</pdfaSchema:prefix>
+      <pdfaSchema:property>
+       <rdf:Seq>
+        <rdf:li rdf:parseType="Resource">
+         <pdfaProperty:name>DocumentFileName</pdfaProperty:name>
+         <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+         <pdfaProperty:category>external</pdfaProperty:category>
+         <pdfaProperty:description>The name of the embedded XML document</pdfaProperty:description>
+        </rdf:li>
+        <rdf:li rdf:parseType="Resource">
+         <pdfaProperty:name>DocumentType</pdfaProperty:name>
+         <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+         <pdfaProperty:category>external</pdfaProperty:category>
+         <pdfaProperty:description>The type of the hybrid document in capital letters, e.g. INVOICE or ORDER</pdfaProperty:description>
+        </rdf:li>
+        <rdf:li rdf:parseType="Resource">
+         <pdfaProperty:name>Version</pdfaProperty:name>
+         <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+         <pdfaProperty:category>external</pdfaProperty:category>
+         <pdfaProperty:description>The actual version of the standard applying to the embedded XML document</pdfaProperty:description>
+        </rdf:li>
+        <rdf:li rdf:parseType="Resource">
+         <pdfaProperty:name>ConformanceLevel</pdfaProperty:name>
+         <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+         <pdfaProperty:category>external</pdfaProperty:category>
+         <pdfaProperty:description>The conformance level of the embedded XML document</pdfaProperty:description>
+        </rdf:li>
+       </rdf:Seq>
+      </pdfaSchema:property>
+     </rdf:li>
+    </rdf:Bag>
+   </pdfaExtension:schemas>
+  </rdf:Description>
+`
+
+func xmpMetadata(info pdfaInfo) []byte {
+	date := info.Date.Format(time.RFC3339)
+
+	var xmp strings.Builder
+	xmp.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	xmp.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	xmp.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	fmt.Fprintf(&xmp, `  <rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+   <pdfaid:part>%d</pdfaid:part>
+   <pdfaid:conformance>B</pdfaid:conformance>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:format>application/pdf</dc:format>
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:title>
+   <dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+   <pdf:Producer>%s</pdf:Producer>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+   <xmp:CreatorTool>%s</xmp:CreatorTool>
+   <xmp:CreateDate>%s</xmp:CreateDate>
+   <xmp:ModifyDate>%s</xmp:ModifyDate>
+  </rdf:Description>
+`, info.Conformance.part(), xmlText(info.Title), xmlText(info.Author), pdfProducer, pdfCreator, date, date)
+	if info.FacturX != "" {
+		fmt.Fprintf(&xmp, facturXSchema, FacturXFilename, info.FacturX)
+	}
+	xmp.WriteString(" </rdf:RDF>\n</x:xmpmeta>\n")
+	// Padding lets editors update the packet in place
+	xmp.WriteString(strings.Repeat(strings.Repeat(" ", 99)+"\n", 20))
+	xmp.WriteString("<?xpacket end=\"w\"?>")
+	return []byte(xmp.String())
+}
+
+// convertPDFA rewrites a PDF produced by gofpdf as PDF/A-1b or PDF/A-3b:
+// it adds the XMP metadata, an sRGB output intent and, for PDF/A-3, the
+// attachments as associated files, and rebuilds the catalog, the Info
+// dictionary and the cross-reference table. Fonts must have been embedded
+// with embedPDFAFonts.
+func convertPDFA(data []byte, info pdfaInfo, attachments []pdfAttachment) ([]byte, error) {
+	if len(attachments) > 0 && info.Conformance.part() == 1 {
+		return nil, fmt.Errorf("PDF/A-1 cannot embed files, use PDF/A-3")
+	}
+	pdf, err := parsePDFObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagesPattern.FindSubmatch(pdf.objects[pdf.root])
+	if pages == nil {
+		return nil, fmt.Errorf("PDF catalog has no pages")
+	}
+
+	next := pdf.size
+	added := make(map[int][]byte)
+	add := func(object []byte) int {
+		number := next
+		added[number] = object
+		next++
+		return number
+	}
+
+	var names, files []string
+	for _, attachment := range attachments {
+		sum := md5.Sum(attachment.Data)
+		file := add(pdfStream(fmt.Sprintf(" /Type /EmbeddedFile /Subtype %s /Params << /ModDate %s /Size %d /CheckSum <%X> >>",
+			pdfName(attachment.MimeType), pdfDate(info.Date), len(attachment.Data), sum), attachment.Data, true))
+		spec := add([]byte(fmt.Sprintf("<< /Type /Filespec /F %s /UF %s /Desc %s /AFRelationship /%s /EF << /F %d 0 R /UF %d 0 R >> >>",
+			pdfText(attachment.Name), pdfText(attachment.Name), pdfText(attachment.Description), attachment.Relationship, file, file)))
+		names = append(names, fmt.Sprintf("%s %d 0 R", pdfText(attachment.Name), spec))
+		files = append(files, fmt.Sprintf("%d 0 R", spec))
+	}
+
+	profile := add(pdfStream(" /N 3", srgbProfile(), true))
+	intent := add([]byte(fmt.Sprintf("<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>", profile)))
+	metadata := add(pdfStream(" /Type /Metadata /Subtype /XML", xmpMetadata(info), false))
+
+	catalog := fmt.Sprintf("<< /Type /Catalog /Pages %s 0 R /Metadata %d 0 R /OutputIntents [%d 0 R] /ViewerPreferences << /DisplayDocTitle true >>",
+		pages[1], metadata, intent)
+	if len(attachments) > 0 {
+		catalog += fmt.Sprintf(" /AF [%s] /Names << /EmbeddedFiles << /Names [%s] >> >>",
+			strings.Join(files, " "), strings.Join(names, " "))
+	}
+	added[pdf.root] = []byte(catalog + " >>")
+	added[pdf.info] = []byte(fmt.Sprintf("<< /Title %s /Author %s /Creator (%s) /Producer (%s) /CreationDate %s /ModDate %s >>",
+		pdfText(info.Title), pdfText(info.Author), pdfCreator, pdfProducer, pdfDate(info.Date), pdfDate(info.Date)))
+
+	var out bytes.Buffer
+	// PDF/A-1 is based on PDF 1.4, PDF/A-3 on PDF 1.7
+	if info.Conformance.part() == 1 {
+		out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	} else {
+		out.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	}
+	offsets := make([]int, next)
+	for number := 1; number < next; number++ {
+		if object, ok := added[number]; ok {
+			offsets[number] = out.Len()
+			fmt.Fprintf(&out, "%d 0 obj\n", number)
+			out.Write(object)
+			out.WriteString("\nendobj\n")
+		} else if object, ok := pdf.objects[number]; ok {
+			offsets[number] = out.Len()
+			out.Write(object)
+			out.WriteString("\n")
+		}
+	}
+
+	xrefOffset := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", next)
+	for number := 1; number < next; number++ {
+		if offsets[number] == 0 {
+			out.WriteString("0000000000 65535 f \n")
+			continue
+		}
+		fmt.Fprintf(&out, "%010d 00000 n \n", offsets[number])
+	}
+	id := md5.Sum(out.Bytes())
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R /ID [<%X> <%X>] >>\nstartxref\n%d\n%%%%EOF\n",
+		next, pdf.root, pdf.info, id, id, xrefOffset)
+	return out.Bytes(), nil
+}
+
+// archivePDF turns a rendered bill into a PDF/A file titled with the
+// bill number.
+func archivePDF(data []byte, b Bill, conformance PDFAConformance) ([]byte, error) {
+	return convertPDFA(data, pdfaInfo{
+		Title:       b.Number,
+		Author:      b.CompanyName,
+		Date:        time.Now(),
+		Conformance: conformance,
+	}, nil)
+}
+
+// embedFacturX turns a rendered bill into a Factur-X hybrid invoice, a
+// PDF/A-3b file.
+func embedFacturX(data []byte, b Bill, profile FacturXProfile, invoiceXML []byte) ([]byte, error) {
+	title := "Invoice " + b.Number
+	if b.CreditNoteFor != "" {
+		title = "Credit note " + b.Number
+	}
+	// Data for the profiles too poor to replace the PDF, Alternative when
+	// the XML carries the whole invoice
+	relationship := "Alternative"
+	if profile == FacturXMinimum {
+		relationship = "Data"
+	}
+
+	return convertPDFA(data, pdfaInfo{
+		Title:       title,
+		Author:      b.CompanyName,
+		Date:        time.Now(),
+		Conformance: PDFA3b,
+		FacturX:     profile,
+	}, []pdfAttachment{{
+		Name:         FacturXFilename,
+		Description:  "Factur-X invoice",
+		MimeType:     "text/xml",
+		Relationship: relationship,
+		Data:         invoiceXML,
+	}})
+}
@@ -0,0 +1,250 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+var (
+	headerPattern       = regexp.MustCompile(`^%PDF-1\.(\d)`)
+	metadataPattern     = regexp.MustCompile(`/Metadata\s+(\d+)\s+0\s+R`)
+	pdfaPartPattern     = regexp.MustCompile(`<pdfaid:part>(\d)</pdfaid:part>`)
+	pdfaLevelPattern    = regexp.MustCompile(`<pdfaid:conformance>([ABU])</pdfaid:conformance>`)
+	xmpTitlePattern     = regexp.MustCompile(`(?s)<dc:title>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	infoTitlePattern    = regexp.MustCompile(`/Title\s*(\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f]*>)`)
+	fontPattern         = regexp.MustCompile(`/Type\s*/Font[\s/>]`)
+	baseFontPattern     = regexp.MustCompile(`/BaseFont\s*/([^\s/<>\[\]()]+)`)
+	descriptorPattern   = regexp.MustCompile(`/FontDescriptor\s+(\d+)\s+0\s+R`)
+	alphaPattern        = regexp.MustCompile(`/(CA|ca)\s+([\d.]+)`)
+	blendModePattern    = regexp.MustCompile(`/BM\s*/(\w+)`)
+	softMaskPattern     = regexp.MustCompile(`/SMask\s*(/None|\d+\s+0\s+R|<<)`)
+	intentProfile       = regexp.MustCompile(`/S\s*/GTS_PDFA1[^>]*/DestOutputProfile\s+\d+\s+0\s+R|/DestOutputProfile\s+\d+\s+0\s+R[^>]*/S\s*/GTS_PDFA1`)
+	transparencyPattern = regexp.MustCompile(`/Group\s*<<[^>]*/S\s*/Transparency`)
+)
+
+// forbiddenPDFA lists the keys no PDF/A file may use, with the reason.
+var forbiddenPDFA = []struct {
+	key    string
+	reason string
+}{
+	{"/JavaScript", "JavaScript is not allowed"},
+	{"/JS ", "JavaScript is not allowed"},
+	{"/Launch", "launch actions are not allowed"},
+	{"/LZWDecode", "LZW compression is not allowed"},
+	{"/Alternates", "alternate images are not allowed"},
+	{"/Interpolate true", "image interpolation is not allowed"},
+	{"/Encrypt", "encryption is not allowed"},
+}
+
+// pdfDict returns the dictionary part of an object, leaving out the data
+// of streams.
+func pdfDict(object []byte) []byte {
+	if i := bytes.Index(object, []byte("stream")); i >= 0 {
+		return object[:i]
+	}
+	return object
+}
+
+// pdfStreamData returns the raw data of a stream object.
+func pdfStreamData(object []byte) []byte {
+	start := bytes.Index(object, []byte("stream"))
+	end := bytes.LastIndex(object, []byte("endstream"))
+	if start < 0 || end < start {
+		return nil
+	}
+	data := object[start+len("stream") : end]
+	data = bytes.TrimPrefix(bytes.TrimPrefix(data, []byte("\r")), []byte("\n"))
+	return bytes.TrimSuffix(bytes.TrimSuffix(data, []byte("\n")), []byte("\r"))
+}
+
+// decodePDFText decodes a literal or hexadecimal PDF text string.
+func decodePDFText(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+	if s[0] == '<' {
+		var units []uint16
+		hex := s[1 : len(s)-1]
+		for i := 0; i+4 <= len(hex); i += 4 {
+			unit, _ := strconv.ParseUint(hex[i:i+4], 16, 16)
+			units = append(units, uint16(unit))
+		}
+		if len(units) > 0 && units[0] == 0xFEFF {
+			units = units[1:]
+		}
+		return string(utf16.Decode(units))
+	}
+	var text []byte
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		text = append(text, s[i])
+	}
+	return string(text)
+}
+
+// CheckPDFA checks a PDF against the PDF/A-1b or PDF/A-3b rules the
+// renderer has to follow, reporting every non-compliant construct found:
+// missing metadata or output intent, fonts that are not embedded,
+// transparency, and the actions, filters and attachments PDF/A forbids.
+// It reads PDFs with a cross-reference table, as written by this package;
+// a full validator such as veraPDF remains the reference.
+func CheckPDFA(data []byte) []error {
+	var problems []error
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	header := headerPattern.FindSubmatch(data)
+	if header == nil {
+		return []error{fmt.Errorf("not a PDF file")}
+	}
+	version, _ := strconv.Atoi(string(header[1]))
+	if line := bytes.IndexByte(data, '\n'); line < 0 || len(data) < line+5 ||
+		data[line+1] != '%' || data[line+2] < 128 || data[line+3] < 128 || data[line+4] < 128 || data[line+5] < 128 {
+		report("the header is not followed by a binary comment")
+	}
+
+	pdf, err := parsePDFObjects(data)
+	if err != nil {
+		return append(problems, err)
+	}
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	if !bytes.Contains(trailer, []byte("/ID")) {
+		report("the trailer has no file identifier")
+	}
+	if bytes.Contains(trailer, []byte("/Encrypt")) {
+		report("encryption is not allowed")
+	}
+
+	// Metadata declaring the PDF/A part
+	part := 0
+	catalog := pdfDict(pdf.objects[pdf.root])
+	xmp := []byte(nil)
+	if m := metadataPattern.FindSubmatch(catalog); m == nil {
+		report("the catalog has no XMP metadata")
+	} else {
+		number, _ := strconv.Atoi(string(m[1]))
+		object := pdf.objects[number]
+		dict := pdfDict(object)
+		switch {
+		case object == nil:
+			report("the XMP metadata object %d is missing", number)
+		case bytes.Contains(dict, []byte("/Filter")):
+			report("object %d: the XMP metadata must not be compressed", number)
+		default:
+			xmp = pdfStreamData(object)
+		}
+	}
+	if xmp != nil {
+		if m := pdfaPartPattern.FindSubmatch(xmp); m == nil {
+			report("the XMP metadata has no pdfaid:part")
+		} else {
+			part, _ = strconv.Atoi(string(m[1]))
+		}
+		if !pdfaLevelPattern.Match(xmp) {
+			report("the XMP metadata has no pdfaid:conformance")
+		}
+
+		// The Info dictionary must agree with the metadata
+		var infoTitle, xmpTitle string
+		if m := infoTitlePattern.FindSubmatch(pdfDict(pdf.objects[pdf.info])); m != nil {
+			infoTitle = decodePDFText(string(m[1]))
+		}
+		if m := xmpTitlePattern.FindSubmatch(xmp); m != nil {
+			xmpTitle = decodeXMLText(string(m[1]))
+		}
+		if infoTitle != xmpTitle {
+			report("the document title %q differs from the XMP title %q", infoTitle, xmpTitle)
+		}
+	}
+	switch {
+	case part == 1 && version > 4:
+		report("PDF/A-1 files must be PDF 1.4 at most, found 1.%d", version)
+	case part != 0 && part != 1 && part != 3:
+		report("PDF/A-%d is not supported, expected PDF/A-1 or PDF/A-3", part)
+	}
+
+	if !bytes.Contains(catalog, []byte("/OutputIntents")) {
+		report("the catalog has no output intent")
+	}
+	if part == 1 && (bytes.Contains(catalog, []byte("/EmbeddedFiles")) || bytes.Contains(catalog, []byte("/AF "))) {
+		report("PDF/A-1 files cannot embed files")
+	}
+
+	numbers := make([]int, 0, len(pdf.objects))
+	for number := range pdf.objects {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	intent := false
+	for _, number := range numbers {
+		dict := pdfDict(pdf.objects[number])
+
+		if bytes.Contains(dict, []byte("/OutputIntent")) && intentProfile.Match(dict) {
+			intent = true
+		}
+
+		for _, forbidden := range forbiddenPDFA {
+			if bytes.Contains(dict, []byte(forbidden.key)) {
+				report("object %d: %s", number, forbidden.reason)
+			}
+		}
+
+		// Every font but the composite ones, checked through their
+		// descendants, must carry its font program
+		if fontPattern.Match(dict) &&
+			!bytes.Contains(dict, []byte("/Subtype /Type0")) && !bytes.Contains(dict, []byte("/Subtype /Type3")) {
+			name := "?"
+			if m := baseFontPattern.FindSubmatch(dict); m != nil {
+				name = string(m[1])
+			}
+			embedded := false
+			if m := descriptorPattern.FindSubmatch(dict); m != nil {
+				descriptor, _ := strconv.Atoi(string(m[1]))
+				embedded = bytes.Contains(pdfDict(pdf.objects[descriptor]), []byte("/FontFile"))
+			}
+			if !embedded {
+				report("object %d: font %s is not embedded", number, name)
+			}
+		}
+
+		// Transparency
+		if m := softMaskPattern.FindSubmatch(dict); m != nil && string(m[1]) != "/None" {
+			report("object %d: transparency is not allowed (soft mask)", number)
+		}
+		for _, m := range alphaPattern.FindAllSubmatch(dict, -1) {
+			if alpha, err := strconv.ParseFloat(string(m[2]), 64); err == nil && alpha != 1 {
+				report("object %d: transparency is not allowed (/%s %s)", number, m[1], m[2])
+			}
+		}
+		if m := blendModePattern.FindSubmatch(dict); m != nil && string(m[1]) != "Normal" && string(m[1]) != "Compatible" {
+			report("object %d: transparency is not allowed (blend mode %s)", number, m[1])
+		}
+		if transparencyPattern.Match(dict) {
+			report("object %d: transparency groups are not allowed", number)
+		}
+	}
+	if bytes.Contains(catalog, []byte("/OutputIntents")) && !intent {
+		report("no PDF/A output intent with an ICC profile")
+	}
+	return problems
+}
+
+// decodeXMLText decodes the entities written by xmlText.
+func decodeXMLText(s string) string {
+	var text struct {
+		Value string `xml:",chardata"`
+	}
+	if err := xml.Unmarshal([]byte("<t>"+s+"</t>"), &text); err != nil {
+		return s
+	}
+	return text.Value
+}
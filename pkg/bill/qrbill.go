@@ -0,0 +1,338 @@
+package bill
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SwissQRBill is payment with the Swiss QR-bill: a payment part and
+// receipt at the bottom of the last page, whose Swiss QR code banking apps
+// scan. Invoices paid to a QR-IBAN carry a QR reference made of the
+// reference prefix and the digits of the invoice number; invoices paid to
+// an IBAN carry a creditor reference (SCOR) made of the invoice number.
+type SwissQRBill struct {
+	// IBAN or QR-IBAN of a Swiss or Liechtenstein account.
+	IBAN string `json:"iban"`
+
+	// Creditor is the account holder, the company of the bill when empty.
+	// Its address is the one of the bill.
+	Creditor string `json:"creditor,omitempty"`
+
+	// ReferencePrefix starts the QR references, e.g. the customer number
+	// given by the bank.
+	ReferencePrefix string `json:"reference_prefix,omitempty"`
+}
+
+// PaymentQRBill is the type of the Swiss QR-bill payment method.
+const PaymentQRBill = "qrbill"
+
+func (p SwissQRBill) Type() string { return PaymentQRBill }
+
+func (p SwissQRBill) Validate() error {
+	if err := ValidateIBAN(p.IBAN); err != nil {
+		return fmt.Errorf("qr-bill: %w", err)
+	}
+	if country := NormalizeIBAN(p.IBAN)[:2]; country != "CH" && country != "LI" {
+		return fmt.Errorf("qr-bill: the account is in %s, not in Switzerland or Liechtenstein", country)
+	}
+	if strings.Trim(p.ReferencePrefix, "0123456789") != "" || len(p.ReferencePrefix) > 20 {
+		return fmt.Errorf("qr-bill: the reference prefix %q is not up to 20 digits", p.ReferencePrefix)
+	}
+	return nil
+}
+
+// Section points to the payment part of the last page.
+func (p SwissQRBill) Section(b Bill) PaymentSection {
+	details := []string{"Account   " + FormatIBAN(p.IBAN)}
+	if kind, reference, err := p.reference(b.Number); err == nil && kind != qrReferenceNone {
+		details = append(details, "Reference "+formatReference(kind, reference))
+	}
+	return PaymentSection{
+		Title:   "Swiss QR-bill",
+		Details: details,
+		Notice:  "Please pay with the payment part at the bottom of the last page",
+	}
+}
+
+// IsQRIBAN reports whether an IBAN is a QR-IBAN, whose institution ID is
+// between 30000 and 31999, to be paid with a QR reference.
+func IsQRIBAN(iban string) bool {
+	normalized := NormalizeIBAN(iban)
+	if len(normalized) < 9 {
+		return false
+	}
+	iid, err := strconv.Atoi(normalized[4:9])
+	return err == nil && iid >= 30000 && iid <= 31999
+}
+
+// Reference types of the Swiss QR-bill.
+const (
+	qrReferenceQRR  = "QRR"
+	qrReferenceSCOR = "SCOR"
+	qrReferenceNone = "NON"
+)
+
+// reference returns the type and the reference of a payment of invoice
+// number to the account.
+func (p SwissQRBill) reference(number string) (string, string, error) {
+	if IsQRIBAN(p.IBAN) {
+		reference, err := QRReference(p.ReferencePrefix, number)
+		return qrReferenceQRR, reference, err
+	}
+	if reference, err := CreditorReference(number); err == nil {
+		return qrReferenceSCOR, reference, nil
+	}
+	return qrReferenceNone, "", nil
+}
+
+// mod10Table is the table of the recursive modulo 10 check digit of the QR
+// reference (and the former ISR reference).
+var mod10Table = [10]int{0, 9, 4, 6, 8, 2, 7, 1, 3, 5}
+
+// qrCheckDigit returns the recursive modulo 10 check digit of digits.
+func qrCheckDigit(digits string) int {
+	carry := 0
+	for _, c := range digits {
+		carry = mod10Table[(carry+int(c-'0'))%10]
+	}
+	return (10 - carry) % 10
+}
+
+// QRReference returns the 27 digit QR reference of an invoice: the prefix,
+// then the digits of the number padded with zeros to 26 digits, then the
+// recursive modulo 10 check digit.
+func QRReference(prefix, number string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number)
+	if digits == "" {
+		return "", fmt.Errorf("QR reference: the invoice number %q has no digits", number)
+	}
+	if len(prefix)+len(digits) > 26 {
+		return "", fmt.Errorf("QR reference: the prefix and the digits of %q make more than 26 digits", number)
+	}
+	reference := prefix + strings.Repeat("0", 26-len(prefix)-len(digits)) + digits
+	return reference + strconv.Itoa(qrCheckDigit(reference)), nil
+}
+
+// ValidateQRReference checks the length and the check digit of a QR
+// reference, spaces allowed.
+func ValidateQRReference(reference string) error {
+	normalized := strings.Join(strings.Fields(reference), "")
+	if len(normalized) != 27 || strings.Trim(normalized, "0123456789") != "" {
+		return fmt.Errorf("QR reference %q: expected 27 digits", reference)
+	}
+	if qrCheckDigit(normalized[:26]) != int(normalized[26]-'0') {
+		return fmt.Errorf("QR reference %q: wrong check digit", reference)
+	}
+	return nil
+}
+
+// CreditorReference returns the ISO 11649 creditor reference of an
+// invoice number: the number itself when it is one, else "RF", the check
+// digits and the letters and digits of the number, at most 21.
+func CreditorReference(number string) (string, error) {
+	if ValidateCreditorReference(number) == nil {
+		return NormalizeIBAN(number), nil
+	}
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return -1
+	}, number)
+	if base == "" || len(base) > 21 {
+		return "", fmt.Errorf("creditor reference: the invoice number %q has no letters and digits or more than 21", number)
+	}
+	return fmt.Sprintf("RF%02d%s", 98-ibanRemainder("RF00"+base), base), nil
+}
+
+// formatReference writes a reference as printed on the QR-bill: QR
+// references in a block of two digits then blocks of five, creditor
+// references in blocks of four.
+func formatReference(kind, reference string) string {
+	if kind != qrReferenceQRR {
+		return FormatIBAN(reference)
+	}
+	groups := []string{reference[:2]}
+	for rest := reference[2:]; rest != ""; rest = rest[5:] {
+		groups = append(groups, rest[:5])
+	}
+	return strings.Join(groups, " ")
+}
+
+// qrAddress is a structured address of the Swiss QR-bill.
+type qrAddress struct {
+	Name     string
+	Street   string
+	Building string
+	Postcode string
+	Town     string
+	Country  string
+}
+
+// streetBuilding splits "Musterstrasse 12a" into the street and the
+// building number.
+var streetBuilding = regexp.MustCompile(`^(.*\D)\s+(\d+[A-Za-z]?(?:[-/]\d+[A-Za-z]?)?)$`)
+
+// truncate shortens s to n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// newQRAddress reads the structured address of a party from the bill
+// fields, reporting whether it has a name, postcode, town and country.
+func newQRAddress(name, address, country string) (qrAddress, bool) {
+	parsed := ParseAddress(address)
+	a := qrAddress{
+		Name:     truncate(strings.TrimSpace(name), 70),
+		Postcode: truncate(parsed.Postcode, 16),
+		Town:     truncate(parsed.City, 35),
+		Country:  strings.ToUpper(strings.TrimSpace(country)),
+	}
+	if len(parsed.Lines) > 0 {
+		a.Street = parsed.Lines[0]
+		if m := streetBuilding.FindStringSubmatch(a.Street); m != nil {
+			a.Street, a.Building = m[1], truncate(m[2], 16)
+		}
+		a.Street = truncate(a.Street, 70)
+	}
+	ok := a.Name != "" && a.Postcode != "" && a.Town != "" && len(a.Country) == 2
+	return a, ok
+}
+
+// fields returns the fields of the address in the Swiss QR code.
+func (a qrAddress) fields() []string {
+	return []string{"S", a.Name, a.Street, a.Building, a.Postcode, a.Town, a.Country}
+}
+
+// lines returns the address as printed on the QR-bill.
+func (a qrAddress) lines() []string {
+	lines := []string{a.Name}
+	if street := strings.TrimSpace(a.Street + " " + a.Building); street != "" {
+		lines = append(lines, street)
+	}
+	return append(lines, a.Country+"-"+a.Postcode+" "+a.Town)
+}
+
+// qrBill is the content of a Swiss QR-bill.
+type qrBill struct {
+	Account   string
+	Creditor  qrAddress
+	Debtor    *qrAddress
+	Amount    float64 // 0 when left to the payer
+	Currency  string
+	Reference string
+	Type      string
+	Message   string
+}
+
+// qrBillOf returns the QR-bill of a payment of amount for the bill, whose
+// reference is made of number.
+func (p SwissQRBill) qrBillOf(b Bill, number string, amount float64) (*qrBill, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	currency, err := CurrencyCode(b.Currency)
+	if err != nil || (currency != "CHF" && currency != "EUR") {
+		return nil, fmt.Errorf("qr-bill: payments are in CHF or EUR, not %q", b.Currency)
+	}
+	if amount > epcMaxAmount {
+		return nil, fmt.Errorf("qr-bill: amount %.2f over 999999999.99", amount)
+	}
+
+	q := &qrBill{
+		Account:  NormalizeIBAN(p.IBAN),
+		Amount:   roundAmount(amount),
+		Currency: currency,
+		Message:  truncate("Invoice "+number, 140),
+	}
+	name := p.Creditor
+	if name == "" {
+		name = b.CompanyName
+	}
+	var ok bool
+	if q.Creditor, ok = newQRAddress(name, b.Address, b.Country); !ok {
+		return nil, fmt.Errorf("qr-bill: the creditor needs a name, a country code and an address ending with the postcode and town")
+	}
+	if debtor, ok := newQRAddress(b.ToCompanyName, b.ToAddress, b.ToCountry); ok {
+		q.Debtor = &debtor
+	}
+	if q.Type, q.Reference, err = p.reference(number); err != nil {
+		return nil, fmt.Errorf("qr-bill: %w", err)
+	}
+	return q, nil
+}
+
+// formatAmount writes an amount as printed on the QR-bill, thousands
+// separated by spaces.
+func (q *qrBill) formatAmount() string {
+	s := strconv.FormatFloat(q.Amount, 'f', 2, 64)
+	whole, cents := s[:len(s)-3], s[len(s)-3:]
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + " " + whole[i:]
+	}
+	return whole + cents
+}
+
+// Payload returns the content of the Swiss QR code, version 2.0 of the
+// Swiss Implementation Guidelines for the QR-bill.
+func (q *qrBill) Payload() string {
+	fields := []string{"SPC", "0200", "1", q.Account}
+	fields = append(fields, q.Creditor.fields()...)
+	// No ultimate creditor
+	fields = append(fields, "", "", "", "", "", "", "")
+	amount := ""
+	if q.Amount > 0 {
+		amount = strconv.FormatFloat(q.Amount, 'f', 2, 64)
+	}
+	fields = append(fields, amount, q.Currency)
+	if q.Debtor != nil {
+		fields = append(fields, q.Debtor.fields()...)
+	} else {
+		fields = append(fields, "", "", "", "", "", "", "")
+	}
+	fields = append(fields, q.Type, q.Reference, q.Message, "EPD")
+	for i, field := range fields {
+		fields[i] = strings.Join(strings.Fields(field), " ")
+	}
+	return strings.Join(fields, "\n")
+}
+
+// qrBillFor returns the QR-bill drawn on the PDF of the content: invoices
+// and reminders with a Swiss QR-bill method and an amount due. Drafts get
+// none, so that they cannot be paid.
+func qrBillFor(content layoutData, opts PDFOptions) (*qrBill, error) {
+	b := content.Bill
+	var method *SwissQRBill
+	for _, m := range b.PaymentMethods {
+		if p, ok := m.(SwissQRBill); ok {
+			method = &p
+			break
+		}
+	}
+	if method == nil || opts.Watermark != "" {
+		return nil, nil
+	}
+	amount := roundAmount(b.Total - TotalPaid(opts.Payments))
+	if amount <= 0 {
+		return nil, nil
+	}
+	number := b.Number
+	if content.ReminderFor != "" {
+		number = content.ReminderFor
+	}
+	return method.qrBillOf(b, number, amount)
+}
@@ -0,0 +1,93 @@
+package bill
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateQRReference(t *testing.T) {
+	// The example reference of the SIX implementation guidelines
+	if got := qrCheckDigit("21000000000313947143000901"); got != 7 {
+		t.Errorf("qrCheckDigit = %d, want 7", got)
+	}
+	for reference, valid := range map[string]bool{
+		"210000000003139471430009017":      true,
+		"21 00000 00003 13947 14300 09017": true,
+		"210000000003139471430009018":      false,
+		"21000000000313947143000901":       false,
+		"21000000000313947143000901A":      false,
+		"2100000000031394714300090170":     false,
+	} {
+		if err := ValidateQRReference(reference); (err == nil) != valid {
+			t.Errorf("ValidateQRReference(%q) = %v, want valid %v", reference, err, valid)
+		}
+	}
+}
+
+func TestQRReference(t *testing.T) {
+	for _, tc := range []struct {
+		prefix, number string
+		want           string
+	}{
+		{"", "INV-123", "000000000000000000000001236"},
+		{"", "2024-001", "000000000000000000020240019"},
+		{"12345", "2024", "123450000000000000000020247"},
+		{"", "21000000000313947143000901", "210000000003139471430009017"},
+	} {
+		got, err := QRReference(tc.prefix, tc.number)
+		if err != nil || got != tc.want {
+			t.Errorf("QRReference(%q, %q) = %s, %v, want %s", tc.prefix, tc.number, got, err, tc.want)
+		}
+	}
+
+	if _, err := QRReference("", "INV"); err == nil || !strings.Contains(err.Error(), "no digits") {
+		t.Errorf("QRReference without digits: %v, want an error", err)
+	}
+	if _, err := QRReference("123456", strings.Repeat("9", 21)); err == nil {
+		t.Errorf("QRReference of more than 26 digits: no error")
+	}
+}
+
+func TestCreditorReference(t *testing.T) {
+	for number, want := range map[string]string{
+		"539007547034":        "RF18539007547034",
+		"RF18 5390 0754 7034": "RF18539007547034",
+		"inv-2024-001":        "RF78INV2024001",
+	} {
+		got, err := CreditorReference(number)
+		if err != nil || got != want {
+			t.Errorf("CreditorReference(%q) = %s, %v, want %s", number, got, err, want)
+		}
+		if err := ValidateCreditorReference(got); err != nil {
+			t.Errorf("CreditorReference(%q) = %s: %v", number, got, err)
+		}
+	}
+	for _, number := range []string{"---", strings.Repeat("1", 22)} {
+		if _, err := CreditorReference(number); err == nil {
+			t.Errorf("CreditorReference(%q): no error", number)
+		}
+	}
+}
+
+func TestQRBillReference(t *testing.T) {
+	for _, tc := range []struct {
+		iban, number    string
+		kind, reference string
+		formatted       string
+	}{
+		{"CH44 3199 9123 0008 8901 2", "2024-001", qrReferenceQRR, "000000000000000000020240019", "00 00000 00000 00000 00202 40019"},
+		{"CH93 0076 2011 6238 5295 7", "2024-001", qrReferenceSCOR, "RF312024001", "RF31 2024 001"},
+		{"CH93 0076 2011 6238 5295 7", strings.Repeat("1", 22), qrReferenceNone, "", ""},
+	} {
+		kind, reference, err := SwissQRBill{IBAN: tc.iban}.reference(tc.number)
+		if err != nil || kind != tc.kind || reference != tc.reference {
+			t.Errorf("reference(%s, %q) = %s %s, %v, want %s %s", tc.iban, tc.number, kind, reference, err, tc.kind, tc.reference)
+			continue
+		}
+		if kind != qrReferenceNone {
+			if got := formatReference(kind, reference); got != tc.formatted {
+				t.Errorf("formatReference(%s, %s) = %q, want %q", kind, reference, got, tc.formatted)
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package bill
+
+import (
+	"math"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
+)
+
+// Dimensions of the Swiss QR-bill in mm, at the bottom of an A4 page: the
+// receipt on the left, the payment part on the right.
+const (
+	qrBillHeight   = 105.0
+	qrReceiptWidth = 62.0
+	qrCodeSize     = 46.0
+	qrCrossSize    = 7.0
+)
+
+// qrBillRenderer draws a Swiss QR-bill from the top of its slip.
+type qrBillRenderer struct {
+	pdf *gofpdf.Fpdf
+	tr  func(string) string
+	top float64
+}
+
+// drawQRBill draws the payment part and receipt of the QR-bill at the
+// bottom of the last page, whose content ends at bottom, or of a new A4
+// page when it is taken or not A4 portrait.
+func drawQRBill(pdf *gofpdf.Fpdf, tr func(string) string, q *qrBill, bottom float64) error {
+	code, err := qrcode.New(q.Payload(), qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	code.DisableBorder = true
+
+	width, height := pdf.GetPageSize()
+	if math.Abs(width-210) > 1 || math.Abs(height-297) > 1 || bottom > height-qrBillHeight {
+		pdf.AddPageFormat("P", gofpdf.SizeType{Wd: 210, Ht: 297})
+		width, height = pdf.GetPageSize()
+		bottom = 0
+	}
+	auto, margin := pdf.GetAutoPageBreak()
+	pdf.SetAutoPageBreak(false, 0)
+	defer pdf.SetAutoPageBreak(auto, margin)
+
+	r := &qrBillRenderer{pdf: pdf, tr: tr, top: height - qrBillHeight}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetDrawColor(0, 0, 0)
+
+	// Perforation
+	pdf.SetLineWidth(0.2)
+	pdf.SetDashPattern([]float64{1, 1}, 0)
+	pdf.Line(0, r.top, width, r.top)
+	pdf.Line(qrReceiptWidth, r.top, qrReceiptWidth, height)
+	pdf.SetDashPattern(nil, 0)
+	if bottom < r.top-5 {
+		pdf.SetFont("Helvetica", "", 7)
+		pdf.SetXY(0, r.top-4)
+		pdf.CellFormat(width, 3, "Separate before paying in", "", 0, "C", false, 0, "")
+	}
+
+	r.drawReceipt(q)
+	r.drawPaymentPart(q, code.Bitmap())
+	return nil
+}
+
+func (r *qrBillRenderer) drawReceipt(q *qrBill) {
+	const x, w = 5.0, qrReceiptWidth - 10
+	const heading, value, leading = 6.0, 8.0, 3.2
+
+	r.title(x, "Receipt")
+	y := r.top + 12
+	y = r.section(x, y, w, heading, value, leading, "Account / Payable to", r.account(q))
+	if q.Type != qrReferenceNone {
+		y = r.section(x, y, w, heading, value, leading, "Reference", []string{formatReference(q.Type, q.Reference)})
+	}
+	if q.Debtor != nil {
+		r.section(x, y, w, heading, value, leading, "Payable by", q.Debtor.lines())
+	} else {
+		r.section(x, y, w, heading, value, leading, "Payable by (name/address)", nil)
+		r.corners(x, y+leading, 52, 20)
+	}
+
+	r.amount(x, r.top+68, 13, heading, value, leading, q, 30, 10)
+
+	r.pdf.SetFont("Helvetica", "B", heading)
+	r.pdf.SetXY(x, r.top+82)
+	r.pdf.CellFormat(w, leading, "Acceptance point", "", 0, "R", false, 0, "")
+}
+
+func (r *qrBillRenderer) drawPaymentPart(q *qrBill, modules [][]bool) {
+	const x = qrReceiptWidth + 5
+	const infoX, infoW = qrReceiptWidth + 56, 210 - qrReceiptWidth - 61
+	const heading, value, leading = 8.0, 10.0, 4.0
+
+	r.title(x, "Payment part")
+	r.qrCode(x, r.top+17, modules)
+	r.amount(x, r.top+68, 14, heading, value, leading, q, 40, 15)
+
+	y := r.top + 5
+	y = r.section(infoX, y, infoW, heading, value, leading, "Account / Payable to", r.account(q))
+	if q.Type != qrReferenceNone {
+		y = r.section(infoX, y, infoW, heading, value, leading, "Reference", []string{formatReference(q.Type, q.Reference)})
+	}
+	y = r.section(infoX, y, infoW, heading, value, leading, "Additional information", []string{q.Message})
+	if q.Debtor != nil {
+		r.section(infoX, y, infoW, heading, value, leading, "Payable by", q.Debtor.lines())
+	} else {
+		r.section(infoX, y, infoW, heading, value, leading, "Payable by (name/address)", nil)
+		r.corners(infoX, y+leading, 65, 25)
+	}
+}
+
+func (r *qrBillRenderer) title(x float64, title string) {
+	r.pdf.SetFont("Helvetica", "B", 11)
+	r.pdf.SetXY(x, r.top+5)
+	r.pdf.CellFormat(50, 5, title, "", 0, "", false, 0, "")
+}
+
+// account returns the lines of the creditor account.
+func (r *qrBillRenderer) account(q *qrBill) []string {
+	return append([]string{FormatIBAN(q.Account)}, q.Creditor.lines()...)
+}
+
+// section draws a heading and its lines, wrapped to w, returning where the
+// next section starts.
+func (r *qrBillRenderer) section(x, y, w, heading, value, leading float64, title string, lines []string) float64 {
+	pdf := r.pdf
+	pdf.SetFont("Helvetica", "B", heading)
+	pdf.SetXY(x, y)
+	pdf.CellFormat(w, leading, title, "", 0, "", false, 0, "")
+	y += leading
+
+	pdf.SetFont("Helvetica", "", value)
+	for _, line := range lines {
+		for _, wrapped := range r.wrap(line, w) {
+			pdf.SetXY(x, y)
+			pdf.CellFormat(w, leading, r.tr(wrapped), "", 0, "", false, 0, "")
+			y += leading
+		}
+	}
+	return y + leading/2
+}
+
+// wrap splits text on spaces into lines no wider than w in the current
+// font.
+func (r *qrBillRenderer) wrap(text string, w float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := strings.TrimSpace(line + " " + word)
+		if line != "" && r.pdf.GetStringWidth(r.tr(candidate)) > w {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	return append(lines, line)
+}
+
+// amount draws the currency and amount, or a box for the payer to fill
+// in when the amount is open.
+func (r *qrBillRenderer) amount(x, y, amountX, heading, value, leading float64, q *qrBill, boxW, boxH float64) {
+	pdf := r.pdf
+	pdf.SetFont("Helvetica", "B", heading)
+	pdf.SetXY(x, y)
+	pdf.CellFormat(amountX, leading, "Currency", "", 0, "", false, 0, "")
+	pdf.CellFormat(boxW, leading, "Amount", "", 0, "", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", value)
+	pdf.SetXY(x, y+leading+1)
+	pdf.CellFormat(amountX, leading, q.Currency, "", 0, "", false, 0, "")
+	if q.Amount > 0 {
+		pdf.CellFormat(boxW, leading, q.formatAmount(), "", 0, "", false, 0, "")
+	} else {
+		r.corners(x+amountX, y+leading+1, boxW, boxH)
+	}
+}
+
+// corners draws the corner marks of a box to fill in by hand.
+func (r *qrBillRenderer) corners(x, y, w, h float64) {
+	const l = 3.0
+	pdf := r.pdf
+	pdf.SetLineWidth(0.26)
+	for _, c := range [][4]float64{
+		{x, y, 1, 1}, {x + w, y, -1, 1}, {x, y + h, 1, -1}, {x + w, y + h, -1, -1},
+	} {
+		pdf.Line(c[0], c[1], c[0]+c[2]*l, c[1])
+		pdf.Line(c[0], c[1], c[0], c[1]+c[3]*l)
+	}
+}
+
+// qrCode draws the Swiss QR code as vector modules, each row's dark runs
+// as one rectangle, with the Swiss cross in its centre.
+func (r *qrBillRenderer) qrCode(x, y float64, modules [][]bool) {
+	pdf := r.pdf
+	m := qrCodeSize / float64(len(modules))
+	pdf.SetFillColor(0, 0, 0)
+	for row, cells := range modules {
+		for col := 0; col < len(cells); col++ {
+			if !cells[col] {
+				continue
+			}
+			start := col
+			for col+1 < len(cells) && cells[col+1] {
+				col++
+			}
+			pdf.Rect(x+float64(start)*m, y+float64(row)*m, float64(col-start+1)*m, m, "F")
+		}
+	}
+
+	// Swiss cross: a black square with a white border and the white cross
+	// of the flag, whose arms are 6/32 of the square wide and 20/32 long
+	cx, cy := x+qrCodeSize/2, y+qrCodeSize/2
+	square := qrCrossSize - 1
+	arm, span := square*6/32, square*20/32
+	pdf.SetFillColor(255, 255, 255)
+	pdf.Rect(cx-qrCrossSize/2, cy-qrCrossSize/2, qrCrossSize, qrCrossSize, "F")
+	pdf.SetFillColor(0, 0, 0)
+	pdf.Rect(cx-square/2, cy-square/2, square, square, "F")
+	pdf.SetFillColor(255, 255, 255)
+	pdf.Rect(cx-arm/2, cy-span/2, arm, span, "F")
+	pdf.Rect(cx-span/2, cy-arm/2, span, arm, "F")
+}
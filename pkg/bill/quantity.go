@@ -0,0 +1,114 @@
+package bill
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultQuantityPrecision is the number of decimals kept on quantities when
+// no precision is configured.
+const DefaultQuantityPrecision = 2
+
+// MaxQuantity is the largest quantity accepted, well within the twelve
+// integer digits of the e-invoicing formats.
+const MaxQuantity = 1e9
+
+type Unit string
+
+const (
+	UnitNone   Unit = ""
+	UnitHours  Unit = "hours"
+	UnitDays   Unit = "days"
+	UnitPieces Unit = "pieces"
+	UnitKg     Unit = "kg"
+	UnitMonths Unit = "months"
+)
+
+// Units lists the units of measure that can be selected on an item.
+var Units = []Unit{UnitNone, UnitHours, UnitDays, UnitPieces, UnitKg, UnitMonths}
+
+var unitSymbols = map[Unit]string{
+	UnitHours:  "h",
+	UnitDays:   "d",
+	UnitPieces: "pcs",
+	UnitKg:     "kg",
+	UnitMonths: "mo",
+}
+
+// Symbol returns the short form of the unit used in the quantity column.
+// Units that are not predefined are printed as is.
+func (u Unit) Symbol() string {
+	if symbol, ok := unitSymbols[u]; ok {
+		return symbol
+	}
+	return string(u)
+}
+
+// ParseUnit accepts either the name or the symbol of a unit.
+func ParseUnit(s string) (Unit, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return UnitNone, nil
+	}
+	for _, unit := range Units {
+		if s == string(unit) || s == unit.Symbol() {
+			return unit, nil
+		}
+	}
+	return UnitNone, fmt.Errorf("unknown unit %q", s)
+}
+
+func resolvePrecision(precision *int) int {
+	if precision == nil || *precision < 0 {
+		return DefaultQuantityPrecision
+	}
+	return *precision
+}
+
+// RoundQuantity rounds a quantity to the given number of decimals, nil
+// meaning DefaultQuantityPrecision and 0 whole units.
+func RoundQuantity(quantity float64, precision *int) float64 {
+	factor := math.Pow(10, float64(resolvePrecision(precision)))
+	return math.Round(quantity*factor) / factor
+}
+
+// ValidateQuantity checks that a quantity is a finite number up to
+// MaxQuantity that is still positive once rounded to precision.
+func ValidateQuantity(quantity float64, precision *int) error {
+	if math.IsNaN(quantity) || math.IsInf(quantity, 0) {
+		return fmt.Errorf("invalid quantity %v", quantity)
+	}
+	if quantity > MaxQuantity {
+		return fmt.Errorf("quantity must not exceed %.0f", float64(MaxQuantity))
+	}
+	if RoundQuantity(quantity, precision) <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	return nil
+}
+
+// ParseQuantity parses a quantity accepted by ValidateQuantity, rounded to
+// precision. Both "." and "," are accepted as decimal separator.
+func ParseQuantity(s string, precision *int) (float64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	if err := ValidateQuantity(value, precision); err != nil {
+		return 0, err
+	}
+	return RoundQuantity(value, precision), nil
+}
+
+// FormatQuantity renders a quantity without trailing zeros followed by the
+// unit symbol, e.g. "7.5 h".
+func FormatQuantity(quantity float64, unit Unit, precision *int) string {
+	s := strconv.FormatFloat(RoundQuantity(quantity, precision), 'f', -1, 64)
+	if symbol := unit.Symbol(); symbol != "" {
+		s += " " + symbol
+	}
+	return s
+}
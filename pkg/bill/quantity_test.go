@@ -0,0 +1,86 @@
+package bill
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFormatQuantity(t *testing.T) {
+	whole, three := 0, 3
+	for _, tc := range []struct {
+		quantity  float64
+		unit      Unit
+		precision *int
+		want      string
+	}{
+		{7.5, UnitHours, nil, "7.5 h"},
+		{1.125, UnitNone, nil, "1.13"},
+		{1.125, UnitKg, &three, "1.125 kg"},
+		{2, UnitDays, &whole, "2 d"},
+		{2.4, UnitPieces, &whole, "2 pcs"},
+	} {
+		if got := FormatQuantity(tc.quantity, tc.unit, tc.precision); got != tc.want {
+			t.Errorf("FormatQuantity(%v, %s) = %q, want %q", tc.quantity, tc.unit, got, tc.want)
+		}
+	}
+}
+
+func TestBillQuantityPrecisionJSON(t *testing.T) {
+	whole := 0
+	data, err := json.Marshal(Bill{Number: "INV-1", QuantityPrecision: &whole})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b Bill
+	if err := json.Unmarshal(data, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Number != "INV-1" || b.QuantityPrecision == nil || *b.QuantityPrecision != 0 {
+		t.Errorf("whole units read back as %v", b.QuantityPrecision)
+	}
+
+	// Bills saved before wrote 0 for the default precision
+	for legacy, want := range map[string]int{
+		`{"Number": "INV-1", "QuantityPrecision": 0}`: DefaultQuantityPrecision,
+		`{"Number": "INV-1", "QuantityPrecision": 3}`: 3,
+	} {
+		var b Bill
+		if err := json.Unmarshal([]byte(legacy), &b); err != nil {
+			t.Fatal(err)
+		}
+		if got := resolvePrecision(b.QuantityPrecision); got != want {
+			t.Errorf("%s: precision %d, want %d", legacy, got, want)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	whole := 0
+	for _, tc := range []struct {
+		s         string
+		precision *int
+		want      float64
+		wantErr   string
+	}{
+		{"7,5", nil, 7.5, ""},
+		{" 1.125 ", nil, 1.13, ""},
+		{"2.4", &whole, 2, ""},
+		{"1e9", nil, 1e9, ""},
+		{"0.004", nil, 0, "positive"},
+		{"0.4", &whole, 0, "positive"},
+		{"-1", nil, 0, "positive"},
+		{"1e12", nil, 0, "exceed"},
+		{"NaN", nil, 0, "invalid"},
+		{"Inf", nil, 0, "invalid"},
+		{"seven", nil, 0, "invalid"},
+	} {
+		got, err := ParseQuantity(tc.s, tc.precision)
+		switch {
+		case tc.wantErr == "" && (err != nil || got != tc.want):
+			t.Errorf("ParseQuantity(%q) = %v, %v, want %v", tc.s, got, err, tc.want)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("ParseQuantity(%q) error = %v, want one mentioning %q", tc.s, err, tc.wantErr)
+		}
+	}
+}
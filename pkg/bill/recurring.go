@@ -0,0 +1,271 @@
+package bill
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	FrequencyMonthly   Frequency = "monthly"
+	FrequencyQuarterly Frequency = "quarterly"
+	FrequencyYearly    Frequency = "yearly"
+)
+
+func ParseFrequency(s string) (Frequency, error) {
+	switch f := Frequency(strings.ToLower(strings.TrimSpace(s))); f {
+	case FrequencyMonthly, FrequencyQuarterly, FrequencyYearly:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown frequency %q (expected monthly, quarterly or yearly)", s)
+}
+
+// months returns the number of months between two invoices.
+func (f Frequency) months() int {
+	switch f {
+	case FrequencyQuarterly:
+		return 3
+	case FrequencyYearly:
+		return 12
+	}
+	return 1
+}
+
+// period returns the key identifying the billing period starting on the
+// given month, e.g. "2024-03", "2024-Q1" or "2024".
+func (f Frequency) period(date time.Time) string {
+	switch f {
+	case FrequencyQuarterly:
+		return fmt.Sprintf("%d-Q%d", date.Year(), (int(date.Month())-1)/3+1)
+	case FrequencyYearly:
+		return date.Format("2006")
+	}
+	return date.Format("2006-01")
+}
+
+// Schedule describes an invoice issued periodically with identical items.
+type Schedule struct {
+	Name string `json:"name"`
+
+	// Template is the path to a template JSON file providing the company,
+	// payment details and, unless overridden below, client and items.
+	Template string `json:"template"`
+
+	ToCompanyName string         `json:"to_company_name,omitempty"`
+	ToAddress     string         `json:"to_address,omitempty"`
+	ToVATNumber   string         `json:"to_vat_number,omitempty"`
+	Items         []TemplateItem `json:"items,omitempty"`
+
+	Frequency  Frequency `json:"frequency"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end,omitempty"`
+	DayOfMonth int       `json:"day_of_month"`
+
+	// NumberFormat is expanded with FormatNumber, NextSequence being the
+	// sequence of the next generated invoice.
+	NumberFormat string `json:"number_format"`
+	NextSequence int    `json:"next_sequence"`
+	OutputDir    string `json:"output_dir,omitempty"`
+
+	Generated []GeneratedInvoice `json:"generated,omitempty"`
+}
+
+// GeneratedInvoice records the invoice issued for a period.
+type GeneratedInvoice struct {
+	Period string    `json:"period"`
+	Number string    `json:"number"`
+	Date   time.Time `json:"date"`
+	Path   string    `json:"path"`
+}
+
+// Occurrence is a billing period of a schedule and its issue date.
+type Occurrence struct {
+	Period string
+	Date   time.Time
+}
+
+func (s *Schedule) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("schedule name is required")
+	}
+	if s.Template == "" {
+		return fmt.Errorf("schedule %s: template is required", s.Name)
+	}
+	if _, err := ParseFrequency(string(s.Frequency)); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	if s.Start.IsZero() {
+		return fmt.Errorf("schedule %s: start date is required", s.Name)
+	}
+	if !s.End.IsZero() && s.End.Before(s.Start) {
+		return fmt.Errorf("schedule %s: end date is before start date", s.Name)
+	}
+	if s.DayOfMonth < 1 || s.DayOfMonth > 31 {
+		return fmt.Errorf("schedule %s: day of month must be between 1 and 31", s.Name)
+	}
+	if s.NumberFormat == "" {
+		return fmt.Errorf("schedule %s: number format is required", s.Name)
+	}
+	if s.NextSequence < 1 {
+		return fmt.Errorf("schedule %s: next sequence must be at least 1", s.Name)
+	}
+	return nil
+}
+
+func (s *Schedule) isGenerated(period string) bool {
+	for _, generated := range s.Generated {
+		if generated.Period == period {
+			return true
+		}
+	}
+	return false
+}
+
+// Due lists the occurrences up to now for which no invoice was generated
+// yet, oldest first. Days past the end of a short month fall on its last day.
+func (s *Schedule) Due(now time.Time) []Occurrence {
+	var due []Occurrence
+
+	start := time.Date(s.Start.Year(), s.Start.Month(), 1, 0, 0, 0, 0, time.Local)
+	for month := start; !month.After(now); month = month.AddDate(0, s.Frequency.months(), 0) {
+		day := s.DayOfMonth
+		if last := month.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		date := time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, time.Local)
+
+		if date.Before(dateOnly(s.Start)) || date.After(now) {
+			continue
+		}
+		if !s.End.IsZero() && date.After(s.End) {
+			break
+		}
+
+		period := s.Frequency.period(month)
+		if !s.isGenerated(period) {
+			due = append(due, Occurrence{Period: period, Date: date})
+		}
+	}
+	return due
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// NextNumber returns the number the next generated invoice will use.
+func (s *Schedule) NextNumber(date time.Time) string {
+	return FormatNumber(s.NumberFormat, date, s.NextSequence)
+}
+
+// Bill builds the invoice of an occurrence from the schedule template.
+func (s *Schedule) Bill(occurrence Occurrence) (Bill, error) {
+	template, err := LoadTemplate(s.Template)
+	if err != nil {
+		return Bill{}, fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+
+	if s.ToCompanyName != "" {
+		template.ToCompanyName = s.ToCompanyName
+		template.ToAddress = s.ToAddress
+		template.ToVATNumber = s.ToVATNumber
+	}
+	if len(s.Items) > 0 {
+		template.Items = s.Items
+	}
+
+	return NewBillFromTemplate(*template, s.NextNumber(occurrence.Date), occurrence.Date), nil
+}
+
+// Generate writes the PDF of an occurrence into outputDir and records it
+// on the schedule, so it is not generated again.
+func (s *Schedule) Generate(occurrence Occurrence, outputDir string) (GeneratedInvoice, error) {
+	b, err := s.Bill(occurrence)
+	if err != nil {
+		return GeneratedInvoice{}, err
+	}
+
+	invoice, err := NewInvoice(b, StatusIssued, time.Now())
+	if err != nil {
+		return GeneratedInvoice{}, err
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return GeneratedInvoice{}, err
+	}
+	outputPath := filepath.Join(outputDir, strings.ReplaceAll(b.Number, "/", "-")+".pdf")
+	if err := GeneratePDF(b, outputPath); err != nil {
+		return GeneratedInvoice{}, err
+	}
+
+	invoice.Path, _ = filepath.Abs(outputPath)
+	if err := SaveInvoice(invoice); err != nil {
+		return GeneratedInvoice{}, err
+	}
+
+	generated := GeneratedInvoice{
+		Period: occurrence.Period,
+		Number: b.Number,
+		Date:   occurrence.Date,
+		Path:   outputPath,
+	}
+	s.Generated = append(s.Generated, generated)
+	s.NextSequence++
+	return generated, nil
+}
+
+func schedulesPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "schedules.json"), nil
+}
+
+// LoadSchedules reads the recurring schedules from the config directory.
+func LoadSchedules() ([]Schedule, error) {
+	path, err := schedulesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// SaveSchedules writes the recurring schedules to the config directory.
+func SaveSchedules(schedules []Schedule) error {
+	path, err := schedulesPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write through a temporary file so an interrupted run never loses the
+	// record of generated periods.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,417 @@
+package bill
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/louisinger/bill/pkg/cms"
+)
+
+// Signature signs generated PDFs with a PAdES (ETSI.CAdES.detached)
+// digital signature.
+type Signature struct {
+	Signer *cms.Signer
+
+	// Reason is shown by PDF readers with the signature, e.g. "Invoice
+	// issued by Muster GmbH".
+	Reason string
+
+	// Visible draws a signature block under the content of the last page.
+	Visible bool
+}
+
+// signatureSize is the room reserved in the PDF for the CMS signature,
+// enough for a certificate chain of a few RSA certificates.
+const signatureSize = 16384
+
+const byteRangePlaceholder = "/ByteRange [0 0000000000 0000000000 0000000000]"
+
+var (
+	kidsPattern      = regexp.MustCompile(`/Kids\s*\[([^\]]*)\]`)
+	refPattern       = regexp.MustCompile(`(\d+)\s+0\s+R`)
+	idPattern        = regexp.MustCompile(`/ID\s*\[[^\]]*\]`)
+	byteRangePattern = regexp.MustCompile(`/ByteRange\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+	sigTypePattern   = regexp.MustCompile(`/Type\s*/Sig[\s/>]`)
+	sigDatePattern   = regexp.MustCompile(`/M\s*\(D:(\d{4})(\d{2})(\d{2})(\d{2})(\d{2})(\d{2})([Z+-])?(\d{2})?'?(\d{2})?'?\)`)
+	sigReasonPattern = regexp.MustCompile(`/Reason\s*(\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f]*>)`)
+)
+
+// signatureBox is where the visible signature was drawn, in PDF points
+// from the bottom left corner of the page.
+type signatureBox struct {
+	page                     int
+	left, bottom, right, top float64
+}
+
+func commonName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+// drawSignatureBox draws the visible signature under the content ending at
+// bottom on the last page, or on a new page when it does not fit there.
+func drawSignatureBox(pdf *gofpdf.Fpdf, tr func(string) string, sig *Signature, bottom float64, at time.Time) *signatureBox {
+	const w, h = 70.0, 22.0
+	width, height := pdf.GetPageSize()
+	_, top, right, breakMargin := pdf.GetMargins()
+
+	y := bottom + 5
+	if y+h > height-breakMargin {
+		pdf.AddPage()
+		y = top
+	}
+	x := width - right - w
+
+	pdf.SetDrawColor(120, 120, 120)
+	pdf.SetLineWidth(0.3)
+	pdf.Rect(x, y, w, h, "D")
+
+	lines := []struct{ style, text string }{
+		{"", "Digitally signed by"},
+		{"B", commonName(sig.Signer.Certificate)},
+		{"", "Date: " + at.Format("2006-01-02 15:04:05 -07:00")},
+	}
+	if sig.Reason != "" {
+		lines = append(lines, struct{ style, text string }{"I", "Reason: " + sig.Reason})
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetY(y + 2)
+	for _, line := range lines {
+		pdf.SetFont("Helvetica", line.style, 8)
+		pdf.SetX(x + 2)
+		pdf.CellFormat(w-4, 4.5, tr(line.text), "", 2, "", false, 0, "")
+	}
+
+	k := 72 / 25.4
+	return &signatureBox{
+		page:   pdf.PageNo(),
+		left:   x * k,
+		bottom: (height - y - h) * k,
+		right:  (x + w) * k,
+		top:    (height - y) * k,
+	}
+}
+
+// objectBody returns the dictionary of an object without its "n 0 obj"
+// and "endobj" keywords.
+func objectBody(object []byte) string {
+	body := object[bytes.Index(object, []byte("obj"))+len("obj"):]
+	return strings.TrimSpace(string(bytes.TrimSuffix(body, []byte("endobj"))))
+}
+
+// insertKey adds an entry to the end of a dictionary.
+func insertKey(dict, entry string) string {
+	i := strings.LastIndex(dict, ">>")
+	return dict[:i] + " " + entry + " " + dict[i:]
+}
+
+// signPDF appends an incremental update to a PDF with a signature field,
+// drawn in box when visible, and signs every byte of the file but the
+// signature itself.
+func signPDF(data []byte, sig *Signature, box *signatureBox, at time.Time) ([]byte, error) {
+	pdf, err := parsePDFObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	catalog := objectBody(pdf.objects[pdf.root])
+	if strings.Contains(catalog, "/AcroForm") {
+		return nil, fmt.Errorf("the PDF already has a form")
+	}
+	pages := pagesPattern.FindStringSubmatch(catalog)
+	if pages == nil {
+		return nil, fmt.Errorf("PDF catalog has no pages")
+	}
+	pagesNumber, _ := strconv.Atoi(pages[1])
+	kids := kidsPattern.FindSubmatch(pdf.objects[pagesNumber])
+	if kids == nil {
+		return nil, fmt.Errorf("PDF page tree not found")
+	}
+	refs := refPattern.FindAllSubmatch(kids[1], -1)
+
+	// An invisible signature is an empty field on the first page
+	index, rect := 0, "0 0 0 0"
+	if box != nil {
+		index = box.page - 1
+		rect = fmt.Sprintf("%.2f %.2f %.2f %.2f", box.left, box.bottom, box.right, box.top)
+	}
+	if index >= len(refs) {
+		return nil, fmt.Errorf("PDF page %d not found", index+1)
+	}
+	page, _ := strconv.Atoi(string(refs[index][1]))
+	pageDict := objectBody(pdf.objects[page])
+
+	sigNumber, widget, appearance := pdf.size, pdf.size+1, pdf.size+2
+	size := pdf.size + 3
+
+	var dict strings.Builder
+	fmt.Fprintf(&dict, "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached %s /Contents <%s> /M %s /Name %s",
+		byteRangePlaceholder, strings.Repeat("0", 2*signatureSize), pdfDate(at), pdfText(commonName(sig.Signer.Certificate)))
+	if sig.Reason != "" {
+		fmt.Fprintf(&dict, " /Reason %s", pdfText(sig.Reason))
+	}
+	dict.WriteString(" >>")
+
+	width, height := 0.0, 0.0
+	if box != nil {
+		width, height = box.right-box.left, box.top-box.bottom
+	}
+	if strings.Contains(pageDict, "/Annots [") {
+		pageDict = strings.Replace(pageDict, "/Annots [", fmt.Sprintf("/Annots [%d 0 R ", widget), 1)
+	} else {
+		pageDict = insertKey(pageDict, fmt.Sprintf("/Annots [%d 0 R]", widget))
+	}
+	objects := map[int]string{
+		sigNumber: dict.String(),
+		widget: fmt.Sprintf("<< /Type /Annot /Subtype /Widget /FT /Sig /T (Signature1) /V %d 0 R /F 4 /P %d 0 R /Rect [%s] /AP << /N %d 0 R >> >>",
+			sigNumber, page, rect, appearance),
+		appearance: string(pdfStream(fmt.Sprintf(" /Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f] /Resources << >>", width, height), nil, false)),
+		page:       pageDict,
+		pdf.root:   insertKey(catalog, fmt.Sprintf("/AcroForm << /Fields [%d 0 R] /SigFlags 3 >>", widget)),
+	}
+	numbers := make([]int, 0, len(objects))
+	for number := range objects {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	var out bytes.Buffer
+	out.Write(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		out.WriteString("\n")
+	}
+	offsets := make(map[int]int)
+	for _, number := range numbers {
+		offsets[number] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", number, objects[number])
+	}
+
+	prev := startxrefPattern.FindSubmatch(data)
+	trailer := data[bytes.LastIndex(data, []byte("trailer")):]
+	id := ""
+	if m := idPattern.Find(trailer); m != nil {
+		id = " " + string(m)
+	}
+	xrefOffset := out.Len()
+	out.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for _, number := range numbers {
+		fmt.Fprintf(&out, "%d 1\n%010d 00000 n \n", number, offsets[number])
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R /Prev %s%s >>\nstartxref\n%d\n%%%%EOF\n",
+		size, pdf.root, pdf.info, prev[1], id, xrefOffset)
+
+	// Everything is signed but the hexadecimal string of /Contents
+	signed := out.Bytes()
+	sigOffset := offsets[sigNumber]
+	start := sigOffset + bytes.Index(signed[sigOffset:], []byte("/Contents <")) + len("/Contents ")
+	end := start + 2*signatureSize + 2
+	byteRange := fmt.Sprintf("/ByteRange [0 %d %d %d", start, end, len(signed)-end)
+	byteRange += strings.Repeat(" ", len(byteRangePlaceholder)-len(byteRange)-1) + "]"
+	copy(signed[sigOffset+bytes.Index(signed[sigOffset:], []byte(byteRangePlaceholder)):], byteRange)
+
+	content := append(append([]byte(nil), signed[:start]...), signed[end:]...)
+	der, err := sig.Signer.SignDetached(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(der) > signatureSize {
+		return nil, fmt.Errorf("the signature takes %d bytes, more than the %d reserved", len(der), signatureSize)
+	}
+	hex.Encode(signed[start+1:], der)
+	return signed, nil
+}
+
+// PDFSignature is a signature found in a PDF by VerifyPDF.
+type PDFSignature struct {
+	// Signer is the certificate of the signer, nil when the signature
+	// cannot be read.
+	Signer *x509.Certificate
+	Time   time.Time
+	Reason string
+
+	// Err is why the signature is invalid, nil when it matches the bytes
+	// it covers.
+	Err error
+
+	// Modified reports that the file was changed after signing: the
+	// signature does not cover it to the end.
+	Modified bool
+
+	// TrustErr is why the certificate does not chain to a root trusted by
+	// the system, nil when it does. Self-signed certificates are valid
+	// but not trusted.
+	TrustErr error
+}
+
+// VerifyPDF checks the digital signatures of a PDF, in the order they
+// appear in the file. A PDF without signatures is an error.
+func VerifyPDF(data []byte) ([]PDFSignature, error) {
+	pdf, err := parsePDFObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	var offsets []int
+	byOffset := make(map[int][]byte)
+	for _, object := range pdf.objects {
+		dict := pdfDict(object)
+		if !sigTypePattern.Match(dict) || !byteRangePattern.Match(dict) {
+			continue
+		}
+		offset := bytes.Index(data, object)
+		offsets = append(offsets, offset)
+		byOffset[offset] = dict
+	}
+	if len(offsets) == 0 {
+		return nil, errors.New("the PDF is not signed")
+	}
+	sort.Ints(offsets)
+
+	var signatures []PDFSignature
+	for _, offset := range offsets {
+		signatures = append(signatures, verifySignature(data, byOffset[offset]))
+	}
+	return signatures, nil
+}
+
+func verifySignature(data, dict []byte) PDFSignature {
+	var sig PDFSignature
+	if m := sigReasonPattern.FindSubmatch(dict); m != nil {
+		sig.Reason = decodePDFText(string(m[1]))
+	}
+	if m := sigDatePattern.FindSubmatch(dict); m != nil {
+		sig.Time = parsePDFDate(m)
+	}
+
+	var r [4]int
+	m := byteRangePattern.FindSubmatch(dict)
+	for i := range r {
+		r[i], _ = strconv.Atoi(string(m[i+1]))
+	}
+	if r[0] != 0 || r[1] >= r[2] || r[2]+r[3] > len(data) || data[r[1]] != '<' || data[r[2]-1] != '>' {
+		sig.Err = errors.New("the byte range does not exclude just the signature")
+		return sig
+	}
+	sig.Modified = r[2]+r[3] != len(data)
+
+	der, err := hex.DecodeString(string(data[r[1]+1 : r[2]-1]))
+	if err != nil {
+		sig.Err = fmt.Errorf("the signature is not hexadecimal: %w", err)
+		return sig
+	}
+	content := append(append([]byte(nil), data[:r[1]]...), data[r[2]:r[2]+r[3]]...)
+	verification, err := cms.VerifyDetached(der, content)
+	if err != nil {
+		sig.Err = err
+		return sig
+	}
+	sig.Signer = verification.Signer
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range verification.Certificates {
+		intermediates.AddCert(cert)
+	}
+	_, sig.TrustErr = sig.Signer.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return sig
+}
+
+// parsePDFDate reads the parts of a (D:YYYYMMDDHHmmSS+HH'mm') date
+// matched by sigDatePattern.
+func parsePDFDate(m [][]byte) time.Time {
+	var n [6]int
+	for i := range n {
+		n[i], _ = strconv.Atoi(string(m[i+1]))
+	}
+	location := time.UTC
+	if sign := string(m[7]); sign == "+" || sign == "-" {
+		hours, _ := strconv.Atoi(string(m[8]))
+		minutes, _ := strconv.Atoi(string(m[9]))
+		offset := hours*3600 + minutes*60
+		if sign == "-" {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+	}
+	return time.Date(n[0], time.Month(n[1]), n[2], n[3], n[4], n[5], 0, location)
+}
+
+// SigningConfig is the certificate PDFs are signed with, kept in the
+// config directory. The password of the key is never stored.
+type SigningConfig struct {
+	// Certificate is a PKCS#12 (.p12, .pfx) file holding the key and the
+	// certificate, or a PEM certificate with its chain.
+	Certificate string `json:"certificate"`
+
+	// Key is the PEM private key matching a PEM certificate.
+	Key string `json:"key,omitempty"`
+
+	Reason  string `json:"reason,omitempty"`
+	Visible bool   `json:"visible,omitempty"`
+}
+
+func signingPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "signing.json"), nil
+}
+
+// LoadSigningConfig reads the signing settings, empty when none were
+// saved.
+func LoadSigningConfig() (SigningConfig, error) {
+	var config SigningConfig
+	path, err := signingPath()
+	if err != nil {
+		return config, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+// SaveSigningConfig writes the signing settings to the config directory.
+func SaveSigningConfig(config SigningConfig) error {
+	path, err := signingPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Signature opens the configured key with password.
+func (c SigningConfig) Signature(password string) (*Signature, error) {
+	if c.Certificate == "" {
+		return nil, errors.New("no signing certificate configured")
+	}
+	signer, err := cms.LoadSigner(c.Certificate, c.Key, password)
+	if err != nil {
+		return nil, fmt.Errorf("signing certificate: %w", err)
+	}
+	return &Signature{Signer: signer, Reason: c.Reason, Visible: c.Visible}, nil
+}
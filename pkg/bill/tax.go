@@ -0,0 +1,130 @@
+package bill
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VAT categories (UNCL5305) used for lines without VAT. Lines with a
+// positive rate are always in the standard category.
+const (
+	VATStandard          = "S"
+	VATExempt            = "E"
+	VATReverseCharge     = "AE"
+	VATNotSubject        = "O"
+	VATZeroRated         = "Z"
+	VATIntraCommunity    = "K"
+	VATExportOutsideEU   = "G"
+	defaultExemptionText = "VAT exempt"
+)
+
+// TaxSubtotal is the VAT of all lines sharing a category and rate.
+type TaxSubtotal struct {
+	Category        string
+	Rate            float64
+	Base            float64
+	Amount          float64
+	ExemptionReason string
+}
+
+// VATCategoryFor returns the category of lines taxed at rate.
+func (b Bill) VATCategoryFor(rate float64) string {
+	if rate > 0 {
+		return VATStandard
+	}
+	if b.VATCategory != "" {
+		return b.VATCategory
+	}
+	return VATExempt
+}
+
+// TaxBreakdown groups the lines per VAT category and rate.
+func (b Bill) TaxBreakdown() []TaxSubtotal {
+	var subtotals []TaxSubtotal
+	for _, item := range b.Items {
+		category := b.VATCategoryFor(item.VATRate)
+
+		found := false
+		for i := range subtotals {
+			if subtotals[i].Category == category && subtotals[i].Rate == item.VATRate {
+				subtotals[i].Base += item.Total
+				found = true
+				break
+			}
+		}
+		if !found {
+			subtotals = append(subtotals, TaxSubtotal{
+				Category: category,
+				Rate:     item.VATRate,
+				Base:     item.Total,
+			})
+		}
+	}
+
+	for i := range subtotals {
+		subtotals[i].Base = roundAmount(subtotals[i].Base)
+		subtotals[i].Amount = roundAmount(subtotals[i].Base * subtotals[i].Rate / 100)
+		if subtotals[i].Category != VATStandard {
+			subtotals[i].ExemptionReason = b.VATExemptionReason
+			if subtotals[i].ExemptionReason == "" {
+				subtotals[i].ExemptionReason = defaultExemptionText
+			}
+		}
+	}
+
+	sort.SliceStable(subtotals, func(i, j int) bool {
+		return subtotals[i].Rate > subtotals[j].Rate
+	})
+	return subtotals
+}
+
+// LineTotal returns the net amount of a line, rounded to cents as printed,
+// so that the lines add up to the totals of the bill.
+func LineTotal(quantity, unitPrice float64) float64 {
+	return roundAmount(quantity * unitPrice)
+}
+
+// NetTotal returns the sum of the lines, VAT excluded.
+func (b Bill) NetTotal() float64 {
+	total := 0.0
+	for _, item := range b.Items {
+		total += item.Total
+	}
+	return roundAmount(total)
+}
+
+// TaxTotal returns the VAT of the bill.
+func (b Bill) TaxTotal() float64 {
+	total := 0.0
+	for _, subtotal := range b.TaxBreakdown() {
+		total += subtotal.Amount
+	}
+	return roundAmount(total)
+}
+
+// UpdateTotal sets Total to the amount due, VAT included.
+func (b *Bill) UpdateTotal() {
+	b.Total = roundAmount(b.NetTotal() + b.TaxTotal())
+}
+
+var currencySymbols = map[string]string{
+	"€":   "EUR",
+	"$":   "USD",
+	"US$": "USD",
+	"£":   "GBP",
+	"¥":   "JPY",
+}
+
+// CurrencyCode returns the ISO 4217 code of the bill currency, which may be
+// entered as a symbol.
+func CurrencyCode(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if code, ok := currencySymbols[currency]; ok {
+		return code, nil
+	}
+	if len(currency) == 3 && strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+		return currency, nil
+	}
+	return "", fmt.Errorf("currency %q is not an ISO 4217 code", currency)
+}
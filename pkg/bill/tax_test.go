@@ -0,0 +1,37 @@
+package bill
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateTotal(t *testing.T) {
+	// Each line prints as 50.00: the totals add up the printed lines
+	template := BillTemplate{
+		Currency: "EUR",
+		Items: []TemplateItem{
+			{Description: "Consulting", Quantity: 1.5, UnitPrice: 33.33, VATRate: 20},
+			{Description: "Support", Quantity: 1.5, UnitPrice: 33.33, VATRate: 20},
+		},
+	}
+	b := NewBillFromTemplate(template, "INV-1", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	for _, item := range b.Items {
+		if item.Total != 50 {
+			t.Errorf("%s: line total %v, want 50", item.Description, item.Total)
+		}
+	}
+
+	b.UpdateTotal()
+	if net := b.NetTotal(); net != 100 {
+		t.Errorf("NetTotal = %v, want 100", net)
+	}
+	if tax := b.TaxTotal(); tax != 20 {
+		t.Errorf("TaxTotal = %v, want 20", tax)
+	}
+	if b.Total != 120 {
+		t.Errorf("Total = %v, want 120", b.Total)
+	}
+	if subtotals := b.TaxBreakdown(); len(subtotals) != 1 || subtotals[0].Base != 100 || subtotals[0].Amount != 20 {
+		t.Errorf("TaxBreakdown = %+v, want a base of 100 and 20 of VAT", subtotals)
+	}
+}
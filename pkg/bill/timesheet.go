@@ -0,0 +1,325 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeEntry is a single line of a time-tracking export.
+type TimeEntry struct {
+	Date        time.Time
+	Project     string
+	Description string
+	Hours       float64
+}
+
+// GroupBy selects how time entries are aggregated into bill items.
+type GroupBy string
+
+const (
+	GroupByProject GroupBy = "project"
+	GroupByDay     GroupBy = "day"
+)
+
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch GroupBy(strings.ToLower(strings.TrimSpace(s))) {
+	case "", GroupByProject:
+		return GroupByProject, nil
+	case GroupByDay:
+		return GroupByDay, nil
+	}
+	return "", fmt.Errorf("unknown grouping %q (expected project or day)", s)
+}
+
+// LoadTimesheet reads a Toggl or Clockify CSV export, a plain
+// date/project/hours CSV or a timewarrior JSON export.
+func LoadTimesheet(path string) ([]TimeEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseTimesheet(f, filepath.Base(path))
+}
+
+// ParseTimesheet detects the export format from the file name and content.
+func ParseTimesheet(r io.Reader, name string) ([]TimeEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if strings.EqualFold(filepath.Ext(name), ".json") || bytes.HasPrefix(trimmed, []byte("[")) {
+		return parseTimewarrior(trimmed)
+	}
+	return parseTimesheetCSV(data)
+}
+
+type timewarriorInterval struct {
+	Start      string   `json:"start"`
+	End        string   `json:"end"`
+	Tags       []string `json:"tags"`
+	Annotation string   `json:"annotation"`
+}
+
+const timewarriorLayout = "20060102T150405Z"
+
+// entryPrecision keeps the seconds of the time entries, which are rounded
+// to the quantity precision only once added up.
+var entryPrecision = 6
+
+func parseTimewarrior(data []byte) ([]TimeEntry, error) {
+	var intervals []timewarriorInterval
+	if err := json.Unmarshal(data, &intervals); err != nil {
+		return nil, fmt.Errorf("invalid timewarrior export: %w", err)
+	}
+
+	entries := make([]TimeEntry, 0, len(intervals))
+	for i, interval := range intervals {
+		if interval.End == "" {
+			// Interval still being tracked
+			continue
+		}
+		start, err := time.Parse(timewarriorLayout, interval.Start)
+		if err != nil {
+			return nil, fmt.Errorf("interval %d: invalid start %q", i+1, interval.Start)
+		}
+		end, err := time.Parse(timewarriorLayout, interval.End)
+		if err != nil {
+			return nil, fmt.Errorf("interval %d: invalid end %q", i+1, interval.End)
+		}
+
+		if end.Equal(start) {
+			continue
+		}
+		if err := ValidateQuantity(end.Sub(start).Hours(), &entryPrecision); err != nil {
+			return nil, fmt.Errorf("interval %d: %w", i+1, err)
+		}
+
+		entry := TimeEntry{
+			Date:        start.Local(),
+			Description: interval.Annotation,
+			Hours:       end.Sub(start).Hours(),
+		}
+		if len(interval.Tags) > 0 {
+			entry.Project = interval.Tags[0]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Column names used by Toggl ("Start date", "Duration") and Clockify
+// ("Start Date", "Duration (decimal)") exports, and by the plain format.
+var (
+	dateColumns     = []string{"start date", "date"}
+	projectColumns  = []string{"project"}
+	descColumns     = []string{"description"}
+	decimalColumns  = []string{"duration (decimal)", "hours"}
+	durationColumns = []string{"duration", "duration (h)"}
+)
+
+var timesheetDateLayouts = []string{"2006-01-02", "01/02/2006", "02.01.2006"}
+
+func findColumn(header []string, names []string) int {
+	for _, name := range names {
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseTimesheetCSV(data []byte) ([]TimeEntry, error) {
+	// Toggl exports start with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("timesheet is empty")
+	}
+
+	header := records[0]
+	dateCol := findColumn(header, dateColumns)
+	projectCol := findColumn(header, projectColumns)
+	descCol := findColumn(header, descColumns)
+	decimalCol := findColumn(header, decimalColumns)
+	durationCol := findColumn(header, durationColumns)
+	if dateCol < 0 || (decimalCol < 0 && durationCol < 0) {
+		return nil, fmt.Errorf("unrecognized timesheet header (expected date, project and hours columns)")
+	}
+
+	column := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	entries := make([]TimeEntry, 0, len(records)-1)
+	for n, record := range records[1:] {
+		line := n + 2
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		date, err := parseTimesheetDate(column(record, dateCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var hours float64
+		if decimalCol >= 0 {
+			hours, err = strconv.ParseFloat(strings.ReplaceAll(column(record, decimalCol), ",", "."), 64)
+		} else {
+			hours, err = parseDuration(column(record, durationCol))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid duration", line)
+		}
+		if hours == 0 {
+			continue
+		}
+		if err := ValidateQuantity(hours, &entryPrecision); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		entries = append(entries, TimeEntry{
+			Date:        date,
+			Project:     column(record, projectCol),
+			Description: column(record, descCol),
+			Hours:       hours,
+		})
+	}
+	return entries, nil
+}
+
+func parseTimesheetDate(s string) (time.Time, error) {
+	for _, layout := range timesheetDateLayouts {
+		if date, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// parseDuration reads a HH:MM:SS or HH:MM duration as hours.
+func parseDuration(s string) (float64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	hours := 0.0
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		switch i {
+		case 0:
+			hours += float64(value)
+		case 1:
+			hours += float64(value) / 60
+		case 2:
+			hours += float64(value) / 3600
+		}
+	}
+	return hours, nil
+}
+
+// TimesheetItems aggregates time entries into bill items billed in hours at
+// the given hourly rate.
+func TimesheetItems(entries []TimeEntry, groupBy GroupBy, hourlyRate float64, precision *int) []BillItem {
+	type group struct {
+		key      string
+		projects []string
+		from, to time.Time
+		hours    float64
+	}
+
+	groups := make(map[string]*group)
+	var keys []string
+	for _, entry := range entries {
+		project := entry.Project
+		if project == "" {
+			project = "No project"
+		}
+
+		key := project
+		if groupBy == GroupByDay {
+			key = entry.Date.Format("2006-01-02")
+		}
+
+		g, ok := groups[key]
+		if !ok {
+			g = &group{key: key, from: entry.Date, to: entry.Date}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		if !containsString(g.projects, project) {
+			g.projects = append(g.projects, project)
+		}
+		if entry.Date.Before(g.from) {
+			g.from = entry.Date
+		}
+		if entry.Date.After(g.to) {
+			g.to = entry.Date
+		}
+		g.hours += entry.Hours
+	}
+	sort.Strings(keys)
+
+	items := make([]BillItem, 0, len(keys))
+	for _, key := range keys {
+		g := groups[key]
+		quantity := RoundQuantity(g.hours, precision)
+		if quantity <= 0 {
+			continue
+		}
+
+		var description string
+		if groupBy == GroupByDay {
+			description = fmt.Sprintf("%s - %s", g.key, strings.Join(g.projects, ", "))
+		} else if g.from.Format("2006-01-02") == g.to.Format("2006-01-02") {
+			description = fmt.Sprintf("%s (%s)", g.key, g.from.Format("2006-01-02"))
+		} else {
+			description = fmt.Sprintf("%s (%s to %s)", g.key, g.from.Format("2006-01-02"), g.to.Format("2006-01-02"))
+		}
+
+		items = append(items, BillItem{
+			Description: description,
+			Quantity:    quantity,
+			Unit:        UnitHours,
+			UnitPrice:   hourlyRate,
+			Total:       LineTotal(quantity, hourlyRate),
+		})
+	}
+	return items
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package bill
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTimesheetCSV(t *testing.T) {
+	csv := "\xef\xbb\xbfProject,Description,Start date,Duration\n" +
+		"Website,Design,2024-03-01,01:30:00\n" +
+		"Website,Review,2024-03-01,00:00:00\n" +
+		"\n" +
+		"Hosting,Setup,02.03.2024,00:00:20\n"
+	entries, err := ParseTimesheet(strings.NewReader(csv), "toggl.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2 (empty ones skipped)", len(entries))
+	}
+	if e := entries[0]; e.Project != "Website" || e.Description != "Design" || e.Hours != 1.5 || e.Date.Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("entry = %+v", e)
+	}
+	if e := entries[1]; e.Date.Format("2006-01-02") != "2024-03-02" || e.Hours <= 0 {
+		t.Errorf("entry = %+v, want 20 seconds on 2024-03-02", e)
+	}
+}
+
+func TestParseTimesheetCSVHours(t *testing.T) {
+	for hours, wantErr := range map[string]string{
+		`"7,5"`: "",
+		"NaN":   "invalid quantity",
+		"Inf":   "invalid quantity",
+		"-2":    "positive",
+		"1e12":  "exceed",
+		"seven": "invalid duration",
+	} {
+		csv := "date,project,hours\n2024-03-01,Website," + hours + "\n"
+		entries, err := ParseTimesheet(strings.NewReader(csv), "hours.csv")
+		switch {
+		case wantErr == "" && (err != nil || len(entries) != 1 || entries[0].Hours != 7.5):
+			t.Errorf("hours %s: %v, %v", hours, entries, err)
+		case wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr) || !strings.Contains(err.Error(), "line 2")):
+			t.Errorf("hours %s: error %v, want one mentioning line 2 and %q", hours, err, wantErr)
+		}
+	}
+}
+
+func TestParseTimewarrior(t *testing.T) {
+	data := `[
+		{"start": "20240301T090000Z", "end": "20240301T103000Z", "tags": ["Website"], "annotation": "Design"},
+		{"start": "20240301T110000Z"}
+	]`
+	entries, err := ParseTimesheet(strings.NewReader(data), "timew.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Hours != 1.5 || entries[0].Project != "Website" {
+		t.Errorf("entries = %+v, want 1.5 h on Website, the running interval skipped", entries)
+	}
+
+	backwards := `[{"start": "20240301T103000Z", "end": "20240301T090000Z"}]`
+	if _, err := ParseTimesheet(strings.NewReader(backwards), "timew.json"); err == nil || !strings.Contains(err.Error(), "interval 1") {
+		t.Errorf("interval ending before it starts: %v, want an error", err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package btcpay takes payments through a BTCPay Server store: it opens a
+// BTCPay invoice for the amount due on a bill through the Greenfield API,
+// keeps its checkout link and payment destinations on the bill, and
+// records the payment when the BTCPay invoice settles, polled with Sync or
+// notified to the Webhook handler.
+package btcpay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// Provider names BTCPay Server in the checkouts of bills.
+const Provider = "btcpay"
+
+// Config is the BTCPay Server settings, kept in btcpay.json of the config
+// directory. The API key is never stored with them.
+type Config struct {
+	// URL is the root of the server, e.g. "https://btcpay.example.com".
+	URL     string `json:"url"`
+	StoreID string `json:"store_id"`
+
+	// WebhookSecret is the secret of the store webhook notifying bill
+	// serve, empty when settlements are polled only.
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	// ExpirationMinutes is how long the checkout accepts payments, the
+	// store default when 0.
+	ExpirationMinutes int `json:"expiration_minutes,omitempty"`
+}
+
+// Validate checks that invoices can be opened with the configuration.
+func (c *Config) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("no BTCPay Server URL configured")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("BTCPay Server URL %q: expected an http or https URL", c.URL)
+	}
+	if c.StoreID == "" {
+		return fmt.Errorf("no BTCPay store configured")
+	}
+	if c.ExpirationMinutes < 0 {
+		return fmt.Errorf("the checkout expiration cannot be negative")
+	}
+	return nil
+}
+
+func configPath() (string, error) {
+	dir, err := bill.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "btcpay.json"), nil
+}
+
+// LoadConfig reads the BTCPay settings, empty when none were saved.
+func LoadConfig() (*Config, error) {
+	config := &Config{}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SaveConfig writes the BTCPay settings to the config directory. The file
+// holds the webhook secret and is only readable by its owner.
+func SaveConfig(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Client calls the Greenfield API of a store.
+type Client struct {
+	Config
+	APIKey string
+
+	// HTTP sends the requests, a client with a 30 seconds timeout when
+	// nil.
+	HTTP *http.Client
+}
+
+// NewClient returns a client of the store of config, authenticated with
+// an API key holding the invoice permissions of the store.
+func NewClient(config Config, apiKey string) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("a BTCPay API key is required")
+	}
+	return &Client{Config: config, APIKey: apiKey}, nil
+}
+
+// Error is an error answered by the Greenfield API.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("BTCPay Server: %s (%s)", e.Message, e.Code)
+	}
+	return fmt.Sprintf("BTCPay Server: %s", e.Message)
+}
+
+// do sends a request to the store API at path, decoding the JSON answer
+// into out.
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	endpoint := strings.TrimRight(c.URL, "/") + "/api/v1/stores/" + url.PathEscape(c.StoreID) + path
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+c.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return apiError(resp, data)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("BTCPay Server: invalid answer to %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// apiError reads an error answer: {"code", "message"}, or a list of
+// {"path", "message"} for invalid requests.
+func apiError(resp *http.Response, data []byte) error {
+	apiErr := &Error{Status: resp.StatusCode, Message: resp.Status}
+	var single struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	var fields []struct {
+		Path    string `json:"path"`
+		Message string `json:"message"`
+	}
+	switch {
+	case json.Unmarshal(data, &single) == nil && single.Message != "":
+		apiErr.Code, apiErr.Message = single.Code, single.Message
+	case json.Unmarshal(data, &fields) == nil && len(fields) > 0:
+		var messages []string
+		for _, field := range fields {
+			messages = append(messages, field.Path+": "+field.Message)
+		}
+		apiErr.Code, apiErr.Message = "validation-error", strings.Join(messages, "; ")
+	}
+	return apiErr
+}
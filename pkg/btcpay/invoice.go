@@ -0,0 +1,153 @@
+package btcpay
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// Invoice statuses of the Greenfield API.
+const (
+	StatusNew        = "New"
+	StatusProcessing = "Processing"
+	StatusSettled    = "Settled"
+	StatusExpired    = "Expired"
+	StatusInvalid    = "Invalid"
+)
+
+// Invoice is a BTCPay invoice. Amounts are decimal strings, as in the API.
+type Invoice struct {
+	ID           string   `json:"id"`
+	Status       string   `json:"status"`
+	Amount       string   `json:"amount"`
+	Currency     string   `json:"currency"`
+	CheckoutLink string   `json:"checkoutLink"`
+	Metadata     Metadata `json:"metadata"`
+
+	// Unix times
+	CreatedTime    int64 `json:"createdTime,omitempty"`
+	ExpirationTime int64 `json:"expirationTime,omitempty"`
+}
+
+// Metadata links a BTCPay invoice to the bill it was opened for.
+type Metadata struct {
+	OrderID   string `json:"orderId,omitempty"`
+	ItemDesc  string `json:"itemDesc,omitempty"`
+	BuyerName string `json:"buyerName,omitempty"`
+}
+
+// PaymentMethod is a way to pay an invoice. BTCPay Server 1.x names the
+// method in PaymentMethod ("BTC", "BTC-LightningNetwork"), 2.x in
+// PaymentMethodID ("BTC-CHAIN", "BTC-LN").
+type PaymentMethod struct {
+	PaymentMethod   string `json:"paymentMethod,omitempty"`
+	PaymentMethodID string `json:"paymentMethodId,omitempty"`
+	Destination     string `json:"destination"`
+	PaymentLink     string `json:"paymentLink,omitempty"`
+	Amount          string `json:"amount,omitempty"`
+	Due             string `json:"due,omitempty"`
+}
+
+// Name returns the name of the payment method.
+func (m PaymentMethod) Name() string {
+	if m.PaymentMethodID != "" {
+		return m.PaymentMethodID
+	}
+	return m.PaymentMethod
+}
+
+type createRequest struct {
+	Amount   string         `json:"amount"`
+	Currency string         `json:"currency"`
+	Metadata Metadata       `json:"metadata"`
+	Checkout *checkoutSetup `json:"checkout,omitempty"`
+}
+
+type checkoutSetup struct {
+	ExpirationMinutes int `json:"expirationMinutes,omitempty"`
+}
+
+// CreateInvoice opens a BTCPay invoice for an amount of the bill currency,
+// quoting the bill number as the order id.
+func (c *Client) CreateInvoice(b bill.Bill, amount float64) (*Invoice, error) {
+	req := createRequest{
+		Amount:   strconv.FormatFloat(amount, 'f', 2, 64),
+		Currency: b.Currency,
+		Metadata: Metadata{
+			OrderID:   b.Number,
+			ItemDesc:  fmt.Sprintf("Invoice %s", b.Number),
+			BuyerName: b.ToCompanyName,
+		},
+	}
+	if c.ExpirationMinutes > 0 {
+		req.Checkout = &checkoutSetup{ExpirationMinutes: c.ExpirationMinutes}
+	}
+	var inv Invoice
+	if err := c.do("POST", "/invoices", req, &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// Invoice fetches a BTCPay invoice.
+func (c *Client) Invoice(id string) (*Invoice, error) {
+	var inv Invoice
+	if err := c.do("GET", "/invoices/"+url.PathEscape(id), nil, &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// PaymentMethods fetches the ways to pay a BTCPay invoice.
+func (c *Client) PaymentMethods(id string) ([]PaymentMethod, error) {
+	var methods []PaymentMethod
+	if err := c.do("GET", "/invoices/"+url.PathEscape(id)+"/payment-methods", nil, &methods); err != nil {
+		return nil, err
+	}
+	return methods, nil
+}
+
+// Checkout opens a BTCPay invoice for the amount due on an invoice and
+// returns it as the checkout of its bill.
+func (c *Client) Checkout(inv *bill.Invoice) (*bill.Checkout, error) {
+	switch inv.Status {
+	case bill.StatusIssued, bill.StatusSent, bill.StatusPartiallyPaid:
+	default:
+		return nil, fmt.Errorf("cannot take payments for a %s invoice", inv.Status)
+	}
+	amount := inv.Balance()
+	if amount <= 0 {
+		return nil, fmt.Errorf("invoice %s has nothing left to pay", inv.Bill.Number)
+	}
+
+	created, err := c.CreateInvoice(inv.Bill, amount)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := c.PaymentMethods(created.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	checkout := &bill.Checkout{
+		Provider: Provider,
+		ID:       created.ID,
+		URL:      created.CheckoutLink,
+		Amount:   amount,
+		Currency: inv.Bill.Currency,
+	}
+	for _, method := range methods {
+		if method.Destination == "" {
+			continue
+		}
+		checkout.Destinations = append(checkout.Destinations, bill.PaymentDestination{
+			Method:      method.Name(),
+			Destination: method.Destination,
+			Link:        method.PaymentLink,
+			Amount:      method.Amount,
+		})
+	}
+	return checkout, nil
+}
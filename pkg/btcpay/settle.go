@@ -0,0 +1,176 @@
+package btcpay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// open reports whether an invoice, not a credit note, has a BTCPay
+// checkout whose payment was not recorded yet.
+func open(inv *bill.Invoice) bool {
+	checkout := inv.Bill.Checkout
+	if checkout == nil || checkout.Provider != Provider || inv.Bill.CreditNoteFor != "" {
+		return false
+	}
+	switch inv.Status {
+	case bill.StatusIssued, bill.StatusSent, bill.StatusPartiallyPaid:
+	default:
+		return false
+	}
+	for _, payment := range inv.Payments {
+		if payment.Reference == checkout.ID {
+			return false
+		}
+	}
+	return true
+}
+
+// settle records the payment of the checkout of inv if remote, its BTCPay
+// invoice, settled. The caller saves the invoice.
+func settle(inv *bill.Invoice, remote *Invoice, now time.Time) (bool, error) {
+	if !open(inv) || remote.ID != inv.Bill.Checkout.ID || remote.Status != StatusSettled {
+		return false, nil
+	}
+	checkout := inv.Bill.Checkout
+	if checkout.Currency != inv.Bill.Currency {
+		return false, fmt.Errorf("invoice %s: the BTCPay invoice %s is in %s", inv.Bill.Number, checkout.ID, checkout.Currency)
+	}
+	payment := bill.Payment{
+		Date:      now,
+		Amount:    checkout.Amount,
+		Method:    "bitcoin",
+		Reference: checkout.ID,
+	}
+	if err := inv.AddPayment(payment, now); err != nil {
+		return false, fmt.Errorf("invoice %s: %w", inv.Bill.Number, err)
+	}
+	return true, nil
+}
+
+// Settle records the payment of the checkout of inv if its BTCPay invoice
+// settled, reporting whether it did. The caller saves the invoice.
+func (c *Client) Settle(inv *bill.Invoice, now time.Time) (bool, error) {
+	if !open(inv) {
+		return false, nil
+	}
+	remote, err := c.Invoice(inv.Bill.Checkout.ID)
+	if err != nil {
+		return false, fmt.Errorf("invoice %s: %w", inv.Bill.Number, err)
+	}
+	return settle(inv, remote, now)
+}
+
+// Sync polls the BTCPay invoices of the stored invoices waiting for their
+// payment, recording and saving those that settled.
+func (c *Client) Sync(now time.Time) ([]*bill.Invoice, error) {
+	invoices, err := bill.ListInvoices()
+	if err != nil {
+		return nil, err
+	}
+	var settled []*bill.Invoice
+	var errs []error
+	for i := range invoices {
+		inv := &invoices[i]
+		ok, err := c.Settle(inv, now)
+		if err == nil && ok {
+			err = bill.SaveInvoice(inv)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			settled = append(settled, inv)
+		}
+	}
+	return settled, errors.Join(errs...)
+}
+
+// SignatureHeader carries the signature of the webhook deliveries of
+// BTCPay Server: "sha256=" and the hex HMAC-SHA256 of the body keyed by
+// the webhook secret.
+const SignatureHeader = "BTCPay-Sig"
+
+// event is the part of a webhook delivery bill reads.
+type event struct {
+	Type      string `json:"type"`
+	StoreID   string `json:"storeId"`
+	InvoiceID string `json:"invoiceId"`
+}
+
+// Webhook returns the handler of the webhook of the store, signed with
+// secret. Deliveries of settled invoices record the payment of the
+// invoice whose checkout it is; the invoice is fetched from the API rather
+// than trusted from the delivery.
+func (c *Client) Webhook(secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "webhook deliveries are POSTed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if secret == "" || !hmac.Equal([]byte(r.Header.Get(SignatureHeader)), []byte(expected)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var e event
+		if err := json.Unmarshal(body, &e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if e.Type != "InvoiceSettled" || e.StoreID != c.StoreID {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := c.settleDelivery(e.InvoiceID, time.Now()); err != nil {
+			// BTCPay Server delivers again on errors
+			log.Printf("btcpay: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (c *Client) settleDelivery(id string, now time.Time) error {
+	remote, err := c.Invoice(id)
+	if err != nil {
+		return err
+	}
+	if remote.Metadata.OrderID == "" {
+		return nil
+	}
+	inv, err := bill.LoadInvoice(remote.Metadata.OrderID)
+	if errors.Is(err, os.ErrNotExist) {
+		// Not opened by bill
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ok, err := settle(inv, remote, now)
+	if err != nil || !ok {
+		return err
+	}
+	return bill.SaveInvoice(inv)
+}
@@ -0,0 +1,219 @@
+package btcpay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// greenfield is a stand-in BTCPay Server answering the invoices of a
+// store with the given statuses.
+type greenfield struct {
+	t        *testing.T
+	statuses map[string]string
+	orders   map[string]string
+	requests int
+}
+
+func (g *greenfield) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.requests++
+	if got := r.Header.Get("Authorization"); got != "token key" {
+		g.t.Errorf("Authorization = %q, want %q", got, "token key")
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/stores/store/invoices/")
+	status, ok := g.statuses[id]
+	if r.Method != http.MethodGet || !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"code": "invoice-not-found", "message": "Invoice not found"})
+		return
+	}
+	json.NewEncoder(w).Encode(Invoice{ID: id, Status: status, Metadata: Metadata{OrderID: g.orders[id]}})
+}
+
+func newTestClient(t *testing.T, g *greenfield) *Client {
+	t.Helper()
+	server := httptest.NewServer(g)
+	t.Cleanup(server.Close)
+	client, err := NewClient(Config{URL: server.URL, StoreID: "store"}, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// useConfigDir keeps the invoices of a test in a directory of its own.
+func useConfigDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+}
+
+func checkoutInvoice(t *testing.T, number, checkoutID string) *bill.Invoice {
+	t.Helper()
+	b := bill.Bill{
+		Number:   number,
+		Date:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Currency: "EUR",
+		Total:    120,
+		Checkout: &bill.Checkout{Provider: Provider, ID: checkoutID, URL: "https://btcpay.example.com/i/" + checkoutID, Amount: 120, Currency: "EUR"},
+	}
+	inv, err := bill.NewInvoice(b, bill.StatusIssued, b.Date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+func TestSettle(t *testing.T) {
+	useConfigDir(t)
+	g := &greenfield{t: t, statuses: map[string]string{"pending": StatusProcessing, "settled": StatusSettled}}
+	client := newTestClient(t, g)
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	pending := checkoutInvoice(t, "INV-1", "pending")
+	if ok, err := client.Settle(pending, now); err != nil || ok {
+		t.Errorf("Settle(processing) = %v, %v, want false, nil", ok, err)
+	}
+	if len(pending.Payments) != 0 {
+		t.Errorf("processing checkout recorded %d payments", len(pending.Payments))
+	}
+
+	inv := checkoutInvoice(t, "INV-2", "settled")
+	if ok, err := client.Settle(inv, now); err != nil || !ok {
+		t.Fatalf("Settle(settled) = %v, %v, want true, nil", ok, err)
+	}
+	if inv.Status != bill.StatusPaid {
+		t.Errorf("status = %s, want %s", inv.Status, bill.StatusPaid)
+	}
+	if len(inv.Payments) != 1 || inv.Payments[0].Reference != "settled" || inv.Payments[0].Amount != 120 {
+		t.Errorf("payments = %+v, want one of 120 referencing the checkout", inv.Payments)
+	}
+
+	// The payment is recorded once, without asking the server again
+	requests := g.requests
+	if ok, err := client.Settle(inv, now); err != nil || ok {
+		t.Errorf("second Settle = %v, %v, want false, nil", ok, err)
+	}
+	if g.requests != requests {
+		t.Errorf("second Settle made %d requests", g.requests-requests)
+	}
+
+	missing := checkoutInvoice(t, "INV-3", "missing")
+	if _, err := client.Settle(missing, now); err == nil || !strings.Contains(err.Error(), "Invoice not found") {
+		t.Errorf("Settle(missing) error = %v, want the API error", err)
+	}
+}
+
+func TestSettleSkipsCreditNotes(t *testing.T) {
+	useConfigDir(t)
+	g := &greenfield{t: t, statuses: map[string]string{"settled": StatusSettled}}
+	client := newTestClient(t, g)
+
+	inv := checkoutInvoice(t, "CN-1", "settled")
+	inv.Bill.CreditNoteFor = "INV-1"
+	if ok, err := client.Settle(inv, time.Now()); err != nil || ok {
+		t.Errorf("Settle(credit note) = %v, %v, want false, nil", ok, err)
+	}
+	if g.requests != 0 {
+		t.Errorf("Settle(credit note) made %d requests", g.requests)
+	}
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhook(t *testing.T) {
+	useConfigDir(t)
+	g := &greenfield{
+		t:        t,
+		statuses: map[string]string{"settled": StatusSettled},
+		orders:   map[string]string{"settled": "INV-1"},
+	}
+	client := newTestClient(t, g)
+	if err := bill.SaveInvoice(checkoutInvoice(t, "INV-1", "settled")); err != nil {
+		t.Fatal(err)
+	}
+	handler := client.Webhook("whsec")
+
+	deliver := func(secret, signature string, body []byte) int {
+		req := httptest.NewRequest(http.MethodPost, "/btcpay/webhook", strings.NewReader(string(body)))
+		if signature == "" {
+			signature = sign(secret, body)
+		}
+		req.Header.Set(SignatureHeader, signature)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	settled := []byte(`{"type": "InvoiceSettled", "storeId": "store", "invoiceId": "settled"}`)
+	for _, tc := range []struct {
+		name, signature string
+	}{
+		{"wrong secret", sign("other", settled)},
+		{"malformed", "sha256=zz"},
+		{"missing", " "},
+	} {
+		if code := deliver("whsec", tc.signature, settled); code != http.StatusUnauthorized {
+			t.Errorf("%s signature: status %d, want %d", tc.name, code, http.StatusUnauthorized)
+		}
+	}
+	if g.requests != 0 {
+		t.Fatalf("unsigned deliveries made %d requests", g.requests)
+	}
+
+	// Other events and stores are acknowledged and ignored
+	other := []byte(`{"type": "InvoiceSettled", "storeId": "other", "invoiceId": "settled"}`)
+	if code := deliver("whsec", "", other); code != http.StatusNoContent || g.requests != 0 {
+		t.Errorf("other store: status %d after %d requests, want %d and none", code, g.requests, http.StatusNoContent)
+	}
+
+	if code := deliver("whsec", "", settled); code != http.StatusNoContent {
+		t.Fatalf("settled: status %d, want %d", code, http.StatusNoContent)
+	}
+	inv, err := bill.LoadInvoice("INV-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Status != bill.StatusPaid || len(inv.Payments) != 1 {
+		t.Errorf("after delivery: %s with %d payments, want paid with one", inv.Status, len(inv.Payments))
+	}
+
+	// Deliveries are retried by BTCPay Server: the payment is kept once
+	if code := deliver("whsec", "", settled); code != http.StatusNoContent {
+		t.Errorf("delivered again: status %d, want %d", code, http.StatusNoContent)
+	}
+	if inv, _ = bill.LoadInvoice("INV-1"); len(inv.Payments) != 1 {
+		t.Errorf("delivered again: %d payments, want 1", len(inv.Payments))
+	}
+}
+
+func TestWebhookWithoutSecret(t *testing.T) {
+	handler := (&Client{Config: Config{StoreID: "store"}}).Webhook("")
+	body := []byte(`{"type": "InvoiceSettled", "storeId": "store", "invoiceId": "settled"}`)
+	req := httptest.NewRequest(http.MethodPost, "/btcpay/webhook", strings.NewReader(string(body)))
+	req.Header.Set(SignatureHeader, sign("", body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/btcpay/webhook", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
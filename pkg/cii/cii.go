@@ -0,0 +1,275 @@
+// Package cii models the UN/CEFACT Cross-Industry-Invoice (CII D16B) XML
+// syntax used by Factur-X, ZUGFeRD and XRechnung.
+//
+// Elements are declared in schema order, which the syntax requires.
+package cii
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NamespaceRSM = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	NamespaceRAM = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	NamespaceQDT = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
+	NamespaceUDT = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+)
+
+// Document type codes (UNTDID 1001).
+const (
+	TypeInvoice    = "380"
+	TypeCreditNote = "381"
+)
+
+// DateFormat is the format code of dates written as YYYYMMDD.
+const DateFormat = "102"
+
+type CrossIndustryInvoice struct {
+	XMLName  xml.Name `xml:"rsm:CrossIndustryInvoice"`
+	XmlnsRSM string   `xml:"xmlns:rsm,attr"`
+	XmlnsRAM string   `xml:"xmlns:ram,attr"`
+	XmlnsQDT string   `xml:"xmlns:qdt,attr"`
+	XmlnsUDT string   `xml:"xmlns:udt,attr"`
+
+	Context     DocumentContext `xml:"rsm:ExchangedDocumentContext"`
+	Document    Document        `xml:"rsm:ExchangedDocument"`
+	Transaction Transaction     `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+// New returns an empty invoice declaring the CII namespaces.
+func New() *CrossIndustryInvoice {
+	return &CrossIndustryInvoice{
+		XmlnsRSM: NamespaceRSM,
+		XmlnsRAM: NamespaceRAM,
+		XmlnsQDT: NamespaceQDT,
+		XmlnsUDT: NamespaceUDT,
+	}
+}
+
+// Marshal serializes the invoice with an XML declaration.
+func (inv *CrossIndustryInvoice) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+type DocumentContext struct {
+	BusinessProcess *ID `xml:"ram:BusinessProcessSpecifiedDocumentContextParameter,omitempty"`
+	Guideline       ID  `xml:"ram:GuidelineSpecifiedDocumentContextParameter"`
+}
+
+type ID struct {
+	ID string `xml:"ram:ID"`
+}
+
+type Document struct {
+	ID            string   `xml:"ram:ID"`
+	TypeCode      string   `xml:"ram:TypeCode"`
+	IssueDateTime DateTime `xml:"ram:IssueDateTime"`
+	Notes         []Note   `xml:"ram:IncludedNote,omitempty"`
+}
+
+type Note struct {
+	Content     string `xml:"ram:Content"`
+	SubjectCode string `xml:"ram:SubjectCode,omitempty"`
+}
+
+type DateTime struct {
+	DateTimeString DateTimeString `xml:"udt:DateTimeString"`
+}
+
+type DateTimeString struct {
+	Format string `xml:"format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// NewDateTime formats a date with DateFormat.
+func NewDateTime(t time.Time) DateTime {
+	return DateTime{DateTimeString{Format: DateFormat, Value: t.Format("20060102")}}
+}
+
+// Time parses a date written with DateFormat.
+func (d DateTime) Time() (time.Time, error) {
+	if d.DateTimeString.Format != "" && d.DateTimeString.Format != DateFormat {
+		return time.Time{}, fmt.Errorf("unsupported date format %s", d.DateTimeString.Format)
+	}
+	return time.Parse("20060102", d.DateTimeString.Value)
+}
+
+type Transaction struct {
+	Lines      []LineItem       `xml:"ram:IncludedSupplyChainTradeLineItem,omitempty"`
+	Agreement  HeaderAgreement  `xml:"ram:ApplicableHeaderTradeAgreement"`
+	Delivery   HeaderDelivery   `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement HeaderSettlement `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type LineItem struct {
+	Document   LineDocument   `xml:"ram:AssociatedDocumentLineDocument"`
+	Product    Product        `xml:"ram:SpecifiedTradeProduct"`
+	Agreement  LineAgreement  `xml:"ram:SpecifiedLineTradeAgreement"`
+	Delivery   LineDelivery   `xml:"ram:SpecifiedLineTradeDelivery"`
+	Settlement LineSettlement `xml:"ram:SpecifiedLineTradeSettlement"`
+}
+
+type LineDocument struct {
+	LineID string `xml:"ram:LineID"`
+}
+
+type Product struct {
+	Name string `xml:"ram:Name"`
+}
+
+type LineAgreement struct {
+	NetPrice Price `xml:"ram:NetPriceProductTradePrice"`
+}
+
+type Price struct {
+	ChargeAmount string `xml:"ram:ChargeAmount"`
+}
+
+type LineDelivery struct {
+	BilledQuantity Quantity `xml:"ram:BilledQuantity"`
+}
+
+type Quantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type LineSettlement struct {
+	Tax       TradeTax        `xml:"ram:ApplicableTradeTax"`
+	Summation LineMonetarySum `xml:"ram:SpecifiedTradeSettlementLineMonetarySummation"`
+}
+
+type LineMonetarySum struct {
+	LineTotalAmount string `xml:"ram:LineTotalAmount"`
+}
+
+type HeaderAgreement struct {
+	BuyerReference string     `xml:"ram:BuyerReference,omitempty"`
+	Seller         TradeParty `xml:"ram:SellerTradeParty"`
+	Buyer          TradeParty `xml:"ram:BuyerTradeParty"`
+}
+
+type TradeParty struct {
+	Name             string            `xml:"ram:Name"`
+	Contact          *TradeContact     `xml:"ram:DefinedTradeContact,omitempty"`
+	Address          *Address          `xml:"ram:PostalTradeAddress,omitempty"`
+	URI              *URI              `xml:"ram:URIUniversalCommunication,omitempty"`
+	TaxRegistrations []TaxRegistration `xml:"ram:SpecifiedTaxRegistration,omitempty"`
+}
+
+type TradeContact struct {
+	PersonName string         `xml:"ram:PersonName,omitempty"`
+	Telephone  *Communication `xml:"ram:TelephoneUniversalCommunication,omitempty"`
+	Email      *URI           `xml:"ram:EmailURIUniversalCommunication,omitempty"`
+}
+
+type Communication struct {
+	CompleteNumber string `xml:"ram:CompleteNumber"`
+}
+
+type URI struct {
+	URIID SchemeID `xml:"ram:URIID"`
+}
+
+type Address struct {
+	Postcode  string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne   string `xml:"ram:LineOne,omitempty"`
+	LineTwo   string `xml:"ram:LineTwo,omitempty"`
+	LineThree string `xml:"ram:LineThree,omitempty"`
+	City      string `xml:"ram:CityName,omitempty"`
+	CountryID string `xml:"ram:CountryID"`
+}
+
+type TaxRegistration struct {
+	ID SchemeID `xml:"ram:ID"`
+}
+
+type SchemeID struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type HeaderDelivery struct{}
+
+type HeaderSettlement struct {
+	PaymentReference string              `xml:"ram:PaymentReference,omitempty"`
+	Currency         string              `xml:"ram:InvoiceCurrencyCode"`
+	PaymentMeans     []PaymentMeans      `xml:"ram:SpecifiedTradeSettlementPaymentMeans,omitempty"`
+	Taxes            []TradeTax          `xml:"ram:ApplicableTradeTax,omitempty"`
+	PaymentTerms     *PaymentTerms       `xml:"ram:SpecifiedTradePaymentTerms,omitempty"`
+	Summation        HeaderMonetarySum   `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+	InvoiceReference *ReferencedDocument `xml:"ram:InvoiceReferencedDocument,omitempty"`
+}
+
+type PaymentMeans struct {
+	TypeCode    string             `xml:"ram:TypeCode"`
+	Information string             `xml:"ram:Information,omitempty"`
+	Account     *CreditorAccount   `xml:"ram:PayeePartyCreditorFinancialAccount,omitempty"`
+	Institution *CreditorInstitute `xml:"ram:PayeeSpecifiedCreditorFinancialInstitution,omitempty"`
+}
+
+type CreditorAccount struct {
+	IBAN        string `xml:"ram:IBANID,omitempty"`
+	AccountName string `xml:"ram:AccountName,omitempty"`
+}
+
+type CreditorInstitute struct {
+	BIC string `xml:"ram:BICID"`
+}
+
+type TradeTax struct {
+	CalculatedAmount string `xml:"ram:CalculatedAmount,omitempty"`
+	TypeCode         string `xml:"ram:TypeCode"`
+	ExemptionReason  string `xml:"ram:ExemptionReason,omitempty"`
+	BasisAmount      string `xml:"ram:BasisAmount,omitempty"`
+	CategoryCode     string `xml:"ram:CategoryCode"`
+	RatePercent      string `xml:"ram:RateApplicablePercent,omitempty"`
+}
+
+type PaymentTerms struct {
+	Description string    `xml:"ram:Description,omitempty"`
+	DueDate     *DateTime `xml:"ram:DueDateDateTime,omitempty"`
+}
+
+type HeaderMonetarySum struct {
+	LineTotalAmount     string `xml:"ram:LineTotalAmount,omitempty"`
+	TaxBasisTotalAmount string `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotalAmount      Amount `xml:"ram:TaxTotalAmount"`
+	GrandTotalAmount    string `xml:"ram:GrandTotalAmount"`
+	TotalPrepaidAmount  string `xml:"ram:TotalPrepaidAmount,omitempty"`
+	DuePayableAmount    string `xml:"ram:DuePayableAmount"`
+}
+
+type Amount struct {
+	CurrencyID string `xml:"currencyID,attr,omitempty"`
+	Value      string `xml:",chardata"`
+}
+
+type ReferencedDocument struct {
+	IssuerAssignedID string    `xml:"ram:IssuerAssignedID"`
+	IssueDate        *DateTime `xml:"ram:FormattedIssueDateTime,omitempty"`
+}
+
+// FormatAmount writes an amount with two decimals.
+func FormatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// FormatPrice writes a unit price with as many decimals as it has, between
+// two and eight, since line amounts are computed from the unrounded price.
+// The UBL and FatturaPA exports write their prices the same way.
+func FormatPrice(price float64) string {
+	s := strings.TrimRight(strconv.FormatFloat(price, 'f', 8, 64), "0")
+	if decimals := len(s) - strings.IndexByte(s, '.') - 1; decimals < 2 {
+		s += strings.Repeat("0", 2-decimals)
+	}
+	return s
+}
@@ -0,0 +1,300 @@
+// Package cms builds and checks the detached CMS signatures (RFC 5652)
+// embedded in signed PDFs, in the CAdES form PAdES requires, and reads the
+// certificates and private keys they are made with from PEM or PKCS#12
+// files.
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+var (
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA1                 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSHA256WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// signingCertificateV2 is the ESS attribute binding the signature to the
+// signer's certificate (RFC 5035), mandatory in CAdES.
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+type essCertIDv2 struct {
+	CertHash []byte // SHA-256, the default algorithm
+}
+
+// Signer is a private key with its certificate and the certificates
+// chaining it to a trusted root, if known.
+type Signer struct {
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+}
+
+// NewSigner checks that a private key matches its certificate and can
+// sign detached CMS signatures.
+func NewSigner(key interface{}, certificate *x509.Certificate, chain []*x509.Certificate) (*Signer, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("cms: unsupported private key")
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("cms: only RSA and ECDSA keys are supported")
+	}
+	if !publicKeyMatches(certificate, key) {
+		return nil, errors.New("cms: the private key does not match the certificate")
+	}
+	return &Signer{Key: signer, Certificate: certificate, Chain: chain}, nil
+}
+
+func rawSet(values ...[]byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(values, nil)}
+}
+
+func marshalAttribute(oid asn1.ObjectIdentifier, value interface{}) ([]byte, error) {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: der}}})
+}
+
+// SignDetached returns a DER ContentInfo holding a detached CAdES
+// signature of content: SHA-256 digests, with the content type, message
+// digest and signing certificate attributes. The signing time is left
+// to the document, as PAdES requires.
+func (s *Signer) SignDetached(content []byte) ([]byte, error) {
+	digest := sha256.Sum256(content)
+	certHash := sha256.Sum256(s.Certificate.Raw)
+
+	// The signature covers the DER SET OF the attributes, sorted by their
+	// encoding, stored with an implicit [0] tag instead
+	var attributes [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidContentType, oidData},
+		{oidMessageDigest, digest[:]},
+		{oidSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}}},
+	} {
+		attr, err := marshalAttribute(a.oid, a.value)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attr)
+	}
+	sort.Slice(attributes, func(i, j int) bool { return bytes.Compare(attributes[i], attributes[j]) < 0 })
+	set := rawSet(attributes...)
+	toSign, err := asn1.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(toSign)
+
+	signatureAlgorithm := oidSHA256WithRSA
+	if _, ok := s.Key.Public().(*ecdsa.PublicKey); ok {
+		signatureAlgorithm = oidECDSAWithSHA256
+	}
+	signature, err := s.Key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates := [][]byte{s.Certificate.Raw}
+	for _, cert := range s.Chain {
+		certificates = append(certificates, cert.Raw)
+	}
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		EncapContentInfo: contentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bytes.Join(certificates, nil)},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                issuerAndSerial{Issuer: asn1.RawValue{FullBytes: s.Certificate.RawIssuer}, Serial: s.Certificate.SerialNumber},
+			DigestAlgorithm:    sha256Algorithm,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: set.Bytes},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: signatureAlgorithm},
+			Signature:          signature,
+		}},
+	}
+	if signatureAlgorithm.Equal(oidSHA256WithRSA) {
+		sd.SignerInfos[0].SignatureAlgorithm.Parameters = asn1.NullRawValue
+	}
+	der, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der},
+	})
+}
+
+// Verification is the outcome of checking a detached signature.
+type Verification struct {
+	// Signer is the certificate of the signer, Certificates all the
+	// certificates carried by the signature.
+	Signer       *x509.Certificate
+	Certificates []*x509.Certificate
+}
+
+// VerifyDetached checks that signature, a DER ContentInfo, is a valid
+// signature of content, returning the signer's certificate. Whether the
+// certificate is trusted is left to the caller.
+func VerifyDetached(signature, content []byte) (*Verification, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(signature, &ci); err != nil {
+		return nil, fmt.Errorf("cms: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("cms: not a signed-data content")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("cms: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("cms: expected one signer, found %d", len(sd.SignerInfos))
+	}
+	certificates, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cms: %w", err)
+	}
+
+	si := sd.SignerInfos[0]
+	var signer *x509.Certificate
+	for _, cert := range certificates {
+		if bytes.Equal(cert.RawIssuer, si.SID.Issuer.FullBytes) && cert.SerialNumber.Cmp(si.SID.Serial) == 0 {
+			signer = cert
+		}
+	}
+	if signer == nil {
+		return nil, errors.New("cms: the signer's certificate is missing")
+	}
+
+	newHash, err := hashFor(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h := newHash()
+	h.Write(content)
+	digest := h.Sum(nil)
+
+	if len(si.SignedAttrs.Bytes) == 0 {
+		return nil, errors.New("cms: the signature has no signed attributes")
+	}
+	var attributes []attribute
+	if _, err := asn1.UnmarshalWithParams(si.SignedAttrs.FullBytes, &attributes, "set,tag:0"); err != nil {
+		return nil, fmt.Errorf("cms: %w", err)
+	}
+	var messageDigest []byte
+	for _, attr := range attributes {
+		if attr.Type.Equal(oidMessageDigest) && len(attr.Values) == 1 {
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &messageDigest); err != nil {
+				return nil, fmt.Errorf("cms: %w", err)
+			}
+		}
+	}
+	if !bytes.Equal(messageDigest, digest) {
+		return nil, errors.New("cms: the content does not match the signed digest")
+	}
+
+	signed, err := asn1.Marshal(rawSet(si.SignedAttrs.Bytes))
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := signatureAlgorithm(si, signer)
+	if err != nil {
+		return nil, err
+	}
+	if err := signer.CheckSignature(algorithm, signed, si.Signature); err != nil {
+		return nil, fmt.Errorf("cms: invalid signature: %w", err)
+	}
+	return &Verification{Signer: signer, Certificates: certificates}, nil
+}
+
+// signatureAlgorithm maps the digest and signature algorithms of a signer
+// to the x509 algorithm checking them.
+func signatureAlgorithm(si signerInfo, signer *x509.Certificate) (x509.SignatureAlgorithm, error) {
+	digest := si.DigestAlgorithm.Algorithm
+	switch signer.PublicKey.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case digest.Equal(oidSHA256):
+			return x509.SHA256WithRSA, nil
+		case digest.Equal(oidSHA384):
+			return x509.SHA384WithRSA, nil
+		case digest.Equal(oidSHA512):
+			return x509.SHA512WithRSA, nil
+		}
+	case *ecdsa.PublicKey:
+		switch {
+		case digest.Equal(oidSHA256):
+			return x509.ECDSAWithSHA256, nil
+		case digest.Equal(oidSHA384):
+			return x509.ECDSAWithSHA384, nil
+		case digest.Equal(oidSHA512):
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("cms: unsupported signature algorithm %v", si.SignatureAlgorithm.Algorithm)
+}
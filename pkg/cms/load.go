@@ -0,0 +1,92 @@
+package cms
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadSigner reads a signing key and its certificate. A .p12 or .pfx
+// certificate file is a PKCS#12 store holding both, opened with password;
+// otherwise certificate is a PEM file of the certificate followed by its
+// chain and key a PEM file of the private key (PKCS#8, PKCS#1 or SEC 1),
+// the key being looked up in the certificate file when key is empty.
+func LoadSigner(certificate, key, password string) (*Signer, error) {
+	data, err := os.ReadFile(certificate)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(certificate)) {
+	case ".p12", ".pfx":
+		privateKey, certificates, err := DecodePKCS12(data, password)
+		if err != nil {
+			return nil, err
+		}
+		return NewSigner(privateKey, certificates[0], certificates[1:])
+	}
+
+	var certificates []*x509.Certificate
+	var privateKey interface{}
+	readPEM := func(data []byte) error {
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				return nil
+			}
+			switch block.Type {
+			case "CERTIFICATE":
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return err
+				}
+				certificates = append(certificates, cert)
+			case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+				if privateKey != nil {
+					continue
+				}
+				if privateKey, err = parsePrivateKey(block.Bytes); err != nil {
+					return err
+				}
+			case "ENCRYPTED PRIVATE KEY":
+				return errors.New("encrypted PEM keys are not supported, use a PKCS#12 file")
+			}
+		}
+	}
+	if err := readPEM(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", certificate, err)
+	}
+	if key != "" {
+		data, err := os.ReadFile(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := readPEM(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("%s: no certificate found", certificate)
+	}
+	if privateKey == nil {
+		return nil, errors.New("no private key found")
+	}
+	return NewSigner(privateKey, certificates[0], certificates[1:])
+}
+
+func parsePrivateKey(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key")
+}
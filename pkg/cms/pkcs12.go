@@ -0,0 +1,452 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"unicode/utf16"
+)
+
+// ErrPassword is returned when a PKCS#12 file does not open with the
+// password given.
+var ErrPassword = errors.New("pkcs12: wrong password")
+
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidKeyBag          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidPBEWithSHA3DES  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHA40RC2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidPBES2           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1    = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC      = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidLocalKeyID      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+)
+
+var errUnsupportedPKCS12 = errors.New("pkcs12: unsupported format")
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// DecodePKCS12 reads the private key and certificates of a PKCS#12 file
+// (.p12 or .pfx), returning the certificate of the key first. Files
+// encrypted with PBES2 (AES or 3DES, the OpenSSL 3 default) and the
+// legacy 3DES and RC2 schemes are supported.
+func DecodePKCS12(data []byte, password string) (interface{}, []*x509.Certificate, error) {
+	var pfx pfxPdu
+	if rest, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return nil, nil, fmt.Errorf("pkcs12: %w", err)
+	} else if len(rest) > 0 {
+		return nil, nil, errors.New("pkcs12: trailing data")
+	}
+	if pfx.Version != 3 || !pfx.AuthSafe.ContentType.Equal(oidData) {
+		return nil, nil, errUnsupportedPKCS12
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+
+	if len(pfx.MacData.Mac.Digest) > 0 {
+		if err := verifyMac(pfx.MacData, authSafe, password); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return nil, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+
+	var bags []safeBag
+	for _, content := range contents {
+		var data []byte
+		switch {
+		case content.ContentType.Equal(oidData):
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &data); err != nil {
+				return nil, nil, fmt.Errorf("pkcs12: %w", err)
+			}
+		case content.ContentType.Equal(oidEncryptedData):
+			var encrypted encryptedData
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &encrypted); err != nil {
+				return nil, nil, fmt.Errorf("pkcs12: %w", err)
+			}
+			var err error
+			info := encrypted.EncryptedContentInfo
+			if data, err = pbeDecrypt(info.ContentEncryptionAlgorithm, info.EncryptedContent, password); err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, errUnsupportedPKCS12
+		}
+		var safeContents []safeBag
+		if _, err := asn1.Unmarshal(data, &safeContents); err != nil {
+			return nil, nil, fmt.Errorf("pkcs12: %w", err)
+		}
+		bags = append(bags, safeContents...)
+	}
+
+	var key interface{}
+	var keyID []byte
+	var certs []*x509.Certificate
+	var certIDs [][]byte
+	for _, bag := range bags {
+		switch {
+		case bag.ID.Equal(oidCertBag):
+			var cb certBag
+			if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+				return nil, nil, fmt.Errorf("pkcs12: %w", err)
+			}
+			if !cb.ID.Equal(oidX509Certificate) {
+				continue
+			}
+			cert, err := x509.ParseCertificate(cb.Data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("pkcs12: %w", err)
+			}
+			certs = append(certs, cert)
+			certIDs = append(certIDs, localKeyID(bag))
+		case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidShroudedKeyBag):
+			if key != nil {
+				return nil, nil, errors.New("pkcs12: more than one private key")
+			}
+			der := bag.Value.Bytes
+			if bag.ID.Equal(oidShroudedKeyBag) {
+				var info encryptedPrivateKeyInfo
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &info); err != nil {
+					return nil, nil, fmt.Errorf("pkcs12: %w", err)
+				}
+				var err error
+				if der, err = pbeDecrypt(info.Algorithm, info.EncryptedData, password); err != nil {
+					return nil, nil, err
+				}
+			}
+			var err error
+			if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+				return nil, nil, fmt.Errorf("pkcs12: %w", err)
+			}
+			keyID = localKeyID(bag)
+		}
+	}
+	if key == nil {
+		return nil, nil, errors.New("pkcs12: no private key")
+	}
+	if len(certs) == 0 {
+		return nil, nil, errors.New("pkcs12: no certificate")
+	}
+
+	// The certificate of the key comes first, found by its local key ID
+	// or else by its public key
+	for i, cert := range certs {
+		if (keyID != nil && bytes.Equal(certIDs[i], keyID)) || publicKeyMatches(cert, key) {
+			certs[0], certs[i] = certs[i], certs[0]
+			return key, certs, nil
+		}
+	}
+	return nil, nil, errors.New("pkcs12: no certificate matches the private key")
+}
+
+func localKeyID(bag safeBag) []byte {
+	for _, attribute := range bag.Attributes {
+		if attribute.ID.Equal(oidLocalKeyID) {
+			var id []byte
+			if _, err := asn1.Unmarshal(attribute.Value.Bytes, &id); err == nil {
+				return id
+			}
+		}
+	}
+	return nil
+}
+
+func publicKeyMatches(cert *x509.Certificate, key interface{}) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && public.Equal(cert.PublicKey)
+}
+
+// bmpPassword encodes a password as PKCS#12 expects for its own key
+// derivation: UTF-16 big-endian with a terminating zero.
+func bmpPassword(password string) []byte {
+	units := utf16.Encode([]rune(password))
+	out := make([]byte, 0, 2*len(units)+2)
+	for _, unit := range units {
+		out = append(out, byte(unit>>8), byte(unit))
+	}
+	return append(out, 0, 0)
+}
+
+func hashFor(algorithm asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case algorithm.Equal(oidSHA1), algorithm.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case algorithm.Equal(oidSHA256), algorithm.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case algorithm.Equal(oidSHA384), algorithm.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case algorithm.Equal(oidSHA512), algorithm.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("pkcs12: unsupported digest %v", algorithm)
+}
+
+// pkcs12KDF derives key material as in RFC 7292 appendix B.2, id being 1
+// for keys, 2 for IVs and 3 for MAC keys.
+func pkcs12KDF(newHash func() hash.Hash, id byte, password, salt []byte, iterations, size int) []byte {
+	h := newHash()
+	v := h.BlockSize()
+
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(data)+v-1)/v))
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+	d := bytes.Repeat([]byte{id}, v)
+	input := append(fill(salt), fill(password)...)
+
+	var out []byte
+	for len(out) < size {
+		h.Reset()
+		h.Write(d)
+		h.Write(input)
+		a := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h.Reset()
+			h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		out = append(out, a...)
+
+		// Each block of the input becomes block + B + 1
+		b := new(big.Int).SetBytes(fill(a)[:v])
+		b.Add(b, big.NewInt(1))
+		modulus := new(big.Int).Lsh(big.NewInt(1), uint(8*v))
+		for j := 0; j < len(input); j += v {
+			block := new(big.Int).SetBytes(input[j : j+v])
+			block.Add(block, b).Mod(block, modulus)
+			raw := block.Bytes()
+			copy(input[j:j+v], make([]byte, v))
+			copy(input[j+v-len(raw):j+v], raw)
+		}
+	}
+	return out[:size]
+}
+
+// pbkdf2 derives a key as in RFC 8018 section 5.2.
+func pbkdf2(newHash func() hash.Hash, password, salt []byte, iterations, size int) []byte {
+	prf := hmac.New(newHash, password)
+	var out []byte
+	for block := uint32(1); len(out) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:size]
+}
+
+func verifyMac(mac macData, content []byte, password string) error {
+	newHash, err := hashFor(mac.Mac.Algorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	key := pkcs12KDF(newHash, 3, bmpPassword(password), mac.MacSalt, mac.Iterations, newHash().Size())
+	h := hmac.New(newHash, key)
+	h.Write(content)
+	if !hmac.Equal(h.Sum(nil), mac.Mac.Digest) {
+		return ErrPassword
+	}
+	return nil
+}
+
+// pbeDecrypt decrypts content protected by a PKCS#12 or PBES2 password
+// based scheme.
+func pbeDecrypt(algorithm pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+	switch {
+	case algorithm.Algorithm.Equal(oidPBEWithSHA3DES), algorithm.Algorithm.Equal(oidPBEWithSHA40RC2):
+		var params pbeParams
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("pkcs12: %w", err)
+		}
+		bmp := bmpPassword(password)
+		if algorithm.Algorithm.Equal(oidPBEWithSHA3DES) {
+			key := pkcs12KDF(sha1.New, 1, bmp, params.Salt, params.Iterations, 24)
+			iv = pkcs12KDF(sha1.New, 2, bmp, params.Salt, params.Iterations, 8)
+			var err error
+			if block, err = des.NewTripleDESCipher(key); err != nil {
+				return nil, err
+			}
+		} else {
+			key := pkcs12KDF(sha1.New, 1, bmp, params.Salt, params.Iterations, 5)
+			iv = pkcs12KDF(sha1.New, 2, bmp, params.Salt, params.Iterations, 8)
+			block = newRC2(key, 40)
+		}
+
+	case algorithm.Algorithm.Equal(oidPBES2):
+		var params pbes2Params
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("pkcs12: %w", err)
+		}
+		if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+			return nil, fmt.Errorf("pkcs12: unsupported key derivation %v", params.KeyDerivationFunc.Algorithm)
+		}
+		var kdf pbkdf2Params
+		if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+			return nil, fmt.Errorf("pkcs12: %w", err)
+		}
+		newHash := sha1.New
+		if len(kdf.PRF.Algorithm) > 0 {
+			var err error
+			if newHash, err = hashFor(kdf.PRF.Algorithm); err != nil {
+				return nil, err
+			}
+		}
+
+		var size int
+		scheme := params.EncryptionScheme.Algorithm
+		switch {
+		case scheme.Equal(oidAES128CBC):
+			size = 16
+		case scheme.Equal(oidAES192CBC), scheme.Equal(oidDESEDE3CBC):
+			size = 24
+		case scheme.Equal(oidAES256CBC):
+			size = 32
+		default:
+			return nil, fmt.Errorf("pkcs12: unsupported cipher %v", scheme)
+		}
+		if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, fmt.Errorf("pkcs12: %w", err)
+		}
+		key := pbkdf2(newHash, []byte(password), kdf.Salt, kdf.Iterations, size)
+		var err error
+		if scheme.Equal(oidDESEDE3CBC) {
+			block, err = des.NewTripleDESCipher(key)
+		} else {
+			block, err = aes.NewCipher(key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("pkcs12: unsupported encryption %v", algorithm.Algorithm)
+	}
+
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 || len(iv) != block.BlockSize() {
+		return nil, errors.New("pkcs12: malformed encrypted data")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// PKCS#7 padding, wrong when the password is
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.Equal(out[len(out)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrPassword
+	}
+	return out[:len(out)-padding], nil
+}
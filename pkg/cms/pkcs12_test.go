@@ -0,0 +1,104 @@
+package cms
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPKCS12KDF(t *testing.T) {
+	// The SHA-1 vectors of the Bouncy Castle PKCS12 tests
+	password := bmpPassword("smeg")
+	salt, _ := hex.DecodeString("0a58cf64530d823f")
+	for _, tc := range []struct {
+		id   byte
+		size int
+		want string
+	}{
+		{1, 24, "8aaae6297b6cb04642ab5b077851284eb7128f1a2a7fbca3"},
+		{2, 8, "79993dfe048d3b76"},
+	} {
+		if got := hex.EncodeToString(pkcs12KDF(sha1.New, tc.id, password, salt, 1, tc.size)); got != tc.want {
+			t.Errorf("pkcs12KDF(id %d) = %s, want %s", tc.id, got, tc.want)
+		}
+	}
+
+	salt, _ = hex.DecodeString("1682c0fc5b3f7ec5")
+	const want = "483dd6e919d7de2e8e648ba8f862f3fbfbdc2bcb2c02957f"
+	if got := hex.EncodeToString(pkcs12KDF(sha1.New, 1, bmpPassword("queeg"), salt, 1000, 24)); got != want {
+		t.Errorf("pkcs12KDF(1000 iterations) = %s, want %s", got, want)
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// The test vectors of RFC 6070
+	for _, tc := range []struct {
+		iterations int
+		want       string
+	}{
+		{1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{4096, "4b007901b765489abead49d926f721d065a429c1"},
+	} {
+		if got := hex.EncodeToString(pbkdf2(sha1.New, []byte("password"), []byte("salt"), tc.iterations, 20)); got != tc.want {
+			t.Errorf("pbkdf2(%d iterations) = %s, want %s", tc.iterations, got, tc.want)
+		}
+	}
+}
+
+func TestDecodePKCS12(t *testing.T) {
+	// signer.p12 is encrypted with the OpenSSL 3 defaults (PBES2, AES-256
+	// and a SHA-256 MAC), legacy.p12 with -legacy (RC2-40 certificates and
+	// a 3DES key)
+	for _, name := range []string{"signer.p12", "legacy.p12"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, certificates, err := DecodePKCS12(data, "secret")
+			if err != nil {
+				t.Fatalf("DecodePKCS12: %v", err)
+			}
+			if len(certificates) != 1 || certificates[0].Subject.CommonName != "Muster GmbH" {
+				t.Fatalf("certificates = %v, want the one of Muster GmbH", certificates)
+			}
+			if !publicKeyMatches(certificates[0], key) {
+				t.Errorf("the key does not match the certificate")
+			}
+
+			if _, _, err := DecodePKCS12(data, "wrong"); !errors.Is(err, ErrPassword) {
+				t.Errorf("wrong password: %v, want %v", err, ErrPassword)
+			}
+		})
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	content := []byte("%PDF-1.7 test")
+	for _, name := range []string{"signer.p12", "signer.pem"} {
+		t.Run(name, func(t *testing.T) {
+			signer, err := LoadSigner(filepath.Join("testdata", name), "", "secret")
+			if err != nil {
+				t.Fatalf("LoadSigner: %v", err)
+			}
+			signature, err := signer.SignDetached(content)
+			if err != nil {
+				t.Fatalf("SignDetached: %v", err)
+			}
+			v, err := VerifyDetached(signature, content)
+			if err != nil {
+				t.Fatalf("VerifyDetached: %v", err)
+			}
+			if !v.Signer.Equal(signer.Certificate) {
+				t.Errorf("signer = %s, want %s", v.Signer.Subject, signer.Certificate.Subject)
+			}
+			if _, err := VerifyDetached(signature, []byte("%PDF-1.7 altered")); err == nil {
+				t.Errorf("the signature verifies altered content")
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package cms
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestRC2(t *testing.T) {
+	// The test vectors of RFC 2268 section 5
+	for _, tc := range []struct {
+		key           string
+		effectiveBits int
+		plaintext     string
+		ciphertext    string
+	}{
+		{"0000000000000000", 63, "0000000000000000", "ebb773f993278eff"},
+		{"ffffffffffffffff", 64, "ffffffffffffffff", "278b27e42e2f0d49"},
+		{"3000000000000000", 64, "1000000000000001", "30649edf9be7d2c2"},
+		{"88", 64, "0000000000000000", "61a8a244adacccf0"},
+		{"88bca90e90875a", 64, "0000000000000000", "6ccf4308974c267f"},
+		{"88bca90e90875a7f0f79c384627bafb2", 64, "0000000000000000", "1a807d272bbe5db1"},
+		{"88bca90e90875a7f0f79c384627bafb2", 128, "0000000000000000", "2269552ab0f85ca6"},
+		{"88bca90e90875a7f0f79c384627bafb216f80a6f85920584c42fceb0be255daf1e", 129, "0000000000000000", "5b78d3a43dfff1f1"},
+	} {
+		key, _ := hex.DecodeString(tc.key)
+		ciphertext, _ := hex.DecodeString(tc.ciphertext)
+		got := make([]byte, 8)
+		newRC2(key, tc.effectiveBits).Decrypt(got, ciphertext)
+		if hex.EncodeToString(got) != tc.plaintext {
+			t.Errorf("key %s, %d bits: Decrypt(%s) = %x, want %s", tc.key, tc.effectiveBits, tc.ciphertext, got, tc.plaintext)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package einvoice
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/cii"
+	"github.com/louisinger/bill/pkg/xrechnung"
+)
+
+func ciiParty(p cii.TradeParty) (name, address, country, vatNumber string) {
+	name = p.Name
+	if p.Address != nil {
+		a := p.Address
+		address = joinAddress([]string{a.LineOne, a.LineTwo, a.LineThree}, a.Postcode, a.City)
+		country = a.CountryID
+	}
+	for _, registration := range p.TaxRegistrations {
+		if registration.ID.SchemeID == "VA" {
+			vatNumber = registration.ID.Value
+		}
+	}
+	return
+}
+
+// fromCII converts a Cross-Industry-Invoice, returning the bill and the
+// total the document states, VAT included.
+func fromCII(inv *cii.CrossIndustryInvoice) (bill.Bill, float64, error) {
+	date, err := inv.Document.IssueDateTime.Time()
+	if err != nil {
+		return bill.Bill{}, 0, fmt.Errorf("issue date: %w", err)
+	}
+
+	tx := inv.Transaction
+	b := bill.Bill{
+		Number:         inv.Document.ID,
+		Date:           date,
+		Currency:       tx.Settlement.Currency,
+		BuyerReference: tx.Agreement.BuyerReference,
+	}
+	if terms := tx.Settlement.PaymentTerms; terms != nil && terms.DueDate != nil {
+		if b.DueDate, err = terms.DueDate.Time(); err != nil {
+			return bill.Bill{}, 0, fmt.Errorf("due date: %w", err)
+		}
+	}
+
+	seller := tx.Agreement.Seller
+	b.CompanyName, b.Address, b.Country, b.VATNumber = ciiParty(seller)
+	if seller.URI != nil && seller.URI.URIID.SchemeID != xrechnung.SchemeEmail {
+		b.PeppolID = electronicAddress(seller.URI.URIID.SchemeID, seller.URI.URIID.Value)
+	}
+	if contact := seller.Contact; contact != nil {
+		b.ContactName = contact.PersonName
+		if contact.Telephone != nil {
+			b.ContactPhone = contact.Telephone.CompleteNumber
+		}
+		if contact.Email != nil {
+			b.ContactEmail = contact.Email.URIID.Value
+		}
+	}
+
+	buyer := tx.Agreement.Buyer
+	b.ToCompanyName, b.ToAddress, b.ToCountry, b.ToVATNumber = ciiParty(buyer)
+	if buyer.URI != nil && buyer.URI.URIID.SchemeID != xrechnung.SchemeLeitwegID {
+		b.ToPeppolID = electronicAddress(buyer.URI.URIID.SchemeID, buyer.URI.URIID.Value)
+	}
+	// XRechnung writes the Leitweg-ID as the buyer reference
+	if xrechnung.CheckLeitwegID(b.BuyerReference) == nil {
+		b.ToLeitwegID, b.BuyerReference = b.BuyerReference, ""
+	}
+
+	sign := 1.0
+	if inv.Document.TypeCode == cii.TypeCreditNote {
+		sign = -1
+		if ref := tx.Settlement.InvoiceReference; ref != nil {
+			b.CreditNoteFor = ref.IssuerAssignedID
+		}
+	}
+
+	for _, means := range tx.Settlement.PaymentMeans {
+		if address, ok := strings.CutPrefix(means.Information, "Bitcoin "); ok {
+			b.BitcoinAddress = address
+		}
+		if means.Account != nil && means.Account.IBAN != "" {
+			transfer := bill.BankTransfer{AccountHolder: means.Account.AccountName, IBAN: means.Account.IBAN}
+			if means.Institution != nil {
+				transfer.BIC = means.Institution.BIC
+			}
+			b.PaymentMethods = append(b.PaymentMethods, bankTransfer(transfer, b.CompanyName)...)
+		}
+	}
+
+	// Lines without VAT share the category of the bill
+	for _, tax := range tx.Settlement.Taxes {
+		if tax.CategoryCode != bill.VATStandard {
+			b.VATCategory = tax.CategoryCode
+			b.VATExemptionReason = tax.ExemptionReason
+			break
+		}
+	}
+
+	for i, line := range tx.Lines {
+		item := bill.BillItem{
+			Description: line.Product.Name,
+			Unit:        bill.UnitFromCode(line.Delivery.BilledQuantity.UnitCode),
+		}
+		if item.Quantity, err = parseNumber(line.Delivery.BilledQuantity.Value); err != nil {
+			return bill.Bill{}, 0, fmt.Errorf("line %d quantity: %w", i+1, err)
+		}
+		if item.VATRate, err = parseNumber(line.Settlement.Tax.RatePercent); err != nil {
+			return bill.Bill{}, 0, fmt.Errorf("line %d VAT rate: %w", i+1, err)
+		}
+		price, err := parseNumber(line.Agreement.NetPrice.ChargeAmount)
+		if err != nil {
+			return bill.Bill{}, 0, fmt.Errorf("line %d price: %w", i+1, err)
+		}
+		total, err := parseNumber(line.Settlement.Summation.LineTotalAmount)
+		if err != nil {
+			return bill.Bill{}, 0, fmt.Errorf("line %d amount: %w", i+1, err)
+		}
+		item.UnitPrice = sign * price
+		item.Total = sign * total
+		b.Items = append(b.Items, item)
+	}
+
+	total, err := parseNumber(tx.Settlement.Summation.GrandTotalAmount)
+	if err != nil {
+		return bill.Bill{}, 0, fmt.Errorf("grand total: %w", err)
+	}
+	return b, sign * total, nil
+}
@@ -0,0 +1,190 @@
+// Package einvoice reads structured invoices, UBL 2.1 invoices and credit
+// notes or UN/CEFACT Cross-Industry-Invoices, back into bills, and exports
+// bills to the formats of the ubl, xrechnung and fatturapa packages.
+package einvoice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/cii"
+	"github.com/louisinger/bill/pkg/ubl"
+)
+
+// prefixes maps the namespaces of both syntaxes to the prefixes used in
+// the tags of the ubl and cii models. UBL documents have no prefix.
+var prefixes = map[string]string{
+	ubl.NamespaceInvoice:    "",
+	ubl.NamespaceCreditNote: "",
+	ubl.NamespaceCAC:        "cac",
+	ubl.NamespaceCBC:        "cbc",
+	cii.NamespaceRSM:        "rsm",
+	cii.NamespaceRAM:        "ram",
+	cii.NamespaceQDT:        "qdt",
+	cii.NamespaceUDT:        "udt",
+}
+
+// prefixReader renames elements to the "prefix:Local" form of the model
+// tags, whatever prefixes the document itself declares. Elements of other
+// namespaces keep their local name and are ignored by the models.
+type prefixReader struct {
+	d *xml.Decoder
+}
+
+func (r prefixReader) rename(name xml.Name) xml.Name {
+	if prefix := prefixes[name.Space]; prefix != "" {
+		return xml.Name{Local: prefix + ":" + name.Local}
+	}
+	return xml.Name{Local: name.Local}
+}
+
+func (r prefixReader) Token() (xml.Token, error) {
+	tok, err := r.d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := xml.CopyToken(tok).(type) {
+	case xml.StartElement:
+		t.Name = r.rename(t.Name)
+		// Namespace declarations were resolved above
+		attrs := t.Attr[:0]
+		for _, attr := range t.Attr {
+			if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+				attrs = append(attrs, attr)
+			}
+		}
+		t.Attr = attrs
+		return t, nil
+	case xml.EndElement:
+		t.Name = r.rename(t.Name)
+		return t, nil
+	default:
+		return t, nil
+	}
+}
+
+func decode(data []byte, v interface{}) error {
+	d := xml.NewTokenDecoder(prefixReader{xml.NewDecoder(bytes.NewReader(data))})
+	return d.Decode(v)
+}
+
+// rootElement returns the name of the first element of the document.
+func rootElement(data []byte) (xml.Name, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return xml.Name{}, fmt.Errorf("no XML element found")
+		}
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// Parse reads a UBL invoice or credit note, or a Cross-Industry-Invoice,
+// into a bill. Credit notes get negative amounts, as the ones of
+// bill.NewCreditNote. Documents whose total differs from the one of their
+// lines, having allowances, charges or rounding the bill model does not
+// carry, are refused.
+func Parse(data []byte) (bill.Bill, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return bill.Bill{}, err
+	}
+
+	var b bill.Bill
+	var total float64
+	switch {
+	case root.Space == ubl.NamespaceInvoice && root.Local == "Invoice",
+		root.Space == ubl.NamespaceCreditNote && root.Local == "CreditNote":
+		var doc ubl.Document
+		if err := decode(data, &doc); err != nil {
+			return bill.Bill{}, fmt.Errorf("reading UBL: %w", err)
+		}
+		if b, total, err = fromUBL(&doc); err != nil {
+			return bill.Bill{}, err
+		}
+	case root.Space == cii.NamespaceRSM && root.Local == "CrossIndustryInvoice":
+		var inv cii.CrossIndustryInvoice
+		if err := decode(data, &inv); err != nil {
+			return bill.Bill{}, fmt.Errorf("reading CII: %w", err)
+		}
+		if b, total, err = fromCII(&inv); err != nil {
+			return bill.Bill{}, err
+		}
+	default:
+		return bill.Bill{}, fmt.Errorf("%s is neither a UBL invoice nor a Cross-Industry-Invoice", root.Local)
+	}
+
+	if len(b.Items) == 0 {
+		return bill.Bill{}, fmt.Errorf("invoice %s has no lines", b.Number)
+	}
+	b.UpdateTotal()
+	if math.Abs(b.Total-total) > 0.01 {
+		return bill.Bill{}, fmt.Errorf("invoice %s totals %.2f but its lines add up to %.2f", b.Number, total, b.Total)
+	}
+	return b, nil
+}
+
+// ParseFile reads a structured invoice from a file.
+func ParseFile(path string) (bill.Bill, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return bill.Bill{}, err
+	}
+	return Parse(data)
+}
+
+func parseNumber(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
+
+// joinAddress writes address lines, postcode and city the way
+// bill.ParseAddress reads them.
+func joinAddress(lines []string, postcode, city string) string {
+	var parts []string
+	for _, line := range lines {
+		if line != "" {
+			parts = append(parts, line)
+		}
+	}
+	if last := strings.TrimSpace(postcode + " " + city); last != "" {
+		parts = append(parts, last)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// electronicAddress writes a scheme and identifier as "scheme:identifier".
+func electronicAddress(scheme, id string) string {
+	if scheme == "" {
+		return id
+	}
+	return scheme + ":" + id
+}
+
+// bankTransfer returns the bank transfer of a payment means as payment
+// methods of a bill, the account held by the seller unless named, or none
+// when the account is not a valid IBAN.
+func bankTransfer(transfer bill.BankTransfer, seller string) bill.PaymentMethodList {
+	if transfer.AccountHolder == "" {
+		transfer.AccountHolder = seller
+	}
+	if transfer.Validate() != nil {
+		return nil
+	}
+	return bill.PaymentMethodList{transfer}
+}
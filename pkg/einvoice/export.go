@@ -0,0 +1,56 @@
+package einvoice
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/fatturapa"
+	"github.com/louisinger/bill/pkg/ubl"
+	"github.com/louisinger/bill/pkg/xrechnung"
+)
+
+// Formats lists the structured formats bills are exported to.
+var Formats = []string{"ubl", "fatturapa", "xrechnung"}
+
+// Export writes a bill as a structured e-invoice in one of Formats. The
+// document is returned with the business rules it breaks, if any, which
+// callers must not send it with.
+func Export(b bill.Bill, format string) ([]byte, []error, error) {
+	var data []byte
+	var violations []error
+	switch format {
+	case "ubl":
+		doc, err := ubl.FromBill(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, violation := range ubl.Check(doc) {
+			violations = append(violations, violation)
+		}
+		if data, err = doc.Marshal(); err != nil {
+			return nil, nil, err
+		}
+	case "fatturapa":
+		f, err := fatturapa.FromBill(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		violations = fatturapa.Validate(f)
+		if data, err = f.Marshal(); err != nil {
+			return nil, nil, err
+		}
+	case "xrechnung":
+		inv, err := xrechnung.FromBill(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		violations = xrechnung.Validate(inv)
+		if data, err = inv.Marshal(); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown format %q (expected %s)", format, strings.Join(Formats, ", "))
+	}
+	return data, violations, nil
+}
@@ -0,0 +1,101 @@
+package einvoice
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/ubl"
+)
+
+func ublParty(p ubl.Party) (name, address, country, vatNumber, endpoint string) {
+	name = p.LegalEntity.RegistrationName
+	if name == "" && p.PartyName != nil {
+		name = p.PartyName.Name
+	}
+	lines := []string{p.Address.StreetName, p.Address.AdditionalStreetName}
+	if p.Address.AddressLine != nil {
+		lines = append(lines, p.Address.AddressLine.Line)
+	}
+	address = joinAddress(lines, p.Address.PostalZone, p.Address.CityName)
+	country = p.Address.Country.IdentificationCode
+	if p.TaxScheme != nil && p.TaxScheme.TaxScheme.ID == "VAT" {
+		vatNumber = p.TaxScheme.CompanyID
+	}
+	if p.EndpointID != nil {
+		endpoint = electronicAddress(p.EndpointID.SchemeID, p.EndpointID.Value)
+	}
+	return
+}
+
+// fromUBL converts a UBL document, returning the bill and the total the
+// document states, VAT included.
+func fromUBL(d *ubl.Document) (bill.Bill, float64, error) {
+	date, err := time.Parse("2006-01-02", d.IssueDate)
+	if err != nil {
+		return bill.Bill{}, 0, fmt.Errorf("issue date: %w", err)
+	}
+
+	b := bill.Bill{
+		Number:         d.ID,
+		Date:           date,
+		Currency:       d.Currency,
+		BuyerReference: d.BuyerReference,
+	}
+	if d.DueDate != "" {
+		if b.DueDate, err = time.Parse("2006-01-02", d.DueDate); err != nil {
+			return bill.Bill{}, 0, fmt.Errorf("due date: %w", err)
+		}
+	}
+	b.CompanyName, b.Address, b.Country, b.VATNumber, b.PeppolID = ublParty(d.Supplier.Party)
+	b.ToCompanyName, b.ToAddress, b.ToCountry, b.ToVATNumber, b.ToPeppolID = ublParty(d.Customer.Party)
+
+	sign := 1.0
+	if d.IsCreditNote() {
+		sign = -1
+		if d.BillingReference != nil {
+			b.CreditNoteFor = d.BillingReference.InvoiceDocumentReference.ID
+		}
+	}
+
+	for _, means := range d.PaymentMeans {
+		switch {
+		case means.Account == nil:
+		case means.Account.Name == "Bitcoin":
+			b.BitcoinAddress = means.Account.ID
+		case means.Code == "58" || means.Code == "30":
+			transfer := bill.BankTransfer{AccountHolder: means.Account.Name, IBAN: means.Account.ID}
+			if means.Account.Branch != nil {
+				transfer.BIC = means.Account.Branch.ID
+			}
+			b.PaymentMethods = append(b.PaymentMethods, bankTransfer(transfer, b.CompanyName)...)
+		}
+	}
+
+	// Lines without VAT share the category of the bill
+	for _, subtotal := range d.TaxTotal.Subtotals {
+		if subtotal.Category.ID != bill.VATStandard {
+			b.VATCategory = subtotal.Category.ID
+			b.VATExemptionReason = subtotal.Category.ExemptionReason
+			break
+		}
+	}
+
+	for i, line := range d.Lines() {
+		item := bill.BillItem{Description: line.Item.Name}
+		if quantity := line.Quantity(); quantity != nil {
+			if item.Quantity, err = parseNumber(quantity.Value); err != nil {
+				return bill.Bill{}, 0, fmt.Errorf("line %d quantity: %w", i+1, err)
+			}
+			item.Unit = bill.UnitFromCode(quantity.UnitCode)
+		}
+		if item.VATRate, err = parseNumber(line.Item.TaxCategory.Percent); err != nil {
+			return bill.Bill{}, 0, fmt.Errorf("line %d VAT rate: %w", i+1, err)
+		}
+		item.UnitPrice = sign * line.Price.PriceAmount.Float()
+		item.Total = sign * line.LineExtensionAmount.Float()
+		b.Items = append(b.Items, item)
+	}
+
+	return b, sign * d.MonetaryTotal.TaxInclusiveAmount.Float(), nil
+}
@@ -0,0 +1,185 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/einvoice"
+)
+
+// Data is what the subject and body templates see: the fields of the bill,
+// such as {{.Number}}, {{.ToCompanyName}} or {{.Total}}, and the state of
+// the invoice.
+type Data struct {
+	bill.Bill
+
+	// Title is "Invoice" or "Credit note".
+	Title   string
+	Status  bill.Status
+	Paid    float64
+	Balance float64
+}
+
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	t, err := template.New("").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("email template: %w", err)
+	}
+	return t, nil
+}
+
+// Render fills a subject or body template, or the fallback one when
+// empty.
+func Render(text, fallback string, data Data) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		text = fallback
+	}
+	t, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("email template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// NewData returns the template data of an invoice.
+func NewData(inv *bill.Invoice) Data {
+	title := "Invoice"
+	if inv.Bill.CreditNoteFor != "" {
+		title = "Credit note"
+	}
+	return Data{
+		Bill:    inv.Bill,
+		Title:   title,
+		Status:  inv.Status,
+		Paid:    inv.Paid(),
+		Balance: inv.Balance(),
+	}
+}
+
+func parseAddresses(addresses []string) ([]*mail.Address, error) {
+	var list []*mail.Address
+	for _, address := range addresses {
+		if strings.TrimSpace(address) == "" {
+			continue
+		}
+		parsed, err := mail.ParseAddressList(address)
+		if err != nil {
+			return nil, fmt.Errorf("address %q: %w", address, err)
+		}
+		list = append(list, parsed...)
+	}
+	return list, nil
+}
+
+// ParseAddresses splits a comma separated list of addresses, checking
+// each of them.
+func ParseAddresses(s string) ([]string, error) {
+	list, err := parseAddresses([]string{s})
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(list))
+	for i, address := range list {
+		addresses[i] = address.String()
+	}
+	return addresses, nil
+}
+
+// Compose builds the message sending a stored invoice to its client: the
+// addresses of the client in the client list, the rendered subject and
+// body, the generated PDF and the e-invoice XML if one is to be attached.
+func Compose(config *Config, inv *bill.Invoice) (*Message, error) {
+	client, err := LookupClient(inv.Bill.ToCompanyName)
+	if err != nil {
+		return nil, err
+	}
+	return ComposeFor(config, inv, client)
+}
+
+// ComposeFor builds the message of Compose with the addresses and e-invoice
+// format of client, such as those of the client list edited for this
+// message.
+func ComposeFor(config *Config, inv *bill.Invoice, client bill.Client) (*Message, error) {
+	if inv.Path == "" {
+		return nil, fmt.Errorf("invoice %s has no generated file", inv.Bill.Number)
+	}
+	if len(client.Email) == 0 {
+		return nil, fmt.Errorf("no email address known for %s", inv.Bill.ToCompanyName)
+	}
+
+	if config.From == "" {
+		return nil, fmt.Errorf("no sender address configured")
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("sender address %q: %w", config.From, err)
+	}
+	m := &Message{From: from, Date: time.Now()}
+	if m.To, err = parseAddresses(client.Email); err != nil {
+		return nil, err
+	}
+	if m.CC, err = parseAddresses(client.CC); err != nil {
+		return nil, err
+	}
+
+	data := NewData(inv)
+	if m.Subject, err = Render(config.Subject, DefaultSubject, data); err != nil {
+		return nil, err
+	}
+	// Subjects are a single line
+	m.Subject = strings.Join(strings.Fields(m.Subject), " ")
+	if m.Body, err = Render(config.Body, DefaultBody, data); err != nil {
+		return nil, err
+	}
+
+	document, err := os.ReadFile(inv.Path)
+	if err != nil {
+		return nil, err
+	}
+	contentType := "application/pdf"
+	if bill.IsHTMLPath(inv.Path) {
+		contentType = "text/html; charset=utf-8"
+	}
+	m.Attachments = append(m.Attachments, Attachment{
+		Name:        filepath.Base(inv.Path),
+		ContentType: contentType,
+		Data:        document,
+	})
+
+	format := config.Attach
+	if client.Attach != "" {
+		format = client.Attach
+	}
+	if format != "" {
+		xml, violations, err := einvoice.Export(inv.Bill, format)
+		if err != nil {
+			return nil, fmt.Errorf("e-invoice: %w", err)
+		}
+		if len(violations) > 0 {
+			return nil, fmt.Errorf("the %s e-invoice fails its checks: %w", format, errors.Join(violations...))
+		}
+		m.Attachments = append(m.Attachments, Attachment{
+			Name:        strings.ReplaceAll(inv.Bill.Number, "/", "-") + ".xml",
+			ContentType: "application/xml",
+			Data:        xml,
+		})
+	}
+	return m, nil
+}
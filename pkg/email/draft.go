@@ -0,0 +1,24 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DraftPath returns where the draft of a generated invoice is written: next
+// to it, with the .eml extension.
+func DraftPath(document string) string {
+	return strings.TrimSuffix(document, filepath.Ext(document)) + ".eml"
+}
+
+// WriteDraft writes the message as an unsent .eml file, which any mail
+// client opens for review before sending.
+func WriteDraft(m *Message, path string) error {
+	m.Draft = true
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,239 @@
+// Package email sends invoices by email: it keeps the SMTP settings, fills the subject and body templates with the
+// invoice, and builds the MIME message carrying the PDF and, optionally,
+// the structured e-invoice.
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// Security is how the connection to the SMTP server is protected.
+type Security string
+
+const (
+	// StartTLS upgrades a plain connection, usually on port 587.
+	StartTLS Security = "starttls"
+	// TLS connects over TLS from the start, usually on port 465.
+	TLS Security = "tls"
+	// Insecure sends in clear, for local relays and test servers only.
+	Insecure Security = "none"
+)
+
+// Securities lists the connection security modes, the default first.
+func Securities() []Security {
+	return []Security{StartTLS, TLS, Insecure}
+}
+
+// ParseSecurity reads a connection security mode, an empty value meaning
+// STARTTLS.
+func ParseSecurity(s string) (Security, error) {
+	switch Security(strings.ToLower(strings.TrimSpace(s))) {
+	case "", StartTLS:
+		return StartTLS, nil
+	case TLS, "ssl":
+		return TLS, nil
+	case Insecure, "plain":
+		return Insecure, nil
+	}
+	return "", fmt.Errorf("unknown SMTP security %q (expected starttls, tls or none)", s)
+}
+
+// SMTP is the server invoices are sent through. The password is never
+// stored.
+type SMTP struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port,omitempty"`
+	Security Security `json:"security,omitempty"`
+	Username string   `json:"username,omitempty"`
+}
+
+// port returns the configured port, or the usual one of the security mode.
+func (s SMTP) port() int {
+	if s.Port != 0 {
+		return s.Port
+	}
+	switch s.Security {
+	case TLS:
+		return 465
+	case Insecure:
+		return 25
+	}
+	return 587
+}
+
+// legacyClient is the addresses of a client as kept in email.json before
+// they moved to the client list.
+type legacyClient struct {
+	Name   string   `json:"name"`
+	To     []string `json:"to"`
+	CC     []string `json:"cc,omitempty"`
+	Attach string   `json:"attach,omitempty"`
+}
+
+// Config is the email settings, kept in email.json of the config
+// directory. The addresses of each client are in the client list (see
+// bill.Client).
+type Config struct {
+	SMTP SMTP `json:"smtp"`
+
+	// From is the sender, e.g. "Muster GmbH <billing@muster.de>".
+	From string `json:"from"`
+
+	// Subject and Body are Go templates over the invoice (see Data), the
+	// defaults being used when empty.
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+
+	// Attach adds the invoice as a structured e-invoice in this format
+	// (see einvoice.Formats) next to the PDF.
+	Attach string `json:"attach,omitempty"`
+}
+
+// DefaultSubject and DefaultBody are the templates of a new configuration.
+const (
+	DefaultSubject = "{{.Title}} {{.Number}} from {{.CompanyName}}"
+	DefaultBody    = `Hello,
+
+Please find attached {{.Title | lower}} {{.Number}} of {{.Date.Format "January 2, 2006"}}, for a total of {{printf "%.2f" .Total}} {{.Currency}}.
+
+Best regards,
+{{.CompanyName}}
+`
+)
+
+// LookupClient returns the client of the client list an invoice is
+// addressed to, or a client with only the name when it is not in the list.
+func LookupClient(name string) (bill.Client, error) {
+	clients, err := bill.LoadClients()
+	if err != nil {
+		return bill.Client{}, err
+	}
+	if i := bill.FindClient(clients, name); i >= 0 {
+		return clients[i], nil
+	}
+	return bill.Client{Name: strings.TrimSpace(name)}, nil
+}
+
+// SaveClient records the addresses and e-invoice format of a client in the
+// client list, adding the client when it is not there yet.
+func SaveClient(client bill.Client) error {
+	clients, err := bill.LoadClients()
+	if err != nil {
+		return err
+	}
+	i := bill.FindClient(clients, client.Name)
+	if i < 0 {
+		return bill.SaveClients(append(clients, client))
+	}
+	clients[i].Email, clients[i].CC, clients[i].Attach = client.Email, client.CC, client.Attach
+	return bill.SaveClients(clients)
+}
+
+// Validate checks that invoices can be sent with the configuration.
+func (c *Config) Validate() error {
+	if c.SMTP.Host == "" {
+		return fmt.Errorf("no SMTP server configured")
+	}
+	if _, err := ParseSecurity(string(c.SMTP.Security)); err != nil {
+		return err
+	}
+	if c.From == "" {
+		return fmt.Errorf("no sender address configured")
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("sender address %q: %w", c.From, err)
+	}
+	for _, text := range []string{c.Subject, c.Body} {
+		if _, err := parseTemplate(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func configPath() (string, error) {
+	dir, err := bill.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "email.json"), nil
+}
+
+// LoadConfig reads the email settings, empty when none were saved. The
+// client addresses of older settings are moved to the client list.
+func LoadConfig() (*Config, error) {
+	config := &Config{}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	var legacy struct {
+		Clients []legacyClient `json:"clients"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	if len(legacy.Clients) > 0 {
+		if err := migrateClients(legacy.Clients); err != nil {
+			return nil, fmt.Errorf("moving the client addresses of email.json: %w", err)
+		}
+		if err := SaveConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// migrateClients copies the addresses of email.json to the client list,
+// keeping the ones already set there.
+func migrateClients(legacy []legacyClient) error {
+	clients, err := bill.LoadClients()
+	if err != nil {
+		return err
+	}
+	for _, old := range legacy {
+		i := bill.FindClient(clients, old.Name)
+		if i < 0 {
+			clients = append(clients, bill.Client{Name: strings.TrimSpace(old.Name)})
+			i = len(clients) - 1
+		}
+		if len(clients[i].Email) == 0 {
+			clients[i].Email, clients[i].CC = old.To, old.CC
+		}
+		if clients[i].Attach == "" {
+			clients[i].Attach = old.Attach
+		}
+	}
+	return bill.SaveClients(clients)
+}
+
+// SaveConfig writes the email settings to the config directory.
+func SaveConfig(config *Config) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,162 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is an email with a plain text body and attachments.
+type Message struct {
+	From    *mail.Address
+	To      []*mail.Address
+	CC      []*mail.Address
+	Subject string
+	Body    string
+	Date    time.Time
+
+	// Draft marks the message as unsent, so that mail clients open it for
+	// editing rather than as a received message.
+	Draft bool
+
+	Attachments []Attachment
+}
+
+// Recipients returns the addresses the message is delivered to.
+func (m *Message) Recipients() []string {
+	var recipients []string
+	for _, list := range [][]*mail.Address{m.To, m.CC} {
+		for _, address := range list {
+			recipients = append(recipients, address.Address)
+		}
+	}
+	return recipients
+}
+
+func joinAddresses(addresses []*mail.Address) string {
+	list := make([]string, len(addresses))
+	for i, address := range addresses {
+		list[i] = address.String()
+	}
+	return strings.Join(list, ", ")
+}
+
+// messageID returns a unique Message-ID in the domain of the sender.
+func messageID(from *mail.Address) string {
+	domain := "localhost"
+	if at := strings.LastIndexByte(from.Address, '@'); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	var random [12]byte
+	rand.Read(random[:])
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random[:]), domain)
+}
+
+// Bytes returns the message in the RFC 5322 format, as a multipart/mixed
+// MIME message when it has attachments.
+func (m *Message) Bytes() ([]byte, error) {
+	if m.From == nil || len(m.To) == 0 {
+		return nil, fmt.Errorf("a message needs a sender and a recipient")
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", m.From.String())
+	header("To", joinAddresses(m.To))
+	if len(m.CC) > 0 {
+		header("Cc", joinAddresses(m.CC))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageID(m.From))
+	header("MIME-Version", "1.0")
+	if m.Draft {
+		header("X-Unsent", "1")
+	}
+
+	body := func(w *bytes.Buffer) error {
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(strings.ReplaceAll(m.Body, "\n", "\r\n"))); err != nil {
+			return err
+		}
+		return qp.Close()
+	}
+
+	if len(m.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := body(&buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	w := multipart.NewWriter(&parts)
+	header("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": w.Boundary()}))
+	buf.WriteString("\r\nThis is a multipart message in MIME format.\r\n")
+
+	text, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var textBody bytes.Buffer
+	if err := body(&textBody); err != nil {
+		return nil, err
+	}
+	text.Write(textBody.Bytes())
+
+	for _, attachment := range m.Attachments {
+		mediaType, params, err := mime.ParseMediaType(attachment.ContentType)
+		if err != nil {
+			mediaType, params = "application/octet-stream", map[string]string{}
+		}
+		params["name"] = attachment.Name
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(mediaType, params)},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Base64 lines are kept under the 78 characters limit
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	buf.Write(parts.Bytes())
+	return buf.Bytes(), nil
+}
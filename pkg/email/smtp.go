@@ -0,0 +1,79 @@
+package email
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// dialTimeout bounds the connection to the SMTP server.
+const dialTimeout = 30 * time.Second
+
+// Send delivers a message through the SMTP server, authenticating when a
+// username is configured. Credentials are only sent over TLS, or to a
+// server on localhost.
+func Send(server SMTP, password string, m *Message) error {
+	security, err := ParseSecurity(string(server.Security))
+	if err != nil {
+		return err
+	}
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(server.Host, strconv.Itoa(server.port()))
+	tlsConfig := &tls.Config{ServerName: server.Host}
+	var conn net.Conn
+	if security == TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, server.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if security == StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", server.Host)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if server.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", server.Username, password, server.Host)); err != nil {
+			return fmt.Errorf("authentication: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.From.Address); err != nil {
+		return err
+	}
+	for _, recipient := range m.Recipients() {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("recipient %s: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
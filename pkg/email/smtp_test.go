@@ -0,0 +1,222 @@
+package email
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is what the stand-in SMTP server was given.
+type received struct {
+	auth       string
+	from       string
+	recipients []string
+	data       string
+}
+
+// smtpServer is a stand-in SMTP server on localhost accepting a single
+// session. It advertises the extensions given and refuses the recipients
+// of the rejected domain.
+func smtpServer(t *testing.T, extensions []string, rejected string) (SMTP, <-chan received) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan received, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		var session received
+		defer func() { sessions <- session }()
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				lines := append([]string{"localhost"}, extensions...)
+				for i, l := range lines {
+					if i == len(lines)-1 {
+						reply("250 " + l)
+					} else {
+						reply("250-" + l)
+					}
+				}
+			case "AUTH":
+				session.auth = strings.TrimPrefix(arg, "PLAIN ")
+				reply("235 2.7.0 Authentication successful")
+			case "MAIL":
+				session.from = arg
+				reply("250 OK")
+			case "RCPT":
+				if rejected != "" && strings.Contains(arg, "@"+rejected) {
+					reply("550 5.1.1 No such user")
+					continue
+				}
+				session.recipients = append(session.recipients, arg)
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(l, "."))
+				}
+				session.data = data.String()
+				reply("250 OK queued")
+			case "RSET", "NOOP":
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return SMTP{Host: "127.0.0.1", Port: p, Security: Insecure}, sessions
+}
+
+func testMessage(t *testing.T) *Message {
+	t.Helper()
+	parse := func(s string) *mail.Address {
+		address, err := mail.ParseAddress(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return address
+	}
+	return &Message{
+		From:    parse("Muster GmbH <billing@muster.de>"),
+		To:      []*mail.Address{parse("ACME <billing@acme.com>")},
+		CC:      []*mail.Address{parse("accounting@acme.com")},
+		Subject: "Rechnung INV-1 über 119,00 €",
+		Body:    "Hello,\nplease find attached invoice INV-1.\n",
+		Date:    time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		Attachments: []Attachment{
+			{Name: "INV-1.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4 test")},
+		},
+	}
+}
+
+func TestSend(t *testing.T) {
+	server, sessions := smtpServer(t, []string{"AUTH PLAIN"}, "")
+	server.Username = "billing"
+	if err := Send(server, "secret", testMessage(t)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	session := <-sessions
+
+	if auth, _ := base64.StdEncoding.DecodeString(session.auth); string(auth) != "\x00billing\x00secret" {
+		t.Errorf("AUTH PLAIN = %q, want the username and password", auth)
+	}
+	if session.from != "FROM:<billing@muster.de>" {
+		t.Errorf("MAIL %s", session.from)
+	}
+	if want := []string{"TO:<billing@acme.com>", "TO:<accounting@acme.com>"}; strings.Join(session.recipients, " ") != strings.Join(want, " ") {
+		t.Errorf("RCPT %v, want %v", session.recipients, want)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatalf("the message does not parse: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Rechnung INV-1 über 119,00 €" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if cc := msg.Header.Get("Cc"); cc != "<accounting@acme.com>" {
+		t.Errorf("Cc = %q", cc)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type %s, %v, want multipart/mixed", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var names []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(part)
+		if part.FileName() == "" {
+			if !strings.Contains(string(data), "please find attached invoice INV-1.") {
+				t.Errorf("body = %q", data)
+			}
+			continue
+		}
+		names = append(names, part.FileName())
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			data, _ = base64.StdEncoding.DecodeString(string(data))
+		}
+		if string(data) != "%PDF-1.4 test" {
+			t.Errorf("%s holds %q", part.FileName(), data)
+		}
+	}
+	if len(names) != 1 || names[0] != "INV-1.pdf" {
+		t.Errorf("attachments %v, want INV-1.pdf", names)
+	}
+}
+
+func TestSendWithoutAuth(t *testing.T) {
+	server, sessions := smtpServer(t, nil, "")
+	if err := Send(server, "", testMessage(t)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if session := <-sessions; session.auth != "" || len(session.recipients) != 2 {
+		t.Errorf("session = %+v, want no authentication and two recipients", session)
+	}
+}
+
+func TestSendRejectedRecipient(t *testing.T) {
+	server, _ := smtpServer(t, nil, "acme.com")
+	err := Send(server, "", testMessage(t))
+	if err == nil || !strings.Contains(err.Error(), "billing@acme.com") {
+		t.Errorf("Send error = %v, want the rejected recipient", err)
+	}
+}
+
+func TestSendRequiresStartTLS(t *testing.T) {
+	server, _ := smtpServer(t, []string{"AUTH PLAIN"}, "")
+	server.Security = StartTLS
+	server.Username = "billing"
+	err := Send(server, "secret", testMessage(t))
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Send error = %v, want STARTTLS to be required", err)
+	}
+}
@@ -0,0 +1,257 @@
+package fatturapa
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/cii"
+)
+
+const dateLayout = "2006-01-02"
+
+// Recipient codes used when the client has none: Italian clients reached
+// through their PEC or their reserved area, and foreign clients.
+const (
+	RecipientUnknown = "0000000"
+	RecipientForeign = "XXXXXXX"
+)
+
+// DefaultTaxRegime is the ordinary tax regime.
+const DefaultTaxRegime = "RF01"
+
+// natures maps the VAT categories of lines without VAT to the FatturaPA
+// nature codes (Natura).
+var natures = map[string]string{
+	bill.VATExempt:          "N4",
+	bill.VATReverseCharge:   "N6.9",
+	bill.VATNotSubject:      "N2.2",
+	bill.VATZeroRated:       "N3.6",
+	bill.VATIntraCommunity:  "N3.2",
+	bill.VATExportOutsideEU: "N3.1",
+}
+
+var (
+	vatPrefix = regexp.MustCompile(`^([A-Z]{2})(.+)$`)
+	province  = regexp.MustCompile(`^(.*?)\s*\(?\b([A-Z]{2})\)?$`)
+	alnum     = regexp.MustCompile(`[^A-Za-z0-9]`)
+)
+
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// formatQuantity writes between 2 and 8 decimals.
+func formatQuantity(quantity float64) string {
+	s := strconv.FormatFloat(quantity, 'f', -1, 64)
+	dot := strings.IndexByte(s, '.')
+	switch {
+	case dot < 0:
+		return s + ".00"
+	case len(s)-dot-1 == 1:
+		return s + "0"
+	case len(s)-dot-1 > 8:
+		return strconv.FormatFloat(quantity, 'f', 8, 64)
+	}
+	return s
+}
+
+// vatID splits a VAT number such as "IT01234567890" into its country and
+// code, using country when the number has no prefix.
+func vatID(vatNumber, country string) *IdFiscale {
+	vatNumber = strings.ToUpper(strings.ReplaceAll(vatNumber, " ", ""))
+	if vatNumber == "" {
+		return nil
+	}
+	if m := vatPrefix.FindStringSubmatch(vatNumber); m != nil {
+		return &IdFiscale{Country: m[1], Code: m[2]}
+	}
+	return &IdFiscale{Country: country, Code: vatNumber}
+}
+
+func sede(address, country string) Sede {
+	parsed := bill.ParseAddress(address)
+	s := Sede{
+		Street:   strings.Join(parsed.Lines, ", "),
+		Postcode: parsed.Postcode,
+		City:     parsed.City,
+		Country:  country,
+	}
+	if country == "IT" {
+		// "20121 Milano MI" or "20121 Milano (MI)"
+		if m := province.FindStringSubmatch(s.City); m != nil && m[1] != "" {
+			s.City, s.Province = m[1], m[2]
+		}
+	} else {
+		// Foreign postcodes do not fit the five digit CAP
+		s.Postcode = "00000"
+	}
+	return s
+}
+
+// FromBill converts a bill to a FatturaPA invoice: a TD04 credit note when
+// the bill cancels an invoice, with amounts written positive. The result
+// should go through Validate before being sent.
+func FromBill(b bill.Bill) (*FatturaElettronica, error) {
+	currency, err := bill.CurrencyCode(b.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	sign := 1.0
+	if b.CreditNoteFor != "" {
+		sign = -1
+	}
+	amount := func(v float64) string {
+		return formatAmount(math.Round(sign*v*100) / 100)
+	}
+
+	f := &FatturaElettronica{
+		XmlnsP:         Namespace,
+		XmlnsDS:        NamespaceDS,
+		XmlnsXSI:       NamespaceXSI,
+		SchemaLocation: SchemaLocation,
+	}
+
+	// Public administrations have six character codes (codice univoco ufficio)
+	f.Version = FormatPrivate
+	recipient := strings.ToUpper(b.ToRecipientCode)
+	if len(recipient) == 6 {
+		f.Version = FormatPA
+	}
+	if recipient == "" {
+		recipient = RecipientUnknown
+		if b.ToCountry != "IT" {
+			recipient = RecipientForeign
+		}
+	}
+
+	sellerVAT := vatID(b.VATNumber, b.Country)
+	transmitter := IdFiscale{Country: b.Country, Code: b.FiscalCode}
+	if sellerVAT != nil {
+		transmitter = *sellerVAT
+	}
+	progressive := alnum.ReplaceAllString(b.Number, "")
+	if len(progressive) > 10 {
+		progressive = progressive[len(progressive)-10:]
+	}
+
+	taxRegime := b.TaxRegime
+	if taxRegime == "" {
+		taxRegime = DefaultTaxRegime
+	}
+
+	f.Header = Header{
+		Transmission: DatiTrasmissione{
+			Transmitter:   transmitter,
+			Progressive:   progressive,
+			Format:        f.Version,
+			RecipientCode: recipient,
+			RecipientPEC:  b.ToPEC,
+		},
+		Seller: CedentePrestatore{
+			Registry: DatiAnagrafici{
+				VATID:      sellerVAT,
+				FiscalCode: b.FiscalCode,
+				Name:       Anagrafica{Denomination: b.CompanyName},
+				TaxRegime:  taxRegime,
+			},
+			Address: sede(b.Address, b.Country),
+		},
+		Buyer: CessionarioCommittente{
+			Registry: DatiAnagrafici{
+				VATID:      vatID(b.ToVATNumber, b.ToCountry),
+				FiscalCode: b.ToFiscalCode,
+				Name:       Anagrafica{Denomination: b.ToCompanyName},
+			},
+			Address: sede(b.ToAddress, b.ToCountry),
+		},
+	}
+
+	document := DatiGeneraliDocumento{
+		Type:     TypeInvoice,
+		Currency: currency,
+		Date:     b.Date.Format(dateLayout),
+		Number:   b.Number,
+		Total:    amount(b.Total),
+	}
+	if b.CreditNoteFor != "" {
+		document.Type = TypeCreditNote
+		f.Body.General.LinkedInvoices = []DatiDocumento{{ID: b.CreditNoteFor}}
+	}
+	// FatturaPA has no payment method for cryptocurrencies, the address
+	// goes in the description of the document
+	if b.BitcoinAddress != "" {
+		document.Reasons = []string{"Pagamento in Bitcoin all'indirizzo " + b.BitcoinAddress}
+	}
+	f.Body.General.Document = document
+
+	for i, item := range b.Items {
+		line := DettaglioLinee{
+			Number:      i + 1,
+			Description: item.Description,
+			Quantity:    formatQuantity(item.Quantity),
+			Unit:        item.Unit.Symbol(),
+			UnitPrice:   cii.FormatPrice(math.Abs(item.UnitPrice)),
+			TotalPrice:  amount(item.Total),
+			VATRate:     formatAmount(item.VATRate),
+		}
+		if item.VATRate == 0 {
+			line.Nature = natures[b.VATCategoryFor(0)]
+		}
+		f.Body.Goods.Lines = append(f.Body.Goods.Lines, line)
+	}
+
+	for _, subtotal := range b.TaxBreakdown() {
+		summary := DatiRiepilogo{
+			VATRate: formatAmount(subtotal.Rate),
+			Taxable: amount(subtotal.Base),
+			Tax:     amount(subtotal.Amount),
+		}
+		if subtotal.Rate == 0 {
+			summary.Nature = natures[subtotal.Category]
+			summary.LegalNotice = subtotal.ExemptionReason
+		} else {
+			// VAT due immediately
+			summary.Chargeable = "I"
+		}
+		f.Body.Goods.Summary = append(f.Body.Goods.Summary, summary)
+	}
+
+	// Credit notes are not paid
+	if b.CreditNoteFor == "" {
+		f.Body.Payment = payment(b)
+	}
+
+	return f, nil
+}
+
+// payment returns the payment of a bill in full by bank transfer to its
+// account or else by card through its payment link. Other methods, such as
+// Bitcoin, have no payment mode.
+func payment(b bill.Bill) *DatiPagamento {
+	detail := DettaglioPagamento{Amount: formatAmount(b.Total)}
+	if transfer, ok := b.BankTransfer(); ok {
+		detail.Mode = PaymentBankTransfer
+		detail.Institute = transfer.BankName
+		detail.IBAN = bill.NormalizeIBAN(transfer.IBAN)
+		detail.BIC = strings.ToUpper(strings.TrimSpace(transfer.BIC))
+	} else {
+		for _, method := range b.PaymentMethods {
+			if _, ok := method.(bill.PaymentLink); ok {
+				detail.Mode = PaymentCard
+				break
+			}
+		}
+	}
+	if detail.Mode == "" {
+		return nil
+	}
+	if !b.DueDate.IsZero() {
+		detail.DueDate = b.DueDate.Format(dateLayout)
+	}
+	return &DatiPagamento{Terms: PaymentInFull, Details: []DettaglioPagamento{detail}}
+}
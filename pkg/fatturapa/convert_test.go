@@ -0,0 +1,78 @@
+package fatturapa
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+func testBill(items ...bill.TemplateItem) bill.Bill {
+	template := bill.BillTemplate{
+		CompanyName:     "Rossi S.r.l.",
+		Address:         "Via Roma 1\n20121 Milano MI",
+		VATNumber:       "IT01234567890",
+		Country:         "IT",
+		FiscalCode:      "01234567890",
+		ToCompanyName:   "Bianchi S.p.A.",
+		ToAddress:       "Corso Italia 2\n00184 Roma RM",
+		ToVATNumber:     "IT09876543210",
+		ToCountry:       "IT",
+		ToRecipientCode: "ABC1234",
+		Currency:        "EUR",
+		Items:           items,
+	}
+	return bill.NewBillFromTemplate(template, "2024/1", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func TestFromBillUnitPrice(t *testing.T) {
+	b := testBill(bill.TemplateItem{Description: "Consulenza", Quantity: 3, UnitPrice: 33.333, VATRate: 22})
+	f, err := FromBill(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := f.Body.Goods.Lines[0]
+	if line.Quantity != "3.00" || line.UnitPrice != "33.333" || line.TotalPrice != "100.00" {
+		t.Errorf("line = %s × %s = %s, want 3.00 × 33.333 = 100.00", line.Quantity, line.UnitPrice, line.TotalPrice)
+	}
+	for _, err := range Validate(f) {
+		t.Errorf("Validate: %v", err)
+	}
+
+	// The price rounded to cents no longer makes the total
+	f.Body.Goods.Lines[0].UnitPrice = "33.33"
+	errs := Validate(f)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "PrezzoTotale") {
+		t.Errorf("Validate = %v, want PrezzoTotale to be reported", errs)
+	}
+}
+
+func TestValidateLineTotal(t *testing.T) {
+	for _, tc := range []struct {
+		quantity, price, total string
+		valid                  bool
+	}{
+		{"1.50", "33.33", "50.00", true},
+		{"", "120.00", "120.00", true},
+		{"2.00", "0.33333333", "0.67", true},
+		{"3.00", "33.33", "100.00", false},
+		{"", "120.00", "100.00", false},
+	} {
+		f, err := FromBill(testBill(bill.TemplateItem{Description: "Consulenza", Quantity: 1, UnitPrice: 1, VATRate: 22}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := &f.Body.Goods.Lines[0]
+		line.Quantity, line.UnitPrice, line.TotalPrice = tc.quantity, tc.price, tc.total
+		var lineErrs []error
+		for _, err := range Validate(f) {
+			if strings.Contains(err.Error(), "PrezzoTotale") {
+				lineErrs = append(lineErrs, err)
+			}
+		}
+		if (len(lineErrs) == 0) != tc.valid {
+			t.Errorf("%s × %s = %s: %v, want valid %v", tc.quantity, tc.price, tc.total, lineErrs, tc.valid)
+		}
+	}
+}
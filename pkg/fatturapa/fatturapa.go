@@ -0,0 +1,169 @@
+// Package fatturapa writes bills as Italian FatturaPA 1.2 electronic
+// invoices, the format of the Sistema di Interscambio (SdI).
+//
+// Elements are declared in schema order, which the syntax requires.
+package fatturapa
+
+import (
+	"encoding/xml"
+)
+
+const (
+	Namespace      = "http://ivaservizi.agenziaentrate.gov.it/docs/xsd/fatture/v1.2"
+	NamespaceDS    = "http://www.w3.org/2000/09/xmldsig#"
+	NamespaceXSI   = "http://www.w3.org/2001/XMLSchema-instance"
+	SchemaLocation = Namespace + " http://www.fatturapa.gov.it/export/fatturazione/sdi/fatturapa/v1.2/Schema_del_file_xml_FatturaPA_versione_1.2.xsd"
+)
+
+// Transmission formats: invoices to public administrations and to
+// private parties.
+const (
+	FormatPA      = "FPA12"
+	FormatPrivate = "FPR12"
+)
+
+// Document types.
+const (
+	TypeInvoice    = "TD01"
+	TypeCreditNote = "TD04"
+)
+
+// Payment terms (CondizioniPagamento) and modes (ModalitaPagamento).
+const (
+	PaymentInFull       = "TP02"
+	PaymentCard         = "MP08"
+	PaymentBankTransfer = "MP05"
+)
+
+type FatturaElettronica struct {
+	XMLName        xml.Name `xml:"p:FatturaElettronica"`
+	Version        string   `xml:"versione,attr"`
+	XmlnsP         string   `xml:"xmlns:p,attr"`
+	XmlnsDS        string   `xml:"xmlns:ds,attr"`
+	XmlnsXSI       string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+
+	Header Header `xml:"FatturaElettronicaHeader"`
+	Body   Body   `xml:"FatturaElettronicaBody"`
+}
+
+// Marshal serializes the invoice with an XML declaration.
+func (f *FatturaElettronica) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+type Header struct {
+	Transmission DatiTrasmissione       `xml:"DatiTrasmissione"`
+	Seller       CedentePrestatore      `xml:"CedentePrestatore"`
+	Buyer        CessionarioCommittente `xml:"CessionarioCommittente"`
+}
+
+type DatiTrasmissione struct {
+	Transmitter   IdFiscale `xml:"IdTrasmittente"`
+	Progressive   string    `xml:"ProgressivoInvio"`
+	Format        string    `xml:"FormatoTrasmissione"`
+	RecipientCode string    `xml:"CodiceDestinatario"`
+	RecipientPEC  string    `xml:"PECDestinatario,omitempty"`
+}
+
+type IdFiscale struct {
+	Country string `xml:"IdPaese"`
+	Code    string `xml:"IdCodice"`
+}
+
+type CedentePrestatore struct {
+	Registry DatiAnagrafici `xml:"DatiAnagrafici"`
+	Address  Sede           `xml:"Sede"`
+}
+
+type CessionarioCommittente struct {
+	Registry DatiAnagrafici `xml:"DatiAnagrafici"`
+	Address  Sede           `xml:"Sede"`
+}
+
+type DatiAnagrafici struct {
+	VATID      *IdFiscale `xml:"IdFiscaleIVA,omitempty"`
+	FiscalCode string     `xml:"CodiceFiscale,omitempty"`
+	Name       Anagrafica `xml:"Anagrafica"`
+	TaxRegime  string     `xml:"RegimeFiscale,omitempty"`
+}
+
+type Anagrafica struct {
+	Denomination string `xml:"Denominazione"`
+}
+
+type Sede struct {
+	Street   string `xml:"Indirizzo"`
+	Postcode string `xml:"CAP"`
+	City     string `xml:"Comune"`
+	Province string `xml:"Provincia,omitempty"`
+	Country  string `xml:"Nazione"`
+}
+
+type Body struct {
+	General DatiGenerali    `xml:"DatiGenerali"`
+	Goods   DatiBeniServizi `xml:"DatiBeniServizi"`
+	Payment *DatiPagamento  `xml:"DatiPagamento,omitempty"`
+}
+
+type DatiGenerali struct {
+	Document       DatiGeneraliDocumento `xml:"DatiGeneraliDocumento"`
+	LinkedInvoices []DatiDocumento       `xml:"DatiFattureCollegate,omitempty"`
+}
+
+type DatiGeneraliDocumento struct {
+	Type     string   `xml:"TipoDocumento"`
+	Currency string   `xml:"Divisa"`
+	Date     string   `xml:"Data"`
+	Number   string   `xml:"Numero"`
+	Total    string   `xml:"ImportoTotaleDocumento,omitempty"`
+	Reasons  []string `xml:"Causale,omitempty"`
+}
+
+type DatiDocumento struct {
+	ID   string `xml:"IdDocumento"`
+	Date string `xml:"Data,omitempty"`
+}
+
+type DatiBeniServizi struct {
+	Lines   []DettaglioLinee `xml:"DettaglioLinee"`
+	Summary []DatiRiepilogo  `xml:"DatiRiepilogo"`
+}
+
+type DettaglioLinee struct {
+	Number      int    `xml:"NumeroLinea"`
+	Description string `xml:"Descrizione"`
+	Quantity    string `xml:"Quantita,omitempty"`
+	Unit        string `xml:"UnitaMisura,omitempty"`
+	UnitPrice   string `xml:"PrezzoUnitario"`
+	TotalPrice  string `xml:"PrezzoTotale"`
+	VATRate     string `xml:"AliquotaIVA"`
+	Nature      string `xml:"Natura,omitempty"`
+}
+
+type DatiRiepilogo struct {
+	VATRate     string `xml:"AliquotaIVA"`
+	Nature      string `xml:"Natura,omitempty"`
+	Taxable     string `xml:"ImponibileImporto"`
+	Tax         string `xml:"Imposta"`
+	Chargeable  string `xml:"EsigibilitaIVA,omitempty"`
+	LegalNotice string `xml:"RiferimentoNormativo,omitempty"`
+}
+
+type DatiPagamento struct {
+	Terms   string               `xml:"CondizioniPagamento"`
+	Details []DettaglioPagamento `xml:"DettaglioPagamento"`
+}
+
+type DettaglioPagamento struct {
+	Mode      string `xml:"ModalitaPagamento"`
+	DueDate   string `xml:"DataScadenzaPagamento,omitempty"`
+	Amount    string `xml:"ImportoPagamento"`
+	Institute string `xml:"IstitutoFinanziario,omitempty"`
+	IBAN      string `xml:"IBAN,omitempty"`
+	BIC       string `xml:"BIC,omitempty"`
+}
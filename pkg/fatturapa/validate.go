@@ -0,0 +1,281 @@
+package fatturapa
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// FieldError is a value breaking a constraint of the FatturaPA 1.2 schema
+// or of the controls of the exchange system.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Patterns of the simple types of the schema.
+var (
+	countryPattern     = regexp.MustCompile(`^[A-Z]{2}$`)
+	currencyPattern    = regexp.MustCompile(`^[A-Z]{3}$`)
+	progressivePattern = regexp.MustCompile(`^[A-Za-z0-9]{1,10}$`)
+	recipientPattern   = regexp.MustCompile(`^[A-Z0-9]{6,7}$`)
+	fiscalCodePattern  = regexp.MustCompile(`^[A-Z0-9]{11,16}$`)
+	postcodePattern    = regexp.MustCompile(`^[0-9]{5}$`)
+	datePattern        = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	digitPattern       = regexp.MustCompile(`[0-9]`)
+	amountPattern      = regexp.MustCompile(`^-?[0-9]{1,11}\.[0-9]{2}$`)
+	pricePattern       = regexp.MustCompile(`^-?[0-9]{1,11}\.[0-9]{2,8}$`)
+	quantityPattern    = regexp.MustCompile(`^[0-9]{1,12}\.[0-9]{2,8}$`)
+	ratePattern        = regexp.MustCompile(`^[0-9]{1,3}\.[0-9]{2}$`)
+	pecPattern         = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	taxRegimePattern   = regexp.MustCompile(`^RF(0[1-9]|1[0-9])$`)
+)
+
+var (
+	documentTypes = map[string]bool{
+		"TD01": true, "TD02": true, "TD03": true, "TD04": true, "TD05": true, "TD06": true,
+		"TD16": true, "TD17": true, "TD18": true, "TD19": true, "TD20": true, "TD21": true,
+		"TD22": true, "TD23": true, "TD24": true, "TD25": true, "TD26": true, "TD27": true,
+	}
+	natureCodes = map[string]bool{
+		"N1": true, "N2.1": true, "N2.2": true, "N3.1": true, "N3.2": true, "N3.3": true,
+		"N3.4": true, "N3.5": true, "N3.6": true, "N4": true, "N5": true, "N6.1": true,
+		"N6.2": true, "N6.3": true, "N6.4": true, "N6.5": true, "N6.6": true, "N6.7": true,
+		"N6.8": true, "N6.9": true, "N7": true,
+	}
+	paymentTerms = map[string]bool{"TP01": true, "TP02": true, "TP03": true}
+	paymentModes = map[string]bool{
+		"MP01": true, "MP02": true, "MP03": true, "MP04": true, "MP05": true, "MP06": true,
+		"MP07": true, "MP08": true, "MP09": true, "MP10": true, "MP11": true, "MP12": true,
+		"MP13": true, "MP14": true, "MP15": true, "MP16": true, "MP17": true, "MP18": true,
+		"MP19": true, "MP20": true, "MP21": true, "MP22": true, "MP23": true,
+	}
+)
+
+// Validate checks the invoice against the structure of the FatturaPA 1.2
+// schema (mandatory elements, lengths, patterns and code lists) and the
+// VAT nature controls of the exchange system, without network access.
+func Validate(f *FatturaElettronica) []error {
+	var errs []error
+	fail := func(path, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	match := func(path, value string, pattern *regexp.Regexp, expected string) {
+		if !pattern.MatchString(value) {
+			fail(path, "%q is not %s", value, expected)
+		}
+	}
+	// text checks the length of a Latin-1 string (String80LatinType and
+	// similar).
+	text := func(path, value string, max int) {
+		if value == "" {
+			fail(path, "is required")
+			return
+		}
+		if utf8.RuneCountInString(value) > max {
+			fail(path, "is longer than %d characters", max)
+		}
+		for _, r := range value {
+			if r > 0xFF {
+				fail(path, "contains %q, only Latin-1 characters are allowed", r)
+				break
+			}
+		}
+	}
+	idFiscale := func(path string, id IdFiscale) {
+		match(path+"/IdPaese", id.Country, countryPattern, "a country code")
+		if id.Code == "" || len(id.Code) > 28 {
+			fail(path+"/IdCodice", "must have 1 to 28 characters")
+		}
+	}
+	sede := func(path string, s Sede) {
+		text(path+"/Indirizzo", s.Street, 60)
+		match(path+"/CAP", s.Postcode, postcodePattern, "a five digit postcode")
+		text(path+"/Comune", s.City, 60)
+		if s.Province != "" {
+			match(path+"/Provincia", s.Province, countryPattern, "a province code")
+		}
+		match(path+"/Nazione", s.Country, countryPattern, "a country code")
+	}
+
+	if f.Version != FormatPA && f.Version != FormatPrivate {
+		fail("FatturaElettronica/@versione", "%q is not FPA12 or FPR12", f.Version)
+	}
+
+	const header = "FatturaElettronicaHeader"
+	tx := f.Header.Transmission
+	idFiscale(header+"/DatiTrasmissione/IdTrasmittente", tx.Transmitter)
+	match(header+"/DatiTrasmissione/ProgressivoInvio", tx.Progressive, progressivePattern, "1 to 10 letters or digits")
+	if tx.Format != f.Version {
+		fail(header+"/DatiTrasmissione/FormatoTrasmissione", "%q does not match the version %q", tx.Format, f.Version)
+	}
+	match(header+"/DatiTrasmissione/CodiceDestinatario", tx.RecipientCode, recipientPattern, "a 6 or 7 character recipient code")
+	if f.Version == FormatPA && len(tx.RecipientCode) != 6 {
+		fail(header+"/DatiTrasmissione/CodiceDestinatario", "public administrations have 6 character codes")
+	}
+	if f.Version == FormatPrivate && len(tx.RecipientCode) != 7 {
+		fail(header+"/DatiTrasmissione/CodiceDestinatario", "private parties have 7 character codes")
+	}
+	if tx.RecipientPEC != "" {
+		match(header+"/DatiTrasmissione/PECDestinatario", tx.RecipientPEC, pecPattern, "an email address")
+		if tx.RecipientCode != RecipientUnknown {
+			fail(header+"/DatiTrasmissione/PECDestinatario", "only allowed with recipient code %s", RecipientUnknown)
+		}
+	}
+
+	seller := f.Header.Seller.Registry
+	if seller.VATID == nil {
+		fail(header+"/CedentePrestatore/DatiAnagrafici/IdFiscaleIVA", "the seller VAT number is required")
+	} else {
+		idFiscale(header+"/CedentePrestatore/DatiAnagrafici/IdFiscaleIVA", *seller.VATID)
+	}
+	if seller.FiscalCode != "" {
+		match(header+"/CedentePrestatore/DatiAnagrafici/CodiceFiscale", seller.FiscalCode, fiscalCodePattern, "a codice fiscale")
+	}
+	text(header+"/CedentePrestatore/DatiAnagrafici/Anagrafica/Denominazione", seller.Name.Denomination, 80)
+	match(header+"/CedentePrestatore/DatiAnagrafici/RegimeFiscale", seller.TaxRegime, taxRegimePattern, "a tax regime (RF01 to RF19)")
+	sede(header+"/CedentePrestatore/Sede", f.Header.Seller.Address)
+
+	buyer := f.Header.Buyer.Registry
+	if buyer.VATID == nil && buyer.FiscalCode == "" {
+		fail(header+"/CessionarioCommittente/DatiAnagrafici", "the client needs a VAT number (partita IVA) or a codice fiscale")
+	}
+	if buyer.VATID != nil {
+		idFiscale(header+"/CessionarioCommittente/DatiAnagrafici/IdFiscaleIVA", *buyer.VATID)
+	}
+	if buyer.FiscalCode != "" {
+		match(header+"/CessionarioCommittente/DatiAnagrafici/CodiceFiscale", buyer.FiscalCode, fiscalCodePattern, "a codice fiscale")
+	}
+	text(header+"/CessionarioCommittente/DatiAnagrafici/Anagrafica/Denominazione", buyer.Name.Denomination, 80)
+	sede(header+"/CessionarioCommittente/Sede", f.Header.Buyer.Address)
+
+	const general = "FatturaElettronicaBody/DatiGenerali/DatiGeneraliDocumento"
+	document := f.Body.General.Document
+	if !documentTypes[document.Type] {
+		fail(general+"/TipoDocumento", "%q is not a document type", document.Type)
+	}
+	match(general+"/Divisa", document.Currency, currencyPattern, "a currency code")
+	match(general+"/Data", document.Date, datePattern, "a YYYY-MM-DD date")
+	if document.Number == "" || len(document.Number) > 20 {
+		fail(general+"/Numero", "must have 1 to 20 characters")
+	} else if !digitPattern.MatchString(document.Number) {
+		fail(general+"/Numero", "must contain at least one digit")
+	}
+	if document.Total != "" {
+		match(general+"/ImportoTotaleDocumento", document.Total, amountPattern, "an amount with two decimals")
+	}
+	for _, reason := range document.Reasons {
+		text(general+"/Causale", reason, 200)
+	}
+	if document.Type == TypeCreditNote && len(f.Body.General.LinkedInvoices) == 0 {
+		fail("FatturaElettronicaBody/DatiGenerali/DatiFattureCollegate", "a credit note must reference the invoice it cancels")
+	}
+
+	const goods = "FatturaElettronicaBody/DatiBeniServizi"
+	if len(f.Body.Goods.Lines) == 0 {
+		fail(goods+"/DettaglioLinee", "at least one line is required")
+	}
+	for i, line := range f.Body.Goods.Lines {
+		path := fmt.Sprintf("%s/DettaglioLinee[%d]", goods, i+1)
+		text(path+"/Descrizione", line.Description, 1000)
+		if line.Quantity != "" {
+			match(path+"/Quantita", line.Quantity, quantityPattern, "a quantity with 2 to 8 decimals")
+		}
+		if len(line.Unit) > 10 {
+			fail(path+"/UnitaMisura", "is longer than 10 characters")
+		}
+		match(path+"/PrezzoUnitario", line.UnitPrice, pricePattern, "a price with 2 to 8 decimals")
+		match(path+"/PrezzoTotale", line.TotalPrice, pricePattern, "a price with 2 to 8 decimals")
+		// Error 00423 of the exchange system: the total is the quantity
+		// (1 when absent) times the unit price, less than a cent apart
+		quantity := 1.0
+		if line.Quantity != "" {
+			quantity, _ = strconv.ParseFloat(line.Quantity, 64)
+		}
+		price, priceErr := strconv.ParseFloat(line.UnitPrice, 64)
+		total, totalErr := strconv.ParseFloat(line.TotalPrice, 64)
+		if priceErr == nil && totalErr == nil && math.Abs(quantity*price-total) > 0.01-1e-9 {
+			fail(path+"/PrezzoTotale", "%s is not Quantita × PrezzoUnitario (%.2f)", line.TotalPrice, quantity*price)
+		}
+		natureRules(fail, path, line.VATRate, line.Nature)
+	}
+	if len(f.Body.Goods.Summary) == 0 {
+		fail(goods+"/DatiRiepilogo", "at least one VAT summary is required")
+	}
+	for i, summary := range f.Body.Goods.Summary {
+		path := fmt.Sprintf("%s/DatiRiepilogo[%d]", goods, i+1)
+		natureRules(fail, path, summary.VATRate, summary.Nature)
+		match(path+"/ImponibileImporto", summary.Taxable, amountPattern, "an amount with two decimals")
+		match(path+"/Imposta", summary.Tax, amountPattern, "an amount with two decimals")
+		if summary.Chargeable != "" && summary.Chargeable != "I" && summary.Chargeable != "D" && summary.Chargeable != "S" {
+			fail(path+"/EsigibilitaIVA", "%q is not I, D or S", summary.Chargeable)
+		}
+		if len(summary.LegalNotice) > 100 {
+			fail(path+"/RiferimentoNormativo", "is longer than 100 characters")
+		}
+	}
+
+	if p := f.Body.Payment; p != nil {
+		const payment = "FatturaElettronicaBody/DatiPagamento"
+		if !paymentTerms[p.Terms] {
+			fail(payment+"/CondizioniPagamento", "%q is not TP01, TP02 or TP03", p.Terms)
+		}
+		if len(p.Details) == 0 {
+			fail(payment+"/DettaglioPagamento", "at least one payment is required")
+		}
+		for i, detail := range p.Details {
+			path := fmt.Sprintf("%s/DettaglioPagamento[%d]", payment, i+1)
+			if !paymentModes[detail.Mode] {
+				fail(path+"/ModalitaPagamento", "%q is not a payment mode (MP01 to MP23)", detail.Mode)
+			}
+			if detail.DueDate != "" {
+				match(path+"/DataScadenzaPagamento", detail.DueDate, datePattern, "a YYYY-MM-DD date")
+			}
+			match(path+"/ImportoPagamento", detail.Amount, amountPattern, "an amount with two decimals")
+			if detail.Institute != "" {
+				text(path+"/IstitutoFinanziario", detail.Institute, 80)
+			}
+			switch {
+			case detail.IBAN != "":
+				if err := bill.ValidateIBAN(detail.IBAN); err != nil {
+					fail(path+"/IBAN", "%v", err)
+				}
+			case detail.Mode == PaymentBankTransfer:
+				fail(path+"/IBAN", "is required to pay by bank transfer")
+			}
+			if detail.BIC != "" {
+				if err := bill.ValidateBIC(detail.BIC); err != nil {
+					fail(path+"/BIC", "%v", err)
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+// natureRules checks the VAT rate and the nature code: lines without VAT
+// need a nature (exchange system controls 00400 and 00401).
+func natureRules(fail func(path, format string, args ...interface{}), path, rate, nature string) {
+	if !ratePattern.MatchString(rate) {
+		fail(path+"/AliquotaIVA", "%q is not a rate with two decimals", rate)
+		return
+	}
+	value, _ := strconv.ParseFloat(rate, 64)
+	switch {
+	case value == 0 && nature == "":
+		fail(path+"/Natura", "is required when the VAT rate is zero")
+	case value != 0 && nature != "":
+		fail(path+"/Natura", "is only allowed when the VAT rate is zero")
+	case nature != "" && !natureCodes[nature]:
+		fail(path+"/Natura", "%q is not a nature code", nature)
+	}
+}
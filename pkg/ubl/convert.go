@@ -0,0 +1,193 @@
+package ubl
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/cii"
+)
+
+// Document type codes (UNTDID 1001).
+const (
+	TypeInvoice    = "380"
+	TypeCreditNote = "381"
+)
+
+const dateLayout = "2006-01-02"
+
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func formatPercent(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
+
+// endpoint parses an electronic address written as "scheme:identifier".
+func endpoint(id string) *Identifier {
+	if id == "" {
+		return nil
+	}
+	scheme, value, ok := strings.Cut(id, ":")
+	if !ok {
+		return &Identifier{Value: id}
+	}
+	return &Identifier{SchemeID: strings.TrimSpace(scheme), Value: strings.TrimSpace(value)}
+}
+
+func address(addr, country string) Address {
+	parsed := bill.ParseAddress(addr)
+	a := Address{
+		CityName:   parsed.City,
+		PostalZone: parsed.Postcode,
+		Country:    Country{IdentificationCode: country},
+	}
+	if len(parsed.Lines) > 0 {
+		a.StreetName = parsed.Lines[0]
+	}
+	if len(parsed.Lines) > 1 {
+		a.AdditionalStreetName = parsed.Lines[1]
+	}
+	if len(parsed.Lines) > 2 {
+		a.AddressLine = &AddressLine{Line: strings.Join(parsed.Lines[2:], ", ")}
+	}
+	return a
+}
+
+func party(name, addr, country, vatNumber, peppolID string) Party {
+	p := Party{
+		EndpointID:  endpoint(peppolID),
+		PartyName:   &PartyName{Name: name},
+		Address:     address(addr, country),
+		LegalEntity: LegalEntity{RegistrationName: name},
+	}
+	if vatNumber != "" {
+		p.TaxScheme = &PartyTax{CompanyID: vatNumber, TaxScheme: TaxScheme{ID: "VAT"}}
+	}
+	return p
+}
+
+func taxCategory(category string, rate float64) TaxCategory {
+	c := TaxCategory{ID: category, TaxScheme: TaxScheme{ID: "VAT"}}
+	// Lines not subject to VAT carry no rate (BR-O-05)
+	if category != bill.VATNotSubject {
+		c.Percent = formatPercent(rate)
+	}
+	return c
+}
+
+// FromBill converts a bill to a Peppol BIS Billing 3.0 document: a credit
+// note when the bill cancels an invoice, with amounts written positive.
+// The result should go through Check before being sent.
+func FromBill(b bill.Bill) (*Document, error) {
+	currency, err := bill.CurrencyCode(b.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	sign := 1.0
+	if b.CreditNoteFor != "" {
+		sign = -1
+	}
+	amount := func(v float64) Amount {
+		return Amount{Currency: currency, Value: formatAmount(math.Round(sign*v*100) / 100)}
+	}
+
+	doc := &Document{
+		Xmlns:           NamespaceInvoice,
+		XmlnsCAC:        NamespaceCAC,
+		XmlnsCBC:        NamespaceCBC,
+		CustomizationID: CustomizationPeppol,
+		ProfileID:       ProfilePeppol,
+		ID:              b.Number,
+		IssueDate:       b.Date.Format(dateLayout),
+		Currency:        currency,
+		BuyerReference:  b.BuyerReference,
+		Supplier:        PartyWrapper{party(b.CompanyName, b.Address, b.Country, b.VATNumber, b.PeppolID)},
+		Customer:        PartyWrapper{party(b.ToCompanyName, b.ToAddress, b.ToCountry, b.ToVATNumber, b.ToPeppolID)},
+	}
+	doc.XMLName.Local = "Invoice"
+	doc.InvoiceTypeCode = TypeInvoice
+	if b.CreditNoteFor != "" {
+		doc.XMLName.Local = "CreditNote"
+		doc.Xmlns = NamespaceCreditNote
+		doc.InvoiceTypeCode = ""
+		doc.CreditNoteTypeCode = TypeCreditNote
+		doc.BillingReference = &BillingReference{DocumentReference{ID: b.CreditNoteFor}}
+	}
+
+	if b.BitcoinAddress != "" {
+		doc.PaymentMeans = []PaymentMeans{{
+			Code:      "ZZZ",
+			PaymentID: b.Number,
+			Account:   &FinancialAccount{ID: b.BitcoinAddress, Name: "Bitcoin"},
+		}}
+	}
+	for _, method := range b.PaymentMethods {
+		transfer, ok := method.(bill.BankTransfer)
+		if !ok {
+			continue
+		}
+		// UNTDID 4461: 58 is a SEPA credit transfer
+		account := &FinancialAccount{ID: bill.NormalizeIBAN(transfer.IBAN), Name: transfer.AccountHolder}
+		if transfer.BIC != "" {
+			account.Branch = &FinancialInstitutionBranch{ID: strings.ToUpper(transfer.BIC)}
+		}
+		doc.PaymentMeans = append(doc.PaymentMeans, PaymentMeans{Code: "58", PaymentID: b.Number, Account: account})
+	}
+	// BR-CO-25: an amount due needs a due date or payment terms. Credit
+	// notes have no DueDate element.
+	if sign*b.Total > 0 {
+		if b.DueDate.IsZero() || doc.IsCreditNote() {
+			doc.PaymentTerms = &PaymentTerms{Note: "Payable upon receipt"}
+		} else {
+			doc.DueDate = b.DueDate.Format(dateLayout)
+		}
+	}
+
+	doc.TaxTotal.TaxAmount = amount(b.TaxTotal())
+	for _, subtotal := range b.TaxBreakdown() {
+		category := taxCategory(subtotal.Category, subtotal.Rate)
+		category.ExemptionReason = subtotal.ExemptionReason
+		doc.TaxTotal.Subtotals = append(doc.TaxTotal.Subtotals, TaxSubtotal{
+			TaxableAmount: amount(subtotal.Base),
+			TaxAmount:     amount(subtotal.Amount),
+			Category:      category,
+		})
+	}
+
+	doc.MonetaryTotal = MonetaryTotal{
+		LineExtensionAmount: amount(b.NetTotal()),
+		TaxExclusiveAmount:  amount(b.NetTotal()),
+		TaxInclusiveAmount:  amount(b.Total),
+		PayableAmount:       amount(b.Total),
+	}
+
+	for i, item := range b.Items {
+		quantity := &Quantity{
+			UnitCode: item.Unit.UnitCode(),
+			Value:    strconv.FormatFloat(item.Quantity, 'f', -1, 64),
+		}
+		line := Line{
+			ID:                  strconv.Itoa(i + 1),
+			LineExtensionAmount: amount(item.Total),
+			Item: Item{
+				Name:        item.Description,
+				TaxCategory: taxCategory(b.VATCategoryFor(item.VATRate), item.VATRate),
+			},
+			Price: Price{PriceAmount: Amount{Currency: currency, Value: cii.FormatPrice(math.Abs(item.UnitPrice))}},
+		}
+		if doc.IsCreditNote() {
+			line.CreditedQuantity = quantity
+			doc.CreditNoteLines = append(doc.CreditNoteLines, line)
+		} else {
+			line.InvoicedQuantity = quantity
+			doc.InvoiceLines = append(doc.InvoiceLines, line)
+		}
+	}
+
+	return doc, nil
+}
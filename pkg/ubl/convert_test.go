@@ -0,0 +1,58 @@
+package ubl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+func testTemplate(items ...bill.TemplateItem) bill.BillTemplate {
+	return bill.BillTemplate{
+		CompanyName:    "Muster GmbH",
+		Address:        "Musterstraße 1\n10115 Berlin",
+		VATNumber:      "DE123456789",
+		Country:        "DE",
+		PeppolID:       "9930:DE123456789",
+		ToCompanyName:  "ACME BV",
+		ToAddress:      "Keizersgracht 1\n1015 CJ Amsterdam",
+		ToVATNumber:    "NL123456789B01",
+		ToCountry:      "NL",
+		ToPeppolID:     "0106:12345678",
+		BuyerReference: "PO-1",
+		Currency:       "EUR",
+		PaymentDays:    30,
+		Items:          items,
+	}
+}
+
+func TestFromBillPassesCheck(t *testing.T) {
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name  string
+		items []bill.TemplateItem
+	}{
+		// Two lines of 49.995 each, printed and exported as 50.00
+		{"rounded lines", []bill.TemplateItem{
+			{Description: "Consulting", Quantity: 1.5, UnitPrice: 33.33, VATRate: 20},
+			{Description: "Support", Quantity: 1.5, UnitPrice: 33.33, VATRate: 20},
+		}},
+		{"fractional price", []bill.TemplateItem{
+			{Description: "Licence", Quantity: 3, UnitPrice: 0.333, VATRate: 19},
+			{Description: "Hosting", Quantity: 7.25, UnitPrice: 12.345, VATRate: 7},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := bill.NewBillFromTemplate(testTemplate(tc.items...), "INV-1", date)
+			for _, note := range []bill.Bill{b, bill.NewCreditNote(b, "CN-1", date)} {
+				doc, err := FromBill(note)
+				if err != nil {
+					t.Fatalf("FromBill(%s): %v", note.Number, err)
+				}
+				for _, v := range Check(doc) {
+					t.Errorf("%s: %v", note.Number, v)
+				}
+			}
+		})
+	}
+}
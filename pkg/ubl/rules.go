@@ -0,0 +1,209 @@
+package ubl
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Violation is a failed EN 16931 or Peppol business rule.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("[%s] %s", v.Rule, v.Message)
+}
+
+var (
+	countryCode  = regexp.MustCompile(`^[A-Z]{2}$`)
+	vatPrefix    = regexp.MustCompile(`^[A-Z]{2}`)
+	endpointCode = regexp.MustCompile(`^\d{4}$`)
+)
+
+// categories lists the VAT categories of the Peppol code list (UNCL5305
+// subset).
+var categories = map[string]bool{
+	"S": true, "Z": true, "E": true, "AE": true, "K": true,
+	"G": true, "O": true, "L": true, "M": true,
+}
+
+// Check verifies the document against the most common EN 16931 (BR-xx)
+// and Peppol BIS 3.0 rules. It is not a full schematron validation but
+// catches what receiving access points reject most often.
+func Check(d *Document) []Violation {
+	var violations []Violation
+	fail := func(rule, format string, args ...interface{}) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	// amountsEqual compares amounts to the cent, the precision of the rules.
+	amountsEqual := func(a, b float64) bool {
+		return math.Abs(a-b) < 0.005
+	}
+
+	if d.CustomizationID == "" {
+		fail("BR-01", "the specification identifier (CustomizationID) is missing")
+	}
+	if d.ID == "" {
+		fail("BR-02", "the invoice number is missing")
+	}
+	if _, err := time.Parse(dateLayout, d.IssueDate); err != nil {
+		fail("BR-03", "the issue date %q is not a YYYY-MM-DD date", d.IssueDate)
+	}
+	if d.InvoiceTypeCode == "" && d.CreditNoteTypeCode == "" {
+		fail("BR-04", "the invoice type code is missing")
+	}
+	if len(d.Currency) != 3 {
+		fail("BR-05", "the currency code %q is not an ISO 4217 code", d.Currency)
+	}
+	if d.BuyerReference == "" {
+		fail("PEPPOL-EN16931-R003", "a buyer reference (e.g. the client's purchase order number) is required")
+	}
+
+	seller, buyer := d.Supplier.Party, d.Customer.Party
+	if seller.LegalEntity.RegistrationName == "" {
+		fail("BR-06", "the seller name is missing")
+	}
+	if buyer.LegalEntity.RegistrationName == "" {
+		fail("BR-07", "the buyer name is missing")
+	}
+	if !countryCode.MatchString(seller.Address.Country.IdentificationCode) {
+		fail("BR-09", "the seller country code %q is not an ISO 3166-1 alpha-2 code", seller.Address.Country.IdentificationCode)
+	}
+	if !countryCode.MatchString(buyer.Address.Country.IdentificationCode) {
+		fail("BR-11", "the buyer country code %q is not an ISO 3166-1 alpha-2 code", buyer.Address.Country.IdentificationCode)
+	}
+	if seller.EndpointID == nil || seller.EndpointID.Value == "" {
+		fail("PEPPOL-EN16931-R020", "the seller electronic address is missing (Peppol ID as scheme:identifier, e.g. 0208:0123456789)")
+	} else if !endpointCode.MatchString(seller.EndpointID.SchemeID) {
+		fail("PEPPOL-EN16931-R020", "the seller electronic address %q has no valid scheme (e.g. 0208:0123456789)", seller.EndpointID.Value)
+	}
+	if buyer.EndpointID == nil || buyer.EndpointID.Value == "" {
+		fail("PEPPOL-EN16931-R010", "the buyer electronic address is missing (client Peppol ID as scheme:identifier)")
+	} else if !endpointCode.MatchString(buyer.EndpointID.SchemeID) {
+		fail("PEPPOL-EN16931-R010", "the buyer electronic address %q has no valid scheme (e.g. 9925:BE0123456789)", buyer.EndpointID.Value)
+	}
+	for _, p := range []struct {
+		role  string
+		party Party
+	}{{"seller", seller}, {"buyer", buyer}} {
+		if p.party.TaxScheme != nil && !vatPrefix.MatchString(p.party.TaxScheme.CompanyID) {
+			fail("BR-CO-09", "the %s VAT number %q must start with its country code", p.role, p.party.TaxScheme.CompanyID)
+		}
+	}
+
+	lines := d.Lines()
+	if len(lines) == 0 {
+		fail("BR-16", "the invoice has no line")
+	}
+	lineTotal := 0.0
+	for _, line := range lines {
+		label := "line " + line.ID
+		if line.ID == "" {
+			fail("BR-21", "a line has no identifier")
+		}
+		if q := line.Quantity(); q == nil || q.Value == "" {
+			fail("BR-22", "%s has no quantity", label)
+		} else if q.UnitCode == "" {
+			fail("BR-23", "%s has no unit of measure", label)
+		}
+		if line.LineExtensionAmount.Value == "" {
+			fail("BR-24", "%s has no net amount", label)
+		}
+		if line.Item.Name == "" {
+			fail("BR-25", "%s has no item name", label)
+		}
+		if line.Price.PriceAmount.Value == "" {
+			fail("BR-26", "%s has no net price", label)
+		} else if line.Price.PriceAmount.Float() < 0 {
+			fail("BR-27", "%s has a negative price, credit the amount with a credit note instead", label)
+		}
+		if !categories[line.Item.TaxCategory.ID] {
+			fail("BR-CO-04", "%s has no valid VAT category (got %q)", label, line.Item.TaxCategory.ID)
+		}
+		if q := line.Quantity(); q != nil && line.Price.PriceAmount.Value != "" {
+			quantity, _ := strconv.ParseFloat(q.Value, 64)
+			expected := math.Round(quantity*line.Price.PriceAmount.Float()*100) / 100
+			if !amountsEqual(math.Abs(line.LineExtensionAmount.Float()), math.Abs(expected)) {
+				fail("PEPPOL-EN16931-R120", "%s net amount %s is not quantity × price (%.2f)", label, line.LineExtensionAmount.Value, expected)
+			}
+		}
+		lineTotal += line.LineExtensionAmount.Float()
+	}
+
+	totals := d.MonetaryTotal
+	if !amountsEqual(totals.LineExtensionAmount.Float(), lineTotal) {
+		fail("BR-CO-10", "the sum of line net amounts %s does not match the lines (%.2f)", totals.LineExtensionAmount.Value, lineTotal)
+	}
+	if !amountsEqual(totals.TaxExclusiveAmount.Float(), totals.LineExtensionAmount.Float()) {
+		fail("BR-CO-13", "the total without VAT %s does not match the sum of lines %s", totals.TaxExclusiveAmount.Value, totals.LineExtensionAmount.Value)
+	}
+	if !amountsEqual(totals.TaxInclusiveAmount.Float(), totals.TaxExclusiveAmount.Float()+d.TaxTotal.TaxAmount.Float()) {
+		fail("BR-CO-15", "the total with VAT %s is not the total without VAT plus VAT", totals.TaxInclusiveAmount.Value)
+	}
+	prepaid := 0.0
+	if totals.PrepaidAmount != nil {
+		prepaid = totals.PrepaidAmount.Float()
+	}
+	if !amountsEqual(totals.PayableAmount.Float(), totals.TaxInclusiveAmount.Float()-prepaid) {
+		fail("BR-CO-16", "the amount due %s is not the total with VAT minus the paid amount", totals.PayableAmount.Value)
+	}
+	if totals.PayableAmount.Float() > 0 && d.DueDate == "" && d.PaymentTerms == nil {
+		fail("BR-CO-25", "a positive amount due requires a due date or payment terms")
+	}
+
+	taxTotal := 0.0
+	for _, subtotal := range d.TaxTotal.Subtotals {
+		category := subtotal.Category
+		taxTotal += subtotal.TaxAmount.Float()
+
+		base := 0.0
+		for _, line := range lines {
+			if line.Item.TaxCategory.ID == category.ID && line.Item.TaxCategory.Percent == category.Percent {
+				base += line.LineExtensionAmount.Float()
+			}
+		}
+		if !amountsEqual(subtotal.TaxableAmount.Float(), base) {
+			fail("BR-"+category.ID+"-08", "the VAT base %s of category %s does not match its lines (%.2f)", subtotal.TaxableAmount.Value, category.ID, base)
+		}
+
+		switch category.ID {
+		case "S":
+			if seller.TaxScheme == nil {
+				fail("BR-S-02", "lines with VAT require the seller VAT number")
+			}
+			rate, _ := strconv.ParseFloat(category.Percent, 64)
+			if rate <= 0 {
+				fail("BR-S-05", "standard rated VAT needs a rate above zero")
+			}
+			expected := math.Round(subtotal.TaxableAmount.Float()*rate) / 100
+			if !amountsEqual(subtotal.TaxAmount.Float(), expected) {
+				fail("BR-S-09", "the VAT amount %s at %s%% is not base × rate (%.2f)", subtotal.TaxAmount.Value, category.Percent, expected)
+			}
+		case "AE", "K":
+			if seller.TaxScheme == nil || buyer.TaxScheme == nil {
+				fail("BR-"+category.ID+"-02", "category %s requires the VAT numbers of the seller and the buyer", category.ID)
+			}
+		case "O":
+			if seller.TaxScheme != nil || buyer.TaxScheme != nil {
+				fail("BR-O-02", "invoices not subject to VAT must not carry VAT numbers")
+			}
+		}
+		if category.ID != "S" && category.ID != "Z" && category.ID != "L" && category.ID != "M" {
+			if category.ExemptionReason == "" {
+				fail("BR-"+category.ID+"-10", "category %s requires an exemption reason", category.ID)
+			}
+			if subtotal.TaxAmount.Float() != 0 {
+				fail("BR-"+category.ID+"-09", "category %s must have no VAT amount", category.ID)
+			}
+		}
+	}
+	if !amountsEqual(d.TaxTotal.TaxAmount.Float(), taxTotal) {
+		fail("BR-CO-14", "the VAT total %s is not the sum of the VAT breakdown (%.2f)", d.TaxTotal.TaxAmount.Value, taxTotal)
+	}
+
+	return violations
+}
@@ -0,0 +1,221 @@
+// Package ubl writes bills as OASIS UBL 2.1 invoices and credit notes
+// following the Peppol BIS Billing 3.0 specification.
+//
+// Elements are declared in schema order, which the syntax requires.
+package ubl
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+const (
+	NamespaceInvoice    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	NamespaceCreditNote = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	NamespaceCAC        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	NamespaceCBC        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+
+	CustomizationPeppol = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	ProfilePeppol       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+)
+
+// Document is a UBL Invoice or, when CreditNoteTypeCode is set, a
+// CreditNote. Both share their structure but for the names of the type
+// code, the lines and the line quantity.
+type Document struct {
+	XMLName  xml.Name
+	Xmlns    string `xml:"xmlns,attr"`
+	XmlnsCAC string `xml:"xmlns:cac,attr"`
+	XmlnsCBC string `xml:"xmlns:cbc,attr"`
+
+	CustomizationID    string            `xml:"cbc:CustomizationID"`
+	ProfileID          string            `xml:"cbc:ProfileID"`
+	ID                 string            `xml:"cbc:ID"`
+	IssueDate          string            `xml:"cbc:IssueDate"`
+	DueDate            string            `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode    string            `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode string            `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Notes              []string          `xml:"cbc:Note,omitempty"`
+	Currency           string            `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference     string            `xml:"cbc:BuyerReference,omitempty"`
+	BillingReference   *BillingReference `xml:"cac:BillingReference,omitempty"`
+	Supplier           PartyWrapper      `xml:"cac:AccountingSupplierParty"`
+	Customer           PartyWrapper      `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans       []PaymentMeans    `xml:"cac:PaymentMeans,omitempty"`
+	PaymentTerms       *PaymentTerms     `xml:"cac:PaymentTerms,omitempty"`
+	TaxTotal           TaxTotal          `xml:"cac:TaxTotal"`
+	MonetaryTotal      MonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines       []Line            `xml:"cac:InvoiceLine,omitempty"`
+	CreditNoteLines    []Line            `xml:"cac:CreditNoteLine,omitempty"`
+}
+
+// IsCreditNote reports whether the document is a CreditNote.
+func (d *Document) IsCreditNote() bool {
+	return d.CreditNoteTypeCode != ""
+}
+
+// Lines returns the invoice or credit note lines.
+func (d *Document) Lines() []Line {
+	if d.IsCreditNote() {
+		return d.CreditNoteLines
+	}
+	return d.InvoiceLines
+}
+
+// Marshal serializes the document with an XML declaration.
+func (d *Document) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+type BillingReference struct {
+	InvoiceDocumentReference DocumentReference `xml:"cac:InvoiceDocumentReference"`
+}
+
+type DocumentReference struct {
+	ID        string `xml:"cbc:ID"`
+	IssueDate string `xml:"cbc:IssueDate,omitempty"`
+}
+
+type PartyWrapper struct {
+	Party Party `xml:"cac:Party"`
+}
+
+type Party struct {
+	EndpointID  *Identifier `xml:"cbc:EndpointID,omitempty"`
+	PartyName   *PartyName  `xml:"cac:PartyName,omitempty"`
+	Address     Address     `xml:"cac:PostalAddress"`
+	TaxScheme   *PartyTax   `xml:"cac:PartyTaxScheme,omitempty"`
+	LegalEntity LegalEntity `xml:"cac:PartyLegalEntity"`
+}
+
+type Identifier struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type PartyName struct {
+	Name string `xml:"cbc:Name"`
+}
+
+type Address struct {
+	StreetName           string       `xml:"cbc:StreetName,omitempty"`
+	AdditionalStreetName string       `xml:"cbc:AdditionalStreetName,omitempty"`
+	CityName             string       `xml:"cbc:CityName,omitempty"`
+	PostalZone           string       `xml:"cbc:PostalZone,omitempty"`
+	AddressLine          *AddressLine `xml:"cac:AddressLine,omitempty"`
+	Country              Country      `xml:"cac:Country"`
+}
+
+type AddressLine struct {
+	Line string `xml:"cbc:Line"`
+}
+
+type Country struct {
+	IdentificationCode string `xml:"cbc:IdentificationCode"`
+}
+
+type PartyTax struct {
+	CompanyID string    `xml:"cbc:CompanyID"`
+	TaxScheme TaxScheme `xml:"cac:TaxScheme"`
+}
+
+type TaxScheme struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type LegalEntity struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+}
+
+type PaymentMeans struct {
+	Code      string            `xml:"cbc:PaymentMeansCode"`
+	PaymentID string            `xml:"cbc:PaymentID,omitempty"`
+	Account   *FinancialAccount `xml:"cac:PayeeFinancialAccount,omitempty"`
+}
+
+type FinancialAccount struct {
+	ID     string                      `xml:"cbc:ID"`
+	Name   string                      `xml:"cbc:Name,omitempty"`
+	Branch *FinancialInstitutionBranch `xml:"cac:FinancialInstitutionBranch,omitempty"`
+}
+
+// FinancialInstitutionBranch identifies the bank of an account by its BIC.
+type FinancialInstitutionBranch struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type PaymentTerms struct {
+	Note string `xml:"cbc:Note"`
+}
+
+type Amount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// Float returns the value of the amount, 0 if it is not a number.
+func (a Amount) Float() float64 {
+	value, _ := strconv.ParseFloat(a.Value, 64)
+	return value
+}
+
+type TaxTotal struct {
+	TaxAmount Amount        `xml:"cbc:TaxAmount"`
+	Subtotals []TaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type TaxSubtotal struct {
+	TaxableAmount Amount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     Amount      `xml:"cbc:TaxAmount"`
+	Category      TaxCategory `xml:"cac:TaxCategory"`
+}
+
+type TaxCategory struct {
+	ID              string    `xml:"cbc:ID"`
+	Percent         string    `xml:"cbc:Percent,omitempty"`
+	ExemptionReason string    `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme       TaxScheme `xml:"cac:TaxScheme"`
+}
+
+type MonetaryTotal struct {
+	LineExtensionAmount Amount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  Amount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  Amount  `xml:"cbc:TaxInclusiveAmount"`
+	PrepaidAmount       *Amount `xml:"cbc:PrepaidAmount,omitempty"`
+	PayableAmount       Amount  `xml:"cbc:PayableAmount"`
+}
+
+type Line struct {
+	ID                  string    `xml:"cbc:ID"`
+	InvoicedQuantity    *Quantity `xml:"cbc:InvoicedQuantity,omitempty"`
+	CreditedQuantity    *Quantity `xml:"cbc:CreditedQuantity,omitempty"`
+	LineExtensionAmount Amount    `xml:"cbc:LineExtensionAmount"`
+	Item                Item      `xml:"cac:Item"`
+	Price               Price     `xml:"cac:Price"`
+}
+
+// Quantity returns the invoiced or credited quantity.
+func (l Line) Quantity() *Quantity {
+	if l.CreditedQuantity != nil {
+		return l.CreditedQuantity
+	}
+	return l.InvoicedQuantity
+}
+
+type Quantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type Item struct {
+	Name        string      `xml:"cbc:Name"`
+	TaxCategory TaxCategory `xml:"cac:ClassifiedTaxCategory"`
+}
+
+type Price struct {
+	PriceAmount Amount `xml:"cbc:PriceAmount"`
+}
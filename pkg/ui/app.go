@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"strconv"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -11,6 +12,7 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/email"
 )
 
 type BillApp struct {
@@ -22,24 +24,71 @@ type BillApp struct {
 	companyName    *widget.Entry
 	address        *widget.Entry
 	vatNumber      *widget.Entry
+	country        *widget.Entry
+	peppolID       *widget.Entry
 	toCompanyName  *widget.Entry
 	toAddress      *widget.Entry
 	toVatNumber    *widget.Entry
+	toCountry      *widget.Entry
+	toPeppolID     *widget.Entry
+	buyerReference *widget.Entry
 	bitcoinAddress *widget.Entry
 	currency       *widget.Entry
+	pageSize       *widget.Select
+	orientation    *widget.Select
+	vatCategory    *widget.Select
+	vatMention     *widget.Entry
+	facturX        *widget.Select
+	pdfa           *widget.Select
+	sign           *widget.Check
 
 	// Default values
 	defaultCompanyName    *widget.Entry
 	defaultAddress        *widget.Entry
 	defaultVatNumber      *widget.Entry
+	defaultCountry        *widget.Entry
+	defaultPeppolID       *widget.Entry
 	defaultBitcoinAddress *widget.Entry
 	defaultCurrency       *widget.Entry
+	defaultPrecision      *widget.Entry
+	defaultLayout         *widget.Entry
+	defaultPageSize       *widget.Select
+	defaultOrientation    *widget.Select
+
+	// Payment methods offered next to the Bitcoin address
+	defaultAccountHolder   *widget.Entry
+	defaultIBAN            *widget.Entry
+	defaultBIC             *widget.Entry
+	defaultPaymentLinkName *widget.Entry
+	defaultPaymentLinkURL  *widget.Entry
+
+	// Signing settings, the password being kept in memory only
+	signCertificate *widget.Entry
+	signKey         *widget.Entry
+	signPassword    *widget.Entry
+	signReason      *widget.Entry
+	signVisible     *widget.Check
+
+	// Email settings, the SMTP password being kept in memory only
+	smtpHost     *widget.Entry
+	smtpPort     *widget.Entry
+	smtpSecurity *widget.Select
+	smtpUsername *widget.Entry
+	smtpPassword *widget.Entry
+	emailFrom    *widget.Entry
+	emailSubject *widget.Entry
+	emailBody    *widget.Entry
+	emailAttach  *widget.Select
+
+	// Number of decimals kept on item quantities
+	quantityPrecision *int
 
 	// Items table
-	items      []bill.BillItem
-	itemList   *widget.Table
-	addButton  *widget.Button
-	totalLabel *widget.Label
+	items        []bill.BillItem
+	itemList     *widget.Table
+	addButton    *widget.Button
+	importButton *widget.Button
+	totalLabel   *widget.Label
 }
 
 func NewBillApp() *BillApp {
@@ -63,12 +112,89 @@ func NewBillApp() *BillApp {
 	ba.defaultVatNumber = widget.NewEntry()
 	ba.defaultVatNumber.SetPlaceHolder("Default VAT Number")
 
+	ba.defaultCountry = widget.NewEntry()
+	ba.defaultCountry.SetPlaceHolder("FR")
+
+	ba.defaultPeppolID = widget.NewEntry()
+	ba.defaultPeppolID.SetPlaceHolder("0009:12345678900012")
+
 	ba.defaultBitcoinAddress = widget.NewEntry()
 	ba.defaultBitcoinAddress.SetPlaceHolder("Default Bitcoin Address")
 
 	ba.defaultCurrency = widget.NewEntry()
 	ba.defaultCurrency.SetPlaceHolder("€")
 
+	ba.defaultPrecision = widget.NewEntry()
+	ba.defaultPrecision.SetPlaceHolder(strconv.Itoa(bill.DefaultQuantityPrecision))
+
+	ba.defaultLayout = widget.NewEntry()
+	ba.defaultLayout.SetPlaceHolder("Built-in layout (path to a layout.json)")
+
+	ba.defaultPageSize = widget.NewSelect(bill.PageSizes(), nil)
+	ba.defaultPageSize.SetSelectedIndex(0)
+
+	ba.defaultOrientation = widget.NewSelect(bill.Orientations(), nil)
+	ba.defaultOrientation.SetSelectedIndex(0)
+
+	ba.defaultAccountHolder = widget.NewEntry()
+	ba.defaultAccountHolder.SetPlaceHolder("Account holder of the bank account")
+
+	ba.defaultIBAN = widget.NewEntry()
+	ba.defaultIBAN.SetPlaceHolder("DE89 3704 0044 0532 0130 00")
+
+	ba.defaultBIC = widget.NewEntry()
+	ba.defaultBIC.SetPlaceHolder("COBADEFFXXX (optional)")
+
+	ba.defaultPaymentLinkName = widget.NewEntry()
+	ba.defaultPaymentLinkName.SetPlaceHolder("PayPal")
+
+	ba.defaultPaymentLinkURL = widget.NewEntry()
+	ba.defaultPaymentLinkURL.SetPlaceHolder("https://paypal.me/yourname")
+
+	ba.signCertificate = widget.NewEntry()
+	ba.signCertificate.SetPlaceHolder("certificate.p12, or a PEM certificate")
+
+	ba.signKey = widget.NewEntry()
+	ba.signKey.SetPlaceHolder("PEM private key (not needed with .p12)")
+
+	ba.signPassword = widget.NewPasswordEntry()
+	ba.signPassword.SetPlaceHolder("Asked once per session, never saved")
+
+	ba.signReason = widget.NewEntry()
+	ba.signReason.SetPlaceHolder("e.g. Invoice issued")
+
+	ba.signVisible = widget.NewCheck("Draw a signature block", nil)
+
+	ba.smtpHost = widget.NewEntry()
+	ba.smtpHost.SetPlaceHolder("smtp.example.com")
+
+	ba.smtpPort = widget.NewEntry()
+	ba.smtpPort.SetPlaceHolder("587")
+
+	var securities []string
+	for _, security := range email.Securities() {
+		securities = append(securities, string(security))
+	}
+	ba.smtpSecurity = widget.NewSelect(securities, nil)
+	ba.smtpSecurity.SetSelectedIndex(0)
+
+	ba.smtpUsername = widget.NewEntry()
+
+	ba.smtpPassword = widget.NewPasswordEntry()
+	ba.smtpPassword.SetPlaceHolder("Asked once per session, never saved")
+
+	ba.emailFrom = widget.NewEntry()
+	ba.emailFrom.SetPlaceHolder("Company <billing@example.com>")
+
+	ba.emailSubject = widget.NewEntry()
+	ba.emailSubject.SetPlaceHolder(email.DefaultSubject)
+
+	ba.emailBody = widget.NewMultiLineEntry()
+	ba.emailBody.SetPlaceHolder(email.DefaultBody)
+
+	ba.emailAttach = widget.NewSelect(attachLabels(), nil)
+	ba.emailAttach.SetSelectedIndex(0)
+
 	// Create UI
 	ba.createUI()
 
@@ -99,6 +225,12 @@ func (ba *BillApp) createUI() {
 	ba.vatNumber = widget.NewEntry()
 	ba.vatNumber.SetPlaceHolder("Your VAT Number")
 
+	ba.country = widget.NewEntry()
+	ba.country.SetPlaceHolder("Country Code (e.g. FR)")
+
+	ba.peppolID = widget.NewEntry()
+	ba.peppolID.SetPlaceHolder("Peppol ID (scheme:identifier)")
+
 	ba.toCompanyName = widget.NewEntry()
 	ba.toCompanyName.SetPlaceHolder("Client Company Name")
 
@@ -109,13 +241,42 @@ func (ba *BillApp) createUI() {
 	ba.toVatNumber = widget.NewEntry()
 	ba.toVatNumber.SetPlaceHolder("Client VAT Number")
 
+	ba.toCountry = widget.NewEntry()
+	ba.toCountry.SetPlaceHolder("Country Code (e.g. DE)")
+
+	ba.toPeppolID = widget.NewEntry()
+	ba.toPeppolID.SetPlaceHolder("Peppol ID (scheme:identifier)")
+
+	ba.buyerReference = widget.NewEntry()
+	ba.buyerReference.SetPlaceHolder("Purchase order or buyer reference")
+
 	ba.bitcoinAddress = widget.NewEntry()
 	ba.bitcoinAddress.SetPlaceHolder("Bitcoin Address")
 
+	ba.vatCategory = widget.NewSelect(vatCategoryLabels(), nil)
+	ba.vatCategory.SetSelectedIndex(0)
+
+	ba.vatMention = widget.NewEntry()
+	ba.vatMention.SetPlaceHolder("e.g. Reverse charge")
+
+	ba.facturX = widget.NewSelect(facturXLabels(), nil)
+	ba.facturX.SetSelectedIndex(0)
+
+	ba.pdfa = widget.NewSelect(pdfaLabels(), nil)
+	ba.pdfa.SetSelectedIndex(0)
+
+	ba.sign = widget.NewCheck("Sign the PDF", nil)
+
 	ba.currency = widget.NewEntry()
 	ba.currency.SetText("€")
 	ba.currency.Resize(fyne.NewSize(50, 35))
 
+	ba.pageSize = widget.NewSelect(bill.PageSizes(), nil)
+	ba.pageSize.SetSelectedIndex(0)
+
+	ba.orientation = widget.NewSelect(bill.Orientations(), nil)
+	ba.orientation.SetSelectedIndex(0)
+
 	// Create items table with direct reference to ba.items
 	ba.itemList = widget.NewTable(
 		func() (int, int) { return len(ba.items), 5 },
@@ -163,7 +324,7 @@ func (ba *BillApp) createUI() {
 			case 0:
 				label.SetText(item.Description)
 			case 1:
-				label.SetText(fmt.Sprintf("%d", item.Quantity))
+				label.SetText(bill.FormatQuantity(item.Quantity, item.Unit, ba.quantityPrecision))
 			case 2:
 				label.SetText(fmt.Sprintf("%.2f %s", item.UnitPrice, ba.currency.Text))
 			case 3:
@@ -193,8 +354,13 @@ func (ba *BillApp) createUI() {
 	ba.addButton = widget.NewButtonWithIcon("Add Item", theme.ContentAddIcon(), ba.showAddItemDialog)
 	ba.addButton.Importance = widget.HighImportance
 
+	ba.importButton = widget.NewButtonWithIcon("Import Hours", theme.FolderOpenIcon(), ba.showImportHoursDialog)
+
 	// Create header with app title and settings
-	header := createHeaderWithSettings("Bill", ba.showSettingsDialog)
+	openButton := widget.NewButtonWithIcon("Open e-invoice", theme.FolderOpenIcon(), ba.showOpenEInvoiceDialog)
+	paymentsButton := widget.NewButtonWithIcon("Payments", theme.ListIcon(), ba.showPaymentsDialog)
+	sendButton := widget.NewButtonWithIcon("Send", theme.MailSendIcon(), ba.showSendDialog)
+	header := createHeaderWithSettings("Bill", ba.showSettingsDialog, openButton, paymentsButton, sendButton)
 
 	// Create form layout with sections and improved spacing
 	invoiceDetails := widget.NewCard("", "", container.NewPadded(
@@ -211,6 +377,14 @@ func (ba *BillApp) createUI() {
 						widget.NewLabelWithStyle("Currency", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 						ba.currency,
 					),
+					container.NewVBox(
+						widget.NewLabelWithStyle("Page Size", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+						ba.pageSize,
+					),
+					container.NewVBox(
+						widget.NewLabelWithStyle("Orientation", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+						ba.orientation,
+					),
 				),
 			),
 		),
@@ -220,16 +394,26 @@ func (ba *BillApp) createUI() {
 		widget.NewFormItem("Company Name", ba.companyName),
 		widget.NewFormItem("Address", ba.address),
 		widget.NewFormItem("VAT Number", ba.vatNumber),
+		widget.NewFormItem("Country", ba.country),
+		widget.NewFormItem("Peppol ID", ba.peppolID),
 	)
 
 	clientDetails := createFormCard("Client Details",
 		widget.NewFormItem("Company Name", ba.toCompanyName),
 		widget.NewFormItem("Address", ba.toAddress),
 		widget.NewFormItem("VAT Number", ba.toVatNumber),
+		widget.NewFormItem("Country", ba.toCountry),
+		widget.NewFormItem("Peppol ID", ba.toPeppolID),
+		widget.NewFormItem("Buyer Reference", ba.buyerReference),
 	)
 
 	paymentDetails := createFormCard("Payment",
 		widget.NewFormItem("Bitcoin Address", ba.bitcoinAddress),
+		widget.NewFormItem("Lines without VAT", ba.vatCategory),
+		widget.NewFormItem("VAT Mention", ba.vatMention),
+		widget.NewFormItem("Factur-X", ba.facturX),
+		widget.NewFormItem("Archival PDF/A", ba.pdfa),
+		widget.NewFormItem("Digital Signature", ba.sign),
 	)
 
 	itemsCard := widget.NewCard("", "", container.NewVBox(
@@ -240,6 +424,7 @@ func (ba *BillApp) createUI() {
 				ba.itemList,
 				container.NewHBox(
 					ba.addButton,
+					ba.importButton,
 					layout.NewSpacer(),
 					ba.totalLabel,
 				),
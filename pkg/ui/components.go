@@ -11,10 +11,13 @@ import (
 	"github.com/louisinger/bill/pkg/bill"
 )
 
-func createHeaderWithSettings(title string, onSettings func()) *fyne.Container {
+func createHeaderWithSettings(title string, onSettings func(), buttons ...fyne.CanvasObject) *fyne.Container {
 	settingsButton := widget.NewButtonWithIcon("Settings", theme.SettingsIcon(), onSettings)
 	settingsButton.Importance = widget.WarningImportance
 
+	actions := container.NewHBox(buttons...)
+	actions.Add(settingsButton)
+
 	header := container.NewHBox(
 		container.NewHBox(
 			widget.NewLabelWithStyle(title, fyne.TextAlignLeading, fyne.TextStyle{
@@ -23,7 +26,7 @@ func createHeaderWithSettings(title string, onSettings func()) *fyne.Container {
 			}),
 		),
 		layout.NewSpacer(),
-		settingsButton,
+		actions,
 	)
 	header.Resize(fyne.NewSize(1000, 60))
 	return header
@@ -39,7 +42,7 @@ func createFormCard(title string, items ...*widget.FormItem) *widget.Card {
 	))
 }
 
-func createItemsTable(items []bill.BillItem, currency string, onDelete func(int)) *widget.Table {
+func createItemsTable(items []bill.BillItem, currency string, precision *int, onDelete func(int)) *widget.Table {
 	table := widget.NewTable(
 		func() (int, int) { return len(items), 5 },
 		func() fyne.CanvasObject {
@@ -86,7 +89,7 @@ func createItemsTable(items []bill.BillItem, currency string, onDelete func(int)
 			case 0:
 				label.SetText(item.Description)
 			case 1:
-				label.SetText(fmt.Sprintf("%d", item.Quantity))
+				label.SetText(bill.FormatQuantity(item.Quantity, item.Unit, precision))
 			case 2:
 				label.SetText(fmt.Sprintf("%.2f %s", item.UnitPrice, currency))
 			case 3:
@@ -122,3 +125,138 @@ func createFooterWithGenerateButton(onGenerate func()) *fyne.Container {
 		generateButton,
 	)
 }
+
+// vatCategories pairs the VAT categories of lines without VAT with the label
+// shown in the form.
+var vatCategories = []struct {
+	code  string
+	label string
+}{
+	{bill.VATExempt, "Exempt"},
+	{bill.VATReverseCharge, "Reverse charge"},
+	{bill.VATNotSubject, "Not subject to VAT"},
+	{bill.VATZeroRated, "Zero rated"},
+	{bill.VATIntraCommunity, "Intra-community supply"},
+	{bill.VATExportOutsideEU, "Export outside the EU"},
+}
+
+func vatCategoryLabels() []string {
+	labels := make([]string, len(vatCategories))
+	for i, category := range vatCategories {
+		labels[i] = category.label
+	}
+	return labels
+}
+
+func vatCategoryCode(label string) string {
+	for _, category := range vatCategories {
+		if category.label == label {
+			return category.code
+		}
+	}
+	return ""
+}
+
+func vatCategoryLabel(code string) string {
+	for _, category := range vatCategories {
+		if category.code == code {
+			return category.label
+		}
+	}
+	return vatCategories[0].label
+}
+
+// facturXProfiles lists the Factur-X profiles offered in the form, the
+// first one producing a plain PDF.
+var facturXProfiles = []struct {
+	profile bill.FacturXProfile
+	label   string
+}{
+	{"", "None"},
+	{bill.FacturXMinimum, "Minimum"},
+	{bill.FacturXBasic, "Basic"},
+	{bill.FacturXEN16931, "EN 16931"},
+}
+
+func facturXLabels() []string {
+	labels := make([]string, len(facturXProfiles))
+	for i, profile := range facturXProfiles {
+		labels[i] = profile.label
+	}
+	return labels
+}
+
+// pdfaLevels lists the PDF/A levels offered in the form, the first one
+// producing a plain PDF.
+var pdfaLevels = []struct {
+	conformance bill.PDFAConformance
+	label       string
+}{
+	{"", "None"},
+	{bill.PDFA1b, "PDF/A-1b"},
+	{bill.PDFA3b, "PDF/A-3b"},
+}
+
+func pdfaLabels() []string {
+	labels := make([]string, len(pdfaLevels))
+	for i, level := range pdfaLevels {
+		labels[i] = level.label
+	}
+	return labels
+}
+
+func pdfaConformance(label string) bill.PDFAConformance {
+	for _, level := range pdfaLevels {
+		if level.label == label {
+			return level.conformance
+		}
+	}
+	return ""
+}
+
+// attachFormats lists the e-invoice formats emails may carry, the first
+// one attaching the PDF alone.
+var attachFormats = []struct {
+	format string
+	label  string
+}{
+	{"", "None"},
+	{"ubl", "UBL (Peppol)"},
+	{"xrechnung", "XRechnung"},
+	{"fatturapa", "FatturaPA"},
+}
+
+func attachLabels() []string {
+	labels := make([]string, len(attachFormats))
+	for i, format := range attachFormats {
+		labels[i] = format.label
+	}
+	return labels
+}
+
+func attachFormat(label string) string {
+	for _, format := range attachFormats {
+		if format.label == label {
+			return format.format
+		}
+	}
+	return ""
+}
+
+func attachLabel(format string) string {
+	for _, f := range attachFormats {
+		if f.format == format {
+			return f.label
+		}
+	}
+	return attachFormats[0].label
+}
+
+func facturXProfile(label string) bill.FacturXProfile {
+	for _, profile := range facturXProfiles {
+		if profile.label == label {
+			return profile.profile
+		}
+	}
+	return ""
+}
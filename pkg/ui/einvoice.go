@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"io"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/einvoice"
+)
+
+// showOpenEInvoiceDialog loads a UBL or CII invoice into the form for
+// review.
+func (ba *BillApp) showOpenEInvoiceDialog() {
+	openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		b, err := einvoice.Parse(data)
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		ba.setBill(b)
+	}, ba.window)
+
+	openDialog.SetFilter(storage.NewExtensionFileFilter([]string{".xml"}))
+	openDialog.Show()
+}
+
+// setBill replaces the content of the form with the bill.
+func (ba *BillApp) setBill(b bill.Bill) {
+	ba.billNumber.SetText(b.Number)
+	ba.currency.SetText(b.Currency)
+	ba.companyName.SetText(b.CompanyName)
+	ba.address.SetText(b.Address)
+	ba.vatNumber.SetText(b.VATNumber)
+	ba.country.SetText(b.Country)
+	ba.peppolID.SetText(b.PeppolID)
+	ba.toCompanyName.SetText(b.ToCompanyName)
+	ba.toAddress.SetText(b.ToAddress)
+	ba.toVatNumber.SetText(b.ToVATNumber)
+	ba.toCountry.SetText(b.ToCountry)
+	ba.toPeppolID.SetText(b.ToPeppolID)
+	ba.buyerReference.SetText(b.BuyerReference)
+	ba.bitcoinAddress.SetText(b.BitcoinAddress)
+	ba.vatCategory.SetSelected(vatCategoryLabel(b.VATCategory))
+	ba.vatMention.SetText(b.VATExemptionReason)
+
+	ba.items = append([]bill.BillItem(nil), b.Items...)
+	ba.updateTotal()
+	ba.itemList.Refresh()
+}
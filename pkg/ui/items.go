@@ -3,10 +3,12 @@ package ui
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
 	"github.com/louisinger/bill/pkg/bill"
 )
@@ -21,11 +23,13 @@ func (ba *BillApp) deleteItem(index int) {
 }
 
 func (ba *BillApp) updateTotal() {
-	total := 0.0
-	for _, item := range ba.items {
-		total += item.Total
+	b := bill.Bill{Items: ba.items}
+	if tax := b.TaxTotal(); tax != 0 {
+		b.UpdateTotal()
+		ba.totalLabel.SetText(fmt.Sprintf("Total: %.2f %s (VAT %.2f %s)", b.Total, ba.currency.Text, tax, ba.currency.Text))
+		return
 	}
-	ba.totalLabel.SetText(fmt.Sprintf("Total: %.2f %s", total, ba.currency.Text))
+	ba.totalLabel.SetText(fmt.Sprintf("Total: %.2f %s", b.NetTotal(), ba.currency.Text))
 }
 
 func (ba *BillApp) showAddItemDialog() {
@@ -37,25 +41,47 @@ func (ba *BillApp) showAddItemDialog() {
 	quantity.SetPlaceHolder("Quantity")
 	quantity.Resize(fyne.NewSize(200, 35))
 
+	unitOptions := make([]string, 0, len(bill.Units))
+	for _, u := range bill.Units {
+		if u != bill.UnitNone {
+			unitOptions = append(unitOptions, string(u))
+		}
+	}
+	unit := widget.NewSelect(unitOptions, nil)
+	unit.PlaceHolder = "(none)"
+
 	unitPrice := widget.NewEntry()
 	unitPrice.SetPlaceHolder("Unit Price")
 	unitPrice.Resize(fyne.NewSize(200, 35))
 
+	vatRate := widget.NewEntry()
+	vatRate.SetPlaceHolder("0")
+
 	// Create a custom form with larger spacing
 	form := container.NewVBox(
 		widget.NewLabelWithStyle("Description", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 		description,
 		widget.NewSeparator(),
-		container.NewGridWithColumns(2,
+		container.NewGridWithColumns(3,
 			container.NewVBox(
 				widget.NewLabelWithStyle("Quantity", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 				quantity,
 			),
+			container.NewVBox(
+				widget.NewLabelWithStyle("Unit", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				unit,
+			),
 			container.NewVBox(
 				widget.NewLabelWithStyle("Unit Price", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 				unitPrice,
 			),
 		),
+		container.NewGridWithColumns(3,
+			container.NewVBox(
+				widget.NewLabelWithStyle("VAT %", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				vatRate,
+			),
+		),
 	)
 
 	// Create and show a custom dialog
@@ -69,23 +95,34 @@ func (ba *BillApp) showAddItemDialog() {
 			return
 		}
 
-		qty, err := strconv.Atoi(quantity.Text)
-		if err != nil || qty <= 0 {
-			dialog.ShowError(fmt.Errorf("invalid quantity (must be a positive number)"), ba.window)
+		qty, err := bill.ParseQuantity(quantity.Text, ba.quantityPrecision)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid quantity (must be a positive number, e.g. 7.5)"), ba.window)
 			return
 		}
 
-		price, err := strconv.ParseFloat(unitPrice.Text, 64)
+		price, err := strconv.ParseFloat(strings.ReplaceAll(unitPrice.Text, ",", "."), 64)
 		if err != nil || price < 0 {
 			dialog.ShowError(fmt.Errorf("invalid unit price (must be a non-negative number)"), ba.window)
 			return
 		}
 
-		total := float64(qty) * price
+		rate := 0.0
+		if vatRate.Text != "" {
+			rate, err = strconv.ParseFloat(strings.ReplaceAll(vatRate.Text, ",", "."), 64)
+			if err != nil || rate < 0 || rate >= 100 {
+				dialog.ShowError(fmt.Errorf("invalid VAT rate (must be a percentage, e.g. 20)"), ba.window)
+				return
+			}
+		}
+
+		total := bill.LineTotal(qty, price)
 		ba.items = append(ba.items, bill.BillItem{
 			Description: description.Text,
 			Quantity:    qty,
+			Unit:        bill.Unit(unit.Selected),
 			UnitPrice:   price,
+			VATRate:     rate,
 			Total:       total,
 		})
 		ba.updateTotal()
@@ -100,3 +137,79 @@ func (ba *BillApp) showAddItemDialog() {
 	customDialog.Resize(fyne.NewSize(600, 400))
 	customDialog.Show()
 }
+
+func (ba *BillApp) showImportHoursDialog() {
+	openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		entries, err := bill.ParseTimesheet(reader, reader.URI().Name())
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		if len(entries) == 0 {
+			dialog.ShowError(fmt.Errorf("no time entries found in %s", reader.URI().Name()), ba.window)
+			return
+		}
+		ba.showImportOptionsDialog(entries)
+	}, ba.window)
+
+	openDialog.SetFilter(storage.NewExtensionFileFilter([]string{".csv", ".json"}))
+	openDialog.Show()
+}
+
+func (ba *BillApp) showImportOptionsDialog(entries []bill.TimeEntry) {
+	groupBy := widget.NewRadioGroup([]string{"Project", "Day"}, nil)
+	groupBy.Horizontal = true
+	groupBy.SetSelected("Project")
+
+	rate := widget.NewEntry()
+	rate.SetPlaceHolder("Hourly Rate")
+
+	hours := 0.0
+	for _, entry := range entries {
+		hours += entry.Hours
+	}
+
+	form := container.NewVBox(
+		widget.NewLabel(fmt.Sprintf("%d time entries, %s in total",
+			len(entries), bill.FormatQuantity(hours, bill.UnitHours, ba.quantityPrecision))),
+		widget.NewSeparator(),
+		widget.NewLabelWithStyle("Group By", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		groupBy,
+		widget.NewLabelWithStyle("Hourly Rate", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		rate,
+	)
+
+	customDialog := dialog.NewCustomConfirm("Import Hours", "Import", "Cancel", form, func(confirm bool) {
+		if !confirm {
+			return
+		}
+
+		hourlyRate, err := strconv.ParseFloat(strings.ReplaceAll(rate.Text, ",", "."), 64)
+		if err != nil || hourlyRate <= 0 {
+			dialog.ShowError(fmt.Errorf("invalid hourly rate (must be a positive number)"), ba.window)
+			return
+		}
+
+		group, err := bill.ParseGroupBy(groupBy.Selected)
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+
+		ba.items = append(ba.items, bill.TimesheetItems(entries, group, hourlyRate, ba.quantityPrecision)...)
+		ba.updateTotal()
+		ba.itemList.Refresh()
+	}, ba.window)
+
+	customDialog.Resize(fyne.NewSize(400, 300))
+	customDialog.Show()
+}
@@ -0,0 +1,197 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+func (ba *BillApp) showPaymentsDialog() {
+	w := ba.app.NewWindow("Payments")
+
+	var invoice *bill.Invoice
+
+	summary := widget.NewLabel("Select an invoice")
+	payments := widget.NewList(
+		func() int {
+			if invoice == nil {
+				return 0
+			}
+			return len(invoice.Payments)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Payment")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			p := invoice.Payments[id]
+			currency := p.Currency
+			if currency == "" {
+				currency = invoice.Bill.Currency
+			}
+			text := fmt.Sprintf("%s  %.2f %s  %s", p.Date.Format("2006-01-02"), p.Amount, currency, p.Method)
+			if p.Reference != "" {
+				text += "  " + p.Reference
+			}
+			obj.(*widget.Label).SetText(text)
+		},
+	)
+
+	refresh := func() {
+		payments.Refresh()
+		if invoice == nil {
+			summary.SetText("Select an invoice")
+			return
+		}
+		balance := invoice.Balance()
+		balanceText := fmt.Sprintf("Balance due: %.2f %s", balance, invoice.Bill.Currency)
+		if balance < 0 {
+			balanceText = fmt.Sprintf("Overpaid: %.2f %s", -balance, invoice.Bill.Currency)
+		}
+		summary.SetText(fmt.Sprintf("%s - Total: %.2f %s - Paid: %.2f %s - %s",
+			invoice.Status, invoice.Bill.Total, invoice.Bill.Currency,
+			invoice.Paid(), invoice.Bill.Currency, balanceText))
+	}
+
+	invoices, err := bill.ListInvoices()
+	if err != nil {
+		dialog.ShowError(err, ba.window)
+		return
+	}
+	var numbers []string
+	for _, inv := range invoices {
+		if inv.Status != bill.StatusDraft && inv.Status != bill.StatusVoid {
+			numbers = append(numbers, inv.Bill.Number)
+		}
+	}
+
+	invoiceSelect := widget.NewSelect(numbers, func(number string) {
+		inv, err := bill.LoadInvoice(number)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		invoice = inv
+		refresh()
+	})
+	invoiceSelect.PlaceHolder = "Invoice"
+
+	date := widget.NewEntry()
+	date.SetText(time.Now().Format("2006-01-02"))
+
+	amount := widget.NewEntry()
+	amount.SetPlaceHolder("Amount")
+
+	method := widget.NewSelectEntry(bill.PaymentMethods)
+	method.SetText(bill.PaymentMethods[0])
+
+	reference := widget.NewEntry()
+	reference.SetPlaceHolder("Bank reference or transaction id")
+
+	currency := widget.NewEntry()
+	currency.SetPlaceHolder("Invoice currency")
+
+	rate := widget.NewEntry()
+	rate.SetPlaceHolder("Exchange rate")
+
+	updatePDF := widget.NewCheck("Update PDF with paid and balance due", nil)
+	updatePDF.SetChecked(true)
+
+	addButton := widget.NewButtonWithIcon("Record Payment", theme.ContentAddIcon(), func() {
+		if invoice == nil {
+			dialog.ShowError(fmt.Errorf("select an invoice first"), w)
+			return
+		}
+
+		paymentDate, err := time.ParseInLocation("2006-01-02", date.Text, time.Local)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid date (expected YYYY-MM-DD)"), w)
+			return
+		}
+		value, err := strconv.ParseFloat(strings.ReplaceAll(amount.Text, ",", "."), 64)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid amount"), w)
+			return
+		}
+		exchangeRate := 0.0
+		if rate.Text != "" {
+			exchangeRate, err = strconv.ParseFloat(strings.ReplaceAll(rate.Text, ",", "."), 64)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("invalid exchange rate"), w)
+				return
+			}
+		}
+
+		payment := bill.Payment{
+			Date:      paymentDate,
+			Amount:    value,
+			Method:    method.Text,
+			Reference: reference.Text,
+			Currency:  currency.Text,
+			Rate:      exchangeRate,
+		}
+		if err := invoice.AddPayment(payment, time.Now()); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+
+		if updatePDF.Checked && invoice.Path != "" {
+			opts, err := ba.pdfOptions(invoice)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if err := bill.GenerateDocument(invoice.Bill, invoice.Path, opts); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+		}
+		if err := bill.SaveInvoice(invoice); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+
+		amount.SetText("")
+		reference.SetText("")
+		refresh()
+		ba.app.SendNotification(fyne.NewNotification("Success", "Payment recorded"))
+	})
+	addButton.Importance = widget.HighImportance
+
+	paymentForm := createFormCard("New Payment",
+		widget.NewFormItem("Date", date),
+		widget.NewFormItem("Amount", amount),
+		widget.NewFormItem("Method", method),
+		widget.NewFormItem("Reference", reference),
+		widget.NewFormItem("Currency", currency),
+		widget.NewFormItem("Rate", rate),
+	)
+
+	content := container.NewBorder(
+		container.NewVBox(
+			invoiceSelect,
+			summary,
+			widget.NewSeparator(),
+		),
+		container.NewVBox(
+			widget.NewSeparator(),
+			paymentForm,
+			container.NewHBox(updatePDF, layout.NewSpacer(), addButton),
+		),
+		nil,
+		nil,
+		payments,
+	)
+
+	w.SetContent(container.NewPadded(content))
+	w.Resize(fyne.NewSize(700, 650))
+	w.Show()
+}
@@ -31,6 +31,81 @@ func (ba *BillApp) generatePDF() {
 		return
 	}
 
+	methods, err := ba.paymentMethods()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("payment methods: %w", err), ba.window)
+		return
+	}
+
+	// Create bill data
+	b := bill.Bill{
+		Number:         ba.billNumber.Text,
+		Date:           time.Now(),
+		CompanyName:    ba.companyName.Text,
+		Address:        ba.address.Text,
+		VATNumber:      ba.vatNumber.Text,
+		Country:        ba.country.Text,
+		ToCompanyName:  ba.toCompanyName.Text,
+		ToAddress:      ba.toAddress.Text,
+		ToVATNumber:    ba.toVatNumber.Text,
+		ToCountry:      ba.toCountry.Text,
+		BuyerReference: ba.buyerReference.Text,
+		PeppolID:       ba.peppolID.Text,
+		ToPeppolID:     ba.toPeppolID.Text,
+		Items:          ba.items,
+		Currency:       ba.currency.Text,
+		BitcoinAddress: ba.bitcoinAddress.Text,
+		PaymentMethods: methods,
+
+		QuantityPrecision:  ba.quantityPrecision,
+		PageSize:           ba.pageSize.Selected,
+		Orientation:        ba.orientation.Selected,
+		VATCategory:        vatCategoryCode(ba.vatCategory.Selected),
+		VATExemptionReason: ba.vatMention.Text,
+	}
+
+	// Calculate total
+	b.UpdateTotal()
+
+	// Check the e-invoice before asking where to save it
+	profile := facturXProfile(ba.facturX.Selected)
+	conformance := pdfaConformance(ba.pdfa.Selected)
+	if profile != "" && conformance == bill.PDFA1b {
+		dialog.ShowError(fmt.Errorf("factur-x invoices are PDF/A-3b, not PDF/A-1b"), ba.window)
+		return
+	}
+	if profile != "" {
+		if _, err := bill.FacturXML(b, profile); err != nil {
+			dialog.ShowError(fmt.Errorf("factur-x: %w", err), ba.window)
+			return
+		}
+	}
+
+	// Refuse to overwrite an invoice that was already issued
+	invoice, err := bill.NewInvoice(b, bill.StatusIssued, time.Now())
+	if err != nil {
+		dialog.ShowError(err, ba.window)
+		return
+	}
+	invoice.FacturX = profile
+	invoice.PDFA = conformance
+
+	// A broken layout is reported now rather than after picking a file
+	if _, err := bill.LoadLayout(ba.defaultLayout.Text); err != nil {
+		dialog.ShowError(err, ba.window)
+		return
+	}
+	invoice.Layout = ba.defaultLayout.Text
+
+	// The key is opened before asking where to save, a wrong password
+	// being the likeliest failure
+	invoice.Signed = ba.sign.Checked
+	opts, err := ba.pdfOptions(invoice)
+	if err != nil {
+		dialog.ShowError(err, ba.window)
+		return
+	}
+
 	// Create a sanitized filename from the invoice number
 	defaultFileName := strings.ReplaceAll(ba.billNumber.Text, "/", "-") + ".pdf"
 
@@ -44,40 +119,24 @@ func (ba *BillApp) generatePDF() {
 		}
 		defer writer.Close()
 
-		// Create bill data
-		b := bill.Bill{
-			Number:         ba.billNumber.Text,
-			Date:           time.Now(),
-			CompanyName:    ba.companyName.Text,
-			Address:        ba.address.Text,
-			VATNumber:      ba.vatNumber.Text,
-			ToCompanyName:  ba.toCompanyName.Text,
-			ToAddress:      ba.toAddress.Text,
-			ToVATNumber:    ba.toVatNumber.Text,
-			Items:          ba.items,
-			Currency:       ba.currency.Text,
-			BitcoinAddress: ba.bitcoinAddress.Text,
-		}
-
-		// Calculate total
-		total := 0.0
-		for _, item := range ba.items {
-			total += item.Total
-		}
-		b.Total = total
-
 		// Generate PDF
 		outputPath := writer.URI().Path()
 		if filepath.Ext(outputPath) != ".pdf" {
 			outputPath += ".pdf"
 		}
 
-		err = bill.GeneratePDF(b, outputPath)
+		err = bill.GeneratePDFWithOptions(b, outputPath, opts)
 		if err != nil {
 			dialog.ShowError(err, ba.window)
 			return
 		}
 
+		invoice.Path = outputPath
+		if err := bill.SaveInvoice(invoice); err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+
 		notification := fyne.NewNotification("Success", "PDF generated successfully")
 		ba.app.SendNotification(notification)
 	}, ba.window)
@@ -0,0 +1,249 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/email"
+)
+
+// emailConfig returns the stored email settings, with the client
+// addresses, updated with the values entered in the settings.
+func (ba *BillApp) emailConfig() (*email.Config, error) {
+	config, err := email.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.SMTP.Host = strings.TrimSpace(ba.smtpHost.Text)
+	config.SMTP.Port = 0
+	if ba.smtpPort.Text != "" {
+		port, err := strconv.Atoi(ba.smtpPort.Text)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid SMTP port %q", ba.smtpPort.Text)
+		}
+		config.SMTP.Port = port
+	}
+	config.SMTP.Security = email.Security(ba.smtpSecurity.Selected)
+	config.SMTP.Username = ba.smtpUsername.Text
+	config.From = ba.emailFrom.Text
+	config.Subject = ba.emailSubject.Text
+	config.Body = ba.emailBody.Text
+	config.Attach = attachFormat(ba.emailAttach.Selected)
+	return config, nil
+}
+
+// loadEmailConfig fills the email settings from the stored ones.
+func (ba *BillApp) loadEmailConfig() error {
+	config, err := email.LoadConfig()
+	if err != nil {
+		return err
+	}
+	ba.smtpHost.SetText(config.SMTP.Host)
+	if config.SMTP.Port != 0 {
+		ba.smtpPort.SetText(strconv.Itoa(config.SMTP.Port))
+	}
+	if security, err := email.ParseSecurity(string(config.SMTP.Security)); err == nil {
+		ba.smtpSecurity.SetSelected(string(security))
+	}
+	ba.smtpUsername.SetText(config.SMTP.Username)
+	ba.emailFrom.SetText(config.From)
+	ba.emailSubject.SetText(config.Subject)
+	ba.emailBody.SetText(config.Body)
+	ba.emailAttach.SetSelected(attachLabel(config.Attach))
+	return nil
+}
+
+func (ba *BillApp) showSendDialog() {
+	w := ba.app.NewWindow("Send Invoice")
+
+	var invoice *bill.Invoice
+
+	to := widget.NewEntry()
+	to.SetPlaceHolder("client@example.com, accounting@example.com")
+	cc := widget.NewEntry()
+	cc.SetPlaceHolder("Copy recipients")
+	subject := widget.NewEntry()
+	body := widget.NewMultiLineEntry()
+	body.SetMinRowsVisible(8)
+	attach := widget.NewSelect(attachLabels(), nil)
+	remember := widget.NewCheck("Remember the addresses for this client", nil)
+	remember.SetChecked(true)
+	summary := widget.NewLabel("Select an invoice")
+
+	invoices, err := bill.ListInvoices()
+	if err != nil {
+		dialog.ShowError(err, ba.window)
+		return
+	}
+	var numbers []string
+	for _, inv := range invoices {
+		if inv.Status != bill.StatusDraft && inv.Status != bill.StatusVoid && inv.Path != "" {
+			numbers = append(numbers, inv.Bill.Number)
+		}
+	}
+
+	invoiceSelect := widget.NewSelect(numbers, func(number string) {
+		inv, err := bill.LoadInvoice(number)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		config, err := ba.emailConfig()
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		invoice = inv
+		summary.SetText(fmt.Sprintf("%s - %s - Total: %.2f %s", inv.Bill.ToCompanyName, inv.Status, inv.Bill.Total, inv.Bill.Currency))
+
+		client, err := email.LookupClient(inv.Bill.ToCompanyName)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		to.SetText(strings.Join(client.Email, ", "))
+		cc.SetText(strings.Join(client.CC, ", "))
+		format := config.Attach
+		if client.Attach != "" {
+			format = client.Attach
+		}
+		attach.SetSelected(attachLabel(format))
+
+		// Preview the templates, which stay editable for this message
+		data := email.NewData(inv)
+		for _, field := range []struct {
+			entry              *widget.Entry
+			template, fallback string
+		}{
+			{subject, config.Subject, email.DefaultSubject},
+			{body, config.Body, email.DefaultBody},
+		} {
+			text, err := email.Render(field.template, field.fallback, data)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			field.entry.SetText(text)
+		}
+	})
+	invoiceSelect.PlaceHolder = "Invoice"
+
+	// compose builds the message from the dialog, the addresses and
+	// e-invoice format chosen here replacing those of the client
+	compose := func() (*email.Config, bill.Client, *email.Message, error) {
+		var client bill.Client
+		if invoice == nil {
+			return nil, client, nil, fmt.Errorf("select an invoice first")
+		}
+		config, err := ba.emailConfig()
+		if err != nil {
+			return nil, client, nil, err
+		}
+
+		if client, err = email.LookupClient(invoice.Bill.ToCompanyName); err != nil {
+			return nil, client, nil, err
+		}
+		client.Attach = attachFormat(attach.Selected)
+		if client.Email, err = email.ParseAddresses(to.Text); err != nil {
+			return nil, client, nil, err
+		}
+		if client.CC, err = email.ParseAddresses(cc.Text); err != nil {
+			return nil, client, nil, err
+		}
+		// The format chosen here applies to this message, even "None"
+		config.Attach = client.Attach
+
+		message, err := email.ComposeFor(config, invoice, client)
+		if err != nil {
+			return nil, client, nil, err
+		}
+		message.Subject = strings.Join(strings.Fields(subject.Text), " ")
+		message.Body = body.Text
+		return config, client, message, nil
+	}
+
+	rememberClient := func(client bill.Client) {
+		if !remember.Checked {
+			return
+		}
+		if err := email.SaveClient(client); err != nil {
+			dialog.ShowError(err, w)
+		}
+	}
+
+	draftButton := widget.NewButtonWithIcon("Save Draft", theme.DocumentSaveIcon(), func() {
+		_, client, message, err := compose()
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		path := email.DraftPath(invoice.Path)
+		if err := email.WriteDraft(message, path); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		rememberClient(client)
+		ba.app.SendNotification(fyne.NewNotification("Success", "Draft saved to "+path))
+		w.Close()
+	})
+
+	sendButton := widget.NewButtonWithIcon("Send", theme.MailSendIcon(), func() {
+		config, client, message, err := compose()
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		if err := config.Validate(); err != nil {
+			dialog.ShowError(fmt.Errorf("%w (see the email settings)", err), w)
+			return
+		}
+		if err := email.Send(config.SMTP, ba.smtpPassword.Text, message); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+
+		rememberClient(client)
+		if invoice.Status == bill.StatusIssued {
+			if err := invoice.Transition(bill.StatusSent, time.Now()); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if err := bill.SaveInvoice(invoice); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+		}
+		ba.app.SendNotification(fyne.NewNotification("Success", "Invoice "+invoice.Bill.Number+" sent"))
+		w.Close()
+	})
+	sendButton.Importance = widget.HighImportance
+
+	form := createFormCard("Message",
+		widget.NewFormItem("To", to),
+		widget.NewFormItem("Cc", cc),
+		widget.NewFormItem("Subject", subject),
+		widget.NewFormItem("Body", body),
+		widget.NewFormItem("E-invoice", attach),
+	)
+
+	content := container.NewBorder(
+		container.NewVBox(invoiceSelect, summary, widget.NewSeparator()),
+		container.NewHBox(remember, layout.NewSpacer(), draftButton, sendButton),
+		nil,
+		nil,
+		container.NewVScroll(form),
+	)
+
+	w.SetContent(container.NewPadded(content))
+	w.Resize(fyne.NewSize(650, 600))
+	w.Show()
+}
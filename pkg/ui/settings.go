@@ -2,8 +2,11 @@ package ui
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -11,6 +14,8 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/email"
 )
 
 type DefaultParameters struct {
@@ -18,6 +23,8 @@ type DefaultParameters struct {
 	CompanyName    string `json:"company_name"`
 	Address        string `json:"address"`
 	VATNumber      string `json:"vat_number"`
+	Country        string `json:"country,omitempty"`
+	PeppolID       string `json:"peppol_id,omitempty"`
 	BitcoinAddress string `json:"bitcoin_address"`
 	Currency       string `json:"currency"`
 
@@ -27,7 +34,49 @@ type DefaultParameters struct {
 	ToVATNumber   string `json:"to_vat_number"`
 
 	// Invoice details
-	BillNumber string `json:"bill_number"`
+	BillNumber        string `json:"bill_number"`
+	QuantityPrecision *int   `json:"quantity_precision,omitempty"`
+	Layout            string `json:"layout,omitempty"`
+	PageSize          string `json:"page_size,omitempty"`
+	Orientation       string `json:"orientation,omitempty"`
+
+	// Payment methods offered next to the Bitcoin address
+	PaymentMethods bill.PaymentMethodList `json:"payment_methods,omitempty"`
+}
+
+// paymentMethods returns the payment methods of the settings: a bank
+// transfer when an IBAN is set and a payment link when a URL is.
+func (ba *BillApp) paymentMethods() (bill.PaymentMethodList, error) {
+	var methods bill.PaymentMethodList
+	if strings.TrimSpace(ba.defaultIBAN.Text) != "" {
+		methods = append(methods, bill.BankTransfer{
+			AccountHolder: strings.TrimSpace(ba.defaultAccountHolder.Text),
+			IBAN:          bill.FormatIBAN(ba.defaultIBAN.Text),
+			BIC:           strings.ToUpper(strings.TrimSpace(ba.defaultBIC.Text)),
+		})
+	}
+	if strings.TrimSpace(ba.defaultPaymentLinkURL.Text) != "" {
+		methods = append(methods, bill.PaymentLink{
+			Name: strings.TrimSpace(ba.defaultPaymentLinkName.Text),
+			URL:  strings.TrimSpace(ba.defaultPaymentLinkURL.Text),
+		})
+	}
+	return methods, methods.Validate()
+}
+
+// setPaymentMethods fills the payment method settings.
+func (ba *BillApp) setPaymentMethods(methods bill.PaymentMethodList) {
+	for _, method := range methods {
+		switch m := method.(type) {
+		case bill.BankTransfer:
+			ba.defaultAccountHolder.SetText(m.AccountHolder)
+			ba.defaultIBAN.SetText(bill.FormatIBAN(m.IBAN))
+			ba.defaultBIC.SetText(m.BIC)
+		case bill.PaymentLink:
+			ba.defaultPaymentLinkName.SetText(m.Name)
+			ba.defaultPaymentLinkURL.SetText(m.URL)
+		}
+	}
 }
 
 func (ba *BillApp) showSettingsDialog() {
@@ -42,6 +91,8 @@ func (ba *BillApp) showSettingsDialog() {
 			widget.NewFormItem("Company Name", ba.defaultCompanyName),
 			widget.NewFormItem("Address", ba.defaultAddress),
 			widget.NewFormItem("VAT Number", ba.defaultVatNumber),
+			widget.NewFormItem("Country", ba.defaultCountry),
+			widget.NewFormItem("Peppol ID", ba.defaultPeppolID),
 		)),
 		widget.NewCard("Default Client Details", "", widget.NewForm(
 			widget.NewFormItem("Client Company Name", widget.NewEntry()),
@@ -52,6 +103,35 @@ func (ba *BillApp) showSettingsDialog() {
 			widget.NewFormItem("Bill Number", widget.NewEntry()),
 			widget.NewFormItem("Bitcoin Address", ba.defaultBitcoinAddress),
 			widget.NewFormItem("Currency", ba.defaultCurrency),
+			widget.NewFormItem("Quantity Decimals", ba.defaultPrecision),
+			widget.NewFormItem("PDF Layout", ba.defaultLayout),
+			widget.NewFormItem("Page Size", ba.defaultPageSize),
+			widget.NewFormItem("Orientation", ba.defaultOrientation),
+		)),
+		widget.NewCard("Payment Methods", "Offered on every invoice next to the Bitcoin address", widget.NewForm(
+			widget.NewFormItem("Account Holder", ba.defaultAccountHolder),
+			widget.NewFormItem("IBAN", ba.defaultIBAN),
+			widget.NewFormItem("BIC", ba.defaultBIC),
+			widget.NewFormItem("Payment Link Name", ba.defaultPaymentLinkName),
+			widget.NewFormItem("Payment Link", ba.defaultPaymentLinkURL),
+		)),
+		widget.NewCard("Digital Signature", "", widget.NewForm(
+			widget.NewFormItem("Certificate", ba.signCertificate),
+			widget.NewFormItem("Private Key", ba.signKey),
+			widget.NewFormItem("Password", ba.signPassword),
+			widget.NewFormItem("Reason", ba.signReason),
+			widget.NewFormItem("", ba.signVisible),
+		)),
+		widget.NewCard("Email", "", widget.NewForm(
+			widget.NewFormItem("SMTP Server", ba.smtpHost),
+			widget.NewFormItem("Port", ba.smtpPort),
+			widget.NewFormItem("Security", ba.smtpSecurity),
+			widget.NewFormItem("Username", ba.smtpUsername),
+			widget.NewFormItem("Password", ba.smtpPassword),
+			widget.NewFormItem("From", ba.emailFrom),
+			widget.NewFormItem("Subject", ba.emailSubject),
+			widget.NewFormItem("Body", ba.emailBody),
+			widget.NewFormItem("Attach E-invoice", ba.emailAttach),
 		)),
 	)
 
@@ -67,37 +147,100 @@ func (ba *BillApp) showSettingsDialog() {
 
 	// Create buttons
 	saveDefaultsButton := widget.NewButtonWithIcon("Save", theme.DocumentSaveIcon(), func() {
+		precision, err := parsePrecision(ba.defaultPrecision.Text)
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		if _, err := bill.LoadLayout(ba.defaultLayout.Text); err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		methods, err := ba.paymentMethods()
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+
 		params := DefaultParameters{
 			CompanyName:    ba.defaultCompanyName.Text,
 			Address:        ba.defaultAddress.Text,
 			VATNumber:      ba.defaultVatNumber.Text,
+			Country:        ba.defaultCountry.Text,
+			PeppolID:       ba.defaultPeppolID.Text,
 			BitcoinAddress: ba.defaultBitcoinAddress.Text,
 			Currency:       ba.defaultCurrency.Text,
 			ToCompanyName:  defaultToCompanyName.Text,
 			ToAddress:      defaultToAddress.Text,
 			ToVATNumber:    defaultToVatNumber.Text,
 			BillNumber:     defaultBillNumber.Text,
+
+			QuantityPrecision: precision,
+			Layout:            ba.defaultLayout.Text,
+			PageSize:          ba.defaultPageSize.Selected,
+			Orientation:       ba.defaultOrientation.Selected,
+			PaymentMethods:    methods,
+		}
+
+		signing := ba.signingConfig()
+		if signing.Certificate != "" {
+			if _, err := signing.Signature(ba.signPassword.Text); err != nil {
+				dialog.ShowError(err, ba.window)
+				return
+			}
+		}
+
+		emailConfig, err := ba.emailConfig()
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		if emailConfig.SMTP.Host != "" || emailConfig.From != "" {
+			if err := emailConfig.Validate(); err != nil {
+				dialog.ShowError(err, ba.window)
+				return
+			}
 		}
 
 		if err := ba.saveDefaultParametersWithData(params); err != nil {
 			dialog.ShowError(err, ba.window)
 			return
 		}
+		if err := bill.SaveSigningConfig(signing); err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		if err := email.SaveConfig(emailConfig); err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
 		notification := fyne.NewNotification("Success", "Default values saved")
 		ba.app.SendNotification(notification)
 	})
 	saveDefaultsButton.Importance = widget.HighImportance
 
 	applyDefaultsButton := widget.NewButtonWithIcon("Apply to Current", theme.ConfirmIcon(), func() {
+		precision, err := parsePrecision(ba.defaultPrecision.Text)
+		if err != nil {
+			dialog.ShowError(err, ba.window)
+			return
+		}
+		ba.quantityPrecision = precision
+		ba.itemList.Refresh()
+
 		ba.companyName.SetText(ba.defaultCompanyName.Text)
 		ba.address.SetText(ba.defaultAddress.Text)
 		ba.vatNumber.SetText(ba.defaultVatNumber.Text)
+		ba.country.SetText(ba.defaultCountry.Text)
+		ba.peppolID.SetText(ba.defaultPeppolID.Text)
 		ba.bitcoinAddress.SetText(ba.defaultBitcoinAddress.Text)
 		ba.currency.SetText(ba.defaultCurrency.Text)
 		ba.toCompanyName.SetText(defaultToCompanyName.Text)
 		ba.toAddress.SetText(defaultToAddress.Text)
 		ba.toVatNumber.SetText(defaultToVatNumber.Text)
 		ba.billNumber.SetText(defaultBillNumber.Text)
+		ba.pageSize.SetSelected(ba.defaultPageSize.Selected)
+		ba.orientation.SetSelected(ba.defaultOrientation.Selected)
 		notification := fyne.NewNotification("Success", "Default values applied")
 		ba.app.SendNotification(notification)
 	})
@@ -112,7 +255,7 @@ func (ba *BillApp) showSettingsDialog() {
 
 	// Create and show dialog
 	w := ba.app.NewWindow("Settings")
-	w.SetContent(container.NewPadded(form))
+	w.SetContent(container.NewVScroll(container.NewPadded(form)))
 	w.Resize(fyne.NewSize(600, 700))
 	w.Show()
 
@@ -172,19 +315,82 @@ func (ba *BillApp) loadDefaultParameters() error {
 	ba.defaultCompanyName.SetText(params.CompanyName)
 	ba.defaultAddress.SetText(params.Address)
 	ba.defaultVatNumber.SetText(params.VATNumber)
+	ba.defaultCountry.SetText(params.Country)
+	ba.defaultPeppolID.SetText(params.PeppolID)
 	ba.defaultBitcoinAddress.SetText(params.BitcoinAddress)
 	ba.defaultCurrency.SetText(params.Currency)
+	if params.QuantityPrecision != nil {
+		ba.defaultPrecision.SetText(strconv.Itoa(*params.QuantityPrecision))
+	}
+	ba.quantityPrecision = params.QuantityPrecision
+	ba.defaultLayout.SetText(params.Layout)
+	if size, err := bill.ParsePageSize(params.PageSize); err == nil {
+		ba.defaultPageSize.SetSelected(size)
+	}
+	if orientation, err := bill.ParseOrientation(params.Orientation); err == nil {
+		ba.defaultOrientation.SetSelected(orientation)
+	}
+	ba.setPaymentMethods(params.PaymentMethods)
 
 	// Always apply default values to form fields
 	ba.companyName.SetText(params.CompanyName)
 	ba.address.SetText(params.Address)
 	ba.vatNumber.SetText(params.VATNumber)
+	ba.country.SetText(params.Country)
+	ba.peppolID.SetText(params.PeppolID)
 	ba.bitcoinAddress.SetText(params.BitcoinAddress)
 	ba.currency.SetText(params.Currency)
 	ba.toCompanyName.SetText(params.ToCompanyName)
 	ba.toAddress.SetText(params.ToAddress)
 	ba.toVatNumber.SetText(params.ToVATNumber)
 	ba.billNumber.SetText(params.BillNumber)
+	ba.pageSize.SetSelected(ba.defaultPageSize.Selected)
+	ba.orientation.SetSelected(ba.defaultOrientation.Selected)
 
-	return nil
+	signing, err := bill.LoadSigningConfig()
+	if err != nil {
+		return err
+	}
+	ba.signCertificate.SetText(signing.Certificate)
+	ba.signKey.SetText(signing.Key)
+	ba.signReason.SetText(signing.Reason)
+	ba.signVisible.SetChecked(signing.Visible)
+
+	return ba.loadEmailConfig()
+}
+
+// signingConfig returns the signing settings entered in the settings.
+func (ba *BillApp) signingConfig() bill.SigningConfig {
+	return bill.SigningConfig{
+		Certificate: ba.signCertificate.Text,
+		Key:         ba.signKey.Text,
+		Reason:      ba.signReason.Text,
+		Visible:     ba.signVisible.Checked,
+	}
+}
+
+// pdfOptions returns the options a stored invoice is regenerated with,
+// signed again if it was signed.
+func (ba *BillApp) pdfOptions(invoice *bill.Invoice) (bill.PDFOptions, error) {
+	opts := invoice.PDFOptions()
+	if invoice.Signed && !bill.IsHTMLPath(invoice.Path) {
+		var err error
+		if opts.Signature, err = ba.signingConfig().Signature(ba.signPassword.Text); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// parsePrecision reads the number of quantity decimals, an empty value
+// meaning the default precision.
+func parsePrecision(text string) (*int, error) {
+	if text == "" {
+		return nil, nil
+	}
+	precision, err := strconv.Atoi(text)
+	if err != nil || precision < 0 || precision > 6 {
+		return nil, fmt.Errorf("quantity decimals must be a number between 0 and 6")
+	}
+	return &precision, nil
 }
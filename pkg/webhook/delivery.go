@@ -0,0 +1,481 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	// ID identifies the event, the same for every endpoint receiving it.
+	ID        string     `json:"id"`
+	Event     bill.Event `json:"event"`
+	CreatedAt time.Time  `json:"created_at"`
+	Invoice   Invoice    `json:"invoice"`
+}
+
+// Invoice describes the invoice of an event: its status and amounts next
+// to the bill itself.
+type Invoice struct {
+	Number   string         `json:"number"`
+	Status   bill.Status    `json:"status"`
+	Currency string         `json:"currency"`
+	Total    float64        `json:"total"`
+	Paid     float64        `json:"paid"`
+	Balance  float64        `json:"balance"`
+	Payments []bill.Payment `json:"payments,omitempty"`
+	Bill     bill.Bill      `json:"bill"`
+}
+
+func newPayload(inv *bill.Invoice, event bill.Event, now time.Time) Payload {
+	return Payload{
+		ID:        newID("evt_"),
+		Event:     event,
+		CreatedAt: now,
+		Invoice: Invoice{
+			Number:   inv.Bill.Number,
+			Status:   inv.Status,
+			Currency: inv.Bill.Currency,
+			Total:    inv.Bill.Total,
+			Paid:     inv.Paid(),
+			Balance:  inv.Balance(),
+			Payments: inv.Payments,
+			Bill:     inv.Bill,
+		},
+	}
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return prefix + hex.EncodeToString(buf)
+}
+
+// State is where a delivery stands.
+type State string
+
+const (
+	Pending   State = "pending"
+	Delivered State = "delivered"
+	Failed    State = "failed"
+)
+
+// MaxAttempts is the number of attempts before a delivery fails for good.
+const MaxAttempts = 8
+
+// RetryBase is the delay before the first retry, doubled after each
+// failed attempt: the last attempt comes about two hours after the first.
+const RetryBase = time.Minute
+
+// Backoff returns the delay after the given number of failed attempts, at
+// least one.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return RetryBase
+	}
+	return RetryBase << (attempts - 1)
+}
+
+// inFlight is how long a delivery being sent is not due for anyone else,
+// well over the timeout of its request.
+const inFlight = time.Minute
+
+// maxLog bounds the number of deliveries kept in the log.
+const maxLog = 1000
+
+// Attempt is a try to deliver an event.
+type Attempt struct {
+	At time.Time `json:"at"`
+
+	// Status is the HTTP status answered, 0 when the request failed.
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Delivery is an event sent to an endpoint, as kept in the delivery log.
+type Delivery struct {
+	ID      string          `json:"id"`
+	URL     string          `json:"url"`
+	Event   bill.Event      `json:"event"`
+	Invoice string          `json:"invoice"`
+	Payload json.RawMessage `json:"payload"`
+
+	State    State     `json:"state"`
+	Attempts []Attempt `json:"attempts"`
+
+	// NextAttempt is when a pending delivery is retried.
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+var httpClient = &http.Client{
+	Timeout: 10 * time.Second,
+	// A redirect is an answer of the endpoint, not where to send the event
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// send makes one attempt to deliver d, signed with secret.
+func send(d *Delivery, secret string, now time.Time) Attempt {
+	attempt := Attempt{At: now}
+	start := time.Now()
+	defer func() {
+		attempt.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	// The log indents the payloads, send them as first marshaled
+	var body bytes.Buffer
+	if err := json.Compact(&body, d.Payload); err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bill-webhook")
+	req.Header.Set(HeaderEvent, string(d.Event))
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body.Bytes()))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	attempt.Status = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		attempt.Error = strings.TrimSpace(fmt.Sprintf("%s %s", resp.Status, body))
+	}
+	return attempt
+}
+
+// attempt tries to deliver d now and schedules the next attempt if it
+// fails. Deliveries to endpoints removed since fail at once.
+func attempt(d *Delivery, config *Config, now time.Time) {
+	endpoint, ok := config.Endpoint(d.URL)
+	var a Attempt
+	if ok {
+		a = send(d, endpoint.Secret, now)
+	} else {
+		a = Attempt{At: now, Error: "the endpoint was removed from the settings"}
+	}
+	d.Attempts = append(d.Attempts, a)
+
+	switch {
+	case a.Error == "":
+		d.State = Delivered
+		d.NextAttempt = time.Time{}
+	case !ok || len(d.Attempts) >= MaxAttempts:
+		d.State = Failed
+		d.NextAttempt = time.Time{}
+	default:
+		d.State = Pending
+		d.NextAttempt = now.Add(Backoff(len(d.Attempts)))
+	}
+}
+
+// Notify queues the deliveries of the events of an invoice to the
+// endpoints subscribed to them. It makes no request, as invoices are saved
+// under locks: the deliveries are made by Flush, as soon as Notify queued
+// them when Run is running, or by FlushQueued.
+func Notify(inv *bill.Invoice, events []bill.Event) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var deliveries []Delivery
+	for _, event := range events {
+		var payload []byte
+		for _, endpoint := range config.Endpoints {
+			if !endpoint.Wants(event) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(newPayload(inv, event, now)); err != nil {
+					return err
+				}
+			}
+			deliveries = append(deliveries, Delivery{
+				ID:          newID("dlv_"),
+				URL:         endpoint.URL,
+				Event:       event,
+				Invoice:     inv.Bill.Number,
+				Payload:     payload,
+				State:       Pending,
+				NextAttempt: now,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	err = updateLog(func(log []Delivery) []Delivery {
+		return append(log, deliveries...)
+	})
+	if err != nil {
+		return err
+	}
+	queuedMu.Lock()
+	for _, d := range deliveries {
+		queuedIDs[d.ID] = true
+	}
+	queuedMu.Unlock()
+	select {
+	case queued <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+var (
+	// queued wakes Run when Notify queues deliveries.
+	queued = make(chan struct{}, 1)
+
+	// queuedIDs are the deliveries queued by this process not flushed
+	// yet.
+	queuedMu  sync.Mutex
+	queuedIDs = map[string]bool{}
+)
+
+// Run makes the deliveries in the background: the new ones as soon as
+// Notify queues them, the retries every interval. It never returns.
+func Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-queued:
+		case <-ticker.C:
+		}
+		if _, _, err := Flush(time.Now()); err != nil {
+			log.Printf("webhook: %v", err)
+		}
+	}
+}
+
+// Flush makes the pending deliveries due at now, returning how many were
+// delivered and how many failed for good. Each delivery is marked in
+// flight in the log before it is sent, so that processes flushing the same
+// log at once do not send it twice.
+func Flush(now time.Time) (delivered, failed int, err error) {
+	return flush(now, nil)
+}
+
+// FlushQueued makes the deliveries queued by Notify in this process, such
+// as those of a CLI command about to exit. It makes no request when none
+// were queued.
+func FlushQueued(now time.Time) (delivered, failed int, err error) {
+	queuedMu.Lock()
+	ids := queuedIDs
+	queuedIDs = map[string]bool{}
+	queuedMu.Unlock()
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+	return flush(now, ids)
+}
+
+// flush makes the deliveries due at now, only those of ids unless nil.
+func flush(now time.Time, ids map[string]bool) (delivered, failed int, err error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return 0, 0, err
+	}
+	for {
+		d, err := claim(now, ids)
+		if err != nil || d == nil {
+			return delivered, failed, err
+		}
+		// Sent by Run or retry, they need not be flushed by FlushQueued
+		queuedMu.Lock()
+		delete(queuedIDs, d.ID)
+		queuedMu.Unlock()
+
+		attempt(d, config, now)
+		switch d.State {
+		case Delivered:
+			delivered++
+		case Failed:
+			failed++
+		}
+		err = updateLog(func(log []Delivery) []Delivery {
+			for i := range log {
+				if log[i].ID == d.ID {
+					log[i] = *d
+				}
+			}
+			return log
+		})
+		if err != nil {
+			return delivered, failed, err
+		}
+	}
+}
+
+// claim marks the next delivery due at now in flight, returning nil when
+// none is due.
+func claim(now time.Time, ids map[string]bool) (*Delivery, error) {
+	var claimed *Delivery
+	err := updateLog(func(log []Delivery) []Delivery {
+		for i := range log {
+			d := &log[i]
+			if d.State != Pending || d.NextAttempt.After(now) || (ids != nil && !ids[d.ID]) {
+				continue
+			}
+			d.NextAttempt = now.Add(inFlight)
+			c := *d
+			claimed = &c
+			return log
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// Test sends a ping event to an endpoint, without logging nor retrying
+// it.
+func Test(endpoint Endpoint, now time.Time) (Attempt, error) {
+	payload, err := json.Marshal(struct {
+		ID        string     `json:"id"`
+		Event     bill.Event `json:"event"`
+		CreatedAt time.Time  `json:"created_at"`
+	}{newID("evt_"), EventPing, now})
+	if err != nil {
+		return Attempt{}, err
+	}
+	d := &Delivery{ID: newID("dlv_"), URL: endpoint.URL, Event: EventPing, Payload: payload}
+	return send(d, endpoint.Secret, now), nil
+}
+
+func logPath() (string, error) {
+	dir, err := bill.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "webhook-deliveries.json"), nil
+}
+
+// logMu serializes the updates of the delivery log within the process,
+// and its lock file those of every process.
+var logMu sync.Mutex
+
+// LoadLog reads the delivery log, oldest first.
+func LoadLog() ([]Delivery, error) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	return loadLog()
+}
+
+func loadLog() ([]Delivery, error) {
+	path, err := logPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var deliveries []Delivery
+	if err := json.Unmarshal(data, &deliveries); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return deliveries, nil
+}
+
+// Lock files older than staleLock were left by a process that died: the
+// log is only locked while it is read and written.
+const (
+	staleLock   = 30 * time.Second
+	lockTimeout = 10 * time.Second
+)
+
+// lockLog takes the lock file of the delivery log, returning the function
+// releasing it.
+func lockLog(path string) (func(), error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another process", filepath.Base(path))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// updateLog changes the delivery log, keeping the latest maxLog
+// deliveries. The log is left as is when change returns nil.
+func updateLog(change func([]Delivery) []Delivery) error {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	path, err := logPath()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockLog(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	deliveries, err := loadLog()
+	if err != nil {
+		return err
+	}
+	deliveries = change(deliveries)
+	if deliveries == nil {
+		return nil
+	}
+	if len(deliveries) > maxLog {
+		deliveries = deliveries[len(deliveries)-maxLog:]
+	}
+
+	data, err := json.MarshalIndent(deliveries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,331 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// useConfigDir keeps the settings and the delivery log of a test in a
+// directory of its own.
+func useConfigDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+}
+
+// receiver is an endpoint answering with status, recording the
+// deliveries whose signature verifies.
+type receiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	status   int
+	verified []bill.Event
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	// Retries are flushed at simulated times: the receiver's clock agrees
+	timestamp := req.Header.Get(HeaderTimestamp)
+	now := time.Now()
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		now = time.Unix(ts, 0)
+	}
+	err := Verify(r.secret, timestamp, req.Header.Get(HeaderSignature), body, now)
+	if err != nil {
+		r.t.Errorf("delivery %s: %v", req.Header.Get(HeaderDelivery), err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.verified = append(r.verified, bill.Event(req.Header.Get(HeaderEvent)))
+	}
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	r.status = status
+	r.mu.Unlock()
+}
+
+func (r *receiver) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.verified)
+}
+
+func newReceiver(t *testing.T, events ...bill.Event) (*receiver, Endpoint) {
+	t.Helper()
+	r := &receiver{t: t, secret: "whsec_test", status: http.StatusOK}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	endpoint := Endpoint{URL: server.URL, Secret: r.secret, Events: events}
+	return r, endpoint
+}
+
+func testInvoice() *bill.Invoice {
+	return &bill.Invoice{
+		Bill:   bill.Bill{Number: "INV-1", Currency: "EUR", Total: 100},
+		Status: bill.StatusIssued,
+	}
+}
+
+func loadOnly(t *testing.T) Delivery {
+	t.Helper()
+	log, err := LoadLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 {
+		t.Fatalf("the log holds %d deliveries, want 1", len(log))
+	}
+	return log[0]
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		7: 64 * time.Minute,
+		0: time.Minute,
+	} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+
+	// The last attempt comes about two hours after the first
+	var total time.Duration
+	for attempts := 1; attempts < MaxAttempts; attempts++ {
+		total += Backoff(attempts)
+	}
+	if total != 127*time.Minute {
+		t.Errorf("retries span %s, want 2h7m", total)
+	}
+}
+
+func TestNotifyQueues(t *testing.T) {
+	useConfigDir(t)
+	paid, paidEndpoint := newReceiver(t, bill.EventPaid)
+	all, allEndpoint := newReceiver(t)
+	if err := SaveConfig(&Config{Endpoints: []Endpoint{paidEndpoint, allEndpoint}}); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if err := Notify(testInvoice(), []bill.Event{bill.EventCreated}); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is sent while the invoice is being saved
+	if paid.received() != 0 || all.received() != 0 {
+		t.Fatalf("Notify sent %d and %d deliveries", paid.received(), all.received())
+	}
+	d := loadOnly(t)
+	if d.URL != allEndpoint.URL || d.State != Pending || len(d.Attempts) != 0 || d.NextAttempt.Before(before.Truncate(time.Second)) {
+		t.Errorf("queued delivery = %+v, want a pending one to %s due now", d, allEndpoint.URL)
+	}
+
+	delivered, failed, err := Flush(time.Now())
+	if err != nil || delivered != 1 || failed != 0 {
+		t.Fatalf("Flush = %d, %d, %v, want 1, 0, nil", delivered, failed, err)
+	}
+	if all.received() != 1 || paid.received() != 0 {
+		t.Errorf("received %d and %d deliveries, want 1 and 0", all.received(), paid.received())
+	}
+	if d := loadOnly(t); d.State != Delivered || len(d.Attempts) != 1 || d.Attempts[0].Status != http.StatusOK {
+		t.Errorf("delivery after Flush = %+v, want delivered in one attempt", d)
+	}
+}
+
+func TestFlushQueued(t *testing.T) {
+	useConfigDir(t)
+	r, endpoint := newReceiver(t)
+	if err := SaveConfig(&Config{Endpoints: []Endpoint{endpoint}}); err != nil {
+		t.Fatal(err)
+	}
+	queuedMu.Lock()
+	queuedIDs = map[string]bool{}
+	queuedMu.Unlock()
+
+	// Nothing was queued: a CLI command like version makes no request
+	if err := updateLog(func(log []Delivery) []Delivery {
+		return append(log, Delivery{ID: "other", URL: endpoint.URL, Event: bill.EventSent, State: Pending, NextAttempt: time.Now()})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if delivered, failed, err := FlushQueued(time.Now()); err != nil || delivered+failed != 0 || r.received() != 0 {
+		t.Fatalf("FlushQueued = %d, %d, %v with nothing queued, want no request", delivered, failed, err)
+	}
+
+	if err := Notify(testInvoice(), []bill.Event{bill.EventCreated}); err != nil {
+		t.Fatal(err)
+	}
+	if delivered, _, err := FlushQueued(time.Now()); err != nil || delivered != 1 || r.received() != 1 {
+		t.Fatalf("FlushQueued delivered %d (%v), received %d, want 1", delivered, err, r.received())
+	}
+	log, err := LoadLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log[0].ID != "other" || log[0].State != Pending {
+		t.Errorf("delivery queued elsewhere = %+v, want it left pending", log[0])
+	}
+}
+
+func TestFlushClaimed(t *testing.T) {
+	useConfigDir(t)
+	r, endpoint := newReceiver(t)
+	if err := SaveConfig(&Config{Endpoints: []Endpoint{endpoint}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Notify(testInvoice(), []bill.Event{bill.EventCreated}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process is sending the delivery
+	now := time.Now()
+	if d, err := claim(now, nil); err != nil || d == nil {
+		t.Fatalf("claim = %v, %v, want the queued delivery", d, err)
+	}
+	if delivered, failed, err := Flush(now); err != nil || delivered+failed != 0 || r.received() != 0 {
+		t.Fatalf("Flush = %d, %d, %v, want the claimed delivery left alone", delivered, failed, err)
+	}
+
+	// It is retried once the claim expired, the process having died
+	if delivered, _, err := Flush(now.Add(inFlight)); err != nil || delivered != 1 || r.received() != 1 {
+		t.Errorf("Flush after the claim delivered %d (%v), want 1", delivered, err)
+	}
+}
+
+func TestFlushRetries(t *testing.T) {
+	useConfigDir(t)
+	r, endpoint := newReceiver(t)
+	r.setStatus(http.StatusServiceUnavailable)
+	if err := SaveConfig(&Config{Endpoints: []Endpoint{endpoint}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Notify(testInvoice(), []bill.Event{bill.EventSent}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if delivered, failed, err := Flush(now); err != nil || delivered != 0 || failed != 0 {
+		t.Fatalf("Flush = %d, %d, %v, want 0, 0, nil", delivered, failed, err)
+	}
+	d := loadOnly(t)
+	if d.State != Pending || !d.NextAttempt.Equal(now.Add(Backoff(1))) {
+		t.Fatalf("after a failure: %s, next attempt %s, want pending at %s", d.State, d.NextAttempt, now.Add(Backoff(1)))
+	}
+	if d.Attempts[0].Status != http.StatusServiceUnavailable || d.Attempts[0].Error == "" {
+		t.Errorf("attempt = %+v, want the 503 recorded", d.Attempts[0])
+	}
+
+	// Deliveries that are not due yet wait
+	if delivered, failed, _ := Flush(now.Add(Backoff(1) - time.Second)); delivered+failed != 0 || r.received() != 1 {
+		t.Errorf("Flush before the retry sent the delivery again")
+	}
+
+	r.setStatus(http.StatusNoContent)
+	if delivered, _, err := Flush(d.NextAttempt); err != nil || delivered != 1 {
+		t.Fatalf("retry: %d delivered, %v", delivered, err)
+	}
+	if d := loadOnly(t); d.State != Delivered || len(d.Attempts) != 2 {
+		t.Errorf("after the retry: %s in %d attempts, want delivered in 2", d.State, len(d.Attempts))
+	}
+}
+
+func TestFlushGivesUp(t *testing.T) {
+	useConfigDir(t)
+	r, endpoint := newReceiver(t)
+	r.setStatus(http.StatusInternalServerError)
+	if err := SaveConfig(&Config{Endpoints: []Endpoint{endpoint}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Notify(testInvoice(), []bill.Event{bill.EventPaid}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		delivered, failed, err := Flush(now)
+		if err != nil || delivered != 0 {
+			t.Fatalf("attempt %d: %d delivered, %v", attempt, delivered, err)
+		}
+		if want := attempt == MaxAttempts; (failed == 1) != want {
+			t.Fatalf("attempt %d: failed = %d", attempt, failed)
+		}
+		now = loadOnly(t).NextAttempt
+	}
+	d := loadOnly(t)
+	if d.State != Failed || len(d.Attempts) != MaxAttempts || !d.NextAttempt.IsZero() {
+		t.Errorf("after %d attempts: %s in %d attempts, next %s", MaxAttempts, d.State, len(d.Attempts), d.NextAttempt)
+	}
+	if r.received() != MaxAttempts {
+		t.Errorf("the endpoint received %d deliveries, want %d", r.received(), MaxAttempts)
+	}
+}
+
+func TestFlushRemovedEndpoint(t *testing.T) {
+	useConfigDir(t)
+	r, endpoint := newReceiver(t)
+	config := &Config{Endpoints: []Endpoint{endpoint}}
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := Notify(testInvoice(), []bill.Event{bill.EventVoided}); err != nil {
+		t.Fatal(err)
+	}
+	config.RemoveEndpoint(endpoint.URL)
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, failed, err := Flush(time.Now()); err != nil || failed != 1 {
+		t.Fatalf("Flush: %d failed, %v, want 1", failed, err)
+	}
+	if r.received() != 0 {
+		t.Errorf("the removed endpoint received %d deliveries", r.received())
+	}
+	if d := loadOnly(t); d.State != Failed {
+		t.Errorf("state = %s, want %s", d.State, Failed)
+	}
+}
+
+func TestSendHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	d := &Delivery{ID: "dlv_1", URL: server.URL, Event: bill.EventPaid, Payload: []byte("{\n  \"id\": \"evt_1\"\n}")}
+	now := time.Unix(1700000000, 0)
+	if a := send(d, "whsec_test", now); a.Error != "" || a.Status != http.StatusOK {
+		t.Fatalf("send = %+v", a)
+	}
+	// The indented payload of the log is sent compacted, and signed so
+	if want := Sign("whsec_test", now.Unix(), []byte(`{"id":"evt_1"}`)); got.Get(HeaderSignature) != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, got.Get(HeaderSignature), want)
+	}
+	for header, want := range map[string]string{
+		HeaderEvent:     string(bill.EventPaid),
+		HeaderDelivery:  "dlv_1",
+		HeaderTimestamp: strconv.FormatInt(now.Unix(), 10),
+		"Content-Type":  "application/json",
+	} {
+		if got.Get(header) != want {
+			t.Errorf("%s = %q, want %q", header, got.Get(header), want)
+		}
+	}
+}
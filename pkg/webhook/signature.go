@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a delivery.
+const (
+	HeaderEvent     = "X-Bill-Event"
+	HeaderDelivery  = "X-Bill-Delivery"
+	HeaderTimestamp = "X-Bill-Timestamp"
+	HeaderSignature = "X-Bill-Signature"
+)
+
+// Tolerance is how old a delivery Verify accepts, bounding replays.
+const Tolerance = 5 * time.Minute
+
+// Sign returns the signature header of a delivery: "sha256=" and the hex
+// HMAC-SHA256, keyed by the secret, of the Unix timestamp, a dot and the
+// body. Signing the timestamp lets receivers refuse replayed deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the timestamp and signature headers of a delivery
+// received at now, as receivers should.
+func Verify(secret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header %q", HeaderTimestamp, timestamp)
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > Tolerance || age < -Tolerance {
+		return fmt.Errorf("delivery timestamp %s is outside the %s tolerance", time.Unix(ts, 0).Format(time.RFC3339), Tolerance)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		return fmt.Errorf("invalid %s header %q", HeaderSignature, signature)
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
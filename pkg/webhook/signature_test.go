@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256 of `1700000000.{"id":"evt_1"}` keyed by whsec_test
+	const want = "sha256=c89214b5b5da833daed6f0b8c5bb6bd58cea9022bd80ccc78230f3942d632925"
+	if got := Sign("whsec_test", 1700000000, []byte(`{"id":"evt_1"}`)); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1700000000, 0)
+	signed := now.Unix()
+	signature := Sign("whsec_test", signed, body)
+	timestamp := strconv.FormatInt(signed, 10)
+
+	for _, tc := range []struct {
+		name            string
+		secret, ts, sig string
+		body            []byte
+		at              time.Time
+		wantErr         string
+	}{
+		{"valid", "whsec_test", timestamp, signature, body, now, ""},
+		{"within tolerance", "whsec_test", timestamp, signature, body, now.Add(Tolerance), ""},
+		{"clock ahead", "whsec_test", timestamp, signature, body, now.Add(-Tolerance), ""},
+		{"too old", "whsec_test", timestamp, signature, body, now.Add(Tolerance + time.Second), "tolerance"},
+		{"from the future", "whsec_test", timestamp, signature, body, now.Add(-Tolerance - time.Second), "tolerance"},
+		{"wrong secret", "other", timestamp, signature, body, now, "mismatch"},
+		{"altered body", "whsec_test", timestamp, signature, []byte(`{"id":"evt_2"}`), now, "mismatch"},
+		{"replayed timestamp", "whsec_test", strconv.FormatInt(signed+1, 10), signature, body, now, "mismatch"},
+		{"invalid timestamp", "whsec_test", "yesterday", signature, body, now, HeaderTimestamp},
+		{"no scheme", "whsec_test", timestamp, strings.TrimPrefix(signature, "sha256="), body, now, HeaderSignature},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify(tc.secret, tc.ts, tc.sig, tc.body, tc.at)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("Verify: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("Verify error = %v, want one mentioning %q", err, tc.wantErr)
+			}
+		})
+	}
+}
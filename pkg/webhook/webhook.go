@@ -0,0 +1,196 @@
+// Package webhook notifies other tools of invoice events: every endpoint
+// of the settings receives a signed JSON POST describing the event and the
+// bill when an invoice is created, sent, paid or voided. Failed deliveries
+// are retried with exponential backoff, and every attempt is kept in a
+// delivery log.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/louisinger/bill/pkg/bill"
+)
+
+// EventPing is sent by Test to check an endpoint. It is not an invoice
+// event and cannot be subscribed to.
+const EventPing bill.Event = "ping"
+
+// Endpoint is a URL receiving the events.
+type Endpoint struct {
+	URL string `json:"url"`
+
+	// Secret signs the deliveries (see Sign), shared with the receiver.
+	Secret string `json:"secret"`
+
+	// Events the endpoint receives, every invoice event when empty.
+	Events []bill.Event `json:"events,omitempty"`
+}
+
+// Wants reports whether the endpoint subscribed to an event.
+func (e Endpoint) Wants(event bill.Event) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, wanted := range e.Events {
+		if wanted == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the URL and the events of the endpoint.
+func (e Endpoint) Validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return fmt.Errorf("webhook URL %q: %w", e.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL %q: expected an http or https URL", e.URL)
+	}
+	if e.Secret == "" {
+		return fmt.Errorf("webhook %s: a secret is required", e.URL)
+	}
+	for _, event := range e.Events {
+		if _, err := ParseEvent(string(event)); err != nil {
+			return fmt.Errorf("webhook %s: %w", e.URL, err)
+		}
+	}
+	return nil
+}
+
+// ParseEvent reads an invoice event, with or without the "invoice."
+// prefix.
+func ParseEvent(s string) (bill.Event, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if !strings.HasPrefix(name, "invoice.") {
+		name = "invoice." + name
+	}
+	for _, event := range bill.Events {
+		if bill.Event(name) == event {
+			return event, nil
+		}
+	}
+	var names []string
+	for _, event := range bill.Events {
+		names = append(names, string(event))
+	}
+	return "", fmt.Errorf("unknown event %q (expected %s)", s, strings.Join(names, ", "))
+}
+
+// NewSecret returns a random secret for a new endpoint.
+func NewSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Config is the webhook settings, kept in webhooks.json of the config
+// directory. The file holds the secrets and is only readable by its owner.
+type Config struct {
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// Endpoint returns the endpoint with this URL, if any.
+func (c *Config) Endpoint(rawURL string) (Endpoint, bool) {
+	for _, endpoint := range c.Endpoints {
+		if endpoint.URL == rawURL {
+			return endpoint, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// SetEndpoint adds an endpoint, or replaces the one with the same URL.
+func (c *Config) SetEndpoint(endpoint Endpoint) {
+	for i := range c.Endpoints {
+		if c.Endpoints[i].URL == endpoint.URL {
+			c.Endpoints[i] = endpoint
+			return
+		}
+	}
+	c.Endpoints = append(c.Endpoints, endpoint)
+}
+
+// RemoveEndpoint removes the endpoint with this URL, reporting whether
+// there was one.
+func (c *Config) RemoveEndpoint(rawURL string) bool {
+	for i := range c.Endpoints {
+		if c.Endpoints[i].URL == rawURL {
+			c.Endpoints = append(c.Endpoints[:i], c.Endpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func configPath() (string, error) {
+	dir, err := bill.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "webhooks.json"), nil
+}
+
+// LoadConfig reads the webhook settings, empty when none were saved.
+func LoadConfig() (*Config, error) {
+	config := &Config{}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SaveConfig writes the webhook settings to the config directory.
+func SaveConfig(config *Config) error {
+	for _, endpoint := range config.Endpoints {
+		if err := endpoint.Validate(); err != nil {
+			return err
+		}
+	}
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+var register sync.Once
+
+// Register queues the events of every invoice saved from now on, to be
+// delivered by Run or Flush. Calling it again has no effect.
+func Register() {
+	register.Do(func() {
+		bill.OnInvoiceEvents(func(inv *bill.Invoice, events []bill.Event) {
+			if err := Notify(inv, events); err != nil {
+				log.Printf("webhook: %v", err)
+			}
+		})
+	})
+}
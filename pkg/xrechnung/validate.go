@@ -0,0 +1,111 @@
+package xrechnung
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/louisinger/bill/pkg/cii"
+)
+
+// MissingField is a business term (BT) XRechnung requires but the invoice
+// lacks, with the rule asking for it when the requirement is not only the
+// cardinality of the term.
+type MissingField struct {
+	Term string
+	Name string
+	Rule string
+}
+
+func (e MissingField) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%s %s is missing", e.Term, e.Name)
+	}
+	return fmt.Sprintf("%s %s is missing [%s]", e.Term, e.Name, e.Rule)
+}
+
+// Validate reports the mandatory business terms of XRechnung 3.0 missing
+// from the invoice, and a Leitweg-ID with wrong check digits. It covers
+// the fields a bill can leave empty, not the full KoSIT rule set.
+func Validate(inv *cii.CrossIndustryInvoice) []error {
+	var errs []error
+	require := func(value, term, name, rule string) {
+		if value == "" {
+			errs = append(errs, MissingField{Term: term, Name: name, Rule: rule})
+		}
+	}
+
+	require(inv.Context.Guideline.ID, "BT-24", "Specification identifier", "BR-01")
+	require(inv.Document.ID, "BT-1", "Invoice number", "BR-02")
+	require(inv.Document.IssueDateTime.DateTimeString.Value, "BT-2", "Invoice issue date", "BR-03")
+	require(inv.Document.TypeCode, "BT-3", "Invoice type code", "BR-04")
+
+	tx := inv.Transaction
+	settlement := tx.Settlement
+	require(settlement.Currency, "BT-5", "Invoice currency code", "BR-05")
+
+	agreement := tx.Agreement
+	require(agreement.BuyerReference, "BT-10", "Buyer reference (Leitweg-ID)", "BR-DE-15")
+	if reference := agreement.BuyerReference; reference != "" && leitwegPattern.MatchString(reference) {
+		if err := CheckLeitwegID(reference); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	seller := agreement.Seller
+	require(seller.Name, "BT-27", "Seller name", "BR-06")
+	var sellerAddress cii.Address
+	if seller.Address != nil {
+		sellerAddress = *seller.Address
+	}
+	require(sellerAddress.City, "BT-37", "Seller city", "BR-DE-3")
+	require(sellerAddress.Postcode, "BT-38", "Seller post code", "BR-DE-4")
+	require(sellerAddress.CountryID, "BT-40", "Seller country code", "BR-09")
+	var contact cii.TradeContact
+	if seller.Contact != nil {
+		contact = *seller.Contact
+	}
+	require(contact.PersonName, "BT-41", "Seller contact point", "BR-DE-5")
+	if contact.Telephone == nil {
+		require("", "BT-42", "Seller contact telephone number", "BR-DE-6")
+	}
+	if contact.Email == nil {
+		require("", "BT-43", "Seller contact email address", "BR-DE-7")
+	}
+	if seller.URI == nil {
+		require("", "BT-34", "Seller electronic address", "")
+	}
+	taxTotal, _ := strconv.ParseFloat(settlement.Summation.TaxTotalAmount.Value, 64)
+	if taxTotal != 0 && len(seller.TaxRegistrations) == 0 {
+		require("", "BT-31", "Seller VAT identifier", "BR-DE-16")
+	}
+
+	buyer := agreement.Buyer
+	require(buyer.Name, "BT-44", "Buyer name", "BR-07")
+	var buyerAddress cii.Address
+	if buyer.Address != nil {
+		buyerAddress = *buyer.Address
+	}
+	require(buyerAddress.City, "BT-52", "Buyer city", "BR-DE-8")
+	require(buyerAddress.Postcode, "BT-53", "Buyer post code", "BR-DE-9")
+	require(buyerAddress.CountryID, "BT-55", "Buyer country code", "BR-11")
+	if buyer.URI == nil {
+		require("", "BT-49", "Buyer electronic address", "")
+	}
+
+	if len(settlement.PaymentMeans) == 0 {
+		require("", "BT-81", "Payment means type code", "BR-DE-1")
+	}
+
+	if len(tx.Lines) == 0 {
+		require("", "BG-25", "Invoice line", "BR-16")
+	}
+	for i, line := range tx.Lines {
+		prefix := fmt.Sprintf("line %d: ", i+1)
+		require(line.Product.Name, "BT-153", prefix+"Item name", "BR-25")
+		require(line.Delivery.BilledQuantity.Value, "BT-129", prefix+"Invoiced quantity", "BR-22")
+		require(line.Settlement.Summation.LineTotalAmount, "BT-131", prefix+"Invoice line net amount", "BR-24")
+		require(line.Agreement.NetPrice.ChargeAmount, "BT-146", prefix+"Item net price", "BR-26")
+	}
+
+	return errs
+}
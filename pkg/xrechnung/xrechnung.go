@@ -0,0 +1,109 @@
+// Package xrechnung writes bills as XRechnung 3.0 invoices in the
+// UN/CEFACT Cross-Industry-Invoice syntax, the format German public
+// administrations accept.
+package xrechnung
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/louisinger/bill/pkg/bill"
+	"github.com/louisinger/bill/pkg/cii"
+)
+
+const (
+	// Specification is the XRechnung 3.0 specification identifier (BT-24).
+	Specification = "urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0"
+
+	// BusinessProcess is the Peppol billing process (BT-23).
+	BusinessProcess = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+)
+
+// Electronic address schemes (EAS): Leitweg-IDs and email addresses.
+const (
+	SchemeLeitwegID = "0204"
+	SchemeEmail     = "EM"
+)
+
+// leitwegPattern matches a coarse address of 2 to 12 digits, an optional
+// fine address and two check digits.
+var leitwegPattern = regexp.MustCompile(`^[0-9]{2,12}(-[A-Za-z0-9]{1,30})?-[0-9]{2}$`)
+
+// CheckLeitwegID validates the format and the ISO 7064 MOD 97-10 check
+// digits of a Leitweg-ID such as "04011000-1234512345-06".
+func CheckLeitwegID(id string) error {
+	if !leitwegPattern.MatchString(id) {
+		return fmt.Errorf("Leitweg-ID %q is not coarse address, optional fine address and check digits", id)
+	}
+	var digits strings.Builder
+	for _, r := range strings.ToUpper(strings.ReplaceAll(id, "-", "")) {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	if new(big.Int).Mod(n, big.NewInt(97)).Int64() != 1 {
+		return fmt.Errorf("Leitweg-ID %q has wrong check digits", id)
+	}
+	return nil
+}
+
+// electronicAddress parses an address written as "scheme:identifier".
+func electronicAddress(id string) *cii.URI {
+	scheme, value, ok := strings.Cut(id, ":")
+	if !ok {
+		return &cii.URI{URIID: cii.SchemeID{Value: strings.TrimSpace(id)}}
+	}
+	return &cii.URI{URIID: cii.SchemeID{SchemeID: strings.TrimSpace(scheme), Value: strings.TrimSpace(value)}}
+}
+
+// FromBill converts a bill to an XRechnung invoice, or a credit note when
+// the bill cancels an invoice. The Leitweg-ID, when set, is the buyer
+// reference and the default electronic address of the client; the seller
+// is reached by email unless it has a Peppol ID. The result should go
+// through Validate before being sent.
+func FromBill(b bill.Bill) (*cii.CrossIndustryInvoice, error) {
+	inv, err := bill.CrossIndustryInvoice(b, bill.FacturXEN16931)
+	if err != nil {
+		return nil, err
+	}
+	inv.Context.BusinessProcess = &cii.ID{ID: BusinessProcess}
+	inv.Context.Guideline.ID = Specification
+
+	agreement := &inv.Transaction.Agreement
+	if b.ToLeitwegID != "" {
+		agreement.BuyerReference = b.ToLeitwegID
+	}
+
+	seller := &agreement.Seller
+	if b.ContactName != "" || b.ContactPhone != "" || b.ContactEmail != "" {
+		contact := &cii.TradeContact{PersonName: b.ContactName}
+		if b.ContactPhone != "" {
+			contact.Telephone = &cii.Communication{CompleteNumber: b.ContactPhone}
+		}
+		if b.ContactEmail != "" {
+			contact.Email = &cii.URI{URIID: cii.SchemeID{Value: b.ContactEmail}}
+		}
+		seller.Contact = contact
+	}
+	switch {
+	case b.PeppolID != "":
+		seller.URI = electronicAddress(b.PeppolID)
+	case b.ContactEmail != "":
+		seller.URI = electronicAddress(SchemeEmail + ":" + b.ContactEmail)
+	}
+
+	buyer := &agreement.Buyer
+	switch {
+	case b.ToPeppolID != "":
+		buyer.URI = electronicAddress(b.ToPeppolID)
+	case b.ToLeitwegID != "":
+		buyer.URI = electronicAddress(SchemeLeitwegID + ":" + b.ToLeitwegID)
+	}
+
+	return inv, nil
+}